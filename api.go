@@ -0,0 +1,251 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAPIPageSize = 100
+	maxAPIPageSize     = 1000
+)
+
+// APIFileInfo is the JSON description of a file returned by APIHandler.
+type APIFileInfo struct {
+	Name string `json:"name"`
+	// Path is the path of the file in the served MFS.
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// Mode is the file mode formatted as by fs.FileMode.String, e.g.
+	// "-rw-r--r--".
+	Mode    string    `json:"mode"`
+	ModTime time.Time `json:"modTime"`
+	IsDir   bool      `json:"isDir"`
+}
+
+func newAPIFileInfo(name string, i fs.FileInfo) APIFileInfo {
+	return APIFileInfo{
+		Name:    i.Name(),
+		Path:    name,
+		Size:    i.Size(),
+		Mode:    i.Mode().String(),
+		ModTime: i.ModTime(),
+		IsDir:   i.IsDir(),
+	}
+}
+
+// APIListing is a page of a directory listing returned by APIHandler.
+type APIListing struct {
+	Path    string        `json:"path"`
+	Entries []APIFileInfo `json:"entries"`
+	// Next is the token of the next page, empty after the last one.
+	Next string `json:"next,omitempty"`
+}
+
+// APIError is the JSON body of the APIHandler error responses.
+type APIError struct {
+	Error string `json:"error"`
+}
+
+// APIHandler returns a handler exposing m as a JSON API, the request URL
+// path being the path in m:
+//
+//   - GET on a directory returns an APIListing page, sorted by name. The
+//     "limit" query parameter sets the page size, 100 by default and 1000 at
+//     most, and "token" the Next token of the previous page.
+//   - GET on a regular file returns its content, supporting range requests.
+//   - GET with the "stat" query parameter returns the APIFileInfo of the file.
+//   - PUT writes the request body to the file and returns its APIFileInfo,
+//     with the 201 Created status when it did not exist. A path ending with a
+//     "/" creates the directory instead.
+//   - DELETE removes the file or the empty directory, the whole tree with
+//     the "recursive" query parameter.
+//
+// Errors are returned as APIError, the writes to mounts which do not
+// support them failing with 405 Method Not Allowed.
+func APIHandler(m MFS) http.Handler {
+	return &apiHandler{m: m}
+}
+
+type apiHandler struct {
+	m MFS
+}
+
+func (h *apiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "."
+	}
+	// the operations are canceled with the request and audited with its
+	// identity
+	m := h.m.WithContext(r.Context())
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if r.URL.Query().Has("stat") {
+			apiStat(w, m, name)
+			return
+		}
+		apiGet(w, r, m, name)
+	case http.MethodPut:
+		apiPut(w, r, m, name)
+	case http.MethodDelete:
+		apiDelete(w, r, m, name)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		apiError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+func apiStat(w http.ResponseWriter, m MFS, name string) {
+	i, err := fs.Stat(m, name)
+	if err != nil {
+		apiFSError(w, "stat", name, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newAPIFileInfo(name, i))
+}
+
+func apiGet(w http.ResponseWriter, r *http.Request, m MFS, name string) {
+	f, err := m.Open(name)
+	if err != nil {
+		apiFSError(w, "open", name, err)
+		return
+	}
+	defer f.Close()
+	i, err := f.Stat()
+	if err != nil {
+		apiFSError(w, "stat", name, err)
+		return
+	}
+	switch {
+	case i.IsDir():
+		apiList(w, r, m, name)
+	case i.Mode().IsRegular():
+		setContentType(w, m, name)
+		serveFile(w, r, f, i)
+	default:
+		apiFSError(w, "open", name, fs.ErrNotExist)
+	}
+}
+
+func apiList(w http.ResponseWriter, r *http.Request, m MFS, name string) {
+	q := r.URL.Query()
+	n := defaultAPIPageSize
+	if v := q.Get("limit"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n <= 0 {
+			apiError(w, http.StatusBadRequest, errors.New("invalid limit"))
+			return
+		}
+		n = min(n, maxAPIPageSize)
+	}
+	ds, next, err := m.ReadDirPage(name, q.Get("token"), n)
+	if err != nil {
+		apiFSError(w, "readdir", name, err)
+		return
+	}
+	res := APIListing{Path: name, Entries: make([]APIFileInfo, 0, len(ds)), Next: next}
+	for _, d := range ds {
+		p := path.Join(name, d.Name())
+		i, err := d.Info()
+		if err != nil {
+			apiFSError(w, "stat", p, err)
+			return
+		}
+		res.Entries = append(res.Entries, newAPIFileInfo(p, i))
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func apiPut(w http.ResponseWriter, r *http.Request, m MFS, name string) {
+	status := http.StatusOK
+	if _, err := fs.Stat(m, name); errors.Is(err, fs.ErrNotExist) {
+		status = http.StatusCreated
+	}
+	op, err := "write", error(nil)
+	if strings.HasSuffix(r.URL.Path, "/") {
+		op, err = "mkdir", m.MkdirAll(name, 0755)
+	} else {
+		err = writeFrom(m, name, r.Body, 0644)
+	}
+	if err != nil {
+		apiFSError(w, op, name, err)
+		return
+	}
+	i, err := fs.Stat(m, name)
+	if err != nil {
+		apiFSError(w, "stat", name, err)
+		return
+	}
+	writeJSON(w, status, newAPIFileInfo(name, i))
+}
+
+func apiDelete(w http.ResponseWriter, r *http.Request, m MFS, name string) {
+	var err error
+	if r.URL.Query().Has("recursive") {
+		err = m.RemoveAll(name)
+	} else {
+		err = m.Remove(name)
+	}
+	if err != nil {
+		apiFSError(w, "remove", name, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func apiError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, APIError{Error: err.Error()})
+}
+
+// apiStatuses maps the errors reported to the clients to their status.
+var apiStatuses = []struct {
+	err    error
+	status int
+}{
+	{fs.ErrNotExist, http.StatusNotFound},
+	{fs.ErrPermission, http.StatusForbidden},
+	{fs.ErrExist, http.StatusConflict},
+	{fs.ErrInvalid, http.StatusBadRequest},
+	{errors.ErrUnsupported, http.StatusMethodNotAllowed},
+}
+
+// apiFSError replies with the status matching the error of the operation op
+// on name, the path requested by the client. Only the kind of the error is
+// reported, its details, e.g. the paths in the mounted file systems, being
+// hidden.
+func apiFSError(w http.ResponseWriter, op, name string, err error) {
+	for _, v := range apiStatuses {
+		if errors.Is(err, v.err) {
+			apiError(w, v.status, &fs.PathError{Op: op, Path: name, Err: v.err})
+			return
+		}
+	}
+	apiError(w, http.StatusInternalServerError, errors.New(http.StatusText(http.StatusInternalServerError)))
+}
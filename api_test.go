@@ -0,0 +1,142 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIHandler(t *testing.T) {
+	m, err := Mount("mem", NewMemFS())
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("static", fstest.MapFS{"foo": {Data: []byte("foo")}}))
+	h := APIHandler(m)
+
+	do := func(method, target, body string, header ...string) *http.Response {
+		var r io.Reader
+		if body != "" {
+			r = strings.NewReader(body)
+		}
+		req := httptest.NewRequest(method, target, r)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Result()
+	}
+	decode := func(res *http.Response, v any) {
+		t.Helper()
+		assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(res.Body).Decode(v))
+	}
+
+	res := do(http.MethodPut, "/mem/dir/", "")
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	for _, v := range []string{"a", "b", "c"} {
+		res = do(http.MethodPut, "/mem/dir/"+v, "content of "+v)
+		require.Equal(t, http.StatusCreated, res.StatusCode)
+	}
+	res = do(http.MethodPut, "/mem/dir/a", "0123456789")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var info APIFileInfo
+	decode(res, &info)
+	assert.Equal(t, APIFileInfo{Name: "a", Path: "mem/dir/a", Size: 10, Mode: "-rw-r--r--", ModTime: info.ModTime}, info)
+
+	res = do(http.MethodGet, "/mem/dir/a", "", "Range", "bytes=2-4")
+	require.Equal(t, http.StatusPartialContent, res.StatusCode)
+	b, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "234", string(b))
+
+	res = do(http.MethodGet, "/mem/dir?stat", "")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	decode(res, &info)
+	assert.True(t, info.IsDir)
+	assert.Equal(t, "mem/dir", info.Path)
+
+	var names []string
+	token := ""
+	for {
+		res = do(http.MethodGet, "/mem/dir?limit=2&token="+token, "")
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		var l APIListing
+		decode(res, &l)
+		for _, v := range l.Entries {
+			names = append(names, v.Path)
+		}
+		if token = l.Next; token == "" {
+			break
+		}
+	}
+	assert.Equal(t, []string{"mem/dir/a", "mem/dir/b", "mem/dir/c"}, names)
+
+	var l APIListing
+	res = do(http.MethodGet, "/", "")
+	decode(res, &l)
+	require.Len(t, l.Entries, 2)
+	assert.Equal(t, "mem", l.Entries[0].Path)
+
+	res = do(http.MethodGet, "/mem/dir?limit=0", "")
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	var e APIError
+	res = do(http.MethodGet, "/mem/missing", "")
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	decode(res, &e)
+	assert.Equal(t, "open mem/missing: file does not exist", e.Error)
+	res = do(http.MethodPut, "/static/bar", "bar")
+	assert.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+	res = do(http.MethodPost, "/mem/dir/a", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+	assert.Equal(t, "GET, HEAD, PUT, DELETE", res.Header.Get("Allow"))
+
+	res = do(http.MethodDelete, "/mem/dir", "")
+	assert.NotEqual(t, http.StatusNoContent, res.StatusCode)
+	res = do(http.MethodDelete, "/mem/dir?recursive", "")
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	res = do(http.MethodGet, "/mem/dir?stat", "")
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	res = do(http.MethodDelete, "/mem", "")
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+}
+
+func TestAPIHandlerContext(t *testing.T) {
+	var ids []string
+	m := New(WithAudit(AuditFunc(func(r AuditRecord) {
+		ids = append(ids, r.Identity)
+	})))
+	require.NoError(t, m.Mount("mem", NewMemFS()))
+	ids = nil
+
+	req := httptest.NewRequest(http.MethodPut, "/mem/foo", strings.NewReader("bar"))
+	req = req.WithContext(ContextWithIdentity(req.Context(), "alice"))
+	w := httptest.NewRecorder()
+	APIHandler(m).ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.NotEmpty(t, ids)
+	for _, v := range ids {
+		assert.Equal(t, "alice", v)
+	}
+}
@@ -0,0 +1,458 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Format is an archive format supported by OpenArchive.
+type Format int
+
+const (
+	FormatZip Format = iota + 1
+	FormatTar
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatZip:
+		return "zip"
+	case FormatTar:
+		return "tar"
+	default:
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+}
+
+const maxSymlinks = 40
+
+// OpenArchive indexes the archive read from r and returns it as a read-only
+// file system. Parent directories missing from the archive are synthesized
+// and symbolic links are resolved inside the archive. Tar entries are read
+// directly from r, so the returned files support Seek and ReadAt.
+func OpenArchive(r io.ReaderAt, size int64, format Format) (fs.FS, error) {
+	a := &archiveFS{entries: map[string]*archiveEntry{
+		".": {name: ".", mode: fs.ModeDir | 0555},
+	}}
+	var err error
+	switch format {
+	case FormatZip:
+		err = a.indexZip(r, size)
+	case FormatTar:
+		err = a.indexTar(r, size)
+	default:
+		err = fmt.Errorf("mfs: unsupported archive format %v", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range a.entries {
+		if e.mode.IsDir() {
+			sort.Strings(e.children)
+		}
+	}
+	return a, nil
+}
+
+func MountArchive(path string, r io.ReaderAt, size int64, format Format, opts ...MountOption) (MFS, error) {
+	f, err := OpenArchive(r, size, format)
+	if err != nil {
+		return nil, err
+	}
+	return Mount(path, f, opts...)
+}
+
+type archiveEntry struct {
+	name     string
+	mode     fs.FileMode
+	size     int64
+	modTime  time.Time
+	target   string
+	children []string
+	sys      any
+	open     func() (io.Reader, error)
+}
+
+type archiveFS struct {
+	entries map[string]*archiveEntry
+	// closer is the archive file opened by the zip and tar openers
+	closer io.Closer
+}
+
+// Close closes the archive file opened by MountURL, once unmounted.
+func (a *archiveFS) Close() error {
+	if a.closer == nil {
+		return nil
+	}
+	return a.closer.Close()
+}
+
+// cleanEntryName turns an archive member name into a valid fs path, returning
+// false for names escaping the archive root.
+func cleanEntryName(name string) (string, bool) {
+	name = path.Clean(strings.TrimLeft(strings.ReplaceAll(name, "\\", "/"), "/"))
+	return name, fs.ValidPath(name)
+}
+
+func (a *archiveFS) add(e *archiveEntry) {
+	if old, ok := a.entries[e.name]; ok && old.mode.IsDir() && e.mode.IsDir() {
+		old.mode, old.modTime, old.sys = e.mode, e.modTime, e.sys
+		return
+	}
+	a.entries[e.name] = e
+	for name := e.name; name != "."; {
+		dir := path.Dir(name)
+		p, ok := a.entries[dir]
+		if !ok {
+			p = &archiveEntry{name: dir, mode: fs.ModeDir | 0555, modTime: e.modTime}
+			a.entries[dir] = p
+		}
+		base := path.Base(name)
+		if !contains(p.children, base) {
+			p.children = append(p.children, base)
+		}
+		if ok {
+			break
+		}
+		name = dir
+	}
+}
+
+func contains(s []string, v string) bool {
+	for _, x := range s {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *archiveFS) indexZip(r io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		name, ok := cleanEntryName(f.Name)
+		if !ok || name == "." {
+			continue
+		}
+		e := &archiveEntry{
+			name:    name,
+			mode:    f.Mode(),
+			size:    int64(f.UncompressedSize64),
+			modTime: f.Modified,
+			sys:     &f.FileHeader,
+		}
+		if strings.HasSuffix(f.Name, "/") {
+			e.mode |= fs.ModeDir
+		}
+		switch {
+		case e.mode.IsDir():
+		case e.mode&fs.ModeSymlink != 0:
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			b, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+			e.target = string(b)
+		default:
+			f := f
+			e.open = func() (io.Reader, error) {
+				if f.Method == zip.Store {
+					off, err := f.DataOffset()
+					if err != nil {
+						return nil, err
+					}
+					return io.NewSectionReader(r, off, int64(f.UncompressedSize64)), nil
+				}
+				return f.Open()
+			}
+		}
+		a.add(e)
+	}
+	return nil
+}
+
+func (a *archiveFS) indexTar(r io.ReaderAt, size int64) error {
+	sr := io.NewSectionReader(r, 0, size)
+	tr := tar.NewReader(sr)
+	links := make(map[string]string)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name, ok := cleanEntryName(h.Name)
+		if !ok || name == "." {
+			continue
+		}
+		e := &archiveEntry{
+			name:    name,
+			mode:    h.FileInfo().Mode(),
+			size:    h.Size,
+			modTime: h.ModTime,
+			sys:     h,
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+		case tar.TypeSymlink:
+			e.target = h.Linkname
+		case tar.TypeLink:
+			if target, ok := cleanEntryName(h.Linkname); ok {
+				links[name] = target
+			}
+			continue
+		case tar.TypeReg, tar.TypeChar, tar.TypeBlock, tar.TypeFifo, tar.TypeGNUSparse:
+			if h.Typeflag == tar.TypeGNUSparse || isPAXSparse(h) {
+				// sparse files cannot be read from their raw offset
+				b, err := io.ReadAll(tr)
+				if err != nil {
+					return err
+				}
+				e.open = func() (io.Reader, error) {
+					return bytes.NewReader(b), nil
+				}
+				break
+			}
+			off, err := sr.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return err
+			}
+			e.open = func() (io.Reader, error) {
+				return io.NewSectionReader(r, off, h.Size), nil
+			}
+		default:
+			continue
+		}
+		a.add(e)
+	}
+	for name, target := range links {
+		t, ok := a.entries[target]
+		if !ok || t.mode.IsDir() {
+			continue
+		}
+		e := *t
+		e.name = name
+		a.add(&e)
+	}
+	return nil
+}
+
+func isPAXSparse(h *tar.Header) bool {
+	for k := range h.PAXRecords {
+		if strings.HasPrefix(k, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup resolves name inside the archive, following symbolic links in every
+// path element, and the last one too when follow is true.
+func (a *archiveFS) lookup(op, name string, follow bool) (*archiveEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if e, ok := a.entries[name]; ok && (e.target == "" || !follow) {
+		return e, nil
+	}
+	cur := "."
+	rest := strings.Split(name, "/")
+	if name == "." {
+		rest = nil
+	}
+	hops := 0
+	for len(rest) > 0 {
+		elem := rest[0]
+		rest = rest[1:]
+		next := path.Join(cur, elem)
+		e, ok := a.entries[next]
+		if !ok {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		if e.target == "" || (len(rest) == 0 && !follow) {
+			cur = next
+			continue
+		}
+		if hops++; hops > maxSymlinks {
+			return nil, &fs.PathError{Op: op, Path: name, Err: errors.New("too many links")}
+		}
+		target := e.target
+		if !path.IsAbs(target) {
+			target = path.Join(cur, target)
+		}
+		target, ok = cleanEntryName(target)
+		if !ok {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		cur = "."
+		if target != "." {
+			rest = append(strings.Split(target, "/"), rest...)
+		}
+	}
+	return a.entries[cur], nil
+}
+
+func (a *archiveFS) Open(name string) (fs.File, error) {
+	e, err := a.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	info := &archiveInfo{e: e, name: path.Base(name)}
+	if e.mode.IsDir() {
+		return &archiveDir{info: info, dirReader: dirReader{list: func() ([]fs.DirEntry, error) {
+			return a.dirEntries(e), nil
+		}}}, nil
+	}
+	if e.open == nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	r, err := e.open()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if sr, ok := r.(*io.SectionReader); ok {
+		return &archiveSeekFile{SectionReader: sr, info: info}, nil
+	}
+	return &archiveFile{r: r, info: info}, nil
+}
+
+func (a *archiveFS) Stat(name string) (fs.FileInfo, error) {
+	e, err := a.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return &archiveInfo{e: e, name: path.Base(name)}, nil
+}
+
+func (a *archiveFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := a.lookup("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !e.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return a.dirEntries(e), nil
+}
+
+func (a *archiveFS) dirEntries(e *archiveEntry) []fs.DirEntry {
+	res := make([]fs.DirEntry, 0, len(e.children))
+	for _, c := range e.children {
+		res = append(res, fs.FileInfoToDirEntry(&archiveInfo{e: a.entries[path.Join(e.name, c)], name: c}))
+	}
+	return res
+}
+
+type archiveInfo struct {
+	e    *archiveEntry
+	name string
+}
+
+func (i *archiveInfo) Name() string {
+	return i.name
+}
+
+func (i *archiveInfo) Size() int64 {
+	if i.e.mode.IsDir() {
+		return 0
+	}
+	return i.e.size
+}
+
+func (i *archiveInfo) Mode() fs.FileMode {
+	return i.e.mode
+}
+
+func (i *archiveInfo) ModTime() time.Time {
+	return i.e.modTime
+}
+
+func (i *archiveInfo) IsDir() bool {
+	return i.e.mode.IsDir()
+}
+
+func (i *archiveInfo) Sys() any {
+	return i.e.sys
+}
+
+type archiveFile struct {
+	r    io.Reader
+	info *archiveInfo
+}
+
+func (f *archiveFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *archiveFile) Read(b []byte) (int, error) {
+	return f.r.Read(b)
+}
+
+func (f *archiveFile) Close() error {
+	if c, ok := f.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+type archiveSeekFile struct {
+	*io.SectionReader
+	info *archiveInfo
+}
+
+func (f *archiveSeekFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *archiveSeekFile) Close() error {
+	return nil
+}
+
+type archiveDir struct {
+	dirReader
+	info *archiveInfo
+}
+
+func (d *archiveDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *archiveDir) Read(_ []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.e.name, Err: errors.New("is a directory")}
+}
+
+func (d *archiveDir) Close() error {
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeTar(t *testing.T) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range []string{"a/b/foo", "a/baz", "quux"} {
+		v := data["foo"]
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(v)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write(v)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "link", Linkname: "a/b", Typeflag: tar.TypeSymlink}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "../escape", Mode: 0644, Typeflag: tar.TypeReg}))
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func makeZip(t *testing.T) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"a/b/foo", "a/baz", "quux"} {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write(data["foo"])
+		require.NoError(t, err)
+	}
+	h := &zip.FileHeader{Name: "link"}
+	h.SetMode(fs.ModeSymlink | 0777)
+	w, err := zw.CreateHeader(h)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("a/b"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestArchive(t *testing.T) {
+	for _, tt := range []struct {
+		format Format
+		data   []byte
+	}{
+		{FormatTar, makeTar(t)},
+		{FormatZip, makeZip(t)},
+	} {
+		t.Run(tt.format.String(), func(t *testing.T) {
+			r := bytes.NewReader(tt.data)
+			a, err := OpenArchive(r, int64(len(tt.data)), tt.format)
+			require.NoError(t, err)
+			require.NoError(t, fstest.TestFS(a, "a/b/foo", "a/baz", "quux"))
+
+			_, err = a.Open("escape")
+			assert.ErrorIs(t, err, fs.ErrNotExist)
+
+			d, err := fs.ReadDir(a, "a")
+			require.NoError(t, err)
+			require.Len(t, d, 2)
+			assert.True(t, d[0].IsDir())
+			assert.Equal(t, "b", d[0].Name())
+
+			m, err := MountArchive("archive", r, int64(len(tt.data)), tt.format)
+			require.NoError(t, err)
+			f, err := m.Open("archive/link/foo")
+			require.NoError(t, err)
+			defer f.Close()
+			b, err := io.ReadAll(f)
+			require.NoError(t, err)
+			assert.NotEmpty(t, b)
+		})
+	}
+}
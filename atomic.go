@@ -0,0 +1,51 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io/fs"
+	"math/rand/v2"
+	"path"
+	"strconv"
+)
+
+// WriteFileAtomic writes data to name so that readers observe either the
+// previous content or the new one, never a partial write. The data is
+// written to a temporary file of the same directory, renamed over name.
+// When the mounted file system cannot rename, name is written directly
+// while holding its exclusive lock, see Lock: the backends without rename,
+// e.g. object stores, replace the whole files at once.
+func WriteFileAtomic(m MFS, name string, data []byte, perm fs.FileMode) error {
+	name = cleanPath(name)
+	tmp := path.Join(path.Dir(name), "."+path.Base(name)+".tmp-"+strconv.FormatUint(rand.Uint64(), 36))
+	if err := m.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	err := m.Rename(tmp, name)
+	if err == nil {
+		return nil
+	}
+	_ = m.Remove(tmp)
+	if !errors.Is(err, errors.ErrUnsupported) {
+		return err
+	}
+	u, err := m.Lock(name, false)
+	if err != nil {
+		return err
+	}
+	defer u.Unlock()
+	return m.WriteFile(name, data, perm)
+}
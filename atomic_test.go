@@ -0,0 +1,66 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// noRenameFS is a writable file system without rename, as object stores.
+type noRenameFS struct {
+	mem *MemFS
+}
+
+func (n noRenameFS) Open(name string) (fs.File, error) {
+	return n.mem.Open(name)
+}
+
+func (n noRenameFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return n.mem.WriteFile(name, data, perm)
+}
+
+func (n noRenameFS) Remove(name string) error {
+	return n.mem.Remove(name)
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	mem := NewMemFS()
+	m, err := Mount("mem", mem)
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("objects", noRenameFS{mem: NewMemFS()}))
+	require.NoError(t, m.Mount("static", fstest.MapFS{}))
+	require.NoError(t, m.MkdirAll("mem/etc", 0755))
+
+	for _, v := range []string{"mem/etc/config", "objects/config"} {
+		require.NoError(t, WriteFileAtomic(m, v, []byte("v1"), 0644))
+		require.NoError(t, WriteFileAtomic(m, v, []byte("v2"), 0644))
+		b, err := fs.ReadFile(m, v)
+		require.NoError(t, err)
+		assert.Equal(t, "v2", string(b))
+	}
+	// no temporary file is left
+	entries, err := fs.ReadDir(mem, "etc")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "config", entries[0].Name())
+
+	assert.ErrorIs(t, WriteFileAtomic(m, "static/config", nil, 0644), errors.ErrUnsupported)
+}
@@ -0,0 +1,169 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+type identityKey struct{}
+
+// ContextWithIdentity returns a copy of ctx carrying the identity of the
+// caller, recorded by the audit log of the operations run with the MFS
+// returned by WithContext.
+func ContextWithIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the identity set with ContextWithIdentity.
+func IdentityFromContext(ctx context.Context) string {
+	v, _ := ctx.Value(identityKey{}).(string)
+	return v
+}
+
+// AuditRecord describes an operation run on an MFS.
+type AuditRecord struct {
+	Time     time.Time
+	Identity string
+	Op       string
+	Path     string
+	// Err is the error returned by the operation, nil on success.
+	Err error
+}
+
+// AuditSink receives the audit records. It is called synchronously by the
+// audited operations.
+type AuditSink interface {
+	Audit(r AuditRecord)
+}
+
+// AuditFunc adapts a function to an AuditSink.
+type AuditFunc func(r AuditRecord)
+
+func (f AuditFunc) Audit(r AuditRecord) {
+	f(r)
+}
+
+// AuditWriter returns a sink writing the records to w as JSON lines.
+func AuditWriter(w io.Writer) AuditSink {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	return AuditFunc(func(r AuditRecord) {
+		v := struct {
+			Time     time.Time `json:"time"`
+			Identity string    `json:"identity,omitempty"`
+			Op       string    `json:"op"`
+			Path     string    `json:"path"`
+			Error    string    `json:"error,omitempty"`
+		}{Time: r.Time, Identity: r.Identity, Op: r.Op, Path: r.Path}
+		if r.Err != nil {
+			v.Error = r.Err.Error()
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		_ = enc.Encode(v)
+	})
+}
+
+// AuditLogger returns a sink logging the records to l, the failed
+// operations at the warning level.
+func AuditLogger(l *slog.Logger) AuditSink {
+	return AuditFunc(func(r AuditRecord) {
+		attrs := []slog.Attr{slog.String("op", r.Op), slog.String("path", r.Path)}
+		if r.Identity != "" {
+			attrs = append(attrs, slog.String("identity", r.Identity))
+		}
+		level := slog.LevelInfo
+		if r.Err != nil {
+			level = slog.LevelWarn
+			attrs = append(attrs, slog.String("error", r.Err.Error()))
+		}
+		l.LogAttrs(context.Background(), level, "mfs audit", attrs...)
+	})
+}
+
+// AuditChannel returns a sink sending the records to ch. The audited
+// operations block until the record is received.
+func AuditChannel(ch chan<- AuditRecord) AuditSink {
+	return AuditFunc(func(r AuditRecord) {
+		ch <- r
+	})
+}
+
+// AuditOption configures WithAudit.
+type AuditOption func(a *auditor)
+
+// WithAuditSampling only records the given fraction of the successful
+// operations. The failed ones are always recorded.
+func WithAuditSampling(rate float64) AuditOption {
+	return func(a *auditor) {
+		a.rate = rate
+	}
+}
+
+// WithAudit records the operations run on the MFS to sink: opening, listing,
+// writing and removing files as well as changing the mount table.
+func WithAudit(sink AuditSink, opts ...AuditOption) Option {
+	return func(m *mfs) {
+		a := &auditor{sink: sink, rate: 1}
+		for _, v := range opts {
+			v(a)
+		}
+		m.audit = a
+	}
+}
+
+type auditor struct {
+	sink AuditSink
+	rate float64
+}
+
+// context returns the context of the operations of m.
+func (m *mfs) context() context.Context {
+	if m.ctx != nil {
+		return m.ctx
+	}
+	return context.Background()
+}
+
+func (m *mfs) WithContext(ctx context.Context) MFS {
+	var v *view
+	if m.view != nil {
+		// the filtered table depends on the context
+		v = &view{filter: m.view.filter}
+	}
+	return &mfs{state: m.state, ctx: ctx, view: v}
+}
+
+// record audits the operation op on name started at start which returned
+// *err, logging it if slow. It is meant to be deferred.
+func (m *mfs) record(op, name string, start time.Time, err *error) {
+	m.recordContext(m.context(), op, name, start, err)
+}
+
+func (m *mfs) recordContext(ctx context.Context, op, name string, start time.Time, err *error) {
+	m.logSlow(ctx, op, name, start, *err)
+	a := m.audit
+	if a == nil || *err == nil && a.rate < 1 && rand.Float64() >= a.rate {
+		return
+	}
+	a.sink.Audit(AuditRecord{Time: time.Now(), Identity: IdentityFromContext(ctx), Op: op, Path: name, Err: *err})
+}
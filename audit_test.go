@@ -0,0 +1,137 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/fs"
+	"log/slog"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAudit(t *testing.T) {
+	var records []AuditRecord
+	m := New(WithAudit(AuditFunc(func(r AuditRecord) {
+		records = append(records, r)
+	})))
+	require.NoError(t, m.Mount("mem", NewMemFS()))
+	alice := m.WithContext(ContextWithIdentity(context.Background(), "alice"))
+	require.NoError(t, alice.WriteFile("mem/foo", data["foo"], 0644))
+	_, err := fs.ReadFile(alice, "mem/foo")
+	require.NoError(t, err)
+	_, err = alice.Open("mem/missing")
+	require.Error(t, err)
+	_, err = alice.ReadDir("mem")
+	require.NoError(t, err)
+	require.NoError(t, m.Remove("mem/foo"))
+
+	var got []string
+	for _, v := range records {
+		got = append(got, strings.Join([]string{v.Identity, v.Op, v.Path}, ":"))
+		assert.False(t, v.Time.IsZero())
+	}
+	assert.Equal(t, []string{
+		":mount:mem",
+		"alice:write:mem/foo",
+		"alice:open:mem/foo",
+		"alice:open:mem/missing",
+		"alice:readdir:mem",
+		":remove:mem/foo",
+	}, got)
+	assert.ErrorIs(t, records[3].Err, fs.ErrNotExist)
+	assert.NoError(t, records[2].Err)
+
+	// the views share the mount table
+	_, err = alice.Open("mem")
+	require.NoError(t, err)
+}
+
+func TestAuditOps(t *testing.T) {
+	var records []AuditRecord
+	m := New(WithAudit(AuditFunc(func(r AuditRecord) {
+		records = append(records, r)
+	})))
+	require.NoError(t, m.Mount("mem", NewMemFS()))
+	alice := m.WithContext(ContextWithIdentity(context.Background(), "alice"))
+	_, _, err := alice.ReadDirPage("mem", "", 10)
+	require.NoError(t, err)
+	_, _, err = alice.ReadDirPage("/", "", 10)
+	require.NoError(t, err)
+	for _, err := range alice.ReadDirIter("mem") {
+		require.NoError(t, err)
+	}
+	for range alice.ReadDirIter("missing") {
+	}
+	_, err = alice.Getxattr("mem", "user.missing")
+	require.Error(t, err)
+	_, err = alice.Listxattr("mem")
+	require.NoError(t, err)
+	id, err := alice.Snapshot("mem")
+	require.NoError(t, err)
+	require.NoError(t, alice.Rollback("mem", id))
+	require.NoError(t, alice.SetPriority("mem", 1))
+
+	var got []string
+	for _, v := range records[1:] {
+		got = append(got, strings.Join([]string{v.Identity, v.Op, v.Path}, ":"))
+	}
+	assert.Equal(t, []string{
+		"alice:readdir:mem",
+		"alice:readdir:/",
+		"alice:readdir:mem",
+		"alice:readdir:missing",
+		"alice:getxattr:mem",
+		"alice:listxattr:mem",
+		"alice:snapshot:mem",
+		"alice:rollback:mem",
+		"alice:setpriority:mem",
+	}, got)
+	assert.ErrorIs(t, records[4].Err, fs.ErrNotExist)
+}
+
+func TestAuditSinks(t *testing.T) {
+	var buf bytes.Buffer
+	m := New(WithAudit(AuditWriter(&buf), WithAuditSampling(0)))
+	require.NoError(t, m.Mount("a", fstest.MapFS{"foo": {Data: data["foo"]}}))
+	_, err := fs.ReadFile(m, "a/foo")
+	require.NoError(t, err)
+	_, err = m.WithContext(ContextWithIdentity(context.Background(), "bob")).Open("a/missing")
+	require.Error(t, err)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 1)
+	var v map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &v))
+	assert.Equal(t, "bob", v["identity"])
+	assert.Equal(t, "open", v["op"])
+	assert.Equal(t, "a/missing", v["path"])
+	assert.Contains(t, v["error"], "file does not exist")
+
+	buf.Reset()
+	m = New(WithAudit(AuditLogger(slog.New(slog.NewTextHandler(&buf, nil)))))
+	require.NoError(t, m.Mount("a", fstest.MapFS{}))
+	assert.Contains(t, buf.String(), "op=mount path=a")
+
+	ch := make(chan AuditRecord, 1)
+	m = New(WithAudit(AuditChannel(ch)))
+	require.NoError(t, m.Mount("a", fstest.MapFS{}))
+	assert.Equal(t, "mount", (<-ch).Op)
+}
@@ -0,0 +1,290 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package azfs provides a file system over an Azure Blob Storage container.
+// Directories are synthesized from the "/" separated blob names. On
+// accounts with a hierarchical namespace, the directory blobs are exposed as
+// directories.
+//
+// Opened files read the blob version they were opened with, identified by
+// its ETag.
+package azfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+
+	"go.linka.cloud/mfs/internal/objfs"
+)
+
+// Option configures the file system.
+type Option func(o *options)
+
+type options struct {
+	prefix   string
+	writable bool
+	ctx      context.Context
+}
+
+// WithPrefix exposes only the blobs under prefix.
+func WithPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+// WithWrites makes the file system writable: WriteFile uploads block blobs
+// and Remove and RemoveAll delete them.
+func WithWrites() Option {
+	return func(o *options) {
+		o.writable = true
+	}
+}
+
+// WithContext sets the context used for the requests. It defaults to
+// context.Background.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// New returns a file system over the blobs of the container.
+func New(c *container.Client, opts ...Option) fs.FS {
+	return newFS(&containerClient{c: c}, opts...)
+}
+
+func newFS(c client, opts ...Option) fs.FS {
+	o := &options{ctx: context.Background()}
+	for _, v := range opts {
+		v(o)
+	}
+	s := &store{c: c}
+	if o.writable {
+		return objfs.NewWritable(o.ctx, s, o.prefix)
+	}
+	return objfs.New(o.ctx, s, o.prefix)
+}
+
+// client is the subset of the container API used by the store.
+type client interface {
+	// listPage lists up to max entries, the service default being used
+	// when max is 0.
+	listPage(ctx context.Context, prefix string, marker *string, max int32) (container.ListBlobsHierarchySegmentResponse, error)
+	properties(ctx context.Context, name string) (blob.GetPropertiesResponse, error)
+	download(ctx context.Context, name string, o *blob.DownloadStreamOptions) (blob.DownloadResponse, error)
+	upload(ctx context.Context, name string, r io.Reader) error
+	delete(ctx context.Context, name string) error
+}
+
+type containerClient struct {
+	c *container.Client
+}
+
+func (c *containerClient) listPage(ctx context.Context, prefix string, marker *string, max int32) (container.ListBlobsHierarchySegmentResponse, error) {
+	o := &container.ListBlobsHierarchyOptions{
+		Prefix:  &prefix,
+		Marker:  marker,
+		Include: container.ListBlobsInclude{Metadata: true},
+	}
+	if max > 0 {
+		o.MaxResults = &max
+	}
+	p := c.c.NewListBlobsHierarchyPager("/", o)
+	res, err := p.NextPage(ctx)
+	return res.ListBlobsHierarchySegmentResponse, err
+}
+
+func (c *containerClient) properties(ctx context.Context, name string) (blob.GetPropertiesResponse, error) {
+	return c.c.NewBlobClient(name).GetProperties(ctx, nil)
+}
+
+func (c *containerClient) download(ctx context.Context, name string, o *blob.DownloadStreamOptions) (blob.DownloadResponse, error) {
+	res, err := c.c.NewBlobClient(name).DownloadStream(ctx, o)
+	return res.DownloadResponse, err
+}
+
+func (c *containerClient) upload(ctx context.Context, name string, r io.Reader) error {
+	_, err := c.c.NewBlockBlobClient(name).UploadStream(ctx, r, nil)
+	return err
+}
+
+func (c *containerClient) delete(ctx context.Context, name string) error {
+	_, err := c.c.NewBlobClient(name).Delete(ctx, nil)
+	return err
+}
+
+type store struct {
+	c client
+}
+
+func (s *store) List(ctx context.Context, prefix string) ([]objfs.Object, []string, error) {
+	return objfs.Collect(s.ListPages(ctx, prefix))
+}
+
+var (
+	_ objfs.TokenStore = (*store)(nil)
+	_ objfs.PagedStore = (*store)(nil)
+)
+
+func (s *store) ListPages(ctx context.Context, prefix string) iter.Seq2[objfs.Page, error] {
+	return func(yield func(objfs.Page, error) bool) {
+		var marker *string
+		seen := make(map[string]bool)
+		for {
+			res, err := s.c.listPage(ctx, prefix, marker, 0)
+			if err != nil {
+				yield(objfs.Page{}, mapErr(err))
+				return
+			}
+			if !yield(page(res, seen), nil) || deref(res.NextMarker) == "" {
+				return
+			}
+			marker = res.NextMarker
+		}
+	}
+}
+
+func (s *store) ListPage(ctx context.Context, prefix, token string, n int) (objfs.Page, string, error) {
+	var marker *string
+	if token != "" {
+		marker = &token
+	}
+	res, err := s.c.listPage(ctx, prefix, marker, int32(n))
+	if err != nil {
+		return objfs.Page{}, "", mapErr(err)
+	}
+	return page(res, make(map[string]bool)), deref(res.NextMarker), nil
+}
+
+// page returns the objects and prefixes of res, skipping the prefixes
+// already seen.
+func page(res container.ListBlobsHierarchySegmentResponse, seen map[string]bool) objfs.Page {
+	var p objfs.Page
+	if res.Segment == nil {
+		return p
+	}
+	for _, v := range res.Segment.BlobPrefixes {
+		if n := deref(v.Name); !seen[n] {
+			seen[n] = true
+			p.Prefixes = append(p.Prefixes, n)
+		}
+	}
+	for _, v := range res.Segment.BlobItems {
+		if isFolder(v.Metadata) {
+			// empty directories of hierarchical namespaces are not
+			// listed as prefixes
+			if n := deref(v.Name) + "/"; !seen[n] {
+				seen[n] = true
+				p.Prefixes = append(p.Prefixes, n)
+			}
+			continue
+		}
+		o := objfs.Object{Key: deref(v.Name)}
+		if p := v.Properties; p != nil {
+			o.Size, o.ModTime, o.Version = deref(p.ContentLength), deref(p.LastModified), string(deref(p.ETag))
+		}
+		p.Objects = append(p.Objects, o)
+	}
+	return p
+}
+
+func (s *store) Stat(ctx context.Context, key string) (objfs.Object, error) {
+	res, err := s.c.properties(ctx, key)
+	if err != nil {
+		return objfs.Object{}, mapErr(err)
+	}
+	if isFolder(res.Metadata) {
+		return objfs.Object{}, objfs.ErrDir
+	}
+	return objfs.Object{Key: key, Size: deref(res.ContentLength), ModTime: deref(res.LastModified), Version: string(deref(res.ETag))}, nil
+}
+
+func (s *store) Get(ctx context.Context, key, version string, off, n int64) (io.ReadCloser, objfs.Object, error) {
+	o := &blob.DownloadStreamOptions{Range: blob.HTTPRange{Offset: off}}
+	if n > 0 {
+		o.Range.Count = n
+	}
+	if version != "" {
+		etag := azcore.ETag(version)
+		o.AccessConditions = &blob.AccessConditions{ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfMatch: &etag}}
+	}
+	res, err := s.c.download(ctx, key, o)
+	if err != nil {
+		return nil, objfs.Object{}, mapErr(err)
+	}
+	if isFolder(res.Metadata) {
+		res.Body.Close()
+		return nil, objfs.Object{}, objfs.ErrDir
+	}
+	return res.Body, objfs.Object{Key: key, Size: deref(res.ContentLength), ModTime: deref(res.LastModified), Version: string(deref(res.ETag))}, nil
+}
+
+func (s *store) Put(ctx context.Context, key string, r io.Reader, _ int64) error {
+	return mapErr(s.c.upload(ctx, key, r))
+}
+
+func (s *store) Delete(ctx context.Context, key string) error {
+	return mapErr(s.c.delete(ctx, key))
+}
+
+// isFolder reports whether the metadata marks a hierarchical namespace
+// directory.
+func isFolder(md map[string]*string) bool {
+	for k, v := range md {
+		if strings.EqualFold(k, "hdi_isfolder") && v != nil && strings.EqualFold(*v, "true") {
+			return true
+		}
+	}
+	return false
+}
+
+// mapErr maps the storage errors to their fs equivalent.
+func mapErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	if bloberror.HasCode(err, bloberror.BlobNotFound, bloberror.ContainerNotFound) {
+		return fmt.Errorf("%w: %v", fs.ErrNotExist, err)
+	}
+	var re *azcore.ResponseError
+	if errors.As(err, &re) {
+		switch re.StatusCode {
+		case http.StatusNotFound:
+			return fmt.Errorf("%w: %v", fs.ErrNotExist, err)
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return fmt.Errorf("%w: %v", fs.ErrPermission, err)
+		}
+	}
+	return err
+}
+
+func deref[T any](v *T) T {
+	var zero T
+	if v == nil {
+		return zero
+	}
+	return *v
+}
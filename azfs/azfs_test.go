@@ -0,0 +1,232 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.linka.cloud/mfs"
+)
+
+type fakeBlob struct {
+	data   []byte
+	etag   azcore.ETag
+	folder bool
+}
+
+// fakeClient is an in-memory container returning listings by pages of two
+// items.
+type fakeClient struct {
+	mu    sync.Mutex
+	blobs map[string]*fakeBlob
+	n     int
+}
+
+func newFakeClient(blobs map[string]string, folders ...string) *fakeClient {
+	c := &fakeClient{blobs: make(map[string]*fakeBlob)}
+	for k, v := range blobs {
+		c.put(k, []byte(v))
+	}
+	for _, v := range folders {
+		c.blobs[v] = &fakeBlob{folder: true}
+	}
+	return c
+}
+
+func (c *fakeClient) put(name string, data []byte) {
+	c.n++
+	c.blobs[name] = &fakeBlob{data: data, etag: azcore.ETag(strconv.Itoa(c.n))}
+}
+
+func notFound() error {
+	return &azcore.ResponseError{ErrorCode: string(bloberror.BlobNotFound), StatusCode: http.StatusNotFound}
+}
+
+func (b *fakeBlob) metadata() map[string]*string {
+	if !b.folder {
+		return nil
+	}
+	v := "true"
+	return map[string]*string{"hdi_isfolder": &v}
+}
+
+func (c *fakeClient) listPage(_ context.Context, prefix string, marker *string, max int32) (container.ListBlobsHierarchySegmentResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var names []string
+	seen := make(map[string]bool)
+	for k := range c.blobs {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if i := strings.Index(k[len(prefix):], "/"); i >= 0 {
+			k = k[:len(prefix)+i+1]
+		}
+		if !seen[k] {
+			seen[k] = true
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	start := 0
+	if marker != nil {
+		start, _ = strconv.Atoi(*marker)
+	}
+	size := 2
+	if max > 0 {
+		size = min(size, int(max))
+	}
+	end := min(start+size, len(names))
+	res := container.ListBlobsHierarchySegmentResponse{Segment: &container.BlobHierarchyListSegment{}}
+	if end < len(names) {
+		res.NextMarker = to(strconv.Itoa(end))
+	}
+	for _, k := range names[start:end] {
+		if strings.HasSuffix(k, "/") {
+			res.Segment.BlobPrefixes = append(res.Segment.BlobPrefixes, &container.BlobPrefix{Name: to(k)})
+			continue
+		}
+		b := c.blobs[k]
+		res.Segment.BlobItems = append(res.Segment.BlobItems, &container.BlobItem{
+			Name:       to(k),
+			Metadata:   b.metadata(),
+			Properties: &container.BlobProperties{ContentLength: to(int64(len(b.data))), ETag: to(b.etag)},
+		})
+	}
+	return res, nil
+}
+
+func (c *fakeClient) properties(_ context.Context, name string) (blob.GetPropertiesResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.blobs[name]
+	if !ok {
+		return blob.GetPropertiesResponse{}, notFound()
+	}
+	return blob.GetPropertiesResponse{ContentLength: to(int64(len(b.data))), ETag: to(b.etag), Metadata: b.metadata()}, nil
+}
+
+func (c *fakeClient) download(_ context.Context, name string, o *blob.DownloadStreamOptions) (blob.DownloadResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.blobs[name]
+	if !ok {
+		return blob.DownloadResponse{}, notFound()
+	}
+	if ac := o.AccessConditions; ac != nil && *ac.ModifiedAccessConditions.IfMatch != b.etag {
+		return blob.DownloadResponse{}, &azcore.ResponseError{ErrorCode: string(bloberror.ConditionNotMet), StatusCode: http.StatusPreconditionFailed}
+	}
+	data := b.data[min(o.Range.Offset, int64(len(b.data))):]
+	if o.Range.Count > 0 && o.Range.Count < int64(len(data)) {
+		data = data[:o.Range.Count]
+	}
+	return blob.DownloadResponse{
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: to(int64(len(data))),
+		ETag:          to(b.etag),
+		Metadata:      b.metadata(),
+	}, nil
+}
+
+func (c *fakeClient) upload(_ context.Context, name string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.put(name, data)
+	return nil
+}
+
+func (c *fakeClient) delete(_ context.Context, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.blobs[name]; !ok {
+		return notFound()
+	}
+	delete(c.blobs, name)
+	return nil
+}
+
+func to[T any](v T) *T {
+	return &v
+}
+
+func TestAzFS(t *testing.T) {
+	c := newFakeClient(map[string]string{
+		"site/index.html":   "index",
+		"site/a":            "a",
+		"site/b":            "b",
+		"site/css/main.css": "body{}",
+		"other":             "other",
+	}, "site/css", "site/empty")
+	f := newFS(c, WithPrefix("site"))
+	require.NoError(t, fstest.TestFS(f, "index.html", "a", "b", "css/main.css"))
+	ds, err := fs.ReadDir(f, ".")
+	require.NoError(t, err)
+	var names []string
+	for _, d := range ds {
+		names = append(names, fmt.Sprintf("%s:%v", d.Name(), d.IsDir()))
+	}
+	assert.Equal(t, []string{"a:false", "b:false", "css:true", "empty:true", "index.html:false"}, names)
+	_, err = f.Open("other")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestAzFSETag(t *testing.T) {
+	c := newFakeClient(map[string]string{"foo": "version 1"})
+	f := newFS(c)
+	file, err := f.Open("foo")
+	require.NoError(t, err)
+	defer file.Close()
+	c.put("foo", []byte("version 2"))
+	_, err = file.(io.ReaderAt).ReadAt(make([]byte, 1), 8)
+	assert.True(t, bloberror.HasCode(err, bloberror.ConditionNotMet))
+}
+
+func TestAzFSWrites(t *testing.T) {
+	c := newFakeClient(nil)
+	m, err := mfs.Mount("az", newFS(c, WithWrites()))
+	require.NoError(t, err)
+	require.NoError(t, m.WriteFile("az/dir/foo", []byte("foo"), 0644))
+	data, err := fs.ReadFile(m, "az/dir/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(data))
+	c.blobs["dir/sub"] = &fakeBlob{folder: true}
+	i, err := fs.Stat(m, "az/dir/sub")
+	require.NoError(t, err)
+	assert.True(t, i.IsDir())
+	require.NoError(t, m.RemoveAll("az/dir"))
+	assert.Empty(t, c.blobs)
+}
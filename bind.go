@@ -0,0 +1,59 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// subFS exposes the directory dir of fsys, forwarding the write operations
+// with the names prefixed by dir, unlike fs.Sub. The names passed to the
+// file system it unwraps to are relative to its root rather than to dir,
+// see mount.shared.
+type subFS struct {
+	forwardFS
+	dir string
+}
+
+func newSubFS(fsys fs.FS, dir string) *subFS {
+	s := &subFS{dir: dir}
+	s.forwardFS = forwardFS{fsys: fsys, route: s.full, err: s.shorten}
+	return s
+}
+
+func (s *subFS) full(op, name string) (fs.FS, string, error) {
+	if !fs.ValidPath(name) {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return s.fsys, path.Join(s.dir, name), nil
+}
+
+// shorten reports the errors of fsys with the names relative to dir.
+func (s *subFS) shorten(err error) error {
+	var pe *fs.PathError
+	if !errors.As(err, &pe) {
+		return err
+	}
+	switch {
+	case pe.Path == s.dir:
+		pe.Path = "."
+	case strings.HasPrefix(pe.Path, s.dir+"/"):
+		pe.Path = pe.Path[len(s.dir)+1:]
+	}
+	return err
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBindShared(t *testing.T) {
+	mem := NewMemFS()
+	require.NoError(t, mem.MkdirAll("a/b", 0755))
+	require.NoError(t, mem.WriteFile("a/b/foo", data["foo"], 0644))
+	m, err := Mount("m1", mem, WithCache(time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, m.Bind("m1/a/b", "b"))
+	read := func(name string) string {
+		b, err := fs.ReadFile(m, name)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	// the writes and the invalidations are seen by the source mount cache
+	assert.Equal(t, string(data["foo"]), read("m1/a/b/foo"))
+	require.NoError(t, m.WriteFile("b/foo", data["baz"], 0644))
+	assert.Equal(t, string(data["baz"]), read("m1/a/b/foo"))
+	require.NoError(t, mem.WriteFile("a/b/foo", data["quux"], 0644))
+	assert.Equal(t, string(data["baz"]), read("b/foo"))
+	m.InvalidateCache("b/foo")
+	assert.Equal(t, string(data["quux"]), read("m1/a/b/foo"))
+
+	u, err := m.Lock("m1/a/b/foo", false)
+	require.NoError(t, err)
+	_, err = m.Lock("b/foo", false)
+	assert.ErrorIs(t, err, ErrLocked)
+	require.NoError(t, u.Unlock())
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "a", "b"), 0755))
+	require.NoError(t, m.Mount("web", Poll(DirFS(dir), 10*time.Millisecond)))
+	require.NoError(t, m.Bind("web/a", "a"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := m.Watch(ctx, "a/b")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a", "b", "foo"), data["foo"], 0644))
+	nextEvent(t, ch, "a/b/foo")
+}
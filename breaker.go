@@ -0,0 +1,217 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is the error returned by the operations of a mount whose
+// circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// WithCircuitBreaker guards the mounted file system with a circuit breaker,
+// see CircuitBreaker.
+func WithCircuitBreaker(failures int, cooldown time.Duration) MountOption {
+	return func(o *mountOptions) {
+		o.breaker = &breakerOptions{failures: failures, cooldown: cooldown}
+	}
+}
+
+type breakerOptions struct {
+	failures int
+	cooldown time.Duration
+}
+
+// CircuitBreaker returns a file system failing the operations of fsys with a
+// *fs.PathError wrapping ErrCircuitOpen, without running them, once failures
+// consecutive operations failed. After cooldown, a single operation is let
+// through: the breaker closes if it succeeds and opens again for cooldown
+// otherwise.
+//
+// Only the errors whose class is a failure count, see ClassifyError: the
+// ones reporting e.g. a missing file are results rather than failures of
+// the backend. The files opened for reading forward io.Seeker and
+// io.ReaderAt, failing with errors.ErrUnsupported when the files of fsys do
+// not.
+func CircuitBreaker(fsys fs.FS, failures int, cooldown time.Duration) fs.FS {
+	return newBreaker(failures, cooldown).wrap(fsys)
+}
+
+// breaker is the circuit breaker shared by the file systems of a mount.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+func newBreaker(failures int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: max(failures, 1), cooldown: cooldown}
+}
+
+func (b *breaker) wrap(fsys fs.FS) fs.FS {
+	return &breakerFS{forwardFS: forwardFS{fsys: fsys, call: func(op, name string, fn func() error) error {
+		return guardedErr(b, op, name, fn)
+	}}, b: b}
+}
+
+// allow reports whether an operation may run and whether it is the trial of
+// a half-open breaker.
+func (b *breaker) allow() (ok, trial bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true, false
+	}
+	if b.trial || time.Since(b.openedAt) < b.cooldown {
+		return false, false
+	}
+	b.trial = true
+	return true, true
+}
+
+// done records the result of an operation.
+func (b *breaker) done(trial bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if trial {
+		b.trial = false
+	}
+	if !ClassifyError(err).Failure() {
+		b.failures = 0
+		return
+	}
+	if b.failures++; b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+}
+
+// guarded runs fn unless the breaker is open.
+func guarded[T any](b *breaker, op, name string, fn func() (T, error)) (T, error) {
+	ok, trial := b.allow()
+	if !ok {
+		var zero T
+		return zero, &fs.PathError{Op: op, Path: name, Err: ErrCircuitOpen}
+	}
+	v, err := fn()
+	b.done(trial, err)
+	return v, err
+}
+
+// guardedErr is guarded for the functions only returning an error.
+func guardedErr(b *breaker, op, name string, fn func() error) error {
+	_, err := guarded(b, op, name, func() (struct{}, error) {
+		return struct{}{}, fn()
+	})
+	return err
+}
+
+type breakerFS struct {
+	forwardFS
+	b *breaker
+}
+
+func (f *breakerFS) Open(name string) (fs.File, error) {
+	file, err := guarded(f.b, "open", name, func() (fs.File, error) {
+		return f.fsys.Open(name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &breakerFile{File: file, b: f.b, name: name}, nil
+}
+
+func (f *breakerFS) Stat(name string) (fs.FileInfo, error) {
+	return guarded(f.b, "stat", name, func() (fs.FileInfo, error) {
+		return fs.Stat(f.fsys, name)
+	})
+}
+
+func (f *breakerFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return guarded(f.b, "readdir", name, func() ([]fs.DirEntry, error) {
+		return fs.ReadDir(f.fsys, name)
+	})
+}
+
+func (f *breakerFS) ReadDirPage(name, token string, n int) ([]fs.DirEntry, string, error) {
+	return readDirPage(f.fsys, name, token, n, func(fn func() (page, error)) (page, error) {
+		return guarded(f.b, "readdir", name, fn)
+	})
+}
+
+func (f *breakerFS) OpenFile(name string, flag int, perm fs.FileMode) (fs.File, error) {
+	w, ok := f.fsys.(OpenFileFS)
+	if !ok {
+		return nil, unsupported("open", name)
+	}
+	// the written files are returned as is to keep their io.Writer
+	return guarded(f.b, "open", name, func() (fs.File, error) {
+		return w.OpenFile(name, flag, perm)
+	})
+}
+
+type breakerFile struct {
+	fs.File
+	b    *breaker
+	name string
+}
+
+func (f *breakerFile) Stat() (fs.FileInfo, error) {
+	return guarded(f.b, "stat", f.name, f.File.Stat)
+}
+
+func (f *breakerFile) Read(b []byte) (int, error) {
+	return guarded(f.b, "read", f.name, func() (int, error) {
+		return f.File.Read(b)
+	})
+}
+
+func (f *breakerFile) ReadAt(b []byte, off int64) (int, error) {
+	r, ok := f.File.(io.ReaderAt)
+	if !ok {
+		return 0, unsupported("read", f.name)
+	}
+	return guarded(f.b, "read", f.name, func() (int, error) {
+		return r.ReadAt(b, off)
+	})
+}
+
+func (f *breakerFile) Seek(offset int64, whence int) (int64, error) {
+	s, ok := f.File.(io.Seeker)
+	if !ok {
+		return 0, unsupported("seek", f.name)
+	}
+	return guarded(f.b, "seek", f.name, func() (int64, error) {
+		return s.Seek(offset, whence)
+	})
+}
+
+func (f *breakerFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	d, ok := f.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errors.New("not a directory")}
+	}
+	return guarded(f.b, "readdir", f.name, func() ([]fs.DirEntry, error) {
+		return d.ReadDir(n)
+	})
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	f := &flakyFS{FS: fstest.MapFS{"foo": {Data: data["foo"]}}}
+	m, err := Mount("remote", f, WithCircuitBreaker(2, 30*time.Millisecond))
+	require.NoError(t, err)
+
+	for range 3 {
+		_, err = fs.Stat(m, "remote/missing")
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+	}
+	f.down.Store(true)
+	for range 2 {
+		_, err = fs.Stat(m, "remote/foo")
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, ErrCircuitOpen)
+	}
+	calls := f.calls.Load()
+	_, err = fs.Stat(m, "remote/foo")
+	var pe *fs.PathError
+	require.True(t, errors.As(err, &pe))
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	_, err = m.Open("remote/foo")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, calls, f.calls.Load())
+
+	// the trial fails, the breaker opens again
+	time.Sleep(40 * time.Millisecond)
+	_, err = fs.Stat(m, "remote/foo")
+	assert.NotErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, calls+1, f.calls.Load())
+	_, err = fs.Stat(m, "remote/foo")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+
+	// the trial succeeds, the breaker closes
+	f.down.Store(false)
+	time.Sleep(40 * time.Millisecond)
+	_, err = fs.Stat(m, "remote/foo")
+	require.NoError(t, err)
+	b, err := fs.ReadFile(m, "remote/foo")
+	require.NoError(t, err)
+	assert.Equal(t, data["foo"], b)
+}
+
+func TestCircuitBreakerAs(t *testing.T) {
+	_, ok := As[RenameFS](CircuitBreaker(NewMemFS(), 1, time.Second))
+	assert.True(t, ok)
+}
+
+func TestCircuitBreakerFile(t *testing.T) {
+	testSeekReadAt(t, func(fsys fs.FS) fs.FS {
+		return CircuitBreaker(fsys, 1, time.Second)
+	})
+}
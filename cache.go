@@ -0,0 +1,462 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheOption configures Cache.
+type CacheOption func(o *cacheOptions)
+
+type cacheOptions struct {
+	ttl         time.Duration
+	swr         time.Duration
+	entries     int
+	maxFileSize int64
+}
+
+// WithStaleWhileRevalidate serves the entries expired for less than d
+// immediately while refreshing them in the background, the latency of the
+// backend only being paid once they expired for longer. A failed refresh
+// keeps serving the stale entry until then.
+func WithStaleWhileRevalidate(d time.Duration) CacheOption {
+	return func(o *cacheOptions) {
+		o.swr = d
+	}
+}
+
+// WithCacheEntries bounds the number of cached entries, the least recently
+// used being evicted first. It defaults to 1024.
+func WithCacheEntries(n int) CacheOption {
+	return func(o *cacheOptions) {
+		o.entries = n
+	}
+}
+
+// WithCacheMaxFileSize sets the size of the largest file whose content is
+// cached, the larger ones being read from the backend. It defaults to 1MiB.
+func WithCacheMaxFileSize(n int64) CacheOption {
+	return func(o *cacheOptions) {
+		o.maxFileSize = n
+	}
+}
+
+// WithCache caches the mounted file system for ttl, see Cache.
+func WithCache(ttl time.Duration, opts ...CacheOption) MountOption {
+	return func(o *mountOptions) {
+		o.cache = newCacheOptions(ttl, opts...)
+	}
+}
+
+func newCacheOptions(ttl time.Duration, opts ...CacheOption) *cacheOptions {
+	o := &cacheOptions{ttl: ttl, entries: 1024, maxFileSize: 1 << 20}
+	for _, v := range opts {
+		v(o)
+	}
+	return o
+}
+
+// Cache returns a file system caching for ttl the file infos, the directory
+// listings and the content of the small files of fsys. The write operations
+// are forwarded, dropping the entries of the paths they touch.
+//
+// Mounted with WithCache, the entries are also dropped by MFS.InvalidateCache
+// and, while mounted, on the changes notified by the mounted file system
+// when it implements WatchFS.
+func Cache(fsys fs.FS, ttl time.Duration, opts ...CacheOption) fs.FS {
+	return newCacheFS(fsys, newCacheOptions(ttl, opts...))
+}
+
+func newCacheFS(fsys fs.FS, o *cacheOptions) *cacheFS {
+	c := &cacheFS{o: o, entries: make(map[cacheKey]*list.Element), lru: list.New()}
+	c.forwardFS = forwardFS{fsys: fsys, call: c.invalidating}
+	return c
+}
+
+type cacheKind int
+
+const (
+	cacheStat cacheKind = iota
+	cacheList
+	cacheContent
+)
+
+type cacheKey struct {
+	kind cacheKind
+	name string
+}
+
+type cacheEntry struct {
+	key        cacheKey
+	v          any
+	size       int64
+	fetched    time.Time
+	refreshing bool
+}
+
+// cachedFile is the content of a file, large reporting a file too large to
+// be cached.
+type cachedFile struct {
+	info  fs.FileInfo
+	data  []byte
+	large bool
+}
+
+type cacheFS struct {
+	forwardFS
+	o *cacheOptions
+
+	mu      sync.Mutex
+	entries map[cacheKey]*list.Element
+	lru     *list.List
+	// gen is incremented by invalidate for the loads started before to
+	// not be stored
+	gen uint64
+	// watchers counts the mounts sharing the cache, the watch being
+	// stopped with the last one
+	watchers int
+	cancel   context.CancelFunc
+	counters CacheStats
+}
+
+// CacheStats are the statistics of the cache of a mount configured with
+// WithCache.
+type CacheStats struct {
+	// Hits counts the lookups served from the cache, StaleHits the ones
+	// served with an expired entry while refreshed.
+	Hits      uint64 `json:"hits"`
+	StaleHits uint64 `json:"staleHits"`
+	Misses    uint64 `json:"misses"`
+	// Evictions counts the entries evicted to honour WithCacheEntries.
+	Evictions uint64 `json:"evictions"`
+	Entries   int    `json:"entries"`
+	// Bytes is the size of the cached file contents.
+	Bytes int64 `json:"bytes"`
+}
+
+func (m *mfs) CacheStats() map[string]CacheStats {
+	res := make(map[string]CacheStats)
+	for k, v := range m.load().mounts {
+		if v.cache != nil {
+			res[k] = v.cache.stats()
+		}
+	}
+	return res
+}
+
+// get returns the cached value of key, loading it with load when missing or
+// expired. The stale values are returned while refreshed in the background.
+func (c *cacheFS) get(key cacheKey, load func() (any, error)) (any, error) {
+	c.mu.Lock()
+	gen := c.gen
+	if e, ok := c.entries[key]; ok {
+		ce := e.Value.(*cacheEntry)
+		age := time.Since(ce.fetched)
+		if age < c.o.ttl+c.o.swr {
+			c.lru.MoveToFront(e)
+			c.counters.Hits++
+			if age >= c.o.ttl {
+				c.counters.StaleHits++
+			}
+			if age >= c.o.ttl && !ce.refreshing {
+				ce.refreshing = true
+				go c.refresh(key, gen, load)
+			}
+			c.mu.Unlock()
+			return ce.v, nil
+		}
+	}
+	c.counters.Misses++
+	c.mu.Unlock()
+	v, err := load()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.put(key, gen, v)
+	c.mu.Unlock()
+	return v, nil
+}
+
+func (c *cacheFS) refresh(key cacheKey, gen uint64, load func() (any, error)) {
+	v, err := load()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil {
+		c.put(key, gen, v)
+		return
+	}
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*cacheEntry).refreshing = false
+	}
+}
+
+// put stores v for key, loaded at generation gen, evicting the least
+// recently used entries beyond the limit. c.mu must be held.
+func (c *cacheFS) put(key cacheKey, gen uint64, v any) {
+	if gen != c.gen {
+		return
+	}
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+	var size int64
+	if f, ok := v.(*cachedFile); ok {
+		size = int64(len(f.data))
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, v: v, size: size, fetched: time.Now()})
+	c.counters.Bytes += size
+	for c.lru.Len() > max(c.o.entries, 1) {
+		c.remove(c.lru.Back())
+		c.counters.Evictions++
+	}
+}
+
+// remove drops the entry e. c.mu must be held.
+func (c *cacheFS) remove(e *list.Element) {
+	ce := e.Value.(*cacheEntry)
+	c.lru.Remove(e)
+	delete(c.entries, ce.key)
+	c.counters.Bytes -= ce.size
+}
+
+// stats returns the statistics of the cache.
+func (c *cacheFS) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.counters
+	s.Entries = c.lru.Len()
+	return s
+}
+
+func (m *mfs) InvalidateCache(name string) {
+	name = strings.TrimPrefix(cleanPath(m.normalize(name)), "/")
+	for _, mnt := range m.load().mounts {
+		if mnt.cache == nil {
+			continue
+		}
+		p := strings.TrimPrefix(mnt.path, "/")
+		switch {
+		case p == "." || p == "":
+			mnt.cache.invalidate(mnt.shared(name))
+		case name == p || name == "." || name == "" || strings.HasPrefix(p, name+"/"):
+			mnt.cache.invalidate(mnt.sub)
+		case strings.HasPrefix(name, p+"/"):
+			mnt.cache.invalidate(mnt.shared(name[len(p)+1:]))
+		}
+	}
+}
+
+// invalidate drops the entries of name, of its children and of its parents.
+func (c *cacheFS) invalidate(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for k, e := range c.entries {
+		if duRelated(k.name, name) {
+			c.remove(e)
+		}
+	}
+}
+
+// startWatch invalidates the entries changed as notified by the wrapped file
+// system, if it notifies its changes, until stopWatch is called as many
+// times. The wrappers below the cache map the events to the names it serves,
+// e.g. the uncompressed names of Decompress, see watcher.
+func (c *cacheFS) startWatch() {
+	c.mu.Lock()
+	c.watchers++
+	started := c.watchers > 1
+	c.mu.Unlock()
+	if started {
+		return
+	}
+	w, ok := watcher(c.fsys)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := w.Watch(ctx, ".")
+	if err != nil {
+		cancel()
+		return
+	}
+	c.mu.Lock()
+	c.cancel = cancel
+	c.mu.Unlock()
+	go func() {
+		for e := range ch {
+			c.invalidate(e.Path)
+		}
+	}()
+}
+
+func (c *cacheFS) stopWatch() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.watchers--; c.watchers == 0 && c.cancel != nil {
+		c.cancel()
+		c.cancel = nil
+	}
+}
+
+// invalidating runs the write operation fn, invalidating name once done.
+func (c *cacheFS) invalidating(_, name string, fn func() error) error {
+	defer c.invalidate(name)
+	return fn()
+}
+
+func (c *cacheFS) Open(name string) (fs.File, error) {
+	i, err := c.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if i.IsDir() {
+		return &cacheDir{info: i, name: name, dir: dirReader{list: func() ([]fs.DirEntry, error) {
+			return c.ReadDir(name)
+		}}}, nil
+	}
+	if !i.Mode().IsRegular() || i.Size() > c.o.maxFileSize {
+		return c.fsys.Open(name)
+	}
+	v, err := c.get(cacheKey{kind: cacheContent, name: name}, func() (any, error) {
+		return c.load(name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	f := v.(*cachedFile)
+	if f.large {
+		return c.fsys.Open(name)
+	}
+	return &cacheFile{Reader: bytes.NewReader(f.data), info: f.info}, nil
+}
+
+// load reads the content of the file name.
+func (c *cacheFS) load(name string) (*cachedFile, error) {
+	f, err := c.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	i, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if i.Size() > c.o.maxFileSize {
+		return &cachedFile{info: i, large: true}, nil
+	}
+	b, err := io.ReadAll(io.LimitReader(f, c.o.maxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > c.o.maxFileSize {
+		return &cachedFile{info: i, large: true}, nil
+	}
+	return &cachedFile{info: i, data: b}, nil
+}
+
+func (c *cacheFS) Stat(name string) (fs.FileInfo, error) {
+	v, err := c.get(cacheKey{kind: cacheStat, name: name}, func() (any, error) {
+		return fs.Stat(c.fsys, name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(fs.FileInfo), nil
+}
+
+func (c *cacheFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	v, err := c.get(cacheKey{kind: cacheList, name: name}, func() (any, error) {
+		return fs.ReadDir(c.fsys, name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the callers may modify the slice
+	return slices.Clone(v.([]fs.DirEntry)), nil
+}
+
+func (c *cacheFS) OpenFile(name string, flag int, perm fs.FileMode) (fs.File, error) {
+	w, ok := c.fsys.(OpenFileFS)
+	if !ok {
+		return nil, unsupported("open", name)
+	}
+	if !writeFlag(flag) {
+		return w.OpenFile(name, flag, perm)
+	}
+	// invalidated again once written, the entries may be refilled meanwhile
+	defer c.invalidate(name)
+	f, err := w.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return onClose(f, name, func() { c.invalidate(name) }), nil
+}
+
+func (c *cacheFS) Rename(oldname, newname string) error {
+	w, ok := c.fsys.(RenameFS)
+	if !ok {
+		return unsupported("rename", oldname)
+	}
+	defer c.invalidate(oldname)
+	defer c.invalidate(newname)
+	return w.Rename(oldname, newname)
+}
+
+type cacheFile struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+func (f *cacheFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *cacheFile) Close() error {
+	return nil
+}
+
+type cacheDir struct {
+	info fs.FileInfo
+	name string
+	dir  dirReader
+}
+
+func (d *cacheDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *cacheDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *cacheDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	return d.dir.ReadDir(n)
+}
+
+func (d *cacheDir) Close() error {
+	return nil
+}
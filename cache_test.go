@@ -0,0 +1,312 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingFS counts the reads reaching the backend.
+type countingFS struct {
+	*MemFS
+	opens, stats, lists atomic.Int32
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	c.opens.Add(1)
+	return c.MemFS.Open(name)
+}
+
+func (c *countingFS) Stat(name string) (fs.FileInfo, error) {
+	c.stats.Add(1)
+	return c.MemFS.Stat(name)
+}
+
+func (c *countingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	c.lists.Add(1)
+	return c.MemFS.ReadDir(name)
+}
+
+func TestCache(t *testing.T) {
+	mem := NewMemFS()
+	require.NoError(t, mem.MkdirAll("dir", 0755))
+	require.NoError(t, mem.WriteFile("dir/foo", []byte("foo"), 0644))
+	require.NoError(t, mem.WriteFile("large", make([]byte, 64), 0644))
+	c := &countingFS{MemFS: mem}
+	m, err := Mount("cached", c, WithCache(time.Hour, WithCacheMaxFileSize(32)))
+	require.NoError(t, err)
+
+	for range 3 {
+		b, err := fs.ReadFile(m, "cached/dir/foo")
+		require.NoError(t, err)
+		assert.Equal(t, "foo", string(b))
+		ds, err := m.ReadDir("cached/dir")
+		require.NoError(t, err)
+		require.Len(t, ds, 1)
+		assert.Equal(t, "foo", ds[0].Name())
+		_, err = fs.ReadFile(m, "cached/large")
+		require.NoError(t, err)
+	}
+	assert.EqualValues(t, 4, c.opens.Load(), "the large file is read from the backend")
+	assert.EqualValues(t, 2, c.stats.Load())
+	assert.EqualValues(t, 1, c.lists.Load())
+
+	// the writes are forwarded
+	require.NoError(t, m.WriteFile("cached/dir/bar", []byte("bar"), 0644))
+	b, err := mem.ReadFile("dir/bar")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(b))
+
+	_, err = fs.ReadFile(m, "cached/missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestCacheExpiry(t *testing.T) {
+	mem := NewMemFS()
+	require.NoError(t, mem.WriteFile("foo", []byte("foo"), 0644))
+	fsys := Cache(mem, 10*time.Millisecond)
+
+	b, err := fs.ReadFile(fsys, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(b))
+	require.NoError(t, mem.WriteFile("foo", []byte("bar"), 0644))
+	b, err = fs.ReadFile(fsys, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(b))
+	time.Sleep(20 * time.Millisecond)
+	b, err = fs.ReadFile(fsys, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(b))
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	mem := NewMemFS()
+	require.NoError(t, mem.WriteFile("foo", []byte("foo"), 0644))
+	fsys := Cache(mem, 10*time.Millisecond, WithStaleWhileRevalidate(time.Hour))
+
+	b, err := fs.ReadFile(fsys, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(b))
+	require.NoError(t, mem.WriteFile("foo", []byte("foobar"), 0644))
+	time.Sleep(20 * time.Millisecond)
+
+	// the stale content is served while refreshed
+	b, err = fs.ReadFile(fsys, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(b))
+	assert.Eventually(t, func() bool {
+		b, err := fs.ReadFile(fsys, "foo")
+		return err == nil && string(b) == "foobar"
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestCacheEviction(t *testing.T) {
+	mem := NewMemFS()
+	require.NoError(t, mem.WriteFile("foo", []byte("foo"), 0644))
+	require.NoError(t, mem.WriteFile("bar", []byte("bar"), 0644))
+	c := Cache(mem, time.Hour, WithCacheEntries(2)).(*cacheFS)
+
+	_, err := fs.ReadFile(c, "foo")
+	require.NoError(t, err)
+	_, err = fs.ReadFile(c, "bar")
+	require.NoError(t, err)
+	assert.Len(t, c.entries, 2)
+	assert.Contains(t, c.entries, cacheKey{kind: cacheContent, name: "bar"})
+	assert.NotContains(t, c.entries, cacheKey{kind: cacheStat, name: "foo"})
+
+	_, ok := As[RenameFS](c)
+	assert.True(t, ok)
+}
+
+// watchMemFS notifies the changes sent on events.
+type watchMemFS struct {
+	*MemFS
+	events chan WatchEvent
+	done   chan struct{}
+}
+
+func (w *watchMemFS) Watch(ctx context.Context, name string) (<-chan WatchEvent, error) {
+	ch := make(chan WatchEvent)
+	go func() {
+		defer close(ch)
+		defer close(w.done)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-w.events:
+				ch <- e
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	mem := NewMemFS()
+	require.NoError(t, mem.MkdirAll("dir", 0755))
+	require.NoError(t, mem.WriteFile("dir/foo", []byte("foo"), 0644))
+	m, err := Mount("cached", mem, WithCache(time.Hour))
+	require.NoError(t, err)
+	read := func(name string) string {
+		b, err := fs.ReadFile(m, name)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	assert.Equal(t, "foo", read("cached/dir/foo"))
+	require.NoError(t, mem.WriteFile("dir/foo", []byte("bar"), 0644))
+	assert.Equal(t, "foo", read("cached/dir/foo"))
+	m.InvalidateCache("cached/dir/foo")
+	assert.Equal(t, "bar", read("cached/dir/foo"))
+
+	ds, err := m.ReadDir("cached/dir")
+	require.NoError(t, err)
+	assert.Len(t, ds, 1)
+	require.NoError(t, mem.WriteFile("dir/baz", nil, 0644))
+	m.InvalidateCache("cached")
+	ds, err = m.ReadDir("cached/dir")
+	require.NoError(t, err)
+	assert.Len(t, ds, 2)
+
+	// the writes through the MFS invalidate the entries they touch
+	require.NoError(t, m.WriteFile("cached/dir/foo", []byte("baz"), 0644))
+	assert.Equal(t, "baz", read("cached/dir/foo"))
+	require.NoError(t, m.Remove("cached/dir/baz"))
+	ds, err = m.ReadDir("cached/dir")
+	require.NoError(t, err)
+	assert.Len(t, ds, 1)
+	require.NoError(t, m.Rename("cached/dir/foo", "cached/dir/bar"))
+	_, err = fs.Stat(m, "cached/dir/foo")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.Equal(t, "baz", read("cached/dir/bar"))
+}
+
+func TestCacheOpenFile(t *testing.T) {
+	for _, name := range []string{"cached/foo", "foo"} {
+		mem := NewMemFS()
+		require.NoError(t, mem.WriteFile("foo", []byte("foo"), 0644))
+		fsys := Cache(mem, time.Hour)
+		if name == "cached/foo" {
+			m, err := Mount("cached", mem, WithCache(time.Hour))
+			require.NoError(t, err)
+			fsys = m
+		}
+		read := func() string {
+			b, err := fs.ReadFile(fsys, name)
+			require.NoError(t, err)
+			return string(b)
+		}
+		assert.Equal(t, "foo", read(), name)
+		f, err := fsys.(OpenFileFS).OpenFile(name, os.O_WRONLY|os.O_TRUNC, 0644)
+		require.NoError(t, err)
+		// the truncated file is cached while it is written
+		assert.Equal(t, "", read(), name)
+		_, err = f.(io.Writer).Write([]byte("bar"))
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		assert.Equal(t, "bar", read(), name)
+	}
+}
+
+func TestCacheWatch(t *testing.T) {
+	w := &watchMemFS{MemFS: NewMemFS(), events: make(chan WatchEvent), done: make(chan struct{})}
+	require.NoError(t, w.WriteFile("foo", []byte("foo"), 0644))
+	m, err := Mount("cached", w, WithCache(time.Hour))
+	require.NoError(t, err)
+
+	b, err := fs.ReadFile(m, "cached/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(b))
+	require.NoError(t, w.MemFS.WriteFile("foo", []byte("bar"), 0644))
+	w.events <- WatchEvent{Path: "foo"}
+	assert.Eventually(t, func() bool {
+		b, err := fs.ReadFile(m, "cached/foo")
+		return err == nil && string(b) == "bar"
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, m.Unmount("cached"))
+	select {
+	case <-w.done:
+	case <-time.After(time.Second):
+		t.Fatal("watch not stopped")
+	}
+}
+
+func TestCacheWatchWrapped(t *testing.T) {
+	gz := func(s string) []byte {
+		return compress(t, []byte(s), func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })
+	}
+	w := &watchMemFS{MemFS: NewMemFS(), events: make(chan WatchEvent), done: make(chan struct{})}
+	require.NoError(t, w.WriteFile("foo.gz", gz("foo"), 0644))
+	m, err := Mount("cached", w, WithDecompression(), WithCache(time.Hour))
+	require.NoError(t, err)
+
+	b, err := fs.ReadFile(m, "cached/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(b))
+	require.NoError(t, w.MemFS.WriteFile("foo.gz", gz("bar"), 0644))
+	// the backend notifies the compressed name, the cache serves the other
+	w.events <- WatchEvent{Path: "foo.gz"}
+	assert.Eventually(t, func() bool {
+		b, err := fs.ReadFile(m, "cached/foo")
+		return err == nil && string(b) == "bar"
+	}, time.Second, time.Millisecond)
+}
+
+func TestCacheStats(t *testing.T) {
+	mem := NewMemFS()
+	require.NoError(t, mem.WriteFile("foo", []byte("foo"), 0644))
+	require.NoError(t, mem.WriteFile("bar", []byte("barbaz"), 0644))
+	m, err := Mount("cached", mem, WithCache(time.Hour, WithCacheEntries(3)))
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("plain", NewMemFS()))
+
+	for range 2 {
+		_, err = fs.ReadFile(m, "cached/foo")
+		require.NoError(t, err)
+	}
+	s := m.CacheStats()
+	require.Len(t, s, 1)
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 2, Entries: 2, Bytes: 3}, s["cached"])
+
+	_, err = fs.ReadFile(m, "cached/bar")
+	require.NoError(t, err)
+	s = m.CacheStats()
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 4, Evictions: 1, Entries: 3, Bytes: 9}, s["cached"])
+
+	h := DebugHandler(m)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/mfs?format=json", nil))
+	var mounts []MountStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &mounts))
+	require.Len(t, mounts, 2)
+	require.NotNil(t, mounts[0].Cache)
+	assert.Equal(t, 3, mounts[0].Cache.Entries)
+	assert.Nil(t, mounts[1].Cache)
+}
@@ -0,0 +1,122 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// CapabilitySet is a set of operations supported by a mounted file system.
+type CapabilitySet uint
+
+const (
+	// CapWrite reports that files can be written, see WriteFileFS and
+	// OpenFileFS.
+	CapWrite CapabilitySet = 1 << iota
+	// CapMkdir reports that directories can be created, see MkdirAllFS.
+	CapMkdir
+	// CapRemove reports that files can be removed, see RemoveFS.
+	CapRemove
+	// CapSeek reports that the file implements io.Seeker.
+	CapSeek
+	// CapReadAt reports that the file implements io.ReaderAt.
+	CapReadAt
+	// CapWatch reports that changes can be watched, see WatchFS.
+	CapWatch
+	// CapXattr reports that extended attributes are supported, see XattrFS.
+	CapXattr
+)
+
+var capabilityNames = []string{"write", "mkdir", "remove", "seek", "readat", "watch", "xattr"}
+
+// Has reports whether s holds all the capabilities of c.
+func (s CapabilitySet) Has(c CapabilitySet) bool {
+	return s&c == c
+}
+
+func (s CapabilitySet) String() string {
+	var names []string
+	for i, v := range capabilityNames {
+		if s&(1<<i) != 0 {
+			names = append(names, v)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// WatchEvent describes a change of a file watched with WatchFS.
+type WatchEvent struct {
+	// Path is the path of the changed file, relative to the file system.
+	Path string
+	// Removed reports that the file was removed, it was created or modified
+	// otherwise.
+	Removed bool
+}
+
+// WatchFS is implemented by file systems able to notify the changes of
+// their files.
+type WatchFS interface {
+	fs.FS
+	// Watch sends the changes of the files under name to the returned
+	// channel, which is closed once ctx is done.
+	Watch(ctx context.Context, name string) (<-chan WatchEvent, error)
+}
+
+func (m *mfs) Capabilities(name string) CapabilitySet {
+	mnt, rel, err := m.lookupPath("capabilities", name)
+	if err != nil {
+		return 0
+	}
+	var c CapabilitySet
+	_, w := As[WriteFileFS](mnt.writable)
+	_, o := As[OpenFileFS](mnt.writable)
+	if w || o {
+		c |= CapWrite
+	}
+	if _, ok := As[MkdirAllFS](mnt.writable); ok {
+		c |= CapMkdir
+	}
+	if _, ok := As[RemoveFS](mnt.writable); ok {
+		c |= CapRemove
+	}
+	if _, ok := watcher(mnt.fs); ok {
+		c |= CapWatch
+	}
+	if _, ok := As[XattrFS](mnt.fs); ok {
+		c |= CapXattr
+	}
+	// the random access is a property of the opened files
+	f, err := mnt.fs.Open(rel)
+	if err != nil {
+		return c
+	}
+	defer f.Close()
+	if s, err := f.Stat(); err != nil || !s.Mode().IsRegular() {
+		return c
+	}
+	if _, ok := f.(io.Seeker); ok {
+		c |= CapSeek
+	}
+	if _, ok := f.(io.ReaderAt); ok {
+		c |= CapReadAt
+	}
+	return c
+}
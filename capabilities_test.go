@@ -0,0 +1,55 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type readOnlyFS struct {
+	fs.FS
+}
+
+func TestCapabilities(t *testing.T) {
+	mem := NewMemFS()
+	require.NoError(t, mem.WriteFile("foo", []byte("foo"), 0644))
+	m, err := Mount("static", fstest.MapFS{"foo": {Data: []byte("foo")}})
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("mem", mem))
+	require.NoError(t, m.Mount("timeout", mem, WithTimeout(time.Second)))
+	require.NoError(t, m.Mount("wrapped", mem, WithMiddleware(func(fsys fs.FS) fs.FS {
+		return readOnlyFS{fsys}
+	})))
+
+	assert.Equal(t, CapabilitySet(0), m.Capabilities("static"))
+	assert.Equal(t, CapSeek|CapReadAt, m.Capabilities("static/foo"))
+	assert.Equal(t, "seek|readat", m.Capabilities("static/foo").String())
+
+	c := m.Capabilities("mem")
+	assert.True(t, c.Has(CapWrite|CapMkdir|CapRemove), c)
+	assert.False(t, c.Has(CapSeek))
+	assert.True(t, m.Capabilities("mem/foo").Has(CapWrite|CapSeek))
+	assert.True(t, m.Capabilities("timeout").Has(CapWrite|CapMkdir|CapRemove))
+	assert.False(t, m.Capabilities("wrapped").Has(CapWrite))
+
+	assert.Equal(t, CapabilitySet(0), m.Capabilities("missing"))
+	assert.Equal(t, "none", m.Capabilities("missing").String())
+}
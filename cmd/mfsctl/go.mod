@@ -0,0 +1,31 @@
+module go.linka.cloud/mfs/cmd/mfsctl
+
+go 1.23.2
+
+require (
+	github.com/stretchr/testify v1.10.0
+	go.linka.cloud/mfs v0.0.0-00010101000000-000000000000
+	go.linka.cloud/mfs/grpc v0.0.0-00010101000000-000000000000
+	go.linka.cloud/mfs/shell v0.0.0-00010101000000-000000000000
+	golang.org/x/term v0.28.0
+	google.golang.org/grpc v1.67.3
+)
+
+require (
+	github.com/andybalholm/brotli v1.1.1 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/klauspost/compress v1.17.11 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/net v0.34.0 // indirect
+	golang.org/x/sys v0.29.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20241209162323-e6fa225c2576 // indirect
+	google.golang.org/protobuf v1.35.2 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace (
+	go.linka.cloud/mfs => ../../
+	go.linka.cloud/mfs/grpc => ../../grpc
+	go.linka.cloud/mfs/shell => ../../shell
+)
@@ -0,0 +1,126 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command mfsctl browses and manages an MFS from the command line.
+//
+// Usage:
+//
+//	mfsctl shell -config path
+//	mfsctl shell -grpc address
+//
+// The shell command runs an interactive shell, see the shell package, over
+// the MFS described by a config file, watched for changes while the shell
+// runs, or over a remote MFS served over gRPC. When the standard input is
+// not a terminal, the commands are read from it line by line.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"golang.org/x/term"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"go.linka.cloud/mfs"
+	mfsgrpc "go.linka.cloud/mfs/grpc"
+	"go.linka.cloud/mfs/shell"
+)
+
+var errUsage = errors.New("usage: mfsctl shell -config path | -grpc address")
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	if err := run(ctx, os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "mfsctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, in *os.File, out io.Writer) error {
+	if len(args) == 0 || args[0] != "shell" {
+		return errUsage
+	}
+	flags := flag.NewFlagSet("shell", flag.ContinueOnError)
+	config := flags.String("config", "", "the config file describing the mounts")
+	addr := flags.String("grpc", "", "the address of a remote MFS served over gRPC")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	m, closeFn, err := open(ctx, *config, *addr)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+	return runShell(shell.New(m), in, out)
+}
+
+// open returns the MFS described by the config file or served at addr.
+func open(ctx context.Context, config, addr string) (mfs.MFS, func(), error) {
+	switch {
+	case config != "" && addr != "":
+		return nil, nil, errUsage
+	case config != "":
+		m, err := mfs.Serve(ctx, config)
+		if err != nil {
+			return nil, nil, err
+		}
+		return m, func() {}, nil
+	case addr != "":
+		conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return nil, nil, err
+		}
+		m := mfs.New()
+		if err := m.Mount("/", mfsgrpc.New(conn, mfsgrpc.WithContext(ctx))); err != nil {
+			_ = conn.Close()
+			return nil, nil, err
+		}
+		return m, func() { _ = conn.Close() }, nil
+	default:
+		return nil, nil, errUsage
+	}
+}
+
+// runShell runs s on the terminal in, with line editing and completion, or
+// executes the lines read from in when it is not a terminal.
+func runShell(s *shell.Shell, in *os.File, out io.Writer) error {
+	if term.IsTerminal(int(in.Fd())) {
+		state, err := term.MakeRaw(int(in.Fd()))
+		if err != nil {
+			return err
+		}
+		defer term.Restore(int(in.Fd()), state)
+		return s.Run(struct {
+			io.Reader
+			io.Writer
+		}{in, out})
+	}
+	sc := bufio.NewScanner(in)
+	for sc.Scan() {
+		if err := s.Exec(out, sc.Text()); errors.Is(err, shell.ErrExit) {
+			return nil
+		} else if err != nil {
+			fmt.Fprintf(out, "error: %v\n", err)
+		}
+	}
+	return sc.Err()
+}
@@ -0,0 +1,74 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	mfsgrpc "go.linka.cloud/mfs/grpc"
+)
+
+func input(t *testing.T, s string) *os.File {
+	p := filepath.Join(t.TempDir(), "input")
+	require.NoError(t, os.WriteFile(p, []byte(s), 0644))
+	f, err := os.Open(p)
+	require.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestShellConfig(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "foo"), []byte("bar"), 0644))
+	p := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(p, []byte(fmt.Sprintf(`{"mounts": [{"path": "data", "url": "file://%s"}]}`, dir)), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var out bytes.Buffer
+	require.NoError(t, run(ctx, []string{"shell", "-config", p}, input(t, "cd data\nls\ncat foo\nexit\nls\n"), &out))
+	assert.Equal(t, "foo\nbar", out.String())
+}
+
+func TestShellGRPC(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := grpc.NewServer()
+	mfsgrpc.RegisterFSServer(s, mfsgrpc.NewServer(fstest.MapFS{"foo": {Data: []byte("bar")}}))
+	go s.Serve(l)
+	defer s.Stop()
+
+	var out bytes.Buffer
+	require.NoError(t, run(context.Background(), []string{"shell", "-grpc", l.Addr().String()}, input(t, "cat /foo\nstat /missing\n"), &out))
+	assert.Contains(t, out.String(), "bar")
+	assert.Contains(t, out.String(), "error: ")
+}
+
+func TestShellUsage(t *testing.T) {
+	assert.ErrorIs(t, run(context.Background(), nil, nil, nil), errUsage)
+	assert.ErrorIs(t, run(context.Background(), []string{"shell"}, nil, nil), errUsage)
+	assert.ErrorIs(t, run(context.Background(), []string{"shell", "-config", "a", "-grpc", "b"}, nil, nil), errUsage)
+}
@@ -0,0 +1,305 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+const defaultPollInterval = 2 * time.Second
+
+// Config describes the mounts of an MFS. It is loaded from JSON documents
+// like:
+//
+//	{"mounts": [{"path": "/data", "url": "file:///srv/data", "decompress": true}]}
+type Config struct {
+	Mounts []MountConfig `json:"mounts"`
+}
+
+// MountConfig describes a mount, its file system being opened with OpenURL.
+type MountConfig struct {
+	Path       string `json:"path"`
+	URL        string `json:"url"`
+	Decompress bool   `json:"decompress,omitempty"`
+	RootInfo   bool   `json:"rootInfo,omitempty"`
+}
+
+func (c MountConfig) options() []MountOption {
+	var opts []MountOption
+	if c.Decompress {
+		opts = append(opts, WithDecompression())
+	}
+	if c.RootInfo {
+		opts = append(opts, WithRootInfo())
+	}
+	return opts
+}
+
+// LoadConfig reads the JSON config file at path.
+func LoadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfig(b)
+}
+
+func parseConfig(b []byte) (*Config, error) {
+	var c Config
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("mfs: config: %w", err)
+	}
+	seen := make(map[string]bool, len(c.Mounts))
+	for i, v := range c.Mounts {
+		if v.Path == "" || v.URL == "" {
+			return nil, fmt.Errorf("mfs: config: mount %d: path and url are required", i)
+		}
+		p := cleanMountPath(v.Path)
+		if seen[p] {
+			return nil, fmt.Errorf("mfs: config: duplicate mount %q", v.Path)
+		}
+		seen[p] = true
+	}
+	return &c, nil
+}
+
+// ConfigEventKind is the kind of a ConfigEvent.
+type ConfigEventKind int
+
+const (
+	// MountAdded is emitted when a mount is added to the config.
+	MountAdded ConfigEventKind = iota
+	// MountRemoved is emitted when a mount is removed from the config.
+	MountRemoved
+	// MountReplaced is emitted when the description of a mount changes.
+	MountReplaced
+	// ConfigFailed is emitted when the config cannot be loaded or applied,
+	// the mounts being left untouched.
+	ConfigFailed
+)
+
+func (k ConfigEventKind) String() string {
+	switch k {
+	case MountAdded:
+		return "added"
+	case MountRemoved:
+		return "removed"
+	case MountReplaced:
+		return "replaced"
+	case ConfigFailed:
+		return "failed"
+	default:
+		return fmt.Sprintf("ConfigEventKind(%d)", int(k))
+	}
+}
+
+// ConfigEvent describes a change applied by Serve.
+type ConfigEvent struct {
+	Kind ConfigEventKind
+	// Mount is the mount added, removed or replaced.
+	Mount MountConfig
+	// Err is the error of a ConfigFailed event.
+	Err error
+}
+
+// ServeOption configures Serve.
+type ServeOption func(o *serveOptions)
+
+type serveOptions struct {
+	interval time.Duration
+	events   func(ConfigEvent)
+	opts     []Option
+}
+
+// WithPollInterval sets how often the config file is checked for changes.
+// It defaults to 2 seconds.
+func WithPollInterval(d time.Duration) ServeOption {
+	return func(o *serveOptions) {
+		if d > 0 {
+			o.interval = d
+		}
+	}
+}
+
+// WithConfigEvents calls fn for every change applied from the config file.
+func WithConfigEvents(fn func(ConfigEvent)) ServeOption {
+	return func(o *serveOptions) {
+		o.events = fn
+	}
+}
+
+// WithOptions configures the MFS created by Serve.
+func WithOptions(opts ...Option) ServeOption {
+	return func(o *serveOptions) {
+		o.opts = append(o.opts, opts...)
+	}
+}
+
+// Serve returns an MFS with the mounts described by the config file at path,
+// see LoadConfig. The file is then watched until ctx is done: mounts added to,
+// removed from or changed in the config are applied atomically, in a single
+// mount table update. Files opened from replaced mounts fail with
+// ErrMountReplaced. Mounts not described by the config are left untouched.
+func Serve(ctx context.Context, path string, opts ...ServeOption) (MFS, error) {
+	o := &serveOptions{interval: defaultPollInterval, events: func(ConfigEvent) {}}
+	for _, v := range opts {
+		v(o)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := parseConfig(b)
+	if err != nil {
+		return nil, err
+	}
+	m := newMFS(o.opts...)
+	s := &configWatcher{m: m, o: o, path: path, current: make(map[string]MountConfig)}
+	if err := s.apply(c); err != nil {
+		return nil, err
+	}
+	s.last = b
+	go s.watch(ctx)
+	return m, nil
+}
+
+type configWatcher struct {
+	m    *mfs
+	o    *serveOptions
+	path string
+	last []byte
+	// current holds the applied mounts by mount path
+	current map[string]MountConfig
+}
+
+func (s *configWatcher) watch(ctx context.Context) {
+	t := time.NewTicker(s.o.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		b, err := os.ReadFile(s.path)
+		if err != nil {
+			s.o.events(ConfigEvent{Kind: ConfigFailed, Err: err})
+			continue
+		}
+		if bytes.Equal(b, s.last) {
+			continue
+		}
+		s.last = b
+		c, err := parseConfig(b)
+		if err == nil {
+			err = s.apply(c)
+		}
+		if err != nil {
+			s.o.events(ConfigEvent{Kind: ConfigFailed, Err: err})
+		}
+	}
+}
+
+// apply opens the file systems of the new and changed mounts, then swaps
+// them in the mount table together with the removals.
+func (s *configWatcher) apply(c *Config) error {
+	var events []ConfigEvent
+	next := make(map[string]MountConfig, len(c.Mounts))
+	mounts := make(map[string]*mount)
+	for _, v := range c.Mounts {
+		p := s.m.mountPath(v.Path)
+		next[p] = v
+		kind := MountAdded
+		if old, ok := s.current[p]; ok {
+			if old == v {
+				continue
+			}
+			kind = MountReplaced
+		}
+		f, err := OpenURL(v.URL)
+		if err != nil {
+			release(mounts)
+			return &fs.PathError{Op: "mount", Path: v.Path, Err: err}
+		}
+		opts := v.options()
+		if c, ok := f.(io.Closer); ok {
+			opts = append(opts, withCloser(c))
+		}
+		mounts[p] = newMount(p, s.m.newMountOptions(opts...), f)
+		events = append(events, ConfigEvent{Kind: kind, Mount: v})
+	}
+	for p, v := range s.current {
+		if _, ok := next[p]; !ok {
+			events = append(events, ConfigEvent{Kind: MountRemoved, Mount: v})
+		}
+	}
+	var replaced []*mount
+	err := s.m.updateAll(func(t *table) (removed, added []*mount, err error) {
+		for p := range s.current {
+			if _, ok := next[p]; ok {
+				continue
+			}
+			if old, ok := t.mounts[p]; ok {
+				delete(t.mounts, p)
+				removed = append(removed, old)
+			}
+		}
+		for p, mnt := range mounts {
+			old, ok := t.mounts[p]
+			if ok && !s.managed(p) {
+				return nil, nil, &fs.PathError{Op: "mount", Path: p, Err: fs.ErrExist}
+			}
+			if ok {
+				removed = append(removed, old)
+				replaced = append(replaced, old)
+			}
+			added = append(added, t.set(mnt))
+		}
+		return removed, added, nil
+	})
+	if err != nil {
+		release(mounts)
+		return err
+	}
+	for _, v := range replaced {
+		v.handles.invalidate()
+	}
+	s.current = next
+	for _, v := range events {
+		s.o.events(v)
+	}
+	return nil
+}
+
+// release closes the backends opened for mounts which were not mounted.
+func release(mounts map[string]*mount) {
+	for _, v := range mounts {
+		for _, b := range v.backends {
+			_ = b.c.Close()
+		}
+	}
+}
+
+func (s *configWatcher) managed(path string) bool {
+	_, ok := s.current[path]
+	return ok
+}
@@ -0,0 +1,127 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(p, []byte(`{"mounts": [{"path": "/data", "url": "file:///srv", "decompress": true}]}`), 0644))
+	c, err := LoadConfig(p)
+	require.NoError(t, err)
+	assert.Equal(t, []MountConfig{{Path: "/data", URL: "file:///srv", Decompress: true}}, c.Mounts)
+
+	for _, v := range []string{
+		`{"mounts": [{"path": "/data"}]}`,
+		`{"mounts": [{"path": "/data", "url": "file:///a"}, {"path": "/data/", "url": "file:///b"}]}`,
+		`{"mounts": `,
+	} {
+		require.NoError(t, os.WriteFile(p, []byte(v), 0644))
+		_, err := LoadConfig(p)
+		assert.Error(t, err, v)
+	}
+}
+
+func TestServe(t *testing.T) {
+	tmp := t.TempDir()
+	dirs := make(map[string]string)
+	for _, v := range []string{"foo", "baz", "quux"} {
+		dirs[v] = filepath.Join(tmp, v)
+		require.NoError(t, os.Mkdir(dirs[v], 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dirs[v], "file"), data[v], 0644))
+	}
+	p := filepath.Join(tmp, "config.json")
+	// renamed into place so that the watcher never reads a partial file
+	writeFile := func(b []byte) {
+		require.NoError(t, os.WriteFile(p+".tmp", b, 0644))
+		require.NoError(t, os.Rename(p+".tmp", p))
+	}
+	write := func(mounts ...string) {
+		s := `{"mounts": [`
+		for i := 0; i < len(mounts); i += 2 {
+			if i > 0 {
+				s += ","
+			}
+			s += fmt.Sprintf(`{"path": %q, "url": "file://%s"}`, mounts[i], dirs[mounts[i+1]])
+		}
+		writeFile([]byte(s + "]}"))
+	}
+	write("a", "foo")
+
+	events := make(chan ConfigEvent, 16)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m, err := Serve(ctx, p, WithPollInterval(5*time.Millisecond), WithConfigEvents(func(e ConfigEvent) { events <- e }))
+	require.NoError(t, err)
+	next := func() ConfigEvent {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for config event")
+			return ConfigEvent{}
+		}
+	}
+	assert.Equal(t, MountAdded, next().Kind)
+	b, err := fs.ReadFile(m, "a/file")
+	require.NoError(t, err)
+	assert.Equal(t, data["foo"], b)
+
+	f, err := m.Open("a/file")
+	require.NoError(t, err)
+	write("a", "baz", "b", "quux")
+	got := map[ConfigEventKind]string{}
+	for i := 0; i < 2; i++ {
+		e := next()
+		got[e.Kind] = e.Mount.Path
+	}
+	assert.Equal(t, map[ConfigEventKind]string{MountReplaced: "a", MountAdded: "b"}, got)
+	_, err = f.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, ErrMountReplaced)
+	b, err = fs.ReadFile(m, "a/file")
+	require.NoError(t, err)
+	assert.Equal(t, data["baz"], b)
+
+	write("b", "quux")
+	e := next()
+	assert.Equal(t, MountRemoved, e.Kind)
+	assert.Equal(t, "a", e.Mount.Path)
+	_, err = fs.Stat(m, "a/file")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	require.NoError(t, m.Mount("manual", fstest.MapFS{}))
+	write("b", "quux", "manual", "foo")
+	e = next()
+	assert.Equal(t, ConfigFailed, e.Kind)
+	assert.ErrorIs(t, e.Err, fs.ErrExist)
+
+	writeFile([]byte("{"))
+	assert.Equal(t, ConfigFailed, next().Kind)
+	b, err = fs.ReadFile(m, "b/file")
+	require.NoError(t, err)
+	assert.Equal(t, data["quux"], b)
+}
@@ -0,0 +1,98 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// WithContentTypes overrides the content types of the mount files reported
+// by ContentType, by extension, e.g. {".md": "text/markdown; charset=utf-8"}.
+// The extensions are matched case-insensitively.
+func WithContentTypes(types map[string]string) MountOption {
+	return func(o *mountOptions) {
+		if o.contentTypes == nil {
+			o.contentTypes = make(map[string]string, len(types))
+		}
+		for k, v := range types {
+			if !strings.HasPrefix(k, ".") {
+				k = "." + k
+			}
+			o.contentTypes[strings.ToLower(k)] = v
+		}
+	}
+}
+
+// ContentType returns the content type of the regular file name: the one
+// set for its extension by WithContentTypes on its mount, the one
+// registered for its extension in the mime package, or the one detected
+// from its first 512 bytes with http.DetectContentType otherwise. The HTTP
+// and REST servers report it.
+func ContentType(m MFS, name string) (string, error) {
+	if ct := typeByName(m, name); ct != "" {
+		return ct, nil
+	}
+	f, err := m.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	i, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if !i.Mode().IsRegular() {
+		return "", &fs.PathError{Op: "contenttype", Path: name, Err: fs.ErrInvalid}
+	}
+	b := make([]byte, 512)
+	n, err := io.ReadFull(f, b)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return http.DetectContentType(b[:n]), nil
+}
+
+// typeByName returns the content type of name given by its extension, or ""
+// when it is unknown and the content must be sniffed.
+func typeByName(fsys fs.FS, name string) string {
+	ext := path.Ext(name)
+	if ext == "" {
+		return ""
+	}
+	if m, ok := fsys.(*mfs); ok {
+		if mnt, _, err := m.lookupPath("contenttype", name); err == nil {
+			if ct, ok := mnt.opts.contentTypes[strings.ToLower(ext)]; ok {
+				return ct
+			}
+		}
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// setContentType sets the Content-Type header when the type of name is
+// known from its extension, the servers sniffing the content otherwise.
+func setContentType(w http.ResponseWriter, fsys fs.FS, name string) {
+	if w.Header().Get("Content-Type") != "" {
+		return
+	}
+	if ct := typeByName(fsys, name); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentType(t *testing.T) {
+	backend := fstest.MapFS{
+		"README.md":  {Data: []byte("# readme")},
+		"index.html": {Data: []byte("<html></html>")},
+		"data":       {Data: []byte("\x89PNG\r\n\x1a\n")},
+		"notes":      {Data: []byte("some text")},
+		"dir/a.md":   {Data: []byte("a")},
+		"page.TPL":   {Data: []byte("{{ . }}")},
+	}
+	m, err := Mount("docs", backend, WithContentTypes(map[string]string{"MD": "text/markdown; charset=utf-8", ".tpl": "text/x-template"}))
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("other", backend))
+
+	for name, want := range map[string]string{
+		"docs/README.md":   "text/markdown; charset=utf-8",
+		"docs/dir/a.md":    "text/markdown; charset=utf-8",
+		"docs/index.html":  "text/html; charset=utf-8",
+		"docs/data":        "image/png",
+		"docs/notes":       "text/plain; charset=utf-8",
+		"other/index.html": "text/html; charset=utf-8",
+	} {
+		ct, err := ContentType(m, name)
+		require.NoError(t, err, name)
+		assert.Equal(t, want, ct, name)
+	}
+	ct, err := ContentType(m, "other/page.TPL")
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", ct)
+
+	_, err = ContentType(m, "docs/missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = ContentType(m, "docs/dir")
+	assert.ErrorIs(t, err, fs.ErrInvalid)
+
+	for _, h := range []http.Handler{
+		FileServer(m),
+		APIHandler(m),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { ServeFile(w, r, m, r.URL.Path[1:]) }),
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs/README.md", nil))
+		assert.Equal(t, "text/markdown; charset=utf-8", w.Result().Header.Get("Content-Type"))
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs/data", nil))
+		assert.Equal(t, "image/png", w.Result().Header.Get("Content-Type"))
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// CopyOption configures Copy.
+type CopyOption func(o *copyOptions)
+
+type copyOptions struct {
+	progress func(path string, written int64)
+}
+
+// WithProgress calls fn as the content of each file is written to its
+// destination path, with the number of bytes written so far.
+func WithProgress(fn func(path string, written int64)) CopyOption {
+	return func(o *copyOptions) {
+		o.progress = fn
+	}
+}
+
+// Copy copies the file or directory tree src to dst. Both paths can belong
+// to different mounts. File contents are streamed when the destination
+// supports OpenFile. Modes are preserved, as are modification times when
+// the destination supports them.
+func Copy(m MFS, src, dst string, opts ...CopyOption) error {
+	o := &copyOptions{}
+	for _, v := range opts {
+		v(o)
+	}
+	src, dst = cleanPath(src), cleanPath(dst)
+	s, err := fs.Stat(m, src)
+	if err != nil {
+		return err
+	}
+	if !s.IsDir() {
+		return copyFile(m, src, dst, s, o)
+	}
+	if dst == src || strings.HasPrefix(dst, src+"/") {
+		return &fs.PathError{Op: "copy", Path: dst, Err: fs.ErrInvalid}
+	}
+	var dirs []string
+	err = WalkDir(m, src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := dst + strings.TrimPrefix(p, src)
+		i, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			dirs = append(dirs, p)
+			return m.MkdirAll(target, i.Mode().Perm())
+		case d.Type().IsRegular():
+			return copyFile(m, p, target, i, o)
+		default:
+			return nil
+		}
+	})
+	if err != nil {
+		return err
+	}
+	// directories modification times change as their content is written
+	for i := len(dirs) - 1; i >= 0; i-- {
+		s, err := fs.Stat(m, dirs[i])
+		if err != nil {
+			return err
+		}
+		chtimes(m, dst+strings.TrimPrefix(dirs[i], src), s)
+	}
+	return nil
+}
+
+func chtimes(m fs.FS, name string, s fs.FileInfo) {
+	if c, ok := m.(ChtimesFS); ok {
+		_ = c.Chtimes(name, s.ModTime(), s.ModTime())
+	}
+}
+
+func copyFile(m MFS, src, dst string, s fs.FileInfo, o *copyOptions) error {
+	in, err := m.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	var r io.Reader = in
+	if o.progress != nil {
+		r = &progressReader{r: in, fn: func(n int64) { o.progress(dst, n) }}
+	}
+	if err := writeFrom(m, dst, r, s.Mode().Perm()); err != nil {
+		return err
+	}
+	chtimes(m, dst, s)
+	return nil
+}
+
+// writeFrom writes the content of r to name, streaming it when m supports
+// OpenFile.
+func writeFrom(m WritableMFS, name string, r io.Reader, perm fs.FileMode) error {
+	out, err := m.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	switch {
+	case errors.Is(err, errors.ErrUnsupported):
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return m.WriteFile(name, b, perm)
+	case err != nil:
+		return err
+	default:
+		w, ok := out.(io.Writer)
+		if !ok {
+			out.Close()
+			return &fs.PathError{Op: "write", Path: name, Err: errors.ErrUnsupported}
+		}
+		if _, err := io.Copy(w, r); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	}
+}
+
+type progressReader struct {
+	r  io.Reader
+	n  int64
+	fn func(n int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.n += int64(n)
+		p.fn(p.n)
+	}
+	return n, err
+}
@@ -0,0 +1,61 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/psanford/memfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopy(t *testing.T) {
+	src := fstest.MapFS{
+		"foo":       {Data: data["foo"], Mode: 0600},
+		"dir/baz":   {Data: data["baz"], Mode: 0644},
+		"dir/a/b/c": {Data: data["quux"], Mode: 0644},
+	}
+	dst := NewMemFS()
+	m, err := Mount("src", src)
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("dst", dst))
+	// psanford/memfs only supports WriteFile
+	require.NoError(t, m.Mount("other", memfs.New()))
+
+	progress := make(map[string]int64)
+	require.NoError(t, Copy(m, "src", "dst/copy", WithProgress(func(p string, n int64) {
+		progress[p] = n
+	})))
+	for k, v := range src {
+		b, err := fs.ReadFile(dst, "copy/"+k)
+		require.NoError(t, err)
+		assert.Equal(t, v.Data, b)
+		s, err := dst.Stat("copy/" + k)
+		require.NoError(t, err)
+		assert.Equal(t, v.Mode, s.Mode())
+		assert.EqualValues(t, len(v.Data), progress["dst/copy/"+k])
+	}
+
+	require.NoError(t, Copy(m, "src/foo", "other/foo"))
+	b, err := fs.ReadFile(m, "other/foo")
+	require.NoError(t, err)
+	assert.Equal(t, data["foo"], b)
+
+	assert.ErrorIs(t, Copy(m, "dst/copy", "dst/copy/nested"), fs.ErrInvalid)
+	assert.ErrorIs(t, Copy(m, "src/nope", "dst/nope"), fs.ErrNotExist)
+}
@@ -0,0 +1,367 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crypt provides a file system wrapper storing the file contents
+// encrypted at rest.
+//
+// Each file is sealed as a whole with an AEAD, using a random nonce stored
+// in front of the ciphertext, after the version of the format:
+//
+//	version || nonce || aead.Seal(plaintext, version || name)
+//
+// The version and the name of the file are authenticated, so that a file
+// cannot be swapped with another one of the same file system unnoticed.
+package crypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// ErrDecrypt is returned when a file cannot be authenticated and decrypted.
+var ErrDecrypt = errors.New("crypt: message authentication failed")
+
+// version is the version of the format of the encrypted files.
+const version = 1
+
+func additionalData(name string) []byte {
+	return append([]byte{version}, name...)
+}
+
+// NewGCM returns an AES-GCM AEAD for the given 16, 24 or 32 bytes key.
+func NewGCM(key []byte) (cipher.AEAD, error) {
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(b)
+}
+
+// Encrypt seals plaintext, the content of the file name, with a fresh random
+// nonce in the format expected by the file system returned by New.
+func Encrypt(aead cipher.AEAD, name string, plaintext []byte) ([]byte, error) {
+	out := make([]byte, 1+aead.NonceSize(), 1+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	out[0] = version
+	nonce := out[1:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(out, nonce, plaintext, additionalData(name)), nil
+}
+
+// Decrypt opens a ciphertext produced by Encrypt for the file name.
+func Decrypt(aead cipher.AEAD, name string, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < 1+aead.NonceSize()+aead.Overhead() || ciphertext[0] != version {
+		return nil, ErrDecrypt
+	}
+	nonce, b := ciphertext[1:1+aead.NonceSize()], ciphertext[1+aead.NonceSize():]
+	p, err := aead.Open(nil, nonce, b, additionalData(name))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return p, nil
+}
+
+// New returns a file system decrypting the files of fsys on read.
+// If fsys supports WriteFile, the returned file system does too, encrypting
+// the data before handing it to fsys, and supports OpenFile, MkdirAll,
+// Remove, RemoveAll and Rename when fsys does, see writableCryptFS.
+func New(fsys fs.FS, aead cipher.AEAD) fs.FS {
+	c := &cryptFS{fsys: fsys, aead: aead}
+	if _, ok := fsys.(writeFileFS); ok {
+		return &writableCryptFS{cryptFS: c}
+	}
+	return c
+}
+
+type writeFileFS interface {
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+}
+
+type mkdirAllFS interface {
+	MkdirAll(name string, perm fs.FileMode) error
+}
+
+type removeFS interface {
+	Remove(name string) error
+}
+
+type removeAllFS interface {
+	RemoveAll(name string) error
+}
+
+func unsupported(op, name string) error {
+	return &fs.PathError{Op: op, Path: name, Err: errors.ErrUnsupported}
+}
+
+type cryptFS struct {
+	fsys fs.FS
+	aead cipher.AEAD
+}
+
+func (c *cryptFS) plainSize(size int64) int64 {
+	return max(0, size-int64(1+c.aead.NonceSize()+c.aead.Overhead()))
+}
+
+func (c *cryptFS) Open(name string) (fs.File, error) {
+	f, err := c.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	s, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !s.Mode().IsRegular() {
+		return f, nil
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	p, err := Decrypt(c.aead, name, b)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &file{Reader: bytes.NewReader(p), info: &info{FileInfo: s, size: int64(len(p))}}, nil
+}
+
+func (c *cryptFS) Stat(name string) (fs.FileInfo, error) {
+	s, err := fs.Stat(c.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if !s.Mode().IsRegular() {
+		return s, nil
+	}
+	return &info{FileInfo: s, size: c.plainSize(s.Size())}, nil
+}
+
+func (c *cryptFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	ds, err := fs.ReadDir(c.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range ds {
+		if v.Type().IsRegular() {
+			ds[i] = &entry{DirEntry: v, c: c}
+		}
+	}
+	return ds, nil
+}
+
+// writableCryptFS writes the files as a whole: the files opened for writing
+// are buffered in memory and encrypted when closed. The renames decrypt and
+// encrypt the files again under their new name, the directories cannot be
+// renamed.
+type writableCryptFS struct {
+	*cryptFS
+}
+
+func (c *writableCryptFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	b, err := Encrypt(c.aead, name, data)
+	if err != nil {
+		return err
+	}
+	return c.fsys.(writeFileFS).WriteFile(name, b, perm)
+}
+
+func (c *writableCryptFS) OpenFile(name string, flag int, perm fs.FileMode) (fs.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) == 0 {
+		return c.Open(name)
+	}
+	var data []byte
+	b, err := fs.ReadFile(c.cryptFS, name)
+	switch {
+	case err == nil:
+		if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+		}
+		if flag&os.O_TRUNC == 0 {
+			data = b
+		}
+	case errors.Is(err, fs.ErrNotExist) && flag&os.O_CREATE != 0:
+		// the file exists once opened
+		if err := c.WriteFile(name, nil, perm); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+	s, err := fs.Stat(c.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	f := &writeFile{c: c, name: name, flag: flag, data: data, info: &info{FileInfo: s}}
+	if flag&os.O_APPEND != 0 {
+		f.off = int64(len(data))
+	}
+	return f, nil
+}
+
+func (c *writableCryptFS) MkdirAll(name string, perm fs.FileMode) error {
+	w, ok := c.fsys.(mkdirAllFS)
+	if !ok {
+		return unsupported("mkdir", name)
+	}
+	return w.MkdirAll(name, perm)
+}
+
+func (c *writableCryptFS) Remove(name string) error {
+	w, ok := c.fsys.(removeFS)
+	if !ok {
+		return unsupported("remove", name)
+	}
+	return w.Remove(name)
+}
+
+func (c *writableCryptFS) RemoveAll(name string) error {
+	w, ok := c.fsys.(removeAllFS)
+	if !ok {
+		return unsupported("removeall", name)
+	}
+	return w.RemoveAll(name)
+}
+
+// Rename writes the file encrypted for newname before removing oldname, the
+// name of the files being authenticated.
+func (c *writableCryptFS) Rename(oldname, newname string) error {
+	w, ok := c.fsys.(removeFS)
+	if !ok {
+		return unsupported("rename", oldname)
+	}
+	s, err := fs.Stat(c.fsys, oldname)
+	if err != nil {
+		return err
+	}
+	if !s.Mode().IsRegular() {
+		return unsupported("rename", oldname)
+	}
+	b, err := fs.ReadFile(c.cryptFS, oldname)
+	if err != nil {
+		return err
+	}
+	if err := c.WriteFile(newname, b, s.Mode().Perm()); err != nil {
+		return err
+	}
+	return w.Remove(oldname)
+}
+
+// writeFile is a file opened for writing, encrypted and written when closed.
+type writeFile struct {
+	c      *writableCryptFS
+	name   string
+	flag   int
+	data   []byte
+	off    int64
+	info   *info
+	closed bool
+}
+
+func (f *writeFile) Stat() (fs.FileInfo, error) {
+	f.info.size = int64(len(f.data))
+	return f.info, nil
+}
+
+func (f *writeFile) Read(b []byte) (int, error) {
+	if f.flag&os.O_RDWR == 0 {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrPermission}
+	}
+	if f.off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(b, f.data[f.off:])
+	f.off += int64(n)
+	return n, nil
+}
+
+func (f *writeFile) Write(b []byte) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrClosed}
+	}
+	if f.flag&os.O_APPEND != 0 {
+		f.off = int64(len(f.data))
+	}
+	if end := f.off + int64(len(b)); end > int64(len(f.data)) {
+		f.data = append(f.data, make([]byte, end-int64(len(f.data)))...)
+	}
+	n := copy(f.data[f.off:], b)
+	f.off += int64(n)
+	return n, nil
+}
+
+func (f *writeFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += int64(len(f.data))
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *writeFile) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	return f.c.WriteFile(f.name, f.data, f.info.Mode().Perm())
+}
+
+type entry struct {
+	fs.DirEntry
+	c *cryptFS
+}
+
+func (e *entry) Info() (fs.FileInfo, error) {
+	s, err := e.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return &info{FileInfo: s, size: e.c.plainSize(s.Size())}, nil
+}
+
+type info struct {
+	fs.FileInfo
+	size int64
+}
+
+func (i *info) Size() int64 {
+	return i.size
+}
+
+type file struct {
+	*bytes.Reader
+	info *info
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *file) Close() error {
+	return nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/psanford/memfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.linka.cloud/mfs"
+)
+
+func TestCrypt(t *testing.T) {
+	aead, err := NewGCM(bytes.Repeat([]byte{42}, 32))
+	require.NoError(t, err)
+
+	backend := memfs.New()
+	require.NoError(t, backend.MkdirAll("secrets", 0700))
+	c := New(backend, aead)
+	w, ok := c.(interface {
+		WriteFile(string, []byte, fs.FileMode) error
+	})
+	require.True(t, ok)
+	require.NoError(t, w.WriteFile("secrets/token", []byte("s3cr3t"), 0600))
+	require.NoError(t, backend.WriteFile("secrets/corrupted", []byte("garbage"), 0600))
+
+	raw, err := fs.ReadFile(backend, "secrets/token")
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "s3cr3t")
+
+	m, err := mfs.Mount("etc", c)
+	require.NoError(t, err)
+	b, err := fs.ReadFile(m, "etc/secrets/token")
+	require.NoError(t, err)
+	assert.Equal(t, "s3cr3t", string(b))
+
+	s, err := fs.Stat(c, "secrets/token")
+	require.NoError(t, err)
+	assert.EqualValues(t, 6, s.Size())
+
+	d, err := fs.ReadDir(c, "secrets")
+	require.NoError(t, err)
+	require.Len(t, d, 2)
+	i, err := d[1].Info()
+	require.NoError(t, err)
+	assert.EqualValues(t, 6, i.Size())
+
+	_, err = c.Open("secrets/corrupted")
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	// the files cannot be swapped
+	require.NoError(t, backend.WriteFile("secrets/swapped", raw, 0600))
+	_, err = c.Open("secrets/swapped")
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	ro := New(readOnlyFS{backend}, aead)
+	_, ok = ro.(interface {
+		WriteFile(string, []byte, fs.FileMode) error
+	})
+	assert.False(t, ok)
+}
+
+type readOnlyFS struct {
+	fs.FS
+}
+
+func TestCryptWrites(t *testing.T) {
+	aead, err := NewGCM(bytes.Repeat([]byte{42}, 32))
+	require.NoError(t, err)
+	m, err := mfs.Mount("etc", New(mfs.NewMemFS(), aead))
+	require.NoError(t, err)
+	read := func(name string) string {
+		b, err := fs.ReadFile(m, name)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	require.NoError(t, m.MkdirAll("etc/secrets", 0700))
+	f, err := m.OpenFile("etc/secrets/token", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	require.NoError(t, err)
+	_, err = f.(io.Writer).Write([]byte("s3cr3t"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	assert.Equal(t, "s3cr3t", read("etc/secrets/token"))
+
+	f, err = m.OpenFile("etc/secrets/token", os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.(io.Writer).Write([]byte("!"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	assert.Equal(t, "s3cr3t!", read("etc/secrets/token"))
+	_, err = m.OpenFile("etc/secrets/token", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	assert.ErrorIs(t, err, fs.ErrExist)
+
+	require.NoError(t, m.Rename("etc/secrets/token", "etc/secrets/renamed"))
+	assert.Equal(t, "s3cr3t!", read("etc/secrets/renamed"))
+	_, err = fs.Stat(m, "etc/secrets/token")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.ErrorIs(t, m.Rename("etc/secrets", "etc/other"), errors.ErrUnsupported)
+
+	require.NoError(t, m.Remove("etc/secrets/renamed"))
+	require.NoError(t, m.RemoveAll("etc/secrets"))
+	_, err = fs.Stat(m, "etc/secrets")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
@@ -0,0 +1,187 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxRecentErrors = 16
+
+// StatsReporter is implemented by file systems exposing statistics, e.g.
+// caches reporting their hit ratio, which are rendered by DebugHandler.
+type StatsReporter interface {
+	Stats() map[string]any
+}
+
+// MountStatus describes the state of a mount, as rendered by DebugHandler.
+type MountStatus struct {
+	Path      string    `json:"path"`
+	MountedAt time.Time `json:"mountedAt"`
+	// Types are the Go types of the mounted file system and of its layers.
+	Types       []string       `json:"types"`
+	Healthy     bool           `json:"healthy"`
+	HealthError string         `json:"healthError,omitempty"`
+	Stats       map[string]any `json:"stats,omitempty"`
+	// Cache are the statistics of the cache configured with WithCache.
+	Cache *CacheStats `json:"cache,omitempty"`
+	// ErrorStats counts the errors returned by the mount during about the
+	// last minute.
+	ErrorStats ErrorStats `json:"errorStats"`
+	// Errors are the most recent errors returned by the mount, the oldest
+	// first. Missing files are not recorded.
+	Errors []ErrorRecord `json:"errors,omitempty"`
+}
+
+// ErrorRecord is an error returned by a mount.
+type ErrorRecord struct {
+	Time  time.Time `json:"time"`
+	Op    string    `json:"op"`
+	Path  string    `json:"path"`
+	Error string    `json:"error"`
+}
+
+// errorLog keeps the most recent errors of a mount.
+type errorLog struct {
+	mu   sync.Mutex
+	errs []ErrorRecord
+}
+
+func (l *errorLog) add(op, name string, err error) {
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.errs) == maxRecentErrors {
+		l.errs = append(l.errs[:0], l.errs[1:]...)
+	}
+	l.errs = append(l.errs, ErrorRecord{Time: time.Now(), Op: op, Path: name, Error: err.Error()})
+}
+
+func (l *errorLog) list() []ErrorRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]ErrorRecord(nil), l.errs...)
+}
+
+func (mnt *mount) status() MountStatus {
+	s := MountStatus{Path: mnt.path, MountedAt: mnt.mountedAt, Healthy: true, ErrorStats: mnt.rates.stats(), Errors: mnt.errs.list()}
+	if h := mnt.health.Load(); h != nil && h.err != nil {
+		s.Healthy, s.HealthError = false, h.err.Error()
+	}
+	if mnt.cache != nil {
+		c := mnt.cache.stats()
+		s.Cache = &c
+	}
+	fss := append([]fs.FS{mnt.fs}, mnt.layers...)
+	if len(mnt.layers) == 1 && !mnt.opts.wraps() {
+		fss = fss[:1]
+	}
+	for _, v := range fss {
+		s.Types = append(s.Types, fmt.Sprintf("%T", v))
+		r, ok := v.(StatsReporter)
+		if !ok {
+			continue
+		}
+		for k, v := range r.Stats() {
+			if s.Stats == nil {
+				s.Stats = make(map[string]any)
+			}
+			if _, ok := s.Stats[k]; !ok {
+				s.Stats[k] = v
+			}
+		}
+	}
+	return s
+}
+
+func (m *mfs) Mounts() []MountInfo {
+	t := m.load()
+	out := make([]MountInfo, 0, len(t.mounts))
+	for _, v := range t.mounts {
+		out = append(out, v.info())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+func (m *mfs) status() []MountStatus {
+	t := m.load()
+	out := make([]MountStatus, 0, len(t.mounts))
+	for _, v := range t.mounts {
+		out = append(out, v.status())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+// DebugHandler returns a handler rendering the mount table of m, usually
+// registered under /debug/mfs: the mounts, their types, last health status,
+// statistics and recent errors. It renders HTML, or JSON when the format
+// query parameter is "json" or the request accepts application/json.
+//
+// The health status is the one recorded by the last Health call, the handler
+// does not check the mounts itself.
+func DebugHandler(m MFS) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, ok := m.(*mfs)
+		if !ok {
+			http.Error(w, "mfs: unsupported MFS implementation", http.StatusNotImplemented)
+			return
+		}
+		mounts := s.status()
+		if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			enc.Encode(mounts)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		debugPage.Execute(w, mounts)
+	})
+}
+
+var debugPage = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html>
+<head><title>mfs</title></head>
+<body>
+<h1>Mounts</h1>
+<table border="1" cellpadding="4">
+<tr><th>Path</th><th>Types</th><th>Mounted at</th><th>Health</th><th>Stats</th><th>Cache</th><th>Errors (last minute)</th><th>Recent errors</th></tr>
+{{ range . }}<tr>
+<td>{{ .Path }}</td>
+<td>{{ range .Types }}{{ . }}<br>{{ end }}</td>
+<td>{{ .MountedAt.Format "2006-01-02 15:04:05" }}</td>
+<td>{{ if .Healthy }}ok{{ else }}{{ .HealthError }}{{ end }}</td>
+<td>{{ range $k, $v := .Stats }}{{ $k }}: {{ $v }}<br>{{ end }}</td>
+<td>{{ with .Cache }}entries: {{ .Entries }}<br>bytes: {{ .Bytes }}<br>hits: {{ .Hits }}<br>stale hits: {{ .StaleHits }}<br>misses: {{ .Misses }}<br>evictions: {{ .Evictions }}{{ end }}</td>
+<td>{{ range $k, $v := .ErrorStats.Classes }}{{ $k }}: {{ $v }}<br>{{ end }}</td>
+<td>{{ range .Errors }}{{ .Time.Format "15:04:05" }} {{ .Op }} {{ .Path }}: {{ .Error }}<br>{{ end }}</td>
+</tr>
+{{ end }}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,94 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type statsFS struct {
+	fstest.MapFS
+}
+
+func (statsFS) Stats() map[string]any {
+	return map[string]any{"hits": 42}
+}
+
+type brokenFS struct{}
+
+func (brokenFS) Open(name string) (fs.File, error) {
+	return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("broken")}
+}
+
+func (brokenFS) Health(context.Context) error {
+	return errors.New("down")
+}
+
+func TestDebugHandler(t *testing.T) {
+	m, err := Mount("cache", statsFS{fstest.MapFS{"foo": {Data: data["foo"]}}})
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("broken", brokenFS{}))
+	m.Health(context.Background())
+	_, err = m.Open("broken/foo")
+	require.Error(t, err)
+	_, err = m.Open("cache/missing")
+	require.Error(t, err)
+
+	var paths []string
+	for _, v := range m.Mounts() {
+		paths = append(paths, v.Path)
+	}
+	assert.Equal(t, []string{"broken", "cache"}, paths)
+
+	h := DebugHandler(m)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/mfs?format=json", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var mounts []MountStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &mounts))
+	require.Len(t, mounts, 2)
+
+	assert.Equal(t, "broken", mounts[0].Path)
+	assert.False(t, mounts[0].Healthy)
+	assert.Equal(t, "down", mounts[0].HealthError)
+	assert.Equal(t, []string{"mfs.brokenFS"}, mounts[0].Types)
+	require.Len(t, mounts[0].Errors, 1)
+	assert.Equal(t, "broken/foo", mounts[0].Errors[0].Path)
+	assert.Equal(t, "broken", mounts[0].Errors[0].Error)
+
+	assert.Equal(t, "cache", mounts[1].Path)
+	assert.True(t, mounts[1].Healthy)
+	assert.EqualValues(t, 42, mounts[1].Stats["hits"])
+	assert.Empty(t, mounts[1].Errors)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/mfs", nil))
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	b, err := io.ReadAll(w.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "<td>broken</td>")
+	assert.Contains(t, string(b), "hits: 42")
+}
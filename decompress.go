@@ -0,0 +1,213 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+type decompressor struct {
+	ext string
+	new func(r io.Reader) (io.Reader, error)
+}
+
+var decompressors = []decompressor{
+	{".gz", func(r io.Reader) (io.Reader, error) {
+		return gzip.NewReader(r)
+	}},
+	{".br", func(r io.Reader) (io.Reader, error) {
+		return brotli.NewReader(r), nil
+	}},
+	{".zst", func(r io.Reader) (io.Reader, error) {
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}},
+}
+
+// Decompress returns a file system exposing the files compressed with gzip
+// (.gz), brotli (.br) or zstd (.zst) under their uncompressed name when no
+// file exists with that name. The compressed files remain accessible. The
+// uncompressed size is computed by reading the file the first time it is
+// needed and remembered until the file changes. The write operations are
+// forwarded as is: a file written under the uncompressed name shadows the
+// compressed one.
+func Decompress(fsys fs.FS) fs.FS {
+	d := &decompressFS{}
+	d.forwardFS = forwardFS{fsys: fsys, readDir: d.ReadDir, event: d.event}
+	return d
+}
+
+type decompressFS struct {
+	forwardFS
+	sizes sizeCache
+}
+
+// components returns the wrapped file system, see Topology.
+func (d *decompressFS) components() []fs.FS {
+	return []fs.FS{d.fsys}
+}
+
+func (d *decompressFS) Open(name string) (fs.File, error) {
+	f, err := d.fsys.Open(name)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) || name == "." {
+		return f, err
+	}
+	for _, c := range decompressors {
+		cf, cerr := d.fsys.Open(name + c.ext)
+		if cerr != nil {
+			continue
+		}
+		s, cerr := cf.Stat()
+		if cerr != nil || !s.Mode().IsRegular() {
+			cf.Close()
+			continue
+		}
+		r, cerr := c.new(cf)
+		if cerr != nil {
+			cf.Close()
+			return nil, &fs.PathError{Op: "open", Path: name, Err: cerr}
+		}
+		return &transformFile{File: cf, r: r, name: path.Base(name), sizes: &d.sizes, path: name}, nil
+	}
+	return nil, err
+}
+
+// compressed reports whether a compressed file exposes name.
+func (d *decompressFS) compressed(name string) bool {
+	for _, c := range decompressors {
+		if s, err := fs.Stat(d.fsys, name+c.ext); err == nil && s.Mode().IsRegular() {
+			return true
+		}
+	}
+	return false
+}
+
+// event notifies the changes of the compressed files under their
+// uncompressed name too when they expose it, the files removed while a
+// compressed one still exposes them being changed rather than removed.
+func (d *decompressFS) event(e WatchEvent) []WatchEvent {
+	if e.Removed && d.compressed(e.Path) {
+		e.Removed = false
+	}
+	res := []WatchEvent{e}
+	for _, c := range decompressors {
+		n, ok := strings.CutSuffix(e.Path, c.ext)
+		if !ok || path.Base(e.Path) == c.ext {
+			continue
+		}
+		if _, err := fs.Stat(d.fsys, n); !errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		res = append(res, WatchEvent{Path: n, Removed: e.Removed && !d.compressed(n)})
+		break
+	}
+	return res
+}
+
+func (d *decompressFS) Stat(name string) (fs.FileInfo, error) {
+	s, err := fs.Stat(d.fsys, name)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) || name == "." {
+		return s, err
+	}
+	for _, c := range decompressors {
+		cs, cerr := fs.Stat(d.fsys, name+c.ext)
+		if cerr != nil || !cs.Mode().IsRegular() {
+			continue
+		}
+		if n, ok := d.sizes.get(name, cs); ok {
+			return &sizedInfo{FileInfo: cs, name: path.Base(name), size: n}, nil
+		}
+		break
+	}
+	f, err := d.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+func (d *decompressFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	ds, err := fs.ReadDir(d.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]struct{}, len(ds))
+	for _, v := range ds {
+		names[v.Name()] = struct{}{}
+	}
+	var res []fs.DirEntry
+	for _, v := range ds {
+		res = append(res, v)
+		if !v.Type().IsRegular() {
+			continue
+		}
+		for _, c := range decompressors {
+			n, ok := strings.CutSuffix(v.Name(), c.ext)
+			if !ok || n == "" {
+				continue
+			}
+			if _, ok := names[n]; ok {
+				continue
+			}
+			names[n] = struct{}{}
+			res = append(res, &decompressEntry{d: d, name: n, path: joinMountPath(name, n)})
+		}
+	}
+	sortEntries(res)
+	return res, nil
+}
+
+// Lstat stats the decompressed files as Stat does, they are not links.
+func (d *decompressFS) Lstat(name string) (fs.FileInfo, error) {
+	i, err := Lstat(d.fsys, name)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return i, err
+	}
+	return d.Stat(name)
+}
+
+type decompressEntry struct {
+	d    *decompressFS
+	name string
+	path string
+}
+
+func (e *decompressEntry) Name() string {
+	return e.name
+}
+
+func (e *decompressEntry) IsDir() bool {
+	return false
+}
+
+func (e *decompressEntry) Type() fs.FileMode {
+	return 0
+}
+
+func (e *decompressEntry) Info() (fs.FileInfo, error) {
+	return e.d.Stat(e.path)
+}
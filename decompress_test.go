@@ -0,0 +1,125 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func compress(t *testing.T, b []byte, fn func(w io.Writer) io.WriteCloser) []byte {
+	var buf bytes.Buffer
+	w := fn(&buf)
+	_, err := w.Write(b)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	gz := compress(t, data["foo"], func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })
+	br := compress(t, data["baz"], func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) })
+	zst := compress(t, data["quux"], func(w io.Writer) io.WriteCloser {
+		e, err := zstd.NewWriter(w)
+		require.NoError(t, err)
+		return e
+	})
+	m, err := Mount("m", fstest.MapFS{
+		"foo.txt.gz":   {Data: gz},
+		"baz.txt.br":   {Data: br},
+		"quux.txt.zst": {Data: zst},
+		"plain.gz":     {Data: gz},
+		"plain":        {Data: []byte("plain")},
+	}, WithDecompression())
+	require.NoError(t, err)
+
+	for name, want := range map[string][]byte{
+		"m/foo.txt":  data["foo"],
+		"m/baz.txt":  data["baz"],
+		"m/quux.txt": data["quux"],
+		"m/plain":    []byte("plain"),
+		"m/plain.gz": gz,
+	} {
+		b, err := fs.ReadFile(m, name)
+		require.NoError(t, err, name)
+		assert.Equal(t, want, b, name)
+	}
+
+	s, err := fs.Stat(m, "m/foo.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "foo.txt", s.Name())
+	assert.EqualValues(t, len(data["foo"]), s.Size())
+
+	d, err := m.ReadDir("m")
+	require.NoError(t, err)
+	var names []string
+	for _, v := range d {
+		names = append(names, v.Name())
+	}
+	assert.Equal(t, []string{"baz.txt", "baz.txt.br", "foo.txt", "foo.txt.gz", "plain", "plain.gz", "quux.txt", "quux.txt.zst"}, names)
+
+	_, err = m.Open("m/nope")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+// openCountingFS counts the files opened.
+type openCountingFS struct {
+	fstest.MapFS
+	opens int
+}
+
+func (c *openCountingFS) Open(name string) (fs.File, error) {
+	c.opens++
+	return c.MapFS.Open(name)
+}
+
+func TestDecompressSize(t *testing.T) {
+	c := &openCountingFS{MapFS: fstest.MapFS{
+		"foo.gz": {Data: compress(t, data["foo"], func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })},
+	}}
+	fsys := Decompress(c)
+
+	// the uncompressed size is remembered
+	s, err := fs.Stat(fsys, "foo")
+	require.NoError(t, err)
+	assert.EqualValues(t, len(data["foo"]), s.Size())
+	opens := c.opens
+	s, err = fs.Stat(fsys, "foo")
+	require.NoError(t, err)
+	assert.EqualValues(t, len(data["foo"]), s.Size())
+	assert.Equal(t, opens, c.opens)
+}
+
+func TestDecompressWrites(t *testing.T) {
+	mem := NewMemFS()
+	require.NoError(t, mem.WriteFile("foo.gz", compress(t, data["foo"], func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }), 0644))
+	fsys := Decompress(mem)
+
+	w, ok := As[WriteFileFS](fsys)
+	require.True(t, ok)
+	require.NoError(t, w.WriteFile("foo", data["baz"], 0644))
+	b, err := fs.ReadFile(fsys, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, data["baz"], b)
+}
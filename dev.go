@@ -0,0 +1,47 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"embed"
+	"io/fs"
+	"time"
+)
+
+// devPollInterval is the interval at which the development directories
+// mounted with MountAssets are polled for changes.
+const devPollInterval = 500 * time.Millisecond
+
+// DevOr returns dev if useDev is true, prod otherwise, e.g. a local
+// directory during development and the embedded files in production.
+func DevOr(dev, prod fs.FS, useDev bool) fs.FS {
+	if useDev {
+		return dev
+	}
+	return prod
+}
+
+// MountAssets creates a new MFS mounting at path the dir directory if
+// useDev is true, e.g. "./web", and e otherwise, with the stripPrefix
+// directory removed as for MountEmbed. In development, the directory is
+// polled every half second, see Poll: the changes are notified by
+// MFS.Watch, e.g. to reload the pages, and invalidate the cache set with
+// WithCache. The embedded files, which cannot change, are not watched.
+func MountAssets(path, dir string, e embed.FS, stripPrefix string, useDev bool, opts ...MountOption) (MFS, error) {
+	if useDev {
+		return Mount(path, Poll(DirFS(dir), devPollInterval), opts...)
+	}
+	return MountEmbed(path, e, stripPrefix, opts...)
+}
@@ -0,0 +1,63 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDevOr(t *testing.T) {
+	dev, prod := fstest.MapFS{}, NewMemFS()
+	assert.Equal(t, fs.FS(dev), DevOr(dev, prod, true))
+	assert.Equal(t, fs.FS(prod), DevOr(dev, prod, false))
+}
+
+func TestMountAssets(t *testing.T) {
+	m, err := MountAssets("assets", "missing", static, "testdata/static", false)
+	require.NoError(t, err)
+	b, err := fs.ReadFile(m, "assets/foo")
+	require.NoError(t, err)
+	assert.Equal(t, data["foo"], b)
+	_, err = m.Watch(context.Background(), "assets")
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "foo"), []byte("dev"), 0644))
+	m, err = MountAssets("assets", dir, static, "testdata/static", true, WithCache(time.Hour))
+	require.NoError(t, err)
+	b, err = fs.ReadFile(m, "assets/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "dev", string(b))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := m.Watch(ctx, "assets")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "foo"), []byte("reloaded"), 0644))
+	nextEvent(t, ch, "assets/foo")
+	assert.Eventually(t, func() bool {
+		b, err := fs.ReadFile(m, "assets/foo")
+		return err == nil && string(b) == "reloaded"
+	}, 3*time.Second, 50*time.Millisecond)
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ChangeKind is the kind of a Change.
+type ChangeKind int
+
+const (
+	// Added entries only exist in the second tree.
+	Added ChangeKind = iota
+	// Removed entries only exist in the first tree.
+	Removed
+	// Modified entries exist in both trees but differ, either by their
+	// content or by their type.
+	Modified
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Modified:
+		return "modified"
+	default:
+		return "unknown"
+	}
+}
+
+// Change describes a difference between two trees.
+type Change struct {
+	// Path is relative to the compared roots.
+	Path  string
+	Kind  ChangeKind
+	IsDir bool
+}
+
+// Diff lists the changes needed to go from the a tree to the b tree, sorted
+// by path.
+func Diff(fsys fs.FS, a, b string, opts ...CompareOption) ([]Change, error) {
+	o := newCompareOptions(opts...)
+	a, b = path.Clean(a), path.Clean(b)
+	ea, err := listTree(fsys, a)
+	if err != nil {
+		return nil, err
+	}
+	eb, err := listTree(fsys, b)
+	if err != nil {
+		return nil, err
+	}
+	var changes []Change
+	for k, da := range ea {
+		if _, ok := eb[k]; !ok {
+			changes = append(changes, Change{Path: k, Kind: Removed, IsDir: da.IsDir()})
+		}
+	}
+	for k, db := range eb {
+		da, ok := ea[k]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Path: k, Kind: Added, IsDir: db.IsDir()})
+		case da.IsDir() != db.IsDir():
+			changes = append(changes, Change{Path: k, Kind: Modified, IsDir: db.IsDir()})
+		case da.Type().IsRegular() && db.Type().IsRegular():
+			same, err := o.compare(fsys, path.Join(a, k), path.Join(b, k))
+			if err != nil {
+				return nil, err
+			}
+			if !same {
+				changes = append(changes, Change{Path: k, Kind: Modified})
+			}
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+func listTree(fsys fs.FS, root string) (map[string]fs.DirEntry, error) {
+	entries := make(map[string]fs.DirEntry)
+	err := WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		if root != "." {
+			p = strings.TrimPrefix(p, root+"/")
+		}
+		entries[p] = d
+		return nil
+	})
+	return entries, err
+}
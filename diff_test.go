@@ -0,0 +1,73 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	now := time.Now()
+	base := fstest.MapFS{
+		"foo":     {Data: []byte("foo"), ModTime: now},
+		"bar":     {Data: []byte("bar"), ModTime: now},
+		"same":    {Data: []byte("same"), ModTime: now},
+		"touched": {Data: []byte("touched"), ModTime: now},
+		"dir/baz": {Data: []byte("baz"), ModTime: now},
+		"kind":    {Data: []byte("file"), ModTime: now},
+	}
+	upper := fstest.MapFS{
+		"foo":      {Data: []byte("FOO"), ModTime: now},
+		"same":     {Data: []byte("same"), ModTime: now},
+		"touched":  {Data: []byte("touched"), ModTime: now.Add(time.Hour)},
+		"dir/baz":  {Data: []byte("baz"), ModTime: now},
+		"dir/quux": {Data: []byte("quux"), ModTime: now},
+		"kind/sub": {Data: []byte("sub"), ModTime: now},
+	}
+	m, err := Mount("base", base)
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("upper", upper))
+
+	changes, err := Diff(m, "base", "upper")
+	require.NoError(t, err)
+	assert.Equal(t, []Change{
+		{Path: "bar", Kind: Removed},
+		{Path: "dir/quux", Kind: Added},
+		// foo has the same size and modification time
+		{Path: "kind", Kind: Modified, IsDir: true},
+		{Path: "kind/sub", Kind: Added},
+		{Path: "touched", Kind: Modified},
+	}, changes)
+
+	changes, err = Diff(m, "base", "upper", WithCompare(CompareContent))
+	require.NoError(t, err)
+	assert.Equal(t, []Change{
+		{Path: "bar", Kind: Removed},
+		{Path: "dir/quux", Kind: Added},
+		{Path: "foo", Kind: Modified},
+		{Path: "kind", Kind: Modified, IsDir: true},
+		{Path: "kind/sub", Kind: Added},
+	}, changes)
+	assert.Equal(t, "modified", Modified.String())
+
+	changes, err = Diff(base, ".", ".")
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
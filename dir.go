@@ -0,0 +1,60 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"io"
+	"io/fs"
+	"sort"
+)
+
+func sortEntries(ds []fs.DirEntry) {
+	sort.Slice(ds, func(i, j int) bool {
+		return ds[i].Name() < ds[j].Name()
+	})
+}
+
+// dirReader implements the paging semantics of fs.ReadDirFile.ReadDir over
+// a directory listed on first use.
+type dirReader struct {
+	list    func() ([]fs.DirEntry, error)
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *dirReader) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		var ds []fs.DirEntry
+		if d.list != nil {
+			var err error
+			if ds, err = d.list(); err != nil {
+				return nil, err
+			}
+		}
+		d.entries, d.read = ds, true
+	}
+	if n <= 0 {
+		res := d.entries
+		d.entries = nil
+		return res, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	res := d.entries[:n:n]
+	d.entries = d.entries[n:]
+	return res, nil
+}
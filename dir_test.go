@@ -0,0 +1,72 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAllDir(t *testing.T, f fs.File, n int) []string {
+	d, ok := f.(fs.ReadDirFile)
+	require.True(t, ok)
+	var names []string
+	for {
+		ds, err := d.ReadDir(n)
+		for _, v := range ds {
+			names = append(names, v.Name())
+		}
+		if n <= 0 {
+			require.NoError(t, err)
+			return names
+		}
+		if err == io.EOF {
+			return names
+		}
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(ds), n)
+	}
+}
+
+func TestReadDirFile(t *testing.T) {
+	m, err := Mount("a", fstest.MapFS{"foo": {Data: data["foo"]}, "dir/baz": {Data: data["baz"]}, "dir/quux": {}})
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("b", fstest.MapFS{}))
+	require.NoError(t, m.Mount("c", fstest.MapFS{}))
+
+	for _, n := range []int{-1, 1, 2} {
+		for name, want := range map[string][]string{
+			".":     {"a", "b", "c"},
+			"a":     {"dir", "foo"},
+			"a/dir": {"baz", "quux"},
+		} {
+			f, err := m.Open(name)
+			require.NoError(t, err)
+			assert.Equal(t, want, readAllDir(t, f, n), name)
+			require.NoError(t, f.Close())
+		}
+	}
+
+	require.NoError(t, m.Mount("/", fstest.MapFS{"index.html": {}}))
+	f, err := m.Open(".")
+	require.NoError(t, err)
+	defer f.Close()
+	assert.Equal(t, []string{"a", "b", "c", "index.html"}, readAllDir(t, f, 1))
+}
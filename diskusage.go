@@ -0,0 +1,226 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// DiskUsage returns the number of regular files under root and their total
+// size. The directories are listed concurrently, from up to the concurrency
+// set by WithConcurrency goroutines.
+//
+// When m is an MFS returned by this package, the totals of the walked
+// directories are cached and the subtrees already known are not listed
+// again: the writes done through the MFS and the mount table changes
+// invalidate the affected directories. Changes made to the backends by other
+// means, or through files still open for writing, are not seen until then.
+func DiskUsage(ctx context.Context, m MFS, root string) (files int, bytes int64, err error) {
+	w := &duWalker{fsys: m}
+	workers := defaultConcurrency
+	if v, ok := m.(*mfs); ok {
+		root = v.normalize(root)
+		w.cache = &v.du
+		w.gen = w.cache.generation()
+		workers = v.concurrency
+	}
+	root = cleanPath(root)
+	s, err := fs.Stat(m, root)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !s.IsDir() {
+		if !s.Mode().IsRegular() {
+			return 0, 0, nil
+		}
+		return 1, s.Size(), nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w.ctx, w.cancel = ctx, cancel
+	// the calling goroutine is one of the workers
+	w.sem = make(chan struct{}, max(workers-1, 0))
+	r, err := w.dir(root)
+	if err != nil {
+		return 0, 0, err
+	}
+	return r.files, r.bytes, nil
+}
+
+type duResult struct {
+	files int
+	bytes int64
+}
+
+type duWalker struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	fsys   fs.FS
+	cache  *duCache
+	gen    uint64
+	sem    chan struct{}
+}
+
+func (w *duWalker) dir(name string) (duResult, error) {
+	if r, ok := w.cache.get(name); ok {
+		return r, nil
+	}
+	if err := w.ctx.Err(); err != nil {
+		return duResult{}, err
+	}
+	ds, err := fs.ReadDir(w.fsys, name)
+	if err != nil {
+		return duResult{}, err
+	}
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		res   duResult
+		first error
+	)
+	add := func(r duResult, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			if first == nil {
+				first = err
+				w.cancel()
+			}
+			return
+		}
+		res.files += r.files
+		res.bytes += r.bytes
+	}
+	for _, d := range ds {
+		p := path.Join(name, d.Name())
+		switch {
+		case d.IsDir():
+			// the subdirectory is walked inline when all the workers are busy
+			select {
+			case w.sem <- struct{}{}:
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer func() { <-w.sem }()
+					add(w.dir(p))
+				}()
+			default:
+				add(w.dir(p))
+			}
+		case d.Type().IsRegular():
+			i, err := d.Info()
+			if err != nil {
+				add(duResult{}, err)
+				continue
+			}
+			add(duResult{files: 1, bytes: i.Size()}, nil)
+		}
+	}
+	wg.Wait()
+	if first != nil {
+		return duResult{}, first
+	}
+	w.cache.put(name, res, w.gen)
+	return res, nil
+}
+
+// duCache holds the DiskUsage totals of the directories by path.
+type duCache struct {
+	mu      sync.Mutex
+	entries map[string]duResult
+	// gen is incremented by every invalidation: the walks started before do
+	// not store their results
+	gen uint64
+}
+
+func (c *duCache) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+func (c *duCache) get(name string) (duResult, bool) {
+	if c == nil {
+		return duResult{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.entries[name]
+	return r, ok
+}
+
+func (c *duCache) put(name string, r duResult, gen uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]duResult)
+	}
+	c.entries[name] = r
+}
+
+// invalidate drops the totals of name, of its parents and of its children.
+func (c *duCache) invalidate(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for k := range c.entries {
+		if duRelated(k, name) {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// duRelated reports whether a and b are the same path or one contains the
+// other. The leading slashes are ignored as they may or may not be part of
+// the walked paths.
+func duRelated(a, b string) bool {
+	a, b = strings.TrimPrefix(a, "/"), strings.TrimPrefix(b, "/")
+	if a == "" || a == "." || b == "" || b == "." {
+		return true
+	}
+	return a == b || strings.HasPrefix(a, b+"/") || strings.HasPrefix(b, a+"/")
+}
+
+// invalidate drops the DiskUsage totals and the cache entries affected by a
+// change to name.
+func (m *mfs) invalidate(name string) {
+	name = cleanPath(m.normalize(name))
+	m.du.invalidate(name)
+	for _, v := range m.aliasPaths(name) {
+		m.du.invalidate(v)
+	}
+	m.InvalidateCache(name)
+	// the flattened nested MFS do not see the changes
+	if mnt, rel, ok := m.loadAll().resolve(name); ok {
+		if n := m.nested(mnt, rel); n != nil {
+			n.invalidate(rel)
+		}
+	}
+}
+
+func writeFlag(flag int) bool {
+	return flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0
+}
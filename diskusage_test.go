@@ -0,0 +1,100 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskUsage(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemFS()
+	require.NoError(t, mem.MkdirAll("a/b", 0755))
+	require.NoError(t, mem.WriteFile("foo", []byte("foo"), 0644))
+	require.NoError(t, mem.WriteFile("a/bar", []byte("bar"), 0644))
+	require.NoError(t, mem.WriteFile("a/b/baz", []byte("bazbaz"), 0644))
+	m := New(WithConcurrency(2))
+	require.NoError(t, m.Mount("mem", mem))
+	require.NoError(t, m.Mount("static", fstest.MapFS{"c/d": {Data: []byte("static")}}))
+
+	files, bytes, err := DiskUsage(ctx, m, "mem")
+	require.NoError(t, err)
+	assert.Equal(t, 3, files)
+	assert.Equal(t, int64(12), bytes)
+
+	files, bytes, err = DiskUsage(ctx, m, "mem/a/bar")
+	require.NoError(t, err)
+	assert.Equal(t, 1, files)
+	assert.Equal(t, int64(3), bytes)
+
+	files, bytes, err = DiskUsage(ctx, m, ".")
+	require.NoError(t, err)
+	assert.Equal(t, 4, files)
+	assert.Equal(t, int64(18), bytes)
+
+	// the cached totals hide the changes made behind the MFS
+	require.NoError(t, mem.WriteFile("a/b/qux", []byte("qux"), 0644))
+	files, _, err = DiskUsage(ctx, m, "mem/a")
+	require.NoError(t, err)
+	assert.Equal(t, 2, files)
+
+	// while the writes through the MFS invalidate them
+	require.NoError(t, m.WriteFile("mem/a/b/quux", []byte("quux"), 0644))
+	files, bytes, err = DiskUsage(ctx, m, "mem")
+	require.NoError(t, err)
+	assert.Equal(t, 5, files)
+	assert.Equal(t, int64(19), bytes)
+
+	require.NoError(t, m.RemoveAll("mem/a/b"))
+	files, bytes, err = DiskUsage(ctx, m, "mem")
+	require.NoError(t, err)
+	assert.Equal(t, 2, files)
+	assert.Equal(t, int64(6), bytes)
+
+	// as do the mount table changes
+	require.NoError(t, m.Unmount("static"))
+	files, _, err = DiskUsage(ctx, m, ".")
+	require.NoError(t, err)
+	assert.Equal(t, 2, files)
+
+	_, _, err = DiskUsage(ctx, m, "missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	require.NoError(t, m.WriteFile("mem/a/bar", []byte("bar"), 0644))
+	_, _, err = DiskUsage(cctx, m, "mem")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestDiskUsageFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/b":   {Data: []byte("b")},
+		"a/c/d": {Data: []byte("dd")},
+		"e":     {Data: []byte("eee")},
+	}
+	m, err := Mount("map", fsys)
+	require.NoError(t, err)
+	files, bytes, err := DiskUsage(context.Background(), m.WithContext(context.Background()), "map/a")
+	require.NoError(t, err)
+	assert.Equal(t, 2, files)
+	assert.Equal(t, int64(3), bytes)
+}
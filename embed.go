@@ -0,0 +1,47 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"embed"
+	"io/fs"
+	"strings"
+)
+
+// MountEmbed mounts e at path with the stripPrefix directory removed, so that
+// an embed.FS built from "static/..." patterns is exposed without the leading
+// "static" element.
+func MountEmbed(path string, e embed.FS, stripPrefix string, opts ...MountOption) (MFS, error) {
+	f, err := stripPrefixFS(e, stripPrefix)
+	if err != nil {
+		return nil, err
+	}
+	return Mount(path, f, opts...)
+}
+
+func stripPrefixFS(f fs.FS, prefix string) (fs.FS, error) {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" || prefix == "." {
+		return f, nil
+	}
+	s, err := fs.Stat(f, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if !s.IsDir() {
+		return nil, &fs.PathError{Op: "sub", Path: prefix, Err: fs.ErrInvalid}
+	}
+	return fs.Sub(f, prefix)
+}
@@ -0,0 +1,48 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"embed"
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//go:embed testdata/static
+var static embed.FS
+
+func TestMountEmbed(t *testing.T) {
+	m, err := MountEmbed("assets", static, "testdata/static/")
+	require.NoError(t, err)
+	b, err := fs.ReadFile(m, "assets/foo")
+	require.NoError(t, err)
+	assert.Equal(t, data["foo"], b)
+	d, err := m.ReadDir("assets")
+	require.NoError(t, err)
+	assert.Len(t, d, 2)
+
+	m, err = MountEmbed("assets", static, "")
+	require.NoError(t, err)
+	_, err = fs.Stat(m, "assets/testdata/static/css/main.css")
+	require.NoError(t, err)
+
+	_, err = MountEmbed("assets", static, "nope")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = MountEmbed("assets", static, "testdata/static/foo")
+	assert.ErrorIs(t, err, fs.ErrInvalid)
+}
@@ -0,0 +1,200 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrorClass classifies the errors returned by the mounted file systems, see
+// ClassifyError.
+type ErrorClass int
+
+const (
+	// ClassNone is the class of nil and io.EOF.
+	ClassNone ErrorClass = iota
+	// ClassNotFound is the class of the errors reporting a missing file.
+	ClassNotFound
+	// ClassPermission is the class of the errors reporting a forbidden
+	// operation.
+	ClassPermission
+	// ClassInvalid is the class of the errors caused by the operation
+	// rather than by the file system, e.g. an existing file, an invalid
+	// argument, an unsupported operation or a canceled context.
+	ClassInvalid
+	// ClassTimeout is the class of the errors reporting an operation which
+	// did not complete in time.
+	ClassTimeout
+	// ClassCorrupt is the class of the errors reporting corrupted content,
+	// e.g. ErrChecksumMismatch or an invalid archive.
+	ClassCorrupt
+	// ClassBackend is the class of the other errors, the file system
+	// failing.
+	ClassBackend
+	numErrorClasses
+)
+
+var errorClassNames = [...]string{"none", "notfound", "permission", "invalid", "timeout", "corrupt", "backend"}
+
+func (c ErrorClass) String() string {
+	if c < 0 || c >= numErrorClasses {
+		return "unknown"
+	}
+	return errorClassNames[c]
+}
+
+func (c ErrorClass) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+func (c *ErrorClass) UnmarshalText(b []byte) error {
+	for i, v := range errorClassNames {
+		if v == string(b) {
+			*c = ErrorClass(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown error class %q", b)
+}
+
+// Failure reports whether the errors of class c are failures of the file
+// system: the ones counted by the circuit breakers and by
+// WithFailureThreshold.
+func (c ErrorClass) Failure() bool {
+	return c >= ClassTimeout
+}
+
+// ClassifyError returns the class of err.
+func ClassifyError(err error) ErrorClass {
+	if err == nil || err == io.EOF {
+		return ClassNone
+	}
+	var ne net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) || errors.As(err, &ne) && ne.Timeout() {
+		return ClassTimeout
+	}
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return ClassNotFound
+	case errors.Is(err, fs.ErrPermission), errors.Is(err, ErrSymlinkRejected):
+		return ClassPermission
+	}
+	for _, v := range []error{fs.ErrExist, fs.ErrInvalid, fs.ErrClosed, errors.ErrUnsupported, context.Canceled, ErrTooManyOperations, ErrFileTooLarge, ErrLocked, ErrCrossMount} {
+		if errors.Is(err, v) {
+			return ClassInvalid
+		}
+	}
+	var ce flate.CorruptInputError
+	if errors.As(err, &ce) {
+		return ClassCorrupt
+	}
+	for _, v := range []error{ErrChecksumMismatch, gzip.ErrChecksum, gzip.ErrHeader, zip.ErrChecksum, zip.ErrFormat, tar.ErrHeader} {
+		if errors.Is(err, v) {
+			return ClassCorrupt
+		}
+	}
+	return ClassBackend
+}
+
+// ErrorStats counts the errors returned by a mount during about the last
+// minute.
+type ErrorStats struct {
+	// Classes counts the errors by class.
+	Classes map[ErrorClass]int `json:"classes,omitempty"`
+	// Failures counts the errors whose class is a failure.
+	Failures int `json:"failures"`
+}
+
+func (m *mfs) ErrorStats() map[string]ErrorStats {
+	t := m.load()
+	res := make(map[string]ErrorStats, len(t.mounts))
+	for k, v := range t.mounts {
+		res[k] = v.rates.stats()
+	}
+	return res
+}
+
+const (
+	errorWindow  = time.Minute
+	errorBuckets = 6
+)
+
+// errorRates counts the errors of a mount by class over errorWindow, split
+// into errorBuckets rotating buckets.
+type errorRates struct {
+	mu      sync.Mutex
+	buckets [errorBuckets]errorBucket
+}
+
+type errorBucket struct {
+	// period is the index of the period counted by the bucket
+	period int64
+	counts [numErrorClasses]int
+}
+
+func errorPeriod(t time.Time) int64 {
+	return t.UnixNano() / int64(errorWindow/errorBuckets)
+}
+
+func (r *errorRates) add(c ErrorClass) {
+	if c == ClassNone {
+		return
+	}
+	p := errorPeriod(time.Now())
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b := &r.buckets[p%errorBuckets]
+	if b.period != p {
+		*b = errorBucket{period: p}
+	}
+	b.counts[c]++
+}
+
+func (r *errorRates) stats() ErrorStats {
+	p := errorPeriod(time.Now())
+	var s ErrorStats
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, b := range r.buckets {
+		if b.period <= p-errorBuckets {
+			continue
+		}
+		for c, n := range b.counts {
+			if n == 0 {
+				continue
+			}
+			if s.Classes == nil {
+				s.Classes = make(map[ErrorClass]int)
+			}
+			s.Classes[ErrorClass(c)] += n
+			if ErrorClass(c).Failure() {
+				s.Failures += n
+			}
+		}
+	}
+	return s
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyError(t *testing.T) {
+	for err, want := range map[error]ErrorClass{
+		nil:                      ClassNone,
+		io.EOF:                   ClassNone,
+		fs.ErrNotExist:           ClassNotFound,
+		fs.ErrPermission:         ClassPermission,
+		fs.ErrExist:              ClassInvalid,
+		errors.ErrUnsupported:    ClassInvalid,
+		context.Canceled:         ClassInvalid,
+		ErrTooManyOperations:     ClassInvalid,
+		context.DeadlineExceeded: ClassTimeout,
+		os.ErrDeadlineExceeded:   ClassTimeout,
+		ErrChecksumMismatch:      ClassCorrupt,
+		gzip.ErrHeader:           ClassCorrupt,
+		ErrCircuitOpen:           ClassBackend,
+		errors.New("boom"):       ClassBackend,
+		&fs.PathError{Op: "open", Path: "foo", Err: &MountError{MountPoint: "a", BackendPath: "foo", Err: fs.ErrNotExist}}: ClassNotFound,
+	} {
+		assert.Equal(t, want, ClassifyError(err), fmt.Sprint(err))
+	}
+	assert.False(t, ClassPermission.Failure())
+	assert.True(t, ClassTimeout.Failure())
+	assert.True(t, ClassBackend.Failure())
+	assert.Equal(t, "corrupt", ClassCorrupt.String())
+}
+
+func TestErrorStats(t *testing.T) {
+	f := &flakyFS{FS: fstest.MapFS{"foo": {Data: data["foo"]}}}
+	m := New(WithFailureThreshold(2))
+	require.NoError(t, m.Mount("flaky", f))
+	require.NoError(t, m.Mount("static", fstest.MapFS{}))
+
+	_, err := m.Open("flaky/missing")
+	require.Error(t, err)
+	assert.Nil(t, m.Health(context.Background())["flaky"])
+
+	f.down.Store(true)
+	for range 2 {
+		_, err = m.Open("flaky/foo")
+		require.Error(t, err)
+	}
+	f.down.Store(false)
+	s := m.ErrorStats()
+	assert.Equal(t, ErrorStats{Classes: map[ErrorClass]int{ClassNotFound: 1, ClassTimeout: 2}, Failures: 2}, s["flaky"])
+	assert.Equal(t, ErrorStats{}, s["static"])
+	assert.ErrorIs(t, m.Health(context.Background())["flaky"], ErrTooManyFailures)
+	assert.Nil(t, m.Health(context.Background())["static"])
+
+	b, err := json.Marshal(s["flaky"])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"classes":{"notfound":1,"timeout":2},"failures":2}`, string(b))
+	var v ErrorStats
+	require.NoError(t, json.Unmarshal(b, &v))
+	assert.Equal(t, s["flaky"], v)
+}
@@ -0,0 +1,60 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+)
+
+// MountError is the error wrapped in the *fs.PathError returned when a
+// mounted file system fails. The PathError carries the MFS path while
+// MountError tells which mount failed and the path it was given.
+type MountError struct {
+	MountPoint  string
+	BackendPath string
+	Err         error
+}
+
+func (e *MountError) Error() string {
+	return "mount " + e.MountPoint + ": " + e.BackendPath + ": " + e.Err.Error()
+}
+
+func (e *MountError) Unwrap() error {
+	return e.Err
+}
+
+// wrapErr wraps the error returned by the mount file system for rel in a
+// *fs.PathError reporting name. io.EOF is returned as is.
+func (mnt *mount) wrapErr(op, name, rel string, err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		var me *MountError
+		if errors.As(pe.Err, &me) {
+			// already wrapped by a nested MFS
+			mnt.errs.add(pe.Op, name, pe.Err)
+			mnt.rates.add(ClassifyError(pe.Err))
+			return &fs.PathError{Op: pe.Op, Path: name, Err: pe.Err}
+		}
+		op, err = pe.Op, pe.Err
+	}
+	mnt.errs.add(op, name, err)
+	mnt.rates.add(ClassifyError(err))
+	return &fs.PathError{Op: op, Path: name, Err: &MountError{MountPoint: mnt.path, BackendPath: rel, Err: err}}
+}
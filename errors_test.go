@@ -0,0 +1,73 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMountError(t *testing.T) {
+	m, err := Mount("a/b", fstest.MapFS{"foo": {Data: data["foo"]}})
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("w", NewMemFS()))
+
+	_, err = m.Open("a/b/dir/missing")
+	var pe *fs.PathError
+	require.ErrorAs(t, err, &pe)
+	assert.Equal(t, "open", pe.Op)
+	assert.Equal(t, "a/b/dir/missing", pe.Path)
+	var me *MountError
+	require.ErrorAs(t, err, &me)
+	assert.Equal(t, "a/b", me.MountPoint)
+	assert.Equal(t, "dir/missing", me.BackendPath)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.Equal(t, "open a/b/dir/missing: mount a/b: dir/missing: file does not exist", err.Error())
+
+	_, err = m.ReadDir("a/b/foo")
+	require.ErrorAs(t, err, &me)
+	assert.Equal(t, "foo", me.BackendPath)
+
+	err = m.Remove("w/missing")
+	require.ErrorAs(t, err, &pe)
+	assert.Equal(t, "w/missing", pe.Path)
+	require.ErrorAs(t, err, &me)
+	assert.Equal(t, "w", me.MountPoint)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	// nested MFS errors are not wrapped twice
+	outer, err := Mount("outer", m)
+	require.NoError(t, err)
+	_, err = outer.Open("outer/a/b/missing")
+	require.ErrorAs(t, err, &pe)
+	assert.Equal(t, "outer/a/b/missing", pe.Path)
+	require.ErrorAs(t, err, &me)
+	assert.Equal(t, "a/b", me.MountPoint)
+	assert.False(t, errors.As(me.Err, new(*MountError)))
+
+	f, err := m.Open("a/b/foo")
+	require.NoError(t, err)
+	_, err = io.ReadAll(f)
+	assert.NoError(t, err)
+	_, err = f.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+	require.NoError(t, f.Close())
+}
@@ -0,0 +1,147 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// WriteTar streams the root tree of fsys to w as a tar archive. Entry names
+// are relative to root. Entries that are neither directories nor regular
+// files are skipped.
+func WriteTar(w io.Writer, fsys fs.FS, root string) error {
+	tw := tar.NewWriter(w)
+	err := walkExport(fsys, root, func(name string, i fs.FileInfo, f fs.File) error {
+		h, err := tar.FileInfoHeader(i, "")
+		if err != nil {
+			return err
+		}
+		h.Name = name
+		if f == nil {
+			return tw.WriteHeader(h)
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// WriteZip streams the root tree of fsys to w as a zip archive. Entry names
+// are relative to root. Entries that are neither directories nor regular
+// files are skipped.
+func WriteZip(w io.Writer, fsys fs.FS, root string) error {
+	zw := zip.NewWriter(w)
+	err := walkExport(fsys, root, func(name string, i fs.FileInfo, f fs.File) error {
+		h, err := zip.FileInfoHeader(i)
+		if err != nil {
+			return err
+		}
+		h.Name = name
+		if f != nil {
+			h.Method = zip.Deflate
+		}
+		fw, err := zw.CreateHeader(h)
+		if err != nil || f == nil {
+			return err
+		}
+		_, err = io.Copy(fw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// WriteArchive streams the root tree of fsys to w using the given format.
+func WriteArchive(w io.Writer, fsys fs.FS, root string, format Format) error {
+	switch format {
+	case FormatZip:
+		return WriteZip(w, fsys, root)
+	case FormatTar:
+		return WriteTar(w, fsys, root)
+	default:
+		return fmt.Errorf("mfs: unsupported archive format %v", format)
+	}
+}
+
+// walkExport calls fn for every directory and regular file below root with
+// its archive name. Directories are passed a nil file.
+func walkExport(fsys fs.FS, root string, fn func(name string, i fs.FileInfo, f fs.File) error) error {
+	root = path.Clean(root)
+	return WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		name := p
+		if root != "." {
+			name = strings.TrimPrefix(p, root+"/")
+		}
+		switch {
+		case d.IsDir():
+			i, err := d.Info()
+			if err != nil {
+				return err
+			}
+			// synthetic directories such as mount points carry no
+			// permissions
+			return fn(name+"/", dirInfo{i}, nil)
+		case d.Type().IsRegular():
+			f, err := fsys.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			i, err := f.Stat()
+			if err != nil {
+				return err
+			}
+			return fn(name, i, f)
+		default:
+			return nil
+		}
+	})
+}
+
+type dirInfo struct {
+	fs.FileInfo
+}
+
+func (i dirInfo) Mode() fs.FileMode {
+	m := i.FileInfo.Mode() | fs.ModeDir
+	if m.Perm() == 0 {
+		m |= 0755
+	}
+	return m
+}
+
+func (i dirInfo) IsDir() bool {
+	return true
+}
@@ -0,0 +1,56 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"bytes"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteArchive(t *testing.T) {
+	m, err := Mount("a", fstest.MapFS{
+		"foo":     {Data: data["foo"], Mode: 0640},
+		"dir/bar": {Data: data["quux"]},
+		"nested":  {Mode: fs.ModeDir},
+	})
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("a/nested", fstest.MapFS{"baz": {Data: data["baz"]}}))
+
+	for _, format := range []Format{FormatTar, FormatZip} {
+		t.Run(format.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, WriteArchive(&buf, m, "a", format))
+			a, err := OpenArchive(bytes.NewReader(buf.Bytes()), int64(buf.Len()), format)
+			require.NoError(t, err)
+			for k, v := range map[string]string{"foo": "foo", "dir/bar": "quux", "nested/baz": "baz"} {
+				b, err := fs.ReadFile(a, k)
+				require.NoError(t, err, k)
+				assert.Equal(t, data[v], b, k)
+			}
+			i, err := fs.Stat(a, "foo")
+			require.NoError(t, err)
+			assert.Equal(t, fs.FileMode(0640), i.Mode().Perm())
+			i, err = fs.Stat(a, "nested")
+			require.NoError(t, err)
+			assert.True(t, i.IsDir())
+		})
+	}
+	assert.Error(t, WriteArchive(&bytes.Buffer{}, m, "a", Format(0)))
+}
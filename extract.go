@@ -0,0 +1,183 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"time"
+)
+
+// OverwritePolicy controls what happens when an extracted file already
+// exists in the destination.
+type OverwritePolicy int
+
+const (
+	// OverwriteExisting replaces the existing files.
+	OverwriteExisting OverwritePolicy = iota
+	// SkipExisting keeps the existing files.
+	SkipExisting
+	// FailIfExists makes the extraction fail with fs.ErrExist.
+	FailIfExists
+)
+
+// ExtractOption configures Untar and Unzip.
+type ExtractOption func(o *extractOptions)
+
+type extractOptions struct {
+	overwrite OverwritePolicy
+}
+
+// WithOverwrite sets the policy applied to files already present in the
+// destination.
+func WithOverwrite(p OverwritePolicy) ExtractOption {
+	return func(o *extractOptions) {
+		o.overwrite = p
+	}
+}
+
+// Untar extracts the tar archive read from r under dst. Members escaping
+// dst make the extraction fail, file modes and modification times are
+// preserved. Links and special files are skipped.
+func Untar(m WritableMFS, dst string, r io.Reader, opts ...ExtractOption) error {
+	e := newExtractor(m, dst, opts...)
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return e.finish()
+		}
+		if err != nil {
+			return err
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			err = e.dir("untar", h.Name, h.FileInfo())
+		case tar.TypeReg, tar.TypeGNUSparse:
+			err = e.file("untar", h.Name, h.FileInfo(), tr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Unzip extracts the zip archive read from r under dst, see Untar.
+func Unzip(m WritableMFS, dst string, r io.ReaderAt, size int64, opts ...ExtractOption) error {
+	e := newExtractor(m, dst, opts...)
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		i := f.FileInfo()
+		switch {
+		case i.IsDir():
+			err = e.dir("unzip", f.Name, i)
+		case i.Mode().IsRegular():
+			err = e.zipFile(f)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return e.finish()
+}
+
+type extractor struct {
+	m    WritableMFS
+	dst  string
+	o    *extractOptions
+	dirs map[string]time.Time
+}
+
+func newExtractor(m WritableMFS, dst string, opts ...ExtractOption) *extractor {
+	o := &extractOptions{}
+	for _, v := range opts {
+		v(o)
+	}
+	return &extractor{m: m, dst: path.Clean(dst), o: o, dirs: make(map[string]time.Time)}
+}
+
+func (e *extractor) target(op, name string) (string, error) {
+	name, ok := cleanEntryName(name)
+	if !ok {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return path.Join(e.dst, name), nil
+}
+
+func (e *extractor) dir(op, name string, i fs.FileInfo) error {
+	p, err := e.target(op, name)
+	if err != nil {
+		return err
+	}
+	if err := e.m.MkdirAll(p, i.Mode().Perm()); err != nil {
+		return err
+	}
+	e.dirs[p] = i.ModTime()
+	return nil
+}
+
+func (e *extractor) zipFile(f *zip.File) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return e.file("unzip", f.Name, f.FileInfo(), r)
+}
+
+func (e *extractor) file(op, name string, i fs.FileInfo, r io.Reader) error {
+	p, err := e.target(op, name)
+	if err != nil {
+		return err
+	}
+	_, err = fs.Stat(e.m, p)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return err
+	case e.o.overwrite == SkipExisting:
+		return nil
+	case e.o.overwrite == FailIfExists:
+		return &fs.PathError{Op: op, Path: p, Err: fs.ErrExist}
+	}
+	if err := e.m.MkdirAll(path.Dir(p), 0755); err != nil {
+		return err
+	}
+	if err := writeFrom(e.m, p, r, i.Mode().Perm()); err != nil {
+		return err
+	}
+	chtimes(e.m, p, i)
+	return nil
+}
+
+// finish restores the directories modification times, which changed as
+// their content was written.
+func (e *extractor) finish() error {
+	c, ok := e.m.(ChtimesFS)
+	if !ok {
+		return nil
+	}
+	for p, t := range e.dirs {
+		_ = c.Chtimes(p, t, t)
+	}
+	return nil
+}
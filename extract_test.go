@@ -0,0 +1,99 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtract(t *testing.T) {
+	src := fstest.MapFS{
+		"foo":     {Data: data["foo"], Mode: 0600},
+		"dir/baz": {Data: data["baz"]},
+	}
+	extract := map[Format]func(m WritableMFS, dst string, b []byte, opts ...ExtractOption) error{
+		FormatTar: func(m WritableMFS, dst string, b []byte, opts ...ExtractOption) error {
+			return Untar(m, dst, bytes.NewReader(b), opts...)
+		},
+		FormatZip: func(m WritableMFS, dst string, b []byte, opts ...ExtractOption) error {
+			return Unzip(m, dst, bytes.NewReader(b), int64(len(b)), opts...)
+		},
+	}
+	for format, fn := range extract {
+		t.Run(format.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, WriteArchive(&buf, src, ".", format))
+			mem := NewMemFS()
+			m, err := Mount("out", mem)
+			require.NoError(t, err)
+
+			require.NoError(t, fn(m, "out/x", buf.Bytes()))
+			for k, v := range src {
+				b, err := fs.ReadFile(mem, "x/"+k)
+				require.NoError(t, err, k)
+				assert.Equal(t, v.Data, b, k)
+			}
+			i, err := mem.Stat("x/foo")
+			require.NoError(t, err)
+			assert.Equal(t, fs.FileMode(0600), i.Mode().Perm())
+
+			require.NoError(t, mem.WriteFile("x/foo", []byte("keep"), 0600))
+			require.NoError(t, fn(m, "out/x", buf.Bytes(), WithOverwrite(SkipExisting)))
+			b, err := mem.ReadFile("x/foo")
+			require.NoError(t, err)
+			assert.Equal(t, []byte("keep"), b)
+
+			assert.ErrorIs(t, fn(m, "out/x", buf.Bytes(), WithOverwrite(FailIfExists)), fs.ErrExist)
+
+			require.NoError(t, fn(m, "out/x", buf.Bytes()))
+			b, err = mem.ReadFile("x/foo")
+			require.NoError(t, err)
+			assert.Equal(t, data["foo"], b)
+		})
+	}
+}
+
+func TestExtractTraversal(t *testing.T) {
+	var tb bytes.Buffer
+	tw := tar.NewWriter(&tb)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "../evil", Mode: 0644, Size: 4, Typeflag: tar.TypeReg}))
+	_, err := tw.Write([]byte("evil"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	var zb bytes.Buffer
+	zw := zip.NewWriter(&zb)
+	w, err := zw.Create("a/../../evil")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("evil"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	mem := NewMemFS()
+	m, err := Mount("out", mem)
+	require.NoError(t, err)
+	assert.ErrorIs(t, Untar(m, "out/x", &tb), fs.ErrInvalid)
+	assert.ErrorIs(t, Unzip(m, "out/x", bytes.NewReader(zb.Bytes()), int64(zb.Len())), fs.ErrInvalid)
+	_, err = mem.Stat("evil")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
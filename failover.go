@@ -0,0 +1,160 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"sync/atomic"
+	"time"
+)
+
+const defaultRetryAfter = 30 * time.Second
+
+// FailoverFS serves its files from the first of its file systems which is
+// available. The file systems failing with an error considered as
+// unavailability are skipped until RetryAfter elapsed or a health check
+// reports them healthy again. The fallback only happens when opening, listing
+// or stating files: reading an opened file does not switch file systems.
+type FailoverFS struct {
+	// RetryAfter is how long a failing file system is skipped. It defaults
+	// to 30 seconds.
+	RetryAfter time.Duration
+	// ShouldFailover reports whether err means that the file system is
+	// unavailable. It defaults to considering any error but fs.ErrNotExist,
+	// fs.ErrExist, fs.ErrPermission, fs.ErrInvalid and fs.ErrClosed.
+	ShouldFailover func(err error) bool
+
+	fss []fs.FS
+	// down holds the unix time in nanoseconds until which each file system
+	// is skipped
+	down []atomic.Int64
+}
+
+// components returns the file systems in order, see Topology.
+func (f *FailoverFS) components() []fs.FS {
+	return f.fss
+}
+
+var (
+	_ fs.StatFS     = (*FailoverFS)(nil)
+	_ fs.ReadDirFS  = (*FailoverFS)(nil)
+	_ HealthChecker = (*FailoverFS)(nil)
+)
+
+// Failover returns a file system serving primary, falling back to fallbacks
+// in order when it is unavailable.
+func Failover(primary fs.FS, fallbacks ...fs.FS) *FailoverFS {
+	fss := append([]fs.FS{primary}, fallbacks...)
+	return &FailoverFS{fss: fss, down: make([]atomic.Int64, len(fss))}
+}
+
+// MountFailover creates a new MFS mounting Failover(primary, fallbacks...)
+// at path.
+func MountFailover(path string, primary fs.FS, fallbacks ...fs.FS) (MFS, error) {
+	return Mount(path, Failover(primary, fallbacks...))
+}
+
+func (f *FailoverFS) Open(name string) (fs.File, error) {
+	var file fs.File
+	err := f.try(func(fsys fs.FS) (err error) {
+		file, err = fsys.Open(name)
+		return err
+	})
+	return file, err
+}
+
+func (f *FailoverFS) Stat(name string) (fs.FileInfo, error) {
+	var i fs.FileInfo
+	err := f.try(func(fsys fs.FS) (err error) {
+		i, err = fs.Stat(fsys, name)
+		return err
+	})
+	return i, err
+}
+
+func (f *FailoverFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	var ds []fs.DirEntry
+	err := f.try(func(fsys fs.FS) (err error) {
+		ds, err = fs.ReadDir(fsys, name)
+		return err
+	})
+	return ds, err
+}
+
+// Health checks all the file systems, making the healthy ones available
+// again. It fails only if none of them is healthy.
+func (f *FailoverFS) Health(ctx context.Context) error {
+	var errs []error
+	for i, fsys := range f.fss {
+		if err := healthOf(ctx, fsys); err != nil {
+			f.markDown(i)
+			errs = append(errs, err)
+			continue
+		}
+		f.down[i].Store(0)
+	}
+	if len(errs) < len(f.fss) {
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+// try calls fn with the available file systems in order until it succeeds
+// or fails with an error not meaning unavailability. When all the file
+// systems are marked down, they are all tried.
+func (f *FailoverFS) try(fn func(fsys fs.FS) error) error {
+	now := time.Now().UnixNano()
+	var up []int
+	for i := range f.fss {
+		if f.down[i].Load() <= now {
+			up = append(up, i)
+		}
+	}
+	if len(up) == 0 {
+		for i := range f.fss {
+			up = append(up, i)
+		}
+	}
+	var err error
+	for _, i := range up {
+		if err = fn(f.fss[i]); err == nil || !f.shouldFailover(err) {
+			return err
+		}
+		f.markDown(i)
+	}
+	return err
+}
+
+func (f *FailoverFS) markDown(i int) {
+	d := f.RetryAfter
+	if d <= 0 {
+		d = defaultRetryAfter
+	}
+	f.down[i].Store(time.Now().Add(d).UnixNano())
+}
+
+func (f *FailoverFS) shouldFailover(err error) bool {
+	if f.ShouldFailover != nil {
+		return f.ShouldFailover(err)
+	}
+	for _, v := range []error{fs.ErrNotExist, fs.ErrExist, fs.ErrPermission, fs.ErrInvalid, fs.ErrClosed} {
+		if errors.Is(err, v) {
+			return false
+		}
+	}
+	return true
+}
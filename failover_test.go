@@ -0,0 +1,106 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type flakyFS struct {
+	fs.FS
+	down  atomic.Bool
+	calls atomic.Int32
+}
+
+func (f *flakyFS) Open(name string) (fs.File, error) {
+	f.calls.Add(1)
+	if f.down.Load() {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: os.ErrDeadlineExceeded}
+	}
+	return f.FS.Open(name)
+}
+
+func TestFailover(t *testing.T) {
+	primary := &flakyFS{FS: fstest.MapFS{"foo": {Data: []byte("primary")}}}
+	fallback := fstest.MapFS{
+		"foo": {Data: []byte("fallback")},
+		"bar": {Data: []byte("fallback")},
+	}
+	m, err := MountFailover("cdn", primary, fallback)
+	require.NoError(t, err)
+
+	b, err := fs.ReadFile(m, "cdn/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "primary", string(b))
+
+	// not found is a definitive answer
+	_, err = fs.ReadFile(m, "cdn/bar")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	primary.down.Store(true)
+	b, err = fs.ReadFile(m, "cdn/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "fallback", string(b))
+
+	// the primary is skipped once it failed
+	primary.down.Store(false)
+	calls := primary.calls.Load()
+	b, err = fs.ReadFile(m, "cdn/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "fallback", string(b))
+	assert.Equal(t, calls, primary.calls.Load())
+
+	// until a health check reports it healthy
+	assert.Equal(t, map[string]error{"cdn": nil}, m.Health(context.Background()))
+	b, err = fs.ReadFile(m, "cdn/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "primary", string(b))
+}
+
+func TestFailoverRetryAfter(t *testing.T) {
+	primary := &flakyFS{FS: fstest.MapFS{"foo": {Data: []byte("primary")}}}
+	f := Failover(primary, fstest.MapFS{"foo": {Data: []byte("fallback")}})
+	f.RetryAfter = time.Millisecond
+
+	primary.down.Store(true)
+	b, err := fs.ReadFile(f, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "fallback", string(b))
+	primary.down.Store(false)
+	time.Sleep(2 * time.Millisecond)
+	b, err = fs.ReadFile(f, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "primary", string(b))
+
+	// all down: the file systems are still tried
+	f = Failover(primary)
+	f.ShouldFailover = func(err error) bool { return errors.Is(err, os.ErrDeadlineExceeded) }
+	primary.down.Store(true)
+	_, err = f.Open("foo")
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	_, err = f.Open("foo")
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	assert.Error(t, f.Health(context.Background()))
+}
@@ -0,0 +1,360 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServerOption configures FileServer.
+type ServerOption func(o *serverOptions)
+
+type serverOptions struct {
+	manifest Manifest
+	listing  *template.Template
+	spa      string
+	notFound string
+}
+
+// WithETagManifest uses the checksums of m as the files ETags instead of
+// hashing their content. The manifest paths are relative to the root of the
+// served file system. Files missing from the manifest get no ETag.
+func WithETagManifest(m Manifest) ServerOption {
+	return func(o *serverOptions) {
+		o.manifest = m
+	}
+}
+
+// WithDirectoryListing renders the directories, including the synthesized
+// ones of an MFS, as HTML listings using tmpl, which is executed with a
+// DirListing. A nil tmpl uses a default template similar to nginx autoindex.
+// Without this option, directories are not found.
+func WithDirectoryListing(tmpl *template.Template) ServerOption {
+	return func(o *serverOptions) {
+		if tmpl == nil {
+			tmpl = defaultListing
+		}
+		o.listing = tmpl
+	}
+}
+
+// WithSPAFallback serves the file name, e.g. "index.html", instead of
+// replying 404 Not Found for unknown paths, as expected by single-page
+// applications handling their routes client side.
+func WithSPAFallback(name string) ServerOption {
+	return func(o *serverOptions) {
+		o.spa = strings.TrimPrefix(path.Clean("/"+name), "/")
+	}
+}
+
+// WithNotFoundFile replies with the content of the file name along the 404
+// Not Found status for unknown paths. It only applies when the SPA fallback
+// is not set or missing.
+func WithNotFoundFile(name string) ServerOption {
+	return func(o *serverOptions) {
+		o.notFound = strings.TrimPrefix(path.Clean("/"+name), "/")
+	}
+}
+
+// DirListing is the data given to the directory listing template.
+type DirListing struct {
+	// Path is the URL path of the directory, ending with a "/".
+	Path    string
+	Entries []DirListingEntry
+}
+
+// DirListingEntry describes a directory entry in a DirListing.
+type DirListingEntry struct {
+	// Name is the entry name, with a trailing "/" for directories.
+	Name string
+	// Href is the URL of the entry relative to the directory, Name escaped.
+	Href    string
+	Size    int64
+	ModTime time.Time
+	IsDir   bool
+}
+
+var defaultListing = template.Must(template.New("listing").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Index of {{ .Path }}</title></head>
+<body>
+<h1>Index of {{ .Path }}</h1><hr><pre><a href="../">../</a>
+{{ range .Entries }}<a href="{{ .Href }}">{{ .Name }}</a>	{{ if .ModTime.IsZero }}-{{ else }}{{ .ModTime.Format "02-Jan-2006 15:04" }}{{ end }}	{{ if .IsDir }}-{{ else }}{{ .Size }}{{ end }}
+{{ end }}</pre><hr>
+</body>
+</html>
+`))
+
+// FileServer returns a handler serving the regular files of fsys, see
+// ServeFile.
+//
+// Responses carry a strong ETag, the SHA-256 of the file content. The hashes
+// of the last files served, up to maxETags, are cached as long as the file
+// size and modification time are unchanged, files without modification time
+// being hashed on every request. Conditional requests (If-None-Match,
+// If-Modified-Since) are answered with 304 Not Modified.
+//
+// The directories holding an index.html file are served that file. The
+// others are only served when WithDirectoryListing is given.
+func FileServer(fsys fs.FS, opts ...ServerOption) http.Handler {
+	o := &serverOptions{}
+	for _, v := range opts {
+		v(o)
+	}
+	return &fileServer{fsys: fsys, o: o, etags: make(map[string]*list.Element), lru: list.New()}
+}
+
+// maxETags is the number of ETags cached by a FileServer.
+const maxETags = 4096
+
+type fileServer struct {
+	fsys fs.FS
+	o    *serverOptions
+
+	mu    sync.Mutex
+	etags map[string]*list.Element
+	lru   *list.List
+}
+
+type etagEntry struct {
+	name    string
+	size    int64
+	modTime time.Time
+	etag    string
+}
+
+func (s *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "."
+	}
+	if err := s.serve(w, r, name, true); err != nil {
+		s.error(w, r, err)
+	}
+}
+
+// serve replies with the file name. It returns the error to report when
+// nothing was written.
+func (s *fileServer) serve(w http.ResponseWriter, r *http.Request, name string, dirs bool) error {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	i, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if dirs && i.IsDir() {
+		return s.serveDir(w, r, name, f)
+	}
+	if !i.Mode().IsRegular() {
+		return fs.ErrNotExist
+	}
+	etag, err := s.etag(name, i)
+	if err != nil {
+		return err
+	}
+	if etag != "" {
+		w.Header().Set("Etag", etag)
+	}
+	setContentType(w, s.fsys, name)
+	serveFile(w, r, f, i)
+	return nil
+}
+
+func (s *fileServer) error(w http.ResponseWriter, r *http.Request, err error) {
+	if !errors.Is(err, fs.ErrNotExist) {
+		httpError(w, err)
+		return
+	}
+	if s.o.spa != "" && s.serve(w, r, s.o.spa, false) == nil {
+		return
+	}
+	if s.o.notFound != "" && s.serveNotFound(w, r) == nil {
+		return
+	}
+	httpError(w, err)
+}
+
+// serveNotFound replies with the content of the not found file and a 404
+// status.
+func (s *fileServer) serveNotFound(w http.ResponseWriter, r *http.Request) error {
+	f, err := s.fsys.Open(s.o.notFound)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	i, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !i.Mode().IsRegular() {
+		return fs.ErrNotExist
+	}
+	ct := typeByName(s.fsys, s.o.notFound)
+	if ct == "" {
+		ct = "text/html; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", ct)
+	if i.Size() >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(i.Size(), 10))
+	}
+	w.WriteHeader(http.StatusNotFound)
+	if r.Method != http.MethodHead {
+		io.Copy(w, f)
+	}
+	return nil
+}
+
+// etag returns the quoted ETag of the file name.
+func (s *fileServer) etag(name string, i fs.FileInfo) (string, error) {
+	if s.o.manifest != nil {
+		if sum, ok := s.o.manifest[name]; ok {
+			return `"` + sum + `"`, nil
+		}
+		return "", nil
+	}
+	cache := !i.ModTime().IsZero()
+	if cache {
+		if etag, ok := s.cachedETag(name, i); ok {
+			return etag, nil
+		}
+	}
+	sum, err := hashFile(s.fsys, name)
+	if err != nil {
+		return "", err
+	}
+	etag := `"` + hex.EncodeToString(sum) + `"`
+	if cache {
+		s.cacheETag(&etagEntry{name: name, size: i.Size(), modTime: i.ModTime(), etag: etag})
+	}
+	return etag, nil
+}
+
+// cachedETag returns the cached ETag of name if the file i is unchanged.
+func (s *fileServer) cachedETag(name string, i fs.FileInfo) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.etags[name]
+	if !ok {
+		return "", false
+	}
+	e := v.Value.(*etagEntry)
+	if e.size != i.Size() || !e.modTime.Equal(i.ModTime()) {
+		return "", false
+	}
+	s.lru.MoveToFront(v)
+	return e.etag, true
+}
+
+// cacheETag caches e, dropping the least recently used ETags beyond
+// maxETags.
+func (s *fileServer) cacheETag(e *etagEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.etags[e.name]; ok {
+		s.lru.Remove(v)
+	}
+	s.etags[e.name] = s.lru.PushFront(e)
+	for s.lru.Len() > maxETags {
+		v := s.lru.Back()
+		s.lru.Remove(v)
+		delete(s.etags, v.Value.(*etagEntry).name)
+	}
+}
+
+// serveDir replies with the index.html file of the directory name, or with
+// its listing.
+func (s *fileServer) serveDir(w http.ResponseWriter, r *http.Request, name string, f fs.File) error {
+	index := path.Join(name, "index.html")
+	i, err := fs.Stat(s.fsys, index)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	hasIndex := err == nil && i.Mode().IsRegular()
+	if !hasIndex && s.o.listing == nil {
+		return fs.ErrNotExist
+	}
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		// the redirect is relative, as the one of http.FileServer, for the
+		// handler to be usable behind http.StripPrefix
+		u := path.Base(r.URL.Path) + "/"
+		if q := r.URL.RawQuery; q != "" {
+			u += "?" + q
+		}
+		w.Header().Set("Location", u)
+		w.WriteHeader(http.StatusMovedPermanently)
+		return nil
+	}
+	if hasIndex {
+		return s.serve(w, r, index, false)
+	}
+	d, ok := f.(fs.ReadDirFile)
+	if !ok {
+		return fs.ErrNotExist
+	}
+	es, err := d.ReadDir(-1)
+	if err != nil {
+		return err
+	}
+	l := DirListing{Path: r.URL.Path, Entries: make([]DirListingEntry, 0, len(es))}
+	for _, v := range es {
+		i, err := v.Info()
+		if err != nil {
+			continue
+		}
+		e := DirListingEntry{Name: v.Name(), Href: url.PathEscape(v.Name()), Size: i.Size(), ModTime: i.ModTime(), IsDir: v.IsDir()}
+		if strings.Contains(e.Href, ":") {
+			// not to be taken for a scheme
+			e.Href = "./" + e.Href
+		}
+		if e.IsDir {
+			e.Name += "/"
+			e.Href += "/"
+		}
+		l.Entries = append(l.Entries, e)
+	}
+	sort.Slice(l.Entries, func(i, j int) bool { return l.Entries[i].Name < l.Entries[j].Name })
+	var buf bytes.Buffer
+	if err := s.o.listing.Execute(&buf, l); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	if r.Method != http.MethodHead {
+		w.Write(buf.Bytes())
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileServerETag(t *testing.T) {
+	mod := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	backend := fstest.MapFS{"foo.txt": {Data: data["foo"], ModTime: mod}}
+	identity := func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+	m, err := Mount("m", backend)
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("stream", fstest.MapFS{"foo.txt": {Data: data["foo"]}}, WithTransform(identity)))
+	h := FileServer(m)
+
+	get := func(name string, header ...string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, name, nil)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Result()
+	}
+	sum := sha256.Sum256(data["foo"])
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+	for _, v := range []string{"/m/foo.txt", "/stream/foo.txt"} {
+		res := get(v)
+		require.Equal(t, http.StatusOK, res.StatusCode, v)
+		assert.Equal(t, etag, res.Header.Get("Etag"), v)
+		b, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Equal(t, data["foo"], b, v)
+
+		res = get(v, "If-None-Match", etag)
+		assert.Equal(t, http.StatusNotModified, res.StatusCode, v)
+		res = get(v, "If-None-Match", `"other"`)
+		assert.Equal(t, http.StatusOK, res.StatusCode, v)
+	}
+
+	res := get("/m/foo.txt", "If-Modified-Since", mod.Format(http.TimeFormat))
+	assert.Equal(t, http.StatusNotModified, res.StatusCode)
+	res = get("/stream/foo.txt", "If-Modified-Since", mod.Format(http.TimeFormat))
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	backend["foo.txt"] = &fstest.MapFile{Data: data["quux"], ModTime: mod.Add(time.Hour)}
+	res = get("/m/foo.txt", "If-None-Match", etag)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.NotEqual(t, etag, res.Header.Get("Etag"))
+
+	h = FileServer(m, WithETagManifest(Manifest{"m/foo.txt": "abc"}))
+	res = get("/m/foo.txt")
+	assert.Equal(t, `"abc"`, res.Header.Get("Etag"))
+	res = get("/stream/foo.txt")
+	assert.Empty(t, res.Header.Get("Etag"))
+	assert.Equal(t, http.StatusNotFound, get("/m/missing").StatusCode)
+}
+
+func TestFileServerListing(t *testing.T) {
+	mod := time.Date(2024, 1, 2, 3, 4, 0, 0, time.UTC)
+	m, err := Mount("m", fstest.MapFS{
+		"foo.txt":         {Data: data["foo"], ModTime: mod},
+		"dir/baz":         {Data: data["baz"]},
+		"odd/a b#c.txt":   {Data: data["foo"]},
+		"odd/x:y":         {Data: data["foo"]},
+		"site/index.html": {Data: data["quux"]},
+		"site/other.html": {Data: data["baz"]},
+	})
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("other", fstest.MapFS{}))
+
+	get := func(h http.Handler, name string) *http.Response {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, name, nil))
+		return w.Result()
+	}
+	assert.Equal(t, http.StatusNotFound, get(FileServer(m), "/m/").StatusCode)
+
+	h := FileServer(m, WithDirectoryListing(nil))
+	res := get(h, "/m")
+	assert.Equal(t, http.StatusMovedPermanently, res.StatusCode)
+	assert.Equal(t, "m/", res.Header.Get("Location"))
+
+	// the redirect is relative to the stripped prefix
+	res = get(http.StripPrefix("/files", h), "/files/m/dir?sort=name")
+	assert.Equal(t, http.StatusMovedPermanently, res.StatusCode)
+	assert.Equal(t, "dir/?sort=name", res.Header.Get("Location"))
+
+	res = get(h, "/m/")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	b, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `<a href="dir/">dir/</a>`)
+	assert.Contains(t, string(b), `<a href="foo.txt">foo.txt</a>	02-Jan-2024 03:04	3`)
+
+	// the names are escaped in the links
+	res = get(h, "/m/odd/")
+	b, err = io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `<a href="a%20b%23c.txt">a b#c.txt</a>`)
+	assert.Contains(t, string(b), `<a href="./x:y">x:y</a>`)
+
+	// the directories holding an index.html are served it, listing or not
+	for _, h := range []http.Handler{h, FileServer(m)} {
+		res = get(h, "/m/site/")
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		b, err = io.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Equal(t, data["quux"], b)
+		assert.Equal(t, "site/", get(h, "/m/site").Header.Get("Location"))
+	}
+
+	tmpl := template.Must(template.New("").Parse(`{{ .Path }}:{{ range .Entries }} {{ .Name }}{{ end }}`))
+	res = get(FileServer(m, WithDirectoryListing(tmpl)), "/")
+	b, err = io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "/: m/ other/", string(b))
+}
+
+func TestFileServerETagBound(t *testing.T) {
+	s := FileServer(fstest.MapFS{}).(*fileServer)
+	for i := range maxETags + 1 {
+		s.cacheETag(&etagEntry{name: strconv.Itoa(i), etag: `"x"`})
+	}
+	assert.Len(t, s.etags, maxETags)
+	assert.Equal(t, maxETags, s.lru.Len())
+	_, ok := s.etags["0"]
+	assert.False(t, ok)
+}
+
+func TestFileServerFallback(t *testing.T) {
+	m, err := Mount("app", fstest.MapFS{
+		"index.html":    {Data: []byte("<html>app</html>")},
+		"404.html":      {Data: []byte("<html>not found</html>")},
+		"assets/app.js": {Data: []byte("js")},
+	})
+	require.NoError(t, err)
+
+	get := func(h http.Handler, name string) (*http.Response, string) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, name, nil))
+		res := w.Result()
+		b, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, string(b)
+	}
+
+	h := FileServer(m, WithSPAFallback("/app/index.html"), WithNotFoundFile("app/404.html"))
+	res, b := get(h, "/app/assets/app.js")
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "js", b)
+	res, b = get(h, "/app/users/42")
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "<html>app</html>", b)
+	assert.NotEmpty(t, res.Header.Get("Etag"))
+
+	h = FileServer(m, WithNotFoundFile("app/404.html"))
+	res, b = get(h, "/app/users/42")
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", res.Header.Get("Content-Type"))
+	assert.Equal(t, "<html>not found</html>", b)
+
+	h = FileServer(m, WithSPAFallback("missing.html"))
+	res, _ = get(h, "/app/users/42")
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
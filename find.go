@@ -0,0 +1,157 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"io/fs"
+	"iter"
+	"path"
+	"strings"
+	"time"
+)
+
+// FindType filters the entries by type.
+type FindType int
+
+const (
+	// FindAny matches all the entries.
+	FindAny FindType = iota
+	// FindFiles matches the regular files.
+	FindFiles
+	// FindDirs matches the directories.
+	FindDirs
+	// FindSymlinks matches the symbolic links.
+	FindSymlinks
+)
+
+// FindOptions are the filters of Find. The zero value matches everything.
+type FindOptions struct {
+	// Name is a path.Match pattern matched against the entries base name.
+	Name string
+	// Type restricts the matched entries type.
+	Type FindType
+	// MinSize and MaxSize bound the size of the matched entries, MaxSize
+	// being ignored when 0.
+	MinSize, MaxSize int64
+	// Newer and Older bound the modification time of the matched entries,
+	// excluded, when not zero.
+	Newer, Older time.Time
+	// MaxDepth limits the descent below root, its children being at depth
+	// 1, when greater than 0.
+	MaxDepth int
+}
+
+// Match is an entry found by Find.
+type Match struct {
+	// Path is the path of the entry in the searched file system.
+	Path string
+	fs.DirEntry
+}
+
+func (o FindOptions) needInfo() bool {
+	return o.MinSize > 0 || o.MaxSize > 0 || !o.Newer.IsZero() || !o.Older.IsZero()
+}
+
+func (o FindOptions) match(d fs.DirEntry) (bool, error) {
+	if o.Name != "" {
+		if ok, _ := path.Match(o.Name, d.Name()); !ok {
+			return false, nil
+		}
+	}
+	switch o.Type {
+	case FindFiles:
+		if !d.Type().IsRegular() {
+			return false, nil
+		}
+	case FindDirs:
+		if !d.IsDir() {
+			return false, nil
+		}
+	case FindSymlinks:
+		if d.Type()&fs.ModeSymlink == 0 {
+			return false, nil
+		}
+	}
+	if !o.needInfo() {
+		return true, nil
+	}
+	i, err := d.Info()
+	if err != nil {
+		return false, err
+	}
+	if i.Size() < o.MinSize || o.MaxSize > 0 && i.Size() > o.MaxSize {
+		return false, nil
+	}
+	if !o.Newer.IsZero() && !i.ModTime().After(o.Newer) {
+		return false, nil
+	}
+	if !o.Older.IsZero() && !i.ModTime().Before(o.Older) {
+		return false, nil
+	}
+	return true, nil
+}
+
+// Find streams the entries of the tree rooted at root matching opts,
+// root included, in the walk order. It walks fsys with WalkDir, so that
+// searching an MFS crosses its mount points. Errors are yielded with the
+// path they occurred on and the walk goes on unless the iteration stops,
+// except for an invalid Name pattern or the cancellation of ctx, which end
+// it.
+func Find(ctx context.Context, fsys fs.FS, root string, opts FindOptions) iter.Seq2[Match, error] {
+	return func(yield func(Match, error) bool) {
+		if _, err := path.Match(opts.Name, ""); err != nil {
+			yield(Match{Path: root}, err)
+			return
+		}
+		root := path.Clean(root)
+		WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+			if err := ctx.Err(); err != nil {
+				yield(Match{Path: p}, err)
+				return fs.SkipAll
+			}
+			if err != nil {
+				if !yield(Match{Path: p}, err) {
+					return fs.SkipAll
+				}
+				return nil
+			}
+			if d == nil {
+				return nil
+			}
+			ok, err := opts.match(d)
+			if ok || err != nil {
+				if !yield(Match{Path: p, DirEntry: d}, err) {
+					return fs.SkipAll
+				}
+			}
+			if d.IsDir() && opts.MaxDepth > 0 && depth(root, p) >= opts.MaxDepth {
+				return fs.SkipDir
+			}
+			return nil
+		})
+	}
+}
+
+// depth returns the number of elements of p below root.
+func depth(root, p string) int {
+	if p == root {
+		return 0
+	}
+	if root == "." || root == "/" {
+		return strings.Count(p, "/") + 1
+	}
+	return strings.Count(strings.TrimPrefix(p, root+"/"), "/") + 1
+}
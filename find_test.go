@@ -0,0 +1,75 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"path"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func find(t *testing.T, ctx context.Context, m MFS, root string, opts FindOptions) []string {
+	var res []string
+	for v, err := range Find(ctx, m, root, opts) {
+		require.NoError(t, err)
+		res = append(res, v.Path)
+	}
+	return res
+}
+
+func TestFind(t *testing.T) {
+	now := time.Now()
+	m, err := Mount("a", fstest.MapFS{
+		"foo.txt":         {Data: data["foo"], ModTime: now},
+		"dir/baz.txt":     {Data: data["quux"], ModTime: now.Add(-time.Hour)},
+		"dir/sub/qux.log": {Data: data["grault"], ModTime: now},
+	})
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("b", fstest.MapFS{"corge.txt": {Data: data["grault"], ModTime: now}}))
+	ctx := context.Background()
+
+	assert.Equal(t, []string{"a/dir/baz.txt", "a/foo.txt", "b/corge.txt"}, find(t, ctx, m, ".", FindOptions{Name: "*.txt"}))
+	assert.Equal(t, []string{"a", "a/dir", "a/dir/sub"}, find(t, ctx, m, "a", FindOptions{Type: FindDirs}))
+	assert.Equal(t, []string{"a/dir/sub/qux.log", "b/corge.txt"}, find(t, ctx, m, ".", FindOptions{Type: FindFiles, MinSize: 6}))
+	assert.Equal(t, []string{"a/foo.txt"}, find(t, ctx, m, "a", FindOptions{Type: FindFiles, MaxSize: 3}))
+	assert.Equal(t, []string{"a/dir/baz.txt"}, find(t, ctx, m, "a", FindOptions{Type: FindFiles, Older: now.Add(-time.Minute)}))
+	assert.Equal(t, []string{"a/dir/sub/qux.log", "a/foo.txt"}, find(t, ctx, m, "a", FindOptions{Type: FindFiles, Newer: now.Add(-time.Minute)}))
+	assert.Equal(t, []string{"a", "a/dir", "a/foo.txt"}, find(t, ctx, m, "a", FindOptions{MaxDepth: 1}))
+
+	var n int
+	for range Find(ctx, m, ".", FindOptions{}) {
+		if n++; n == 2 {
+			break
+		}
+	}
+	assert.Equal(t, 2, n)
+
+	for _, err := range Find(ctx, m, ".", FindOptions{Name: "["}) {
+		assert.ErrorIs(t, err, path.ErrBadPattern)
+	}
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	for _, err := range Find(cctx, m, ".", FindOptions{}) {
+		assert.ErrorIs(t, err, context.Canceled)
+	}
+	for _, err := range Find(ctx, m, "a/missing", FindOptions{}) {
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,400 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"io/fs"
+	"iter"
+	"time"
+)
+
+// forwardFS forwards the operations of fs.FS and of the optional interfaces
+// of this package to fsys. The wrappers embed it and override the
+// operations they change, the others failing with errors.ErrUnsupported
+// when fsys does not implement them: As reports whether the whole chain
+// does.
+type forwardFS struct {
+	fsys fs.FS
+	// route, when not nil, returns the file system and the name an
+	// operation on name is forwarded to, e.g. to prefix it, or an error to
+	// reject it.
+	route func(op, name string) (fs.FS, string, error)
+	// err, when not nil, maps the errors of the forwarded operations, e.g.
+	// to restore the names changed by route.
+	err func(error) error
+	// call, when not nil, runs the forwarded operations only returning an
+	// error, e.g. to bound them with a timeout.
+	call func(op, name string, fn func() error) error
+	// readDir, when not nil, lists the directories for ReadDirPage and
+	// ReadDirIter, for the wrappers changing the entries of fsys.
+	readDir func(name string) ([]fs.DirEntry, error)
+	// event, when not nil, maps an event of the watches to the ones of the
+	// wrapper, for the wrappers changing the names of fsys, e.g. to drop the
+	// events of the hidden files.
+	event func(e WatchEvent) []WatchEvent
+}
+
+// Unwrap returns the wrapped file system, see As.
+func (f *forwardFS) Unwrap() fs.FS {
+	return f.fsys
+}
+
+func (f *forwardFS) to(op, name string) (fs.FS, string, error) {
+	if f.route == nil {
+		return f.fsys, name, nil
+	}
+	return f.route(op, name)
+}
+
+func (f *forwardFS) wrap(err error) error {
+	if err == nil || f.err == nil {
+		return err
+	}
+	return f.err(err)
+}
+
+func (f *forwardFS) do(op, name string, fn func() error) error {
+	if f.call == nil {
+		return f.wrap(fn())
+	}
+	return f.wrap(f.call(op, name, fn))
+}
+
+func (f *forwardFS) Open(name string) (fs.File, error) {
+	fsys, rel, err := f.to("open", name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := fsys.Open(rel)
+	return file, f.wrap(err)
+}
+
+func (f *forwardFS) Stat(name string) (fs.FileInfo, error) {
+	fsys, rel, err := f.to("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	i, err := fs.Stat(fsys, rel)
+	return i, f.wrap(err)
+}
+
+func (f *forwardFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	fsys, rel, err := f.to("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	ds, err := fs.ReadDir(fsys, rel)
+	return ds, f.wrap(err)
+}
+
+func (f *forwardFS) ReadDirPage(name, token string, n int) ([]fs.DirEntry, string, error) {
+	if f.readDir != nil {
+		ds, err := f.readDir(name)
+		if err != nil {
+			return nil, "", err
+		}
+		return pageEntries("readdir", name, ds, token, n)
+	}
+	fsys, rel, err := f.to("readdir", name)
+	if err != nil {
+		return nil, "", err
+	}
+	ds, next, err := readDirPage(fsys, rel, token, n, nil)
+	return ds, next, f.wrap(err)
+}
+
+func (f *forwardFS) ReadDirIter(name string) iter.Seq2[fs.DirEntry, error] {
+	if f.readDir != nil {
+		return func(yield func(fs.DirEntry, error) bool) {
+			ds, err := f.readDir(name)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			for _, d := range ds {
+				if !yield(d, nil) {
+					return
+				}
+			}
+		}
+	}
+	fsys, rel, err := f.to("readdir", name)
+	if err != nil {
+		return failedIter(err)
+	}
+	return func(yield func(fs.DirEntry, error) bool) {
+		for d, err := range forwardIter(fsys, rel) {
+			if !yield(d, f.wrap(err)) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (f *forwardFS) ReadLink(name string) (string, error) {
+	fsys, rel, err := f.to("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	target, err := ReadLink(fsys, rel)
+	return target, f.wrap(err)
+}
+
+func (f *forwardFS) Lstat(name string) (fs.FileInfo, error) {
+	fsys, rel, err := f.to("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	i, err := Lstat(fsys, rel)
+	return i, f.wrap(err)
+}
+
+// Lock locks name in the wrapped file system, if it supports it, the MFS
+// holding the locks of the mounts itself.
+func (f *forwardFS) Lock(name string, shared bool) (Unlocker, error) {
+	fsys, rel, err := f.to("lock", name)
+	if err != nil {
+		return nil, err
+	}
+	l, ok := fsys.(LockFS)
+	if !ok {
+		return UnlockFunc(func() error { return nil }), nil
+	}
+	u, err := l.Lock(rel, shared)
+	return u, f.wrap(err)
+}
+
+func (f *forwardFS) Getxattr(name, attr string) ([]byte, error) {
+	fsys, rel, err := f.to("getxattr", name)
+	if err != nil {
+		return nil, err
+	}
+	x, ok := fsys.(XattrFS)
+	if !ok {
+		return nil, unsupported("getxattr", name)
+	}
+	b, err := x.Getxattr(rel, attr)
+	return b, f.wrap(err)
+}
+
+func (f *forwardFS) Setxattr(name, attr string, value []byte) error {
+	fsys, rel, err := f.to("setxattr", name)
+	if err != nil {
+		return err
+	}
+	x, ok := fsys.(XattrFS)
+	if !ok {
+		return unsupported("setxattr", name)
+	}
+	return f.do("setxattr", name, func() error {
+		return x.Setxattr(rel, attr, value)
+	})
+}
+
+func (f *forwardFS) Listxattr(name string) ([]string, error) {
+	fsys, rel, err := f.to("listxattr", name)
+	if err != nil {
+		return nil, err
+	}
+	x, ok := fsys.(XattrFS)
+	if !ok {
+		return nil, unsupported("listxattr", name)
+	}
+	res, err := x.Listxattr(rel)
+	return res, f.wrap(err)
+}
+
+func (f *forwardFS) OpenFile(name string, flag int, perm fs.FileMode) (fs.File, error) {
+	fsys, rel, err := f.to("open", name)
+	if err != nil {
+		return nil, err
+	}
+	w, ok := fsys.(OpenFileFS)
+	if !ok {
+		return nil, unsupported("open", name)
+	}
+	file, err := w.OpenFile(rel, flag, perm)
+	return file, f.wrap(err)
+}
+
+func (f *forwardFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	fsys, rel, err := f.to("write", name)
+	if err != nil {
+		return err
+	}
+	w, ok := fsys.(WriteFileFS)
+	if !ok {
+		return unsupported("write", name)
+	}
+	return f.do("write", name, func() error {
+		return w.WriteFile(rel, data, perm)
+	})
+}
+
+func (f *forwardFS) MkdirAll(name string, perm fs.FileMode) error {
+	fsys, rel, err := f.to("mkdir", name)
+	if err != nil {
+		return err
+	}
+	w, ok := fsys.(MkdirAllFS)
+	if !ok {
+		return unsupported("mkdir", name)
+	}
+	return f.do("mkdir", name, func() error {
+		return w.MkdirAll(rel, perm)
+	})
+}
+
+func (f *forwardFS) Remove(name string) error {
+	fsys, rel, err := f.to("remove", name)
+	if err != nil {
+		return err
+	}
+	w, ok := fsys.(RemoveFS)
+	if !ok {
+		return unsupported("remove", name)
+	}
+	return f.do("remove", name, func() error {
+		return w.Remove(rel)
+	})
+}
+
+func (f *forwardFS) RemoveAll(name string) error {
+	fsys, rel, err := f.to("removeall", name)
+	if err != nil {
+		return err
+	}
+	w, ok := fsys.(RemoveAllFS)
+	if !ok {
+		return unsupported("removeall", name)
+	}
+	return f.do("removeall", name, func() error {
+		return w.RemoveAll(rel)
+	})
+}
+
+// Rename renames in the file system oldname is routed to.
+func (f *forwardFS) Rename(oldname, newname string) error {
+	fsys, oldrel, err := f.to("rename", oldname)
+	if err != nil {
+		return err
+	}
+	_, newrel, err := f.to("rename", newname)
+	if err != nil {
+		return err
+	}
+	w, ok := fsys.(RenameFS)
+	if !ok {
+		return unsupported("rename", oldname)
+	}
+	return f.do("rename", oldname, func() error {
+		return w.Rename(oldrel, newrel)
+	})
+}
+
+func (f *forwardFS) Chtimes(name string, atime, mtime time.Time) error {
+	fsys, rel, err := f.to("chtimes", name)
+	if err != nil {
+		return err
+	}
+	w, ok := fsys.(ChtimesFS)
+	if !ok {
+		return unsupported("chtimes", name)
+	}
+	return f.do("chtimes", name, func() error {
+		return w.Chtimes(rel, atime, mtime)
+	})
+}
+
+func (f *forwardFS) Chmod(name string, mode fs.FileMode) error {
+	fsys, rel, err := f.to("chmod", name)
+	if err != nil {
+		return err
+	}
+	w, ok := fsys.(ChmodFS)
+	if !ok {
+		return unsupported("chmod", name)
+	}
+	return f.do("chmod", name, func() error {
+		return w.Chmod(rel, mode)
+	})
+}
+
+// Usage reports the usage of the wrapped file system, the wrappers not
+// changing the space it holds.
+func (f *forwardFS) Usage() (Usage, error) {
+	u, ok := f.fsys.(UsageFS)
+	if !ok {
+		return Usage{}, unsupported("usage", ".")
+	}
+	s, err := u.Usage()
+	return s, f.wrap(err)
+}
+
+func (f *forwardFS) Snapshot() (SnapshotID, error) {
+	s, ok := f.fsys.(SnapshotFS)
+	if !ok {
+		return 0, unsupported("snapshot", ".")
+	}
+	id, err := s.Snapshot()
+	return id, f.wrap(err)
+}
+
+func (f *forwardFS) Rollback(id SnapshotID) error {
+	s, ok := f.fsys.(SnapshotFS)
+	if !ok {
+		return unsupported("rollback", ".")
+	}
+	return f.do("rollback", ".", func() error {
+		return s.Rollback(id)
+	})
+}
+
+// Watch watches name in the wrapped file system, if it notifies its changes,
+// the names of the events being mapped back to the ones of the wrapper.
+func (f *forwardFS) Watch(ctx context.Context, name string) (<-chan WatchEvent, error) {
+	fsys, rel, err := f.to("watch", name)
+	if err != nil {
+		return nil, err
+	}
+	w, ok := watcher(fsys)
+	if !ok {
+		return nil, unsupported("watch", name)
+	}
+	in, err := w.Watch(ctx, rel)
+	if err != nil {
+		return nil, f.wrap(err)
+	}
+	if rel == name && f.event == nil {
+		return in, nil
+	}
+	return mapEvents(ctx, in, func(e WatchEvent) []WatchEvent {
+		if rel != name {
+			e.Path = rebase(e.Path, rel, name)
+		}
+		if f.event == nil {
+			return []WatchEvent{e}
+		}
+		return f.event(e)
+	}), nil
+}
+
+// canWatch reports whether the wrapped file system notifies its changes,
+// see watcher.
+func (f *forwardFS) canWatch() bool {
+	_, ok := watcher(f.fsys)
+	return ok
+}
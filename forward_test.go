@@ -0,0 +1,120 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/unicode/norm"
+)
+
+func TestForward(t *testing.T) {
+	dir := symlinkDir(t)
+	wrappers := map[string]func(fs.FS) fs.FS{
+		"confine": Confine,
+		"sub": func(fsys fs.FS) fs.FS {
+			return newSubFS(DirFS(filepath.Dir(dir)), filepath.Base(dir))
+		},
+		"cache": func(fsys fs.FS) fs.FS {
+			return Cache(fsys, time.Minute)
+		},
+		"timeout": func(fsys fs.FS) fs.FS {
+			return Timeout(fsys, time.Minute)
+		},
+		"limit": func(fsys fs.FS) fs.FS {
+			return Limit(fsys, 1, QueueOnLimit)
+		},
+		"retry": func(fsys fs.FS) fs.FS {
+			return Retry(fsys, RetryPolicy{})
+		},
+		"breaker": func(fsys fs.FS) fs.FS {
+			return CircuitBreaker(fsys, 1, time.Minute)
+		},
+		"glob": func(fsys fs.FS) fs.FS {
+			return GlobFilter(fsys, nil, []string{"*.secret"})
+		},
+		"maxsize": func(fsys fs.FS) fs.FS {
+			return MaxFileSize(fsys, 1024)
+		},
+		"decompress": Decompress,
+		"transform": func(fsys fs.FS) fs.FS {
+			return Transform(fsys, func(_ string, r io.Reader) (io.Reader, error) {
+				return r, nil
+			})
+		},
+		"verify": func(fsys fs.FS) fs.FS {
+			return Verify(fsys, Manifest{})
+		},
+		"normalize": func(fsys fs.FS) fs.FS {
+			return Normalize(fsys, norm.NFC)
+		},
+		"symlinks": func(fsys fs.FS) fs.FS {
+			return Symlinks(fsys, SymlinkContain)
+		},
+		"trash": func(fsys fs.FS) fs.FS {
+			return newTrashFS(fsys, fsys, time.Hour)
+		},
+		"merge": func(fsys fs.FS) fs.FS {
+			return Merge(fsys, NewMemFS())
+		},
+	}
+	for k, wrap := range wrappers {
+		t.Run(k, func(t *testing.T) {
+			fsys := wrap(DirFS(dir))
+			_, ok := As[ReadLinkFS](fsys)
+			assert.True(t, ok)
+			target, err := ReadLink(fsys, "file")
+			require.NoError(t, err)
+			assert.Equal(t, "sub/foo", target)
+			i, err := Lstat(fsys, "file")
+			require.NoError(t, err)
+			assert.Equal(t, fs.ModeSymlink, i.Mode().Type())
+			_, err = Lstat(fsys, "missing")
+			assert.ErrorIs(t, err, fs.ErrNotExist)
+
+			// the operations the chain does not support fail
+			_, ok = As[RenameFS](fsys)
+			assert.False(t, ok)
+			r, ok := fsys.(RenameFS)
+			require.True(t, ok)
+			assert.ErrorIs(t, r.Rename("file", "other"), errors.ErrUnsupported)
+		})
+	}
+}
+
+func TestForwardLock(t *testing.T) {
+	backend := &lockingFS{MemFS: NewMemFS(), locked: map[string]bool{"dir/held": true}}
+	fsys := newSubFS(Timeout(Confine(backend), time.Minute), "dir")
+	_, ok := As[LockFS](fsys)
+	assert.True(t, ok)
+	_, err := fsys.Lock("held", false)
+	assert.ErrorIs(t, err, ErrLocked)
+	var pe *fs.PathError
+	require.ErrorAs(t, err, &pe)
+	assert.Equal(t, "held", pe.Path)
+	u, err := fsys.Lock("free", false)
+	require.NoError(t, err)
+	assert.True(t, backend.locked["dir/free"])
+	require.NoError(t, u.Unlock())
+	_, err = fsys.Lock("../escape", false)
+	assert.ErrorIs(t, err, fs.ErrInvalid)
+}
@@ -0,0 +1,377 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ftp serves an MFS over FTP with the ftpserverlib server.
+//
+// The MFS is exposed read-only by default, WithWrites enabling the uploads,
+// the directories creation and the removals and renames.
+package ftp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	ftpserver "github.com/fclairamb/ftpserverlib"
+	"github.com/spf13/afero"
+
+	"go.linka.cloud/mfs"
+)
+
+var (
+	_ ftpserver.MainDriver                          = (*Driver)(nil)
+	_ ftpserver.ClientDriver                        = (*clientDriver)(nil)
+	_ ftpserver.ClientDriverExtensionFileList       = (*clientDriver)(nil)
+	_ ftpserver.ClientDriverExtensionAvailableSpace = (*clientDriver)(nil)
+	_ afero.File                                    = (*file)(nil)
+)
+
+// ErrNoTLS is returned when a client requests TLS while the driver was not
+// given a TLS configuration.
+var ErrNoTLS = errors.New("ftp: TLS is not configured")
+
+// AuthFunc authenticates the FTP users.
+type AuthFunc func(user, pass string) error
+
+// Option configures the Driver.
+type Option func(o *options)
+
+type options struct {
+	writable bool
+	settings *ftpserver.Settings
+	auth     AuthFunc
+	tls      *tls.Config
+}
+
+// WithWrites serves the MFS read-write. The writes to mounts which do not
+// support them still fail.
+func WithWrites() Option {
+	return func(o *options) {
+		o.writable = true
+	}
+}
+
+// WithSettings sets the server settings. They default to listening on
+// ":2121".
+func WithSettings(s *ftpserver.Settings) Option {
+	return func(o *options) {
+		o.settings = s
+	}
+}
+
+// WithAuth authenticates the users with fn. Without it, any user is
+// accepted.
+func WithAuth(fn AuthFunc) Option {
+	return func(o *options) {
+		o.auth = fn
+	}
+}
+
+// WithTLSConfig enables the explicit TLS of the control and data
+// connections.
+func WithTLSConfig(c *tls.Config) Option {
+	return func(o *options) {
+		o.tls = c
+	}
+}
+
+// Driver is the ftpserverlib main driver serving an MFS. The operations of
+// the authenticated users are done with their name as the identity, see
+// mfs.ContextWithIdentity.
+type Driver struct {
+	m mfs.MFS
+	o *options
+}
+
+// NewDriver returns the driver serving m.
+func NewDriver(m mfs.MFS, opts ...Option) *Driver {
+	o := &options{}
+	for _, v := range opts {
+		v(o)
+	}
+	if o.settings == nil {
+		o.settings = &ftpserver.Settings{ListenAddr: ":2121"}
+	}
+	return &Driver{m: m, o: o}
+}
+
+// NewServer returns the FTP server serving m, see NewDriver.
+func NewServer(m mfs.MFS, opts ...Option) *ftpserver.FtpServer {
+	return ftpserver.NewFtpServer(NewDriver(m, opts...))
+}
+
+func (d *Driver) GetSettings() (*ftpserver.Settings, error) {
+	return d.o.settings, nil
+}
+
+func (d *Driver) ClientConnected(ftpserver.ClientContext) (string, error) {
+	return "MFS FTP server", nil
+}
+
+func (d *Driver) ClientDisconnected(ftpserver.ClientContext) {}
+
+func (d *Driver) AuthUser(_ ftpserver.ClientContext, user, pass string) (ftpserver.ClientDriver, error) {
+	if d.o.auth != nil {
+		if err := d.o.auth(user, pass); err != nil {
+			return nil, err
+		}
+	}
+	m := d.m.WithContext(mfs.ContextWithIdentity(context.Background(), user))
+	return &clientDriver{m: m, writable: d.o.writable}, nil
+}
+
+func (d *Driver) GetTLSConfig() (*tls.Config, error) {
+	if d.o.tls == nil {
+		return nil, ErrNoTLS
+	}
+	return d.o.tls, nil
+}
+
+// clientDriver is the afero.Fs of an authenticated user.
+type clientDriver struct {
+	m        mfs.MFS
+	writable bool
+}
+
+// name converts the absolute paths given by the server to MFS names.
+func name(p string) string {
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if p == "" {
+		return "."
+	}
+	return p
+}
+
+func (c *clientDriver) check(op, p string) error {
+	if !c.writable {
+		return &fs.PathError{Op: op, Path: p, Err: fs.ErrPermission}
+	}
+	return nil
+}
+
+func (c *clientDriver) Name() string {
+	return "mfs"
+}
+
+func (c *clientDriver) Create(p string) (afero.File, error) {
+	return c.OpenFile(p, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (c *clientDriver) Mkdir(p string, perm os.FileMode) error {
+	if err := c.check("mkdir", p); err != nil {
+		return err
+	}
+	n := name(p)
+	if _, err := fs.Stat(c.m, n); err == nil {
+		return &fs.PathError{Op: "mkdir", Path: p, Err: fs.ErrExist}
+	}
+	if _, err := fs.Stat(c.m, path.Dir(n)); err != nil {
+		return err
+	}
+	return c.m.MkdirAll(n, perm)
+}
+
+func (c *clientDriver) MkdirAll(p string, perm os.FileMode) error {
+	if err := c.check("mkdir", p); err != nil {
+		return err
+	}
+	return c.m.MkdirAll(name(p), perm)
+}
+
+func (c *clientDriver) Open(p string) (afero.File, error) {
+	return c.OpenFile(p, os.O_RDONLY, 0)
+}
+
+// OpenFile opens the file p. The server creating files with all the
+// permissions, they are restricted to 0644.
+func (c *clientDriver) OpenFile(p string, flag int, perm os.FileMode) (afero.File, error) {
+	n := name(p)
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) == 0 {
+		f, err := c.m.Open(n)
+		if err != nil {
+			return nil, err
+		}
+		return &file{File: f, name: p}, nil
+	}
+	if err := c.check("open", p); err != nil {
+		return nil, err
+	}
+	f, err := c.m.OpenFile(n, flag, perm&0644)
+	if err != nil {
+		return nil, err
+	}
+	return &file{File: f, name: p}, nil
+}
+
+func (c *clientDriver) Remove(p string) error {
+	if err := c.check("remove", p); err != nil {
+		return err
+	}
+	return c.m.Remove(name(p))
+}
+
+func (c *clientDriver) RemoveAll(p string) error {
+	if err := c.check("removeall", p); err != nil {
+		return err
+	}
+	return c.m.RemoveAll(name(p))
+}
+
+func (c *clientDriver) Rename(oldname, newname string) error {
+	if err := c.check("rename", oldname); err != nil {
+		return err
+	}
+	return c.m.Rename(name(oldname), name(newname))
+}
+
+func (c *clientDriver) Stat(p string) (os.FileInfo, error) {
+	return fs.Stat(c.m, name(p))
+}
+
+func (c *clientDriver) Chmod(p string, mode os.FileMode) error {
+	if err := c.check("chmod", p); err != nil {
+		return err
+	}
+	return c.m.Chmod(name(p), mode)
+}
+
+func (c *clientDriver) Chown(p string, _, _ int) error {
+	return &fs.PathError{Op: "chown", Path: p, Err: errors.ErrUnsupported}
+}
+
+func (c *clientDriver) Chtimes(p string, atime, mtime time.Time) error {
+	if err := c.check("chtimes", p); err != nil {
+		return err
+	}
+	return c.m.Chtimes(name(p), atime, mtime)
+}
+
+func (c *clientDriver) ReadDir(p string) ([]os.FileInfo, error) {
+	ds, err := c.m.ReadDir(name(p))
+	if err != nil {
+		return nil, err
+	}
+	return infos(ds)
+}
+
+func (c *clientDriver) GetAvailableSpace(p string) (int64, error) {
+	u, err := c.m.Usage(name(p))
+	if err != nil {
+		return 0, err
+	}
+	return int64(u.Free), nil
+}
+
+func infos(ds []fs.DirEntry) ([]os.FileInfo, error) {
+	res := make([]os.FileInfo, 0, len(ds))
+	for _, d := range ds {
+		i, err := d.Info()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, i)
+	}
+	return res, nil
+}
+
+// file is the afero.File of an MFS file, the operations its backend does not
+// support failing with errors.ErrUnsupported.
+type file struct {
+	fs.File
+	name string
+}
+
+func (f *file) unsupported(op string) error {
+	return &fs.PathError{Op: op, Path: f.name, Err: errors.ErrUnsupported}
+}
+
+func (f *file) Name() string {
+	return f.name
+}
+
+func (f *file) ReadAt(b []byte, off int64) (int, error) {
+	if r, ok := f.File.(io.ReaderAt); ok {
+		return r.ReadAt(b, off)
+	}
+	return 0, f.unsupported("read")
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := f.File.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	return 0, f.unsupported("seek")
+}
+
+func (f *file) Write(b []byte) (int, error) {
+	if w, ok := f.File.(io.Writer); ok {
+		return w.Write(b)
+	}
+	return 0, f.unsupported("write")
+}
+
+func (f *file) WriteAt(b []byte, off int64) (int, error) {
+	if w, ok := f.File.(io.WriterAt); ok {
+		return w.WriteAt(b, off)
+	}
+	return 0, f.unsupported("write")
+}
+
+func (f *file) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *file) Readdir(n int) ([]os.FileInfo, error) {
+	d, ok := f.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, f.unsupported("readdir")
+	}
+	ds, err := d.ReadDir(n)
+	if err != nil {
+		return nil, err
+	}
+	return infos(ds)
+}
+
+func (f *file) Readdirnames(n int) ([]string, error) {
+	is, err := f.Readdir(n)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(is))
+	for i, v := range is {
+		names[i] = v.Name()
+	}
+	return names, nil
+}
+
+func (f *file) Sync() error {
+	if s, ok := f.File.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+func (f *file) Truncate(size int64) error {
+	if t, ok := f.File.(interface{ Truncate(int64) error }); ok {
+		return t.Truncate(size)
+	}
+	return f.unsupported("truncate")
+}
@@ -0,0 +1,118 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ftp
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"net"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	ftpserver "github.com/fclairamb/ftpserverlib"
+	"github.com/secsy/goftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.linka.cloud/mfs"
+)
+
+func serve(t *testing.T, m mfs.MFS, opts ...Option) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := NewServer(m, append(opts, WithSettings(&ftpserver.Settings{Listener: l}))...)
+	require.NoError(t, s.Listen())
+	go s.Serve()
+	t.Cleanup(func() { s.Stop() })
+	return l.Addr().String()
+}
+
+func dial(t *testing.T, addr, user, pass string) *goftp.Client {
+	c, err := goftp.DialConfig(goftp.Config{User: user, Password: pass, Timeout: 5 * time.Second}, addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestReadOnly(t *testing.T) {
+	m, err := mfs.Mount("static", fstest.MapFS{"foo": {Data: []byte("foo")}, "dir/bar": {Data: []byte("bar")}})
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("mem", mfs.NewMemFS()))
+	c := dial(t, serve(t, m), "anonymous", "anonymous")
+
+	is, err := c.ReadDir("/")
+	require.NoError(t, err)
+	require.Len(t, is, 2)
+	assert.Equal(t, "mem", is[0].Name())
+	assert.Equal(t, "static", is[1].Name())
+
+	is, err = c.ReadDir("/static")
+	require.NoError(t, err)
+	require.Len(t, is, 2)
+
+	var b bytes.Buffer
+	require.NoError(t, c.Retrieve("/static/dir/bar", &b))
+	assert.Equal(t, "bar", b.String())
+
+	assert.Error(t, c.Store("/mem/foo", bytes.NewBufferString("foo")))
+	_, err = c.Mkdir("/mem/dir")
+	assert.Error(t, err)
+	assert.Error(t, c.Delete("/static/foo"))
+	_, err = fs.Stat(m, "mem/foo")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestReadWrite(t *testing.T) {
+	m, err := mfs.Mount("mem", mfs.NewMemFS())
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("static", fstest.MapFS{}))
+	auth := func(user, pass string) error {
+		if user != "user" || pass != "pass" {
+			return errors.New("invalid credentials")
+		}
+		return nil
+	}
+	addr := serve(t, m, WithWrites(), WithAuth(auth))
+
+	_, err = goftp.DialConfig(goftp.Config{User: "user", Password: "wrong", Timeout: 5 * time.Second}, addr)
+	if err == nil {
+		_, err = dial(t, addr, "user", "wrong").ReadDir("/")
+	}
+	assert.Error(t, err)
+
+	c := dial(t, addr, "user", "pass")
+	_, err = c.Mkdir("/mem/dir")
+	require.NoError(t, err)
+	require.NoError(t, c.Store("/mem/dir/foo", bytes.NewBufferString("foo")))
+	b, err := fs.ReadFile(m, "mem/dir/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(b))
+	i, err := fs.Stat(m, "mem/dir/foo")
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0644), i.Mode().Perm())
+
+	require.NoError(t, c.Rename("/mem/dir/foo", "/mem/dir/bar"))
+	i, err = c.Stat("/mem/dir/bar")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), i.Size())
+	require.NoError(t, c.Delete("/mem/dir/bar"))
+	require.NoError(t, c.Rmdir("/mem/dir"))
+	_, err = fs.Stat(m, "mem/dir")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	assert.Error(t, c.Store("/static/foo", bytes.NewBufferString("foo")))
+}
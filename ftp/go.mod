@@ -0,0 +1,24 @@
+module go.linka.cloud/mfs/ftp
+
+go 1.23.2
+
+require (
+	github.com/fclairamb/ftpserverlib v0.25.0
+	github.com/secsy/goftp v0.0.0-20200609142545-aa2de14babf4
+	github.com/spf13/afero v1.11.0
+	github.com/stretchr/testify v1.10.0
+	go.linka.cloud/mfs v0.0.0-00010101000000-000000000000
+)
+
+require (
+	github.com/andybalholm/brotli v1.1.1 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/fclairamb/go-log v0.5.0 // indirect
+	github.com/klauspost/compress v1.17.11 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/sys v0.29.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace go.linka.cloud/mfs => ../
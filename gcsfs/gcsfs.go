@@ -0,0 +1,258 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gcsfs provides a file system over a Google Cloud Storage bucket.
+// Directories are synthesized from the "/" separated object names.
+//
+// Opened files read the object generation they were opened with, so that
+// seeking or reading at offsets never mixes the content of two versions of
+// an object being overwritten.
+package gcsfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"net/http"
+	"strconv"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+
+	"go.linka.cloud/mfs/internal/objfs"
+)
+
+const defaultPageSize = 1000
+
+// Option configures the file system.
+type Option func(o *options)
+
+type options struct {
+	prefix   string
+	writable bool
+	pageSize int
+	ctx      context.Context
+}
+
+// WithPrefix exposes only the objects under prefix.
+func WithPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+// WithWrites makes the file system writable: WriteFile uploads objects and
+// Remove and RemoveAll delete them.
+func WithWrites() Option {
+	return func(o *options) {
+		o.writable = true
+	}
+}
+
+// WithPageSize sets the number of objects requested by listing page. It
+// defaults to 1000.
+func WithPageSize(n int) Option {
+	return func(o *options) {
+		o.pageSize = n
+	}
+}
+
+// WithContext sets the context used for the requests. It defaults to
+// context.Background.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// New returns a file system over the objects of the bucket.
+func New(b *storage.BucketHandle, opts ...Option) fs.FS {
+	return newFS(&bucketHandle{b: b}, opts...)
+}
+
+// Open creates a client authenticated with the application default
+// credentials, e.g. from the GOOGLE_APPLICATION_CREDENTIALS environment
+// variable, and returns a file system over bucket.
+func Open(ctx context.Context, bucket string, opts ...Option) (fs.FS, error) {
+	c, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return New(c.Bucket(bucket), opts...), nil
+}
+
+func newFS(b bucket, opts ...Option) fs.FS {
+	o := &options{ctx: context.Background(), pageSize: defaultPageSize}
+	for _, v := range opts {
+		v(o)
+	}
+	s := &store{b: b, pageSize: o.pageSize}
+	if o.writable {
+		return objfs.NewWritable(o.ctx, s, o.prefix)
+	}
+	return objfs.New(o.ctx, s, o.prefix)
+}
+
+// bucket is the subset of the bucket API used by the store.
+type bucket interface {
+	objects(ctx context.Context, q *storage.Query, pageSize int) objectIterator
+	attrs(ctx context.Context, name string) (*storage.ObjectAttrs, error)
+	newRangeReader(ctx context.Context, name string, gen, off, n int64) (io.ReadCloser, storage.ReaderObjectAttrs, error)
+	newWriter(ctx context.Context, name string) io.WriteCloser
+	delete(ctx context.Context, name string) error
+}
+
+type objectIterator interface {
+	Next() (*storage.ObjectAttrs, error)
+}
+
+type bucketHandle struct {
+	b *storage.BucketHandle
+}
+
+func (h *bucketHandle) objects(ctx context.Context, q *storage.Query, pageSize int) objectIterator {
+	it := h.b.Objects(ctx, q)
+	it.PageInfo().MaxSize = pageSize
+	return it
+}
+
+func (h *bucketHandle) attrs(ctx context.Context, name string) (*storage.ObjectAttrs, error) {
+	return h.b.Object(name).Attrs(ctx)
+}
+
+func (h *bucketHandle) newRangeReader(ctx context.Context, name string, gen, off, n int64) (io.ReadCloser, storage.ReaderObjectAttrs, error) {
+	o := h.b.Object(name)
+	if gen != 0 {
+		o = o.Generation(gen)
+	}
+	r, err := o.NewRangeReader(ctx, off, n)
+	if err != nil {
+		return nil, storage.ReaderObjectAttrs{}, err
+	}
+	return r, r.Attrs, nil
+}
+
+func (h *bucketHandle) newWriter(ctx context.Context, name string) io.WriteCloser {
+	return h.b.Object(name).NewWriter(ctx)
+}
+
+func (h *bucketHandle) delete(ctx context.Context, name string) error {
+	return h.b.Object(name).Delete(ctx)
+}
+
+type store struct {
+	b        bucket
+	pageSize int
+}
+
+func (s *store) List(ctx context.Context, prefix string) ([]objfs.Object, []string, error) {
+	return objfs.Collect(s.ListPages(ctx, prefix))
+}
+
+// ListPages yields the listing by pages of up to pageSize entries, the
+// iterator fetching the objects page by page.
+func (s *store) ListPages(ctx context.Context, prefix string) iter.Seq2[objfs.Page, error] {
+	return func(yield func(objfs.Page, error) bool) {
+		it := s.b.objects(ctx, &storage.Query{Prefix: prefix, Delimiter: "/"}, s.pageSize)
+		var (
+			page objfs.Page
+			n    int
+		)
+		for {
+			a, err := it.Next()
+			if err == iterator.Done {
+				if n > 0 {
+					yield(page, nil)
+				}
+				return
+			}
+			if err != nil {
+				yield(objfs.Page{}, mapErr(err))
+				return
+			}
+			if a.Prefix != "" {
+				page.Prefixes = append(page.Prefixes, a.Prefix)
+			} else {
+				page.Objects = append(page.Objects, object(a))
+			}
+			if n++; n == s.pageSize {
+				if !yield(page, nil) {
+					return
+				}
+				page, n = objfs.Page{}, 0
+			}
+		}
+	}
+}
+
+func (s *store) Stat(ctx context.Context, key string) (objfs.Object, error) {
+	a, err := s.b.attrs(ctx, key)
+	if err != nil {
+		return objfs.Object{}, mapErr(err)
+	}
+	return object(a), nil
+}
+
+func (s *store) Get(ctx context.Context, key, version string, off, n int64) (io.ReadCloser, objfs.Object, error) {
+	var gen int64
+	if version != "" {
+		var err error
+		if gen, err = strconv.ParseInt(version, 10, 64); err != nil {
+			return nil, objfs.Object{}, fmt.Errorf("invalid generation %q: %w", version, err)
+		}
+	}
+	r, a, err := s.b.newRangeReader(ctx, key, gen, off, n)
+	if err != nil {
+		return nil, objfs.Object{}, mapErr(err)
+	}
+	return r, objfs.Object{Key: key, Size: a.Size, ModTime: a.LastModified, Version: strconv.FormatInt(a.Generation, 10)}, nil
+}
+
+func (s *store) Put(ctx context.Context, key string, r io.Reader, _ int64) error {
+	w := s.b.newWriter(ctx, key)
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return mapErr(err)
+	}
+	return mapErr(w.Close())
+}
+
+func (s *store) Delete(ctx context.Context, key string) error {
+	return mapErr(s.b.delete(ctx, key))
+}
+
+func object(a *storage.ObjectAttrs) objfs.Object {
+	return objfs.Object{Key: a.Name, Size: a.Size, ModTime: a.Updated, Version: strconv.FormatInt(a.Generation, 10)}
+}
+
+// mapErr maps the storage errors to their fs equivalent.
+func mapErr(err error) error {
+	if errors.Is(err, storage.ErrObjectNotExist) || errors.Is(err, storage.ErrBucketNotExist) {
+		return fmt.Errorf("%w: %v", fs.ErrNotExist, err)
+	}
+	var ae *googleapi.Error
+	if errors.As(err, &ae) {
+		switch ae.Code {
+		case http.StatusNotFound:
+			return fmt.Errorf("%w: %v", fs.ErrNotExist, err)
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return fmt.Errorf("%w: %v", fs.ErrPermission, err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,193 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsfs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"cloud.google.com/go/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/iterator"
+
+	"go.linka.cloud/mfs"
+)
+
+// fakeBucket keeps every generation of its objects.
+type fakeBucket struct {
+	mu   sync.Mutex
+	data map[string][][]byte
+}
+
+func newFakeBucket(objects map[string]string) *fakeBucket {
+	b := &fakeBucket{data: make(map[string][][]byte)}
+	for k, v := range objects {
+		b.data[k] = [][]byte{[]byte(v)}
+	}
+	return b
+}
+
+func (b *fakeBucket) put(name string, data []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data[name] = append(b.data[name], data)
+}
+
+func (b *fakeBucket) list(q *storage.Query) []*storage.ObjectAttrs {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var res []*storage.ObjectAttrs
+	seen := make(map[string]bool)
+	for k, v := range b.data {
+		if !strings.HasPrefix(k, q.Prefix) {
+			continue
+		}
+		if i := strings.Index(k[len(q.Prefix):], q.Delimiter); q.Delimiter != "" && i >= 0 {
+			p := k[:len(q.Prefix)+i+1]
+			if !seen[p] {
+				seen[p] = true
+				res = append(res, &storage.ObjectAttrs{Prefix: p})
+			}
+			continue
+		}
+		res = append(res, &storage.ObjectAttrs{Name: k, Size: int64(len(v[len(v)-1])), Generation: int64(len(v))})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name+res[i].Prefix < res[j].Name+res[j].Prefix
+	})
+	return res
+}
+
+func (b *fakeBucket) objects(_ context.Context, q *storage.Query, _ int) objectIterator {
+	return &fakeIterator{attrs: b.list(q)}
+}
+
+func (b *fakeBucket) attrs(_ context.Context, name string) (*storage.ObjectAttrs, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	v, ok := b.data[name]
+	if !ok {
+		return nil, storage.ErrObjectNotExist
+	}
+	return &storage.ObjectAttrs{Name: name, Size: int64(len(v[len(v)-1])), Generation: int64(len(v))}, nil
+}
+
+func (b *fakeBucket) newRangeReader(_ context.Context, name string, gen, off, n int64) (io.ReadCloser, storage.ReaderObjectAttrs, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	v, ok := b.data[name]
+	if !ok || gen > int64(len(v)) {
+		return nil, storage.ReaderObjectAttrs{}, storage.ErrObjectNotExist
+	}
+	if gen == 0 {
+		gen = int64(len(v))
+	}
+	data := v[gen-1]
+	r := data[min(off, int64(len(data))):]
+	if n >= 0 && n < int64(len(r)) {
+		r = r[:n]
+	}
+	return io.NopCloser(bytes.NewReader(r)), storage.ReaderObjectAttrs{Size: int64(len(data)), Generation: gen}, nil
+}
+
+type fakeWriter struct {
+	bytes.Buffer
+	b    *fakeBucket
+	name string
+}
+
+func (w *fakeWriter) Close() error {
+	w.b.put(w.name, w.Bytes())
+	return nil
+}
+
+func (b *fakeBucket) newWriter(_ context.Context, name string) io.WriteCloser {
+	return &fakeWriter{b: b, name: name}
+}
+
+func (b *fakeBucket) delete(_ context.Context, name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.data[name]; !ok {
+		return storage.ErrObjectNotExist
+	}
+	delete(b.data, name)
+	return nil
+}
+
+type fakeIterator struct {
+	attrs []*storage.ObjectAttrs
+	i     int
+}
+
+func (it *fakeIterator) Next() (*storage.ObjectAttrs, error) {
+	if it.i >= len(it.attrs) {
+		return nil, iterator.Done
+	}
+	it.i++
+	return it.attrs[it.i-1], nil
+}
+
+func TestGCSFS(t *testing.T) {
+	b := newFakeBucket(map[string]string{
+		"site/index.html":   "index",
+		"site/a":            "a",
+		"site/css/main.css": "body{}",
+		"other":             "other",
+	})
+	f := newFS(b, WithPrefix("site"), WithPageSize(1))
+	require.NoError(t, fstest.TestFS(f, "index.html", "a", "css/main.css"))
+	_, err := f.Open("other")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestGCSFSGeneration(t *testing.T) {
+	b := newFakeBucket(map[string]string{"foo": "generation 1"})
+	f := newFS(b)
+	file, err := f.Open("foo")
+	require.NoError(t, err)
+	defer file.Close()
+	b.put("foo", []byte("generation 2"))
+
+	_, err = file.(io.Seeker).Seek(11, io.SeekStart)
+	require.NoError(t, err)
+	data, err := io.ReadAll(file)
+	require.NoError(t, err)
+	assert.Equal(t, "1", string(data))
+
+	data, err = fs.ReadFile(f, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "generation 2", string(data))
+}
+
+func TestGCSFSWrites(t *testing.T) {
+	b := newFakeBucket(nil)
+	m, err := mfs.Mount("gcs", newFS(b, WithWrites()))
+	require.NoError(t, err)
+	require.NoError(t, m.WriteFile("gcs/dir/foo", []byte("foo"), 0644))
+	data, err := fs.ReadFile(m, "gcs/dir/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(data))
+	require.NoError(t, m.RemoveAll("gcs/dir"))
+	assert.Empty(t, b.data)
+}
@@ -0,0 +1,293 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"io/fs"
+	"iter"
+	"path"
+	"strings"
+)
+
+// WithInclude only exposes the files of the mount matching one of globs,
+// see GlobFilter. It may be given several times, the globs being appended.
+func WithInclude(globs ...string) MountOption {
+	return func(o *mountOptions) {
+		o.include = append(o.include, globs...)
+	}
+}
+
+// WithExclude hides the files and directories of the mount matching one of
+// globs, see GlobFilter. It may be given several times, the globs being
+// appended.
+func WithExclude(globs ...string) MountOption {
+	return func(o *mountOptions) {
+		o.exclude = append(o.exclude, globs...)
+	}
+}
+
+// WithHideDotfiles hides the files and directories of the mount whose name
+// starts with a dot, with their content, e.g. for a public file server. It
+// is WithExclude(".*").
+func WithHideDotfiles() MountOption {
+	return WithExclude(".*")
+}
+
+// GlobFilter returns a file system hiding the entries of fsys excluded by
+// the globs: the files matching none of include when it is not empty, the
+// files and directories matching one of exclude with their content. The
+// directories are not subject to include, e.g. "*.css" exposes the style
+// sheets of all the directories.
+//
+// The globs are path.Match patterns, "**" matching any number of
+// directories. The globs without a slash are matched against the base name
+// of the entries at any depth, e.g. "*.secret", the others against their
+// path, e.g. "assets/*.js" or ".git/**", which matches ".git" and its
+// content. Invalid globs match nothing.
+//
+// The hidden entries are missing from the listings and cannot be opened
+// nor stated, failing with fs.ErrNotExist, so that fs.Glob, which lists the
+// directories, honours the filters too. Writing them fails with
+// fs.ErrPermission.
+func GlobFilter(fsys fs.FS, include, exclude []string) fs.FS {
+	g := &globFS{include: include, exclude: exclude}
+	g.forwardFS = forwardFS{fsys: fsys, route: g.route, event: g.event}
+	return g
+}
+
+type globFS struct {
+	forwardFS
+	include, exclude []string
+}
+
+// hidden reports whether the entry name, a directory when dir is set, is
+// filtered out.
+func (g *globFS) hidden(name string, dir bool) bool {
+	if name == "." {
+		return false
+	}
+	// the content of the excluded directories is excluded
+	for p := name; p != "."; p = path.Dir(p) {
+		if matchGlobs(g.exclude, p) {
+			return true
+		}
+	}
+	return !dir && len(g.include) != 0 && !matchGlobs(g.include, name)
+}
+
+func matchGlobs(globs []string, name string) bool {
+	for _, v := range globs {
+		if !strings.Contains(v, "/") {
+			if ok, _ := path.Match(v, path.Base(name)); ok {
+				return true
+			}
+			continue
+		}
+		if matchGlob(strings.Split(v, "/"), strings.Split(name, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches the segments of a name against the ones of a glob.
+func matchGlob(glob, name []string) bool {
+	for len(glob) > 0 {
+		if glob[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchGlob(glob[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(glob[0], name[0]); !ok {
+			return false
+		}
+		glob, name = glob[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// check fails with fs.ErrNotExist when name is hidden, stating it to know
+// whether it is a directory when include is set.
+func (g *globFS) check(op, name string) (fs.FileInfo, error) {
+	if g.hidden(name, true) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if len(g.include) == 0 {
+		return nil, nil
+	}
+	i, err := fs.Stat(g.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if g.hidden(name, i.IsDir()) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return i, nil
+}
+
+// checkWrite fails with fs.ErrPermission when name would be hidden.
+func (g *globFS) checkWrite(op, name string, dir bool) error {
+	if g.hidden(name, dir) {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrPermission}
+	}
+	return nil
+}
+
+// route checks the names of the forwarded operations, the written ones
+// failing with fs.ErrPermission when they would be hidden.
+func (g *globFS) route(op, name string) (fs.FS, string, error) {
+	var err error
+	switch op {
+	case "open", "write":
+		err = g.checkWrite(op, name, false)
+	case "mkdir":
+		err = g.checkWrite(op, name, true)
+	default:
+		_, err = g.check(op, name)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return g.fsys, name, nil
+}
+
+// event drops the events of the hidden entries. The removed ones cannot be
+// stated to know whether they are directories: only exclude applies to them.
+func (g *globFS) event(e WatchEvent) []WatchEvent {
+	dir := true
+	if len(g.include) != 0 && !e.Removed {
+		i, err := fs.Stat(g.fsys, e.Path)
+		dir = err == nil && i.IsDir()
+	}
+	if g.hidden(e.Path, dir) {
+		return nil
+	}
+	return []WatchEvent{e}
+}
+
+func (g *globFS) Open(name string) (fs.File, error) {
+	if _, err := g.check("open", name); err != nil {
+		return nil, err
+	}
+	f, err := g.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := f.(fs.ReadDirFile); ok {
+		return &globDir{ReadDirFile: d, g: g, name: name}, nil
+	}
+	return f, nil
+}
+
+func (g *globFS) Stat(name string) (fs.FileInfo, error) {
+	i, err := g.check("stat", name)
+	if err != nil || i != nil {
+		return i, err
+	}
+	return fs.Stat(g.fsys, name)
+}
+
+func (g *globFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if _, err := g.check("readdir", name); err != nil {
+		return nil, err
+	}
+	ds, err := fs.ReadDir(g.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return g.filter(name, ds), nil
+}
+
+// ReadDirPage filters the page of the wrapped file system, which may then
+// hold fewer entries than requested.
+func (g *globFS) ReadDirPage(name, token string, n int) ([]fs.DirEntry, string, error) {
+	if _, err := g.check("readdir", name); err != nil {
+		return nil, "", err
+	}
+	ds, next, err := readDirPage(g.fsys, name, token, n, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return g.filter(name, ds), next, nil
+}
+
+func (g *globFS) ReadDirIter(name string) iter.Seq2[fs.DirEntry, error] {
+	if _, err := g.check("readdir", name); err != nil {
+		return failedIter(err)
+	}
+	return func(yield func(fs.DirEntry, error) bool) {
+		for d, err := range forwardIter(g.fsys, name) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if g.hidden(joinMountPath(name, d.Name()), d.IsDir()) {
+				continue
+			}
+			if !yield(d, nil) {
+				return
+			}
+		}
+	}
+}
+
+// filter removes the hidden entries of the directory name from ds.
+func (g *globFS) filter(name string, ds []fs.DirEntry) []fs.DirEntry {
+	res := ds[:0]
+	for _, d := range ds {
+		if !g.hidden(joinMountPath(name, d.Name()), d.IsDir()) {
+			res = append(res, d)
+		}
+	}
+	return res
+}
+
+func (g *globFS) Rename(oldname, newname string) error {
+	w, ok := g.fsys.(RenameFS)
+	if !ok {
+		return unsupported("rename", oldname)
+	}
+	i, err := g.check("rename", oldname)
+	if err != nil {
+		return err
+	}
+	if err := g.checkWrite("rename", newname, i != nil && i.IsDir()); err != nil {
+		return err
+	}
+	return w.Rename(oldname, newname)
+}
+
+type globDir struct {
+	fs.ReadDirFile
+	g    *globFS
+	name string
+}
+
+func (d *globDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	for {
+		ds, err := d.ReadDirFile.ReadDir(n)
+		ds = d.g.filter(d.name, ds)
+		// keep reading when a whole batch was filtered out
+		if len(ds) > 0 || err != nil || n <= 0 {
+			return ds, err
+		}
+	}
+}
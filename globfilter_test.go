@@ -0,0 +1,132 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlobFilter(t *testing.T) {
+	src := fstest.MapFS{
+		"index.html":         {Data: []byte("index")},
+		"app.js":             {Data: []byte("app")},
+		"style.css":          {Data: []byte("style")},
+		"db.secret":          {Data: []byte("secret")},
+		"assets/logo.css":    {Data: []byte("logo")},
+		"assets/key.secret":  {Data: []byte("secret")},
+		".git/config":        {Data: []byte("config")},
+		".git/objects/ab/cd": {Data: []byte("object")},
+	}
+	mem := NewMemFS()
+	m, err := Mount("site", src, WithExclude("*.secret", ".git/**"))
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("static", src, WithInclude("*.css", "*.js"), WithExclude("assets/**")))
+	require.NoError(t, m.Mount("rw", mem, WithExclude("*.secret")))
+
+	names := func(name string) []string {
+		ds, err := m.ReadDir(name)
+		require.NoError(t, err)
+		var res []string
+		for _, v := range ds {
+			res = append(res, v.Name())
+		}
+		return res
+	}
+	assert.Equal(t, []string{"app.js", "assets", "index.html", "style.css"}, names("site"))
+	assert.Equal(t, []string{"logo.css"}, names("site/assets"))
+	// the directories are not subject to the include globs
+	assert.Equal(t, []string{".git", "app.js", "style.css"}, names("static"))
+
+	for _, v := range []string{"site/db.secret", "site/assets/key.secret", "site/.git", "site/.git/config", "site/.git/objects/ab/cd", "static/index.html", "static/assets/logo.css"} {
+		_, err := m.Open(v)
+		assert.ErrorIs(t, err, fs.ErrNotExist, v)
+		_, err = fs.Stat(m, v)
+		assert.ErrorIs(t, err, fs.ErrNotExist, v)
+	}
+	b, err := fs.ReadFile(m, "static/style.css")
+	require.NoError(t, err)
+	assert.Equal(t, "style", string(b))
+
+	matches, err := fs.Glob(m, "site/*")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"site/app.js", "site/assets", "site/index.html", "site/style.css"}, matches)
+	matches, err = fs.Glob(m, "site/assets/*.secret")
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+
+	f, err := m.Open("site")
+	require.NoError(t, err)
+	ds, err := f.(fs.ReadDirFile).ReadDir(1)
+	require.NoError(t, err)
+	require.Len(t, ds, 1)
+	assert.Equal(t, "app.js", ds[0].Name())
+	require.NoError(t, f.Close())
+
+	assert.ErrorIs(t, m.WriteFile("rw/new.secret", nil, 0644), fs.ErrPermission)
+	require.NoError(t, m.WriteFile("rw/new.txt", nil, 0644))
+	assert.ErrorIs(t, m.Rename("rw/new.txt", "rw/new.secret"), fs.ErrPermission)
+}
+
+func TestMatchGlobs(t *testing.T) {
+	for _, v := range []struct {
+		glob, name string
+		want       bool
+	}{
+		{"*.secret", "a.secret", true},
+		{"*.secret", "dir/a.secret", true},
+		{"dir/*.js", "dir/a.js", true},
+		{"dir/*.js", "other/dir/a.js", false},
+		{"**/*.js", "a.js", true},
+		{"**/*.js", "a/b/c.js", true},
+		{".git/**", ".git", true},
+		{".git/**", ".git/a/b", true},
+		{".git/**", "a/.git", false},
+		{"a/**/b", "a/x/y/b", true},
+		{"[", "[", false},
+	} {
+		assert.Equal(t, v.want, matchGlobs([]string{v.glob}, v.name), "%s %s", v.glob, v.name)
+	}
+}
+
+func TestHideDotfiles(t *testing.T) {
+	m, err := Mount("public", fstest.MapFS{
+		"index.html":    {Data: []byte("index")},
+		".env":          {Data: []byte("secret")},
+		".well-known/a": {Data: []byte("a")},
+		"dir/.htaccess": {Data: []byte("deny")},
+		"dir/page.html": {Data: []byte("page")},
+	}, WithHideDotfiles())
+	require.NoError(t, err)
+
+	ds, err := m.ReadDir("public")
+	require.NoError(t, err)
+	require.Len(t, ds, 2)
+	assert.Equal(t, "dir", ds[0].Name())
+	assert.Equal(t, "index.html", ds[1].Name())
+	ds, err = m.ReadDir("public/dir")
+	require.NoError(t, err)
+	require.Len(t, ds, 1)
+	assert.Equal(t, "page.html", ds[0].Name())
+
+	for _, v := range []string{"public/.env", "public/.well-known", "public/.well-known/a", "public/dir/.htaccess"} {
+		_, err := fs.ReadFile(m, v)
+		assert.ErrorIs(t, err, fs.ErrNotExist, v)
+	}
+}
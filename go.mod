@@ -2,10 +2,17 @@ module go.linka.cloud/mfs
 
 go 1.23.2
 
+require (
+	github.com/andybalholm/brotli v1.1.1
+	github.com/klauspost/compress v1.17.11
+	github.com/psanford/memfs v0.0.0-20241019191636-4ef911798f9b
+	github.com/stretchr/testify v1.10.0
+	golang.org/x/sys v0.29.0
+	golang.org/x/text v0.21.0
+)
+
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/psanford/memfs v0.0.0-20241019191636-4ef911798f9b // indirect
-	github.com/stretchr/testify v1.9.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,192 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"iter"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// binarySniffLen is the length of the file prefix looked at for NUL bytes
+// to detect binary files.
+const binarySniffLen = 512
+
+// GrepMatch is a line matched by Grep.
+type GrepMatch struct {
+	Path string
+	// Line is the 1-based number of the matched line, 0 for binary files.
+	Line int
+	// Text is the matched line, without its line terminator.
+	Text string
+	// Binary reports a binary file containing a match, reported once
+	// without line.
+	Binary bool
+}
+
+// GrepOption configures Grep.
+type GrepOption func(o *grepOptions)
+
+type grepOptions struct {
+	concurrency int
+	find        FindOptions
+}
+
+// WithGrepConcurrency bounds the number of files searched concurrently. It
+// defaults to 8.
+func WithGrepConcurrency(n int) GrepOption {
+	return func(o *grepOptions) {
+		if n > 0 {
+			o.concurrency = n
+		}
+	}
+}
+
+// WithGrepFilter restricts the searched files to those matching opts. Only
+// regular files are searched whatever opts.Type.
+func WithGrepFilter(opts FindOptions) GrepOption {
+	return func(o *grepOptions) {
+		o.find = opts
+	}
+}
+
+type grepResult struct {
+	m   GrepMatch
+	err error
+}
+
+// Grep streams the lines of the files of the tree rooted at root matching
+// pattern. The files are found with Find, crossing the mount points of an
+// MFS, and searched concurrently: the matches of a file are yielded in
+// order but may interleave with those of other files. Files with a NUL byte
+// in their first 512 bytes are binary and reported once when matching.
+// Errors are yielded with the path they occurred on and the search goes on
+// unless the iteration stops or ctx is done.
+func Grep(ctx context.Context, fsys fs.FS, root string, pattern *regexp.Regexp, opts ...GrepOption) iter.Seq2[GrepMatch, error] {
+	o := &grepOptions{concurrency: defaultConcurrency}
+	for _, v := range opts {
+		v(o)
+	}
+	o.find.Type = FindFiles
+	return func(yield func(GrepMatch, error) bool) {
+		cctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		out := make(chan grepResult)
+		send := func(r grepResult) bool {
+			select {
+			case out <- r:
+				return true
+			case <-cctx.Done():
+				return false
+			}
+		}
+		paths := make(chan string)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(paths)
+			for v, err := range Find(cctx, fsys, root, o.find) {
+				if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+					return
+				}
+				if err != nil {
+					if !send(grepResult{m: GrepMatch{Path: v.Path}, err: err}) {
+						return
+					}
+					continue
+				}
+				select {
+				case paths <- v.Path:
+				case <-cctx.Done():
+					return
+				}
+			}
+		}()
+		for range o.concurrency {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for p := range paths {
+					if cctx.Err() != nil {
+						continue
+					}
+					if err := grepFile(fsys, p, pattern, send); err != nil && !send(grepResult{m: GrepMatch{Path: p}, err: err}) {
+						return
+					}
+				}
+			}()
+		}
+		go func() {
+			wg.Wait()
+			close(out)
+		}()
+		for r := range out {
+			if !yield(r.m, r.err) {
+				cancel()
+				for range out {
+				}
+				return
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			yield(GrepMatch{Path: root}, err)
+		}
+	}
+}
+
+// grepFile sends the matches of the file name to send, stopping when send
+// returns false.
+func grepFile(fsys fs.FS, name string, pattern *regexp.Regexp, send func(grepResult) bool) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	head, err := r.Peek(binarySniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		if pattern.MatchReader(r) {
+			send(grepResult{m: GrepMatch{Path: name, Binary: true}})
+		}
+		return nil
+	}
+	for n := 1; ; n++ {
+		line, err := r.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		if line == "" && err != nil {
+			return nil
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if pattern.MatchString(line) && !send(grepResult{m: GrepMatch{Path: name, Line: n, Text: line}}) {
+			return nil
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
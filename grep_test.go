@@ -0,0 +1,69 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGrep(t *testing.T) {
+	m, err := Mount("a", fstest.MapFS{
+		"foo.txt":     {Data: []byte("hello\nworld\r\nhello again")},
+		"dir/bar.log": {Data: []byte("nothing here\nsay hello\n")},
+		"bin":         {Data: []byte("hello\x00world")},
+	})
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("b", fstest.MapFS{"baz.txt": {Data: []byte("world")}}))
+	ctx := context.Background()
+
+	grep := func(re string, opts ...GrepOption) []string {
+		var res []string
+		for v, err := range Grep(ctx, m, ".", regexp.MustCompile(re), opts...) {
+			require.NoError(t, err)
+			res = append(res, fmt.Sprintf("%s:%d:%s:%v", v.Path, v.Line, v.Text, v.Binary))
+		}
+		sort.Strings(res)
+		return res
+	}
+	assert.Equal(t, []string{
+		"a/bin:0::true",
+		"a/dir/bar.log:2:say hello:false",
+		"a/foo.txt:1:hello:false",
+		"a/foo.txt:3:hello again:false",
+	}, grep("hello"))
+	assert.Equal(t, []string{"a/foo.txt:2:world:false", "b/baz.txt:1:world:false"}, grep("^world$", WithGrepConcurrency(1)))
+	assert.Equal(t, []string{"a/foo.txt:2:world:false", "b/baz.txt:1:world:false"}, grep("world", WithGrepFilter(FindOptions{Name: "*.txt"})))
+
+	n := 0
+	for range Grep(ctx, m, ".", regexp.MustCompile("o")) {
+		n++
+		break
+	}
+	assert.Equal(t, 1, n)
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	for _, err := range Grep(cctx, m, ".", regexp.MustCompile("o")) {
+		assert.ErrorIs(t, err, context.Canceled)
+	}
+}
@@ -0,0 +1,338 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"sort"
+
+	"google.golang.org/grpc"
+)
+
+var (
+	_ fs.StatFS     = (*FS)(nil)
+	_ fs.ReadDirFS  = (*FS)(nil)
+	_ fs.ReadFileFS = (*FS)(nil)
+	_ io.ReaderAt   = (*file)(nil)
+	_ io.Seeker     = (*file)(nil)
+)
+
+// Option configures the client file system.
+type Option func(o *options)
+
+type options struct {
+	ctx context.Context
+}
+
+// WithContext sets the context used for the requests. It defaults to
+// context.Background.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// FS is the file system served by a Server, e.g. to be mounted in an MFS.
+// Its files implement io.Seeker and io.ReaderAt, their content being
+// streamed from the requested offset.
+type FS struct {
+	c   FSClient
+	ctx context.Context
+}
+
+// New returns the file system served on conn.
+func New(conn grpc.ClientConnInterface, opts ...Option) *FS {
+	o := &options{ctx: context.Background()}
+	for _, v := range opts {
+		v(o)
+	}
+	return &FS{c: NewFSClient(conn), ctx: o.ctx}
+}
+
+func (f *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	i, err := f.c.Open(f.ctx, &OpenRequest{Name: name})
+	if err != nil {
+		return nil, fromStatus("open", name, err)
+	}
+	info := fileInfo{i}
+	if info.IsDir() {
+		return &dir{fs: f, name: name, info: info}, nil
+	}
+	return &file{fs: f, name: name, info: info}, nil
+}
+
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	i, err := f.c.Stat(f.ctx, &StatRequest{Name: name})
+	if err != nil {
+		return nil, fromStatus("stat", name, err)
+	}
+	return fileInfo{i}, nil
+}
+
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	stream, err := f.c.ReadDir(f.ctx, &ReadDirRequest{Name: name})
+	if err != nil {
+		return nil, fromStatus("readdir", name, err)
+	}
+	ds, err := readDir(name, -1, stream)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i].Name() < ds[j].Name() })
+	return ds, nil
+}
+
+// readDir receives at least n entries of the directory name from stream
+// unless it ends, all of them when n is negative.
+func readDir(name string, n int, stream FS_ReadDirClient) ([]fs.DirEntry, error) {
+	var ds []fs.DirEntry
+	for n < 0 || len(ds) < n {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ds, fromStatus("readdir", name, err)
+		}
+		for _, v := range res.GetEntries() {
+			ds = append(ds, fs.FileInfoToDirEntry(fileInfo{v}))
+		}
+	}
+	return ds, nil
+}
+
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	return f.read(f.ctx, name, 0, 0)
+}
+
+// read returns the content of name from offset, up to length bytes unless
+// it is zero.
+func (f *FS) read(ctx context.Context, name string, offset, length int64) ([]byte, error) {
+	stream, err := f.c.Read(ctx, &ReadRequest{Name: name, Offset: offset, Length: length})
+	if err != nil {
+		return nil, fromStatus("read", name, err)
+	}
+	var b []byte
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			return b, nil
+		}
+		if err != nil {
+			return nil, fromStatus("read", name, err)
+		}
+		b = append(b, res.GetData()...)
+	}
+}
+
+type file struct {
+	fs     *FS
+	name   string
+	info   fileInfo
+	offset int64
+	// stream is the content being read from offset
+	stream FS_ReadClient
+	cancel context.CancelFunc
+	buf    []byte
+	closed bool
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	if f.closed {
+		return nil, &fs.PathError{Op: "stat", Path: f.name, Err: fs.ErrClosed}
+	}
+	return f.info, nil
+}
+
+func (f *file) Read(b []byte) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+	if f.stream == nil {
+		ctx, cancel := context.WithCancel(f.fs.ctx)
+		stream, err := f.fs.c.Read(ctx, &ReadRequest{Name: f.name, Offset: f.offset})
+		if err != nil {
+			cancel()
+			return 0, fromStatus("read", f.name, err)
+		}
+		f.stream, f.cancel = stream, cancel
+	}
+	for len(f.buf) == 0 {
+		res, err := f.stream.Recv()
+		if err == io.EOF {
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, fromStatus("read", f.name, err)
+		}
+		f.buf = res.GetData()
+	}
+	n := copy(b, f.buf)
+	f.buf = f.buf[n:]
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *file) ReadAt(b []byte, off int64) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	data, err := f.fs.read(f.fs.ctx, f.name, off, int64(len(b)))
+	n := copy(b, data)
+	if err != nil {
+		return n, err
+	}
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrClosed}
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.Size()
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if offset != f.offset {
+		f.reset()
+		f.offset = offset
+	}
+	return offset, nil
+}
+
+// reset stops the content stream, the next Read opening a new one.
+func (f *file) reset() {
+	if f.cancel != nil {
+		f.cancel()
+	}
+	f.stream, f.cancel, f.buf = nil, nil, nil
+}
+
+func (f *file) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.reset()
+	f.closed = true
+	return nil
+}
+
+type dir struct {
+	fs     *FS
+	name   string
+	info   fileInfo
+	stream FS_ReadDirClient
+	cancel context.CancelFunc
+	// buf holds the entries received but not returned yet
+	buf    []fs.DirEntry
+	eof    bool
+	closed bool
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) {
+	if d.closed {
+		return nil, &fs.PathError{Op: "stat", Path: d.name, Err: fs.ErrClosed}
+	}
+	return d.info, nil
+}
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: fs.ErrClosed}
+	}
+	if d.stream == nil && !d.eof {
+		ctx, cancel := context.WithCancel(d.fs.ctx)
+		stream, err := d.fs.c.ReadDir(ctx, &ReadDirRequest{Name: d.name})
+		if err != nil {
+			cancel()
+			return nil, fromStatus("readdir", d.name, err)
+		}
+		d.stream, d.cancel = stream, cancel
+	}
+	if !d.eof && (n <= 0 || len(d.buf) < n) {
+		want := -1
+		if n > 0 {
+			want = n - len(d.buf)
+		}
+		ds, err := readDir(d.name, want, d.stream)
+		d.buf = append(d.buf, ds...)
+		if err != nil {
+			return nil, err
+		}
+		if n <= 0 || len(ds) < want {
+			d.eof = true
+			d.cancel()
+		}
+	}
+	if n <= 0 {
+		ds := d.buf
+		d.buf = nil
+		return ds, nil
+	}
+	if len(d.buf) == 0 {
+		return nil, io.EOF
+	}
+	k := min(n, len(d.buf))
+	ds := d.buf[:k]
+	d.buf = d.buf[k:]
+	return ds, nil
+}
+
+func (d *dir) Close() error {
+	if d.closed {
+		return &fs.PathError{Op: "close", Path: d.name, Err: fs.ErrClosed}
+	}
+	if d.cancel != nil {
+		d.cancel()
+	}
+	d.closed = true
+	return nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package grpc serves file systems over gRPC, e.g. a composed MFS, and
+// provides the client file system reading them, so that a process can mount
+// the file system of another one.
+//
+// The service is described by mfs.proto. The names are the ones of the
+// served file system, slash-separated and unrooted.
+package grpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative mfs.proto
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// chunkSize is the maximum size of the content sent in a ReadResponse.
+const chunkSize = 32 << 10
+
+// readDirBatch is the maximum number of entries sent in a ReadDirResponse.
+const readDirBatch = 256
+
+func newFileInfo(i fs.FileInfo) *FileInfo {
+	return &FileInfo{
+		Name:    i.Name(),
+		Size:    i.Size(),
+		Mode:    uint32(i.Mode()),
+		ModTime: timestamppb.New(i.ModTime()),
+	}
+}
+
+// fileInfo is the fs.FileInfo of a received FileInfo.
+type fileInfo struct {
+	i *FileInfo
+}
+
+func (i fileInfo) Name() string       { return i.i.GetName() }
+func (i fileInfo) Size() int64        { return i.i.GetSize() }
+func (i fileInfo) Mode() fs.FileMode  { return fs.FileMode(i.i.GetMode()) }
+func (i fileInfo) ModTime() time.Time { return i.i.GetModTime().AsTime() }
+func (i fileInfo) IsDir() bool        { return i.Mode().IsDir() }
+func (i fileInfo) Sys() any           { return nil }
+
+// toStatus converts the errors of the served file system to gRPC status
+// errors, the fs and context sentinel errors being mapped to status codes.
+func toStatus(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	code := codes.Unknown
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		code = codes.NotFound
+	case errors.Is(err, fs.ErrExist):
+		code = codes.AlreadyExists
+	case errors.Is(err, fs.ErrPermission):
+		code = codes.PermissionDenied
+	case errors.Is(err, fs.ErrInvalid):
+		code = codes.InvalidArgument
+	case errors.Is(err, fs.ErrClosed):
+		code = codes.FailedPrecondition
+	case errors.Is(err, errors.ErrUnsupported):
+		code = codes.Unimplemented
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	}
+	// the client adds the operation and path back
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		err = pe.Err
+	}
+	return status.Error(code, err.Error())
+}
+
+// remoteError is an error returned by the server.
+type remoteError struct {
+	code codes.Code
+	msg  string
+}
+
+func (e *remoteError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the sentinel error matching the status code.
+func (e *remoteError) Unwrap() error {
+	switch e.code {
+	case codes.NotFound:
+		return fs.ErrNotExist
+	case codes.AlreadyExists:
+		return fs.ErrExist
+	case codes.PermissionDenied:
+		return fs.ErrPermission
+	case codes.InvalidArgument:
+		return fs.ErrInvalid
+	case codes.FailedPrecondition:
+		return fs.ErrClosed
+	case codes.Unimplemented:
+		return errors.ErrUnsupported
+	case codes.DeadlineExceeded:
+		return context.DeadlineExceeded
+	case codes.Canceled:
+		return context.Canceled
+	default:
+		return nil
+	}
+}
+
+func fromStatus(op, name string, err error) error {
+	if s, ok := status.FromError(err); ok {
+		err = &remoteError{code: s.Code(), msg: s.Message()}
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
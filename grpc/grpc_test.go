@@ -0,0 +1,128 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"go.linka.cloud/mfs"
+)
+
+func serve(t *testing.T, fsys fs.FS) *FS {
+	l := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	RegisterFSServer(s, NewServer(fsys))
+	go s.Serve(l)
+	t.Cleanup(s.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return New(conn)
+}
+
+func TestFS(t *testing.T) {
+	big := strings.Repeat("0123456789", 4<<10)
+	mem := mfs.NewMemFS()
+	require.NoError(t, mem.MkdirAll("dir", 0755))
+	require.NoError(t, mem.WriteFile("dir/big", []byte(big), 0644))
+	require.NoError(t, mem.WriteFile("foo", []byte("foo"), 0644))
+	m, err := mfs.Mount("mem", mem)
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("map", fstest.MapFS{"bar": {Data: []byte("bar")}}))
+
+	require.NoError(t, fstest.TestFS(serve(t, fstest.MapFS{"foo": {Data: []byte("foo")}, "dir/bar": {Data: []byte("bar")}}), "foo", "dir/bar"))
+
+	c := serve(t, m)
+
+	b, err := fs.ReadFile(c, "mem/dir/big")
+	require.NoError(t, err)
+	assert.Equal(t, big, string(b))
+
+	f, err := c.Open("mem/dir/big")
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.(io.Seeker).Seek(30005, io.SeekStart)
+	require.NoError(t, err)
+	p := make([]byte, 5)
+	_, err = io.ReadFull(f, p)
+	require.NoError(t, err)
+	assert.Equal(t, "56789", string(p))
+	n, err := f.(io.ReaderAt).ReadAt(p, int64(len(big)-3))
+	assert.Equal(t, 3, n)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, "789", string(p[:n]))
+
+	_, err = c.Open("mem/missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	var pe *fs.PathError
+	require.True(t, errors.As(err, &pe))
+	assert.Equal(t, "mem/missing", pe.Path)
+	_, err = c.Stat("../foo")
+	assert.ErrorIs(t, err, fs.ErrInvalid)
+	_, err = c.ReadDir("mem/foo")
+	assert.Error(t, err)
+
+	// the remote file system can be mounted in another MFS
+	r, err := mfs.Mount("remote", c)
+	require.NoError(t, err)
+	b, err = fs.ReadFile(r, "remote/mem/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(b))
+	ds, err := r.ReadDir("remote")
+	require.NoError(t, err)
+	require.Len(t, ds, 2)
+	assert.Equal(t, "map", ds[0].Name())
+	assert.Equal(t, "mem", ds[1].Name())
+}
+
+func TestReadDirBatches(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for i := range readDirBatch*2 + 1 {
+		fsys[strings.Repeat("a", i+1)] = &fstest.MapFile{}
+	}
+	c := serve(t, fsys)
+	ds, err := c.ReadDir(".")
+	require.NoError(t, err)
+	assert.Len(t, ds, readDirBatch*2+1)
+
+	f, err := c.Open(".")
+	require.NoError(t, err)
+	defer f.Close()
+	d := f.(fs.ReadDirFile)
+	ds, err = d.ReadDir(10)
+	require.NoError(t, err)
+	assert.Len(t, ds, 10)
+	ds, err = d.ReadDir(-1)
+	require.NoError(t, err)
+	assert.Len(t, ds, readDirBatch*2+1-10)
+	_, err = d.ReadDir(1)
+	assert.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,272 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: mfs.proto
+
+package grpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	FS_Open_FullMethodName    = "/linka.cloud.mfs.FS/Open"
+	FS_Stat_FullMethodName    = "/linka.cloud.mfs.FS/Stat"
+	FS_ReadDir_FullMethodName = "/linka.cloud.mfs.FS/ReadDir"
+	FS_Read_FullMethodName    = "/linka.cloud.mfs.FS/Read"
+)
+
+// FSClient is the client API for FS service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// FS exposes a read-only file system. The names are slash-separated and
+// unrooted, as for the Go io/fs package.
+type FSClient interface {
+	// Open opens the named file or directory and returns its information.
+	Open(ctx context.Context, in *OpenRequest, opts ...grpc.CallOption) (*FileInfo, error)
+	// Stat returns the information of the named file.
+	Stat(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (*FileInfo, error)
+	// ReadDir streams the entries of the named directory by batches, sorted
+	// by name.
+	ReadDir(ctx context.Context, in *ReadDirRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ReadDirResponse], error)
+	// Read streams the content of the named file by chunks.
+	Read(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ReadResponse], error)
+}
+
+type fSClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFSClient(cc grpc.ClientConnInterface) FSClient {
+	return &fSClient{cc}
+}
+
+func (c *fSClient) Open(ctx context.Context, in *OpenRequest, opts ...grpc.CallOption) (*FileInfo, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FileInfo)
+	err := c.cc.Invoke(ctx, FS_Open_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fSClient) Stat(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (*FileInfo, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FileInfo)
+	err := c.cc.Invoke(ctx, FS_Stat_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fSClient) ReadDir(ctx context.Context, in *ReadDirRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ReadDirResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FS_ServiceDesc.Streams[0], FS_ReadDir_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ReadDirRequest, ReadDirResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FS_ReadDirClient = grpc.ServerStreamingClient[ReadDirResponse]
+
+func (c *fSClient) Read(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ReadResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FS_ServiceDesc.Streams[1], FS_Read_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ReadRequest, ReadResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FS_ReadClient = grpc.ServerStreamingClient[ReadResponse]
+
+// FSServer is the server API for FS service.
+// All implementations must embed UnimplementedFSServer
+// for forward compatibility.
+//
+// FS exposes a read-only file system. The names are slash-separated and
+// unrooted, as for the Go io/fs package.
+type FSServer interface {
+	// Open opens the named file or directory and returns its information.
+	Open(context.Context, *OpenRequest) (*FileInfo, error)
+	// Stat returns the information of the named file.
+	Stat(context.Context, *StatRequest) (*FileInfo, error)
+	// ReadDir streams the entries of the named directory by batches, sorted
+	// by name.
+	ReadDir(*ReadDirRequest, grpc.ServerStreamingServer[ReadDirResponse]) error
+	// Read streams the content of the named file by chunks.
+	Read(*ReadRequest, grpc.ServerStreamingServer[ReadResponse]) error
+	mustEmbedUnimplementedFSServer()
+}
+
+// UnimplementedFSServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedFSServer struct{}
+
+func (UnimplementedFSServer) Open(context.Context, *OpenRequest) (*FileInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Open not implemented")
+}
+func (UnimplementedFSServer) Stat(context.Context, *StatRequest) (*FileInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stat not implemented")
+}
+func (UnimplementedFSServer) ReadDir(*ReadDirRequest, grpc.ServerStreamingServer[ReadDirResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method ReadDir not implemented")
+}
+func (UnimplementedFSServer) Read(*ReadRequest, grpc.ServerStreamingServer[ReadResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Read not implemented")
+}
+func (UnimplementedFSServer) mustEmbedUnimplementedFSServer() {}
+func (UnimplementedFSServer) testEmbeddedByValue()            {}
+
+// UnsafeFSServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FSServer will
+// result in compilation errors.
+type UnsafeFSServer interface {
+	mustEmbedUnimplementedFSServer()
+}
+
+func RegisterFSServer(s grpc.ServiceRegistrar, srv FSServer) {
+	// If the following call pancis, it indicates UnimplementedFSServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&FS_ServiceDesc, srv)
+}
+
+func _FS_Open_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OpenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FSServer).Open(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FS_Open_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FSServer).Open(ctx, req.(*OpenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FS_Stat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FSServer).Stat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FS_Stat_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FSServer).Stat(ctx, req.(*StatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FS_ReadDir_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ReadDirRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FSServer).ReadDir(m, &grpc.GenericServerStream[ReadDirRequest, ReadDirResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FS_ReadDirServer = grpc.ServerStreamingServer[ReadDirResponse]
+
+func _FS_Read_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ReadRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FSServer).Read(m, &grpc.GenericServerStream[ReadRequest, ReadResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FS_ReadServer = grpc.ServerStreamingServer[ReadResponse]
+
+// FS_ServiceDesc is the grpc.ServiceDesc for FS service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var FS_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "linka.cloud.mfs.FS",
+	HandlerType: (*FSServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Open",
+			Handler:    _FS_Open_Handler,
+		},
+		{
+			MethodName: "Stat",
+			Handler:    _FS_Stat_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ReadDir",
+			Handler:       _FS_ReadDir_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Read",
+			Handler:       _FS_Read_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "mfs.proto",
+}
@@ -0,0 +1,141 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"context"
+	"io"
+	"io/fs"
+
+	"go.linka.cloud/mfs"
+)
+
+var _ FSServer = (*Server)(nil)
+
+// Server is the FSServer exposing a file system.
+type Server struct {
+	UnimplementedFSServer
+	fsys fs.FS
+}
+
+// NewServer returns a Server exposing fsys. When fsys is an mfs.MFS, the
+// requests context is passed to its operations, see mfs.MFS.WithContext.
+// The server is registered with RegisterFSServer.
+func NewServer(fsys fs.FS) *Server {
+	return &Server{fsys: fsys}
+}
+
+func (s *Server) withContext(ctx context.Context) fs.FS {
+	if m, ok := s.fsys.(mfs.MFS); ok {
+		return m.WithContext(ctx)
+	}
+	return s.fsys
+}
+
+func (s *Server) Open(ctx context.Context, req *OpenRequest) (*FileInfo, error) {
+	f, err := s.withContext(ctx).Open(req.GetName())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	defer f.Close()
+	i, err := f.Stat()
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return newFileInfo(i), nil
+}
+
+func (s *Server) Stat(ctx context.Context, req *StatRequest) (*FileInfo, error) {
+	i, err := fs.Stat(s.withContext(ctx), req.GetName())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return newFileInfo(i), nil
+}
+
+func (s *Server) ReadDir(req *ReadDirRequest, stream FS_ReadDirServer) error {
+	ctx := stream.Context()
+	var (
+		ds  []fs.DirEntry
+		err error
+	)
+	if m, ok := s.fsys.(mfs.MFS); ok {
+		ds, err = m.WithContext(ctx).ReadDirContext(ctx, req.GetName())
+	} else {
+		ds, err = fs.ReadDir(s.fsys, req.GetName())
+	}
+	if err != nil {
+		return toStatus(err)
+	}
+	for len(ds) != 0 {
+		n := min(len(ds), readDirBatch)
+		res := &ReadDirResponse{Entries: make([]*FileInfo, 0, n)}
+		for _, d := range ds[:n] {
+			i, err := d.Info()
+			if err != nil {
+				return toStatus(err)
+			}
+			res.Entries = append(res.Entries, newFileInfo(i))
+		}
+		if err := stream.Send(res); err != nil {
+			return err
+		}
+		ds = ds[n:]
+	}
+	return nil
+}
+
+func (s *Server) Read(req *ReadRequest, stream FS_ReadServer) error {
+	if req.GetOffset() < 0 || req.GetLength() < 0 {
+		return toStatus(&fs.PathError{Op: "read", Path: req.GetName(), Err: fs.ErrInvalid})
+	}
+	f, err := s.withContext(stream.Context()).Open(req.GetName())
+	if err != nil {
+		return toStatus(err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if off := req.GetOffset(); off > 0 {
+		if sk, ok := f.(io.Seeker); ok {
+			_, err = sk.Seek(off, io.SeekStart)
+		} else {
+			_, err = io.CopyN(io.Discard, f, off)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return toStatus(err)
+		}
+	}
+	if req.GetLength() > 0 {
+		r = io.LimitReader(r, req.GetLength())
+	}
+	b := make([]byte, chunkSize)
+	for {
+		n, err := r.Read(b)
+		if n > 0 {
+			if err := stream.Send(&ReadResponse{Data: b[:n]}); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return toStatus(err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// ErrMountReplaced is returned by files opened from a mount which has since
+// been replaced.
+var ErrMountReplaced = errors.New("mount replaced")
+
+// defaultDrainTimeout is the drain timeout of MountOrReplace.
+const defaultDrainTimeout = time.Minute
+
+// WithDrainTimeout leaves the files opened from the mount up to d to be
+// read when it is replaced, instead of failing with ErrMountReplaced at
+// once: they keep reading from the replaced file system until closed or
+// until d elapsed.
+func WithDrainTimeout(d time.Duration) MountOption {
+	return func(o *mountOptions) {
+		o.drain = d
+	}
+}
+
+// handles tracks the files opened through a mount so that they can be
+// invalidated when the mount is replaced.
+type handles struct {
+	mu    sync.Mutex
+	files map[*file]struct{}
+	done  bool
+}
+
+func (h *handles) add(f *file) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.done {
+		return false
+	}
+	if h.files == nil {
+		h.files = make(map[*file]struct{})
+	}
+	h.files[f] = struct{}{}
+	return true
+}
+
+func (h *handles) remove(f *file) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.files, f)
+}
+
+// drain invalidates the tracked files after d, leaving them time to be read
+// to completion, or at once if d is not positive. The files opened after
+// the call are not tracked anymore.
+func (h *handles) drain(d time.Duration) {
+	if d <= 0 {
+		h.invalidate()
+		return
+	}
+	h.mu.Lock()
+	h.done = true
+	h.mu.Unlock()
+	time.AfterFunc(d, h.invalidate)
+}
+
+// invalidate closes all the tracked files, which will then fail with
+// ErrMountReplaced.
+func (h *handles) invalidate() {
+	h.mu.Lock()
+	files := h.files
+	h.files, h.done = nil, true
+	h.mu.Unlock()
+	for f := range files {
+		f.invalidate()
+	}
+}
+
+func (m *mfs) Replace(path string, f fs.FS) (err error) {
+	defer m.record("replace", path, time.Now(), &err)
+	if err := m.checkView("replace", path); err != nil {
+		return err
+	}
+	path = m.mountPath(path)
+	var old *mount
+	err = m.update(func(t *table) (*mount, *mount, error) {
+		var ok bool
+		old, ok = t.mounts[path]
+		if !ok {
+			return nil, nil, &fs.PathError{Op: "replace", Path: path, Err: fs.ErrNotExist}
+		}
+		o := *old.opts
+		o.closer = nil
+		mnt := newMount(path, &o, f)
+		mnt.priority.Store(old.priority.Load())
+		mnt.locks = old.locks
+		return old, t.set(mnt), nil
+	})
+	if err != nil {
+		return err
+	}
+	old.handles.drain(old.opts.drain)
+	return nil
+}
+
+func (m *mfs) MountOrReplace(path string, f fs.FS, opts ...MountOption) error {
+	return m.Mount(path, f, append(append([]MountOption{WithDrainTimeout(defaultDrainTimeout)}, opts...), WithShadowing(Replace))...)
+}
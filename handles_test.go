@@ -0,0 +1,165 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplace(t *testing.T) {
+	v1 := fstest.MapFS{"foo": {Data: []byte("v1")}}
+	v2 := fstest.MapFS{"foo": {Data: []byte("v2")}}
+	m, err := Mount("site", v1, WithRootInfo())
+	require.NoError(t, err)
+	assert.ErrorIs(t, m.Replace("nope", v2), fs.ErrNotExist)
+
+	f, err := m.Open("site/foo")
+	require.NoError(t, err)
+	closed, err := m.Open("site/foo")
+	require.NoError(t, err)
+	require.NoError(t, closed.Close())
+
+	var events []string
+	m.OnUnmount(func(i MountInfo) { events = append(events, "unmount "+i.Path) })
+	m.OnMount(func(i MountInfo) { events = append(events, "mount "+i.Path) })
+	require.NoError(t, m.Replace("site", v2))
+	assert.Equal(t, []string{"unmount site", "mount site"}, events)
+
+	_, err = io.ReadAll(f)
+	assert.ErrorIs(t, err, ErrMountReplaced)
+	assert.NoError(t, f.Close())
+
+	b, err := fs.ReadFile(m, "site/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "v2", string(b))
+
+	f, err = m.Open("site/foo")
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("site", v1, WithShadowing(Replace)))
+	_, err = io.ReadAll(f)
+	assert.ErrorIs(t, err, ErrMountReplaced)
+}
+
+func TestMountOrReplace(t *testing.T) {
+	snapshot := func(v string) fs.FS {
+		return fstest.MapFS{"index.html": {Data: []byte(v)}}
+	}
+	m := New()
+	require.NoError(t, m.MountOrReplace("site", snapshot("v1")))
+	pub, err := Mount("pub", m, WithCache(time.Hour))
+	require.NoError(t, err)
+	b, err := fs.ReadFile(pub, "pub/site/index.html")
+	require.NoError(t, err)
+	assert.Equal(t, "v1", string(b))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := m.Watch(ctx, ".")
+	require.NoError(t, err)
+	f, err := m.Open("site/index.html")
+	require.NoError(t, err)
+
+	require.NoError(t, m.MountOrReplace("site", snapshot("v2")))
+	assert.Equal(t, WatchEvent{Path: "site"}, nextEvent(t, ch, "site"))
+	b, err = fs.ReadFile(m, "site/index.html")
+	require.NoError(t, err)
+	assert.Equal(t, "v2", string(b))
+	assert.Eventually(t, func() bool {
+		b, err := fs.ReadFile(pub, "pub/site/index.html")
+		return err == nil && string(b) == "v2"
+	}, time.Second, 10*time.Millisecond)
+	// the file opened from the first snapshot is drained
+	b, err = io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "v1", string(b))
+	require.NoError(t, f.Close())
+
+	f, err = m.Open("site/index.html")
+	require.NoError(t, err)
+	require.NoError(t, m.MountOrReplace("site", snapshot("v3"), WithDrainTimeout(10*time.Millisecond)))
+	nextEvent(t, ch, "site")
+	assert.Eventually(t, func() bool {
+		_, err := f.Stat()
+		return errors.Is(err, ErrMountReplaced)
+	}, time.Second, 10*time.Millisecond)
+
+	// the replacement keeps the priority and the locks of the mount
+	require.NoError(t, m.SetPriority("site", 2))
+	u, err := m.Lock("site/index.html", false)
+	require.NoError(t, err)
+	require.NoError(t, m.MountOrReplace("site", snapshot("v4")))
+	nextEvent(t, ch, "site")
+	assert.EqualValues(t, 2, m.(*mfs).load().mounts["site"].priority.Load())
+	_, err = m.Lock("site/index.html", false)
+	assert.ErrorIs(t, err, ErrLocked)
+	require.NoError(t, u.Unlock())
+
+	require.NoError(t, m.Unmount("site"))
+	assert.Equal(t, WatchEvent{Path: "site", Removed: true}, nextEvent(t, ch, "site"))
+}
+
+// replacingFS runs replace on its first Open, before returning, counting
+// the closes of its files.
+type replacingFS struct {
+	fs.FS
+	once    sync.Once
+	replace func()
+	closes  int
+}
+
+func (r *replacingFS) Open(name string) (fs.File, error) {
+	r.once.Do(r.replace)
+	f, err := r.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &closeCountFile{File: f, r: r}, nil
+}
+
+type closeCountFile struct {
+	fs.File
+	r *replacingFS
+}
+
+func (f *closeCountFile) Close() error {
+	f.r.closes++
+	return f.File.Close()
+}
+
+func TestOpenReplaced(t *testing.T) {
+	m := New()
+	r := &replacingFS{FS: fstest.MapFS{"foo": {Data: []byte("v1")}}}
+	r.replace = func() {
+		require.NoError(t, m.Replace("site", fstest.MapFS{"foo": {Data: []byte("v2")}}))
+	}
+	require.NoError(t, m.Mount("site", r))
+
+	// the file is opened again from the new mount
+	b, err := fs.ReadFile(m, "site/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "v2", string(b))
+	// the file opened from the replaced mount is closed once
+	assert.Equal(t, 1, r.closes)
+}
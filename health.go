@@ -0,0 +1,160 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// ErrUnhealthy is returned when accessing a mount whose last health check
+// failed with the FailFast policy.
+var ErrUnhealthy = errors.New("mount is unhealthy")
+
+// ErrTooManyFailures is the health error of the mounts which failed too
+// often, see WithFailureThreshold.
+var ErrTooManyFailures = errors.New("too many failures")
+
+// HealthChecker is implemented by file systems able to report their health,
+// e.g. remote storages checking their connectivity. Other file systems are
+// checked by stating their root directory.
+type HealthChecker interface {
+	Health(ctx context.Context) error
+}
+
+// HealthPolicy controls how the mounts whose last health check failed are
+// exposed.
+type HealthPolicy int
+
+const (
+	// IgnoreUnhealthy keeps serving unhealthy mounts.
+	IgnoreUnhealthy HealthPolicy = iota
+	// HideUnhealthy removes unhealthy mounts from the listings and makes
+	// them report fs.ErrNotExist.
+	HideUnhealthy
+	// FailFast makes the operations on unhealthy mounts fail with
+	// ErrUnhealthy without reaching the backend.
+	FailFast
+)
+
+// WithHealthPolicy sets the policy applied to unhealthy mounts.
+func WithHealthPolicy(p HealthPolicy) Option {
+	return func(m *mfs) {
+		m.healthPolicy = p
+	}
+}
+
+// WithFailureThreshold makes Health report the mounts whose operations
+// failed n times or more during about the last minute as unhealthy with
+// ErrTooManyFailures, whatever their health check, see ErrorStats. The
+// failures are the errors whose class is a failure, see ClassifyError.
+func WithFailureThreshold(n int) Option {
+	return func(m *mfs) {
+		m.failureThreshold = n
+	}
+}
+
+type healthStatus struct {
+	err error
+}
+
+func (mnt *mount) healthy() bool {
+	s := mnt.health.Load()
+	return s == nil || s.err == nil
+}
+
+// healthOf checks fsys with the first HealthChecker found unwrapping it,
+// see As, stating its root directory when there is none.
+func healthOf(ctx context.Context, fsys fs.FS) error {
+	for v := fsys; v != nil; {
+		if h, ok := v.(HealthChecker); ok {
+			return h.Health(ctx)
+		}
+		u, ok := v.(interface{ Unwrap() fs.FS })
+		if !ok {
+			break
+		}
+		v = u.Unwrap()
+	}
+	_, err := fs.Stat(fsys, ".")
+	return err
+}
+
+// checkHealth checks mnt, reporting it unhealthy when it failed threshold
+// times or more if threshold is positive.
+func (mnt *mount) checkHealth(ctx context.Context, threshold int) error {
+	err := healthOf(ctx, mnt.fs)
+	if n := mnt.rates.stats().Failures; err == nil && threshold > 0 && n >= threshold {
+		err = fmt.Errorf("%w: %d failures in the last minute", ErrTooManyFailures, n)
+	}
+	mnt.health.Store(&healthStatus{err: err})
+	return err
+}
+
+// Health checks the mounted file systems concurrently and returns their
+// status by mount point, a nil error meaning healthy. The results are
+// recorded for the health policy.
+func (m *mfs) Health(ctx context.Context) map[string]error {
+	t := m.load()
+	var mounts []*mount
+	for _, v := range t.mounts {
+		mounts = append(mounts, v)
+	}
+	var mu sync.Mutex
+	res := make(map[string]error, len(mounts))
+	_ = parallel(ctx, m.concurrency, len(mounts), func(i int) error {
+		err := mounts[i].checkHealth(ctx, m.failureThreshold)
+		mu.Lock()
+		res[mounts[i].path] = err
+		mu.Unlock()
+		return nil
+	})
+	return res
+}
+
+// WatchHealth calls Health every interval until ctx is done.
+func (m *mfs) WatchHealth(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		m.Health(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// healthErr returns the error reported for the unhealthy mount mnt
+// according to the health policy.
+func (m *mfs) healthErr(mnt *mount, op, name, rel string) error {
+	if m.healthPolicy == IgnoreUnhealthy || mnt.healthy() {
+		return nil
+	}
+	if m.healthPolicy == HideUnhealthy {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return &fs.PathError{Op: op, Path: name, Err: &MountError{MountPoint: mnt.path, BackendPath: rel, Err: ErrUnhealthy}}
+}
+
+// hidden reports whether mnt is removed from the listings.
+func (m *mfs) hidden(mnt *mount) bool {
+	return m.healthPolicy == HideUnhealthy && !mnt.healthy()
+}
@@ -0,0 +1,132 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type checkedFS struct {
+	fs.FS
+	err   atomic.Pointer[error]
+	calls atomic.Int32
+}
+
+func (c *checkedFS) Health(_ context.Context) error {
+	c.calls.Add(1)
+	if err := c.err.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+func (c *checkedFS) fail(err error) {
+	c.err.Store(&err)
+}
+
+func TestHealth(t *testing.T) {
+	down := errors.New("down")
+	for _, tt := range []struct {
+		policy HealthPolicy
+		err    error
+	}{
+		{policy: IgnoreUnhealthy},
+		{policy: HideUnhealthy, err: fs.ErrNotExist},
+		{policy: FailFast, err: ErrUnhealthy},
+	} {
+		remote := &checkedFS{FS: fstest.MapFS{"foo": {Data: data["foo"]}}}
+		m := New(WithHealthPolicy(tt.policy))
+		require.NoError(t, m.Mount("local", fstest.MapFS{"foo": {Data: data["foo"]}}))
+		require.NoError(t, m.Mount("remote", remote))
+
+		assert.Equal(t, map[string]error{"local": nil, "remote": nil}, m.Health(context.Background()))
+		remote.fail(down)
+		assert.Equal(t, map[string]error{"local": nil, "remote": down}, m.Health(context.Background()))
+
+		_, err := fs.ReadFile(m, "remote/foo")
+		ds, _ := m.ReadDir(".")
+		var paths []string
+		require.NoError(t, WalkDir(m, ".", func(p string, _ fs.DirEntry, err error) error {
+			if err == nil {
+				paths = append(paths, p)
+			}
+			return nil
+		}))
+		if tt.err == nil {
+			assert.NoError(t, err)
+			assert.Len(t, ds, 2)
+			assert.Contains(t, paths, "remote/foo")
+		} else {
+			assert.ErrorIs(t, err, tt.err)
+			assert.NotContains(t, paths, "remote/foo")
+		}
+		switch tt.policy {
+		case HideUnhealthy:
+			require.Len(t, ds, 1)
+			assert.Equal(t, "local", ds[0].Name())
+		case FailFast:
+			// unhealthy mounts stay listed
+			assert.Len(t, ds, 2)
+		}
+		_, err = fs.ReadFile(m, "local/foo")
+		assert.NoError(t, err)
+
+		remote.fail(nil)
+		m.Health(context.Background())
+		_, err = fs.ReadFile(m, "remote/foo")
+		assert.NoError(t, err)
+	}
+}
+
+func TestWatchHealth(t *testing.T) {
+	remote := &checkedFS{FS: fstest.MapFS{}}
+	m := New(WithHealthPolicy(FailFast))
+	require.NoError(t, m.Mount("remote", remote))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.WatchHealth(ctx, time.Millisecond)
+		close(done)
+	}()
+	remote.fail(errors.New("down"))
+	assert.Eventually(t, func() bool {
+		_, err := m.Open("remote")
+		return errors.Is(err, ErrUnhealthy)
+	}, time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return remote.calls.Load() > 1
+	}, time.Second, time.Millisecond)
+	cancel()
+	<-done
+}
+
+func TestHealthWrapped(t *testing.T) {
+	remote := &checkedFS{FS: fstest.MapFS{"foo": {Data: data["foo"]}}}
+	m := New()
+	require.NoError(t, m.Mount("remote", remote, WithTimeout(time.Minute), WithCache(time.Minute)))
+	down := errors.New("down")
+	remote.fail(down)
+	assert.Equal(t, map[string]error{"remote": down}, m.Health(context.Background()))
+	assert.Equal(t, int32(1), remote.calls.Load())
+}
@@ -0,0 +1,214 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// MountInfo describes a mount point.
+type MountInfo struct {
+	Path      string
+	FS        fs.FS
+	MountedAt time.Time
+}
+
+func (mnt *mount) info() MountInfo {
+	return MountInfo{Path: mnt.path, FS: mnt.fs, MountedAt: mnt.mountedAt}
+}
+
+// OnMount only calls fn for the mounts exposed by the view if m is one.
+func (m *mfs) OnMount(fn func(MountInfo)) {
+	fn = m.viewHook(fn)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onMount = append(m.onMount, fn)
+}
+
+// OnUnmount only calls fn for the mounts exposed by the view if m is one.
+func (m *mfs) OnUnmount(fn func(MountInfo)) {
+	fn = m.viewHook(fn)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onUnmount = append(m.onUnmount, fn)
+}
+
+// viewHook restricts the hook fn to the mounts exposed by the view if m is
+// one.
+func (m *mfs) viewHook(fn func(MountInfo)) func(MountInfo) {
+	if m.view == nil {
+		return fn
+	}
+	return func(i MountInfo) {
+		if m.visible(i) {
+			fn(i)
+		}
+	}
+}
+
+// viewEvent restricts ev to the mounts exposed by the view if m is one,
+// reporting whether it concerns one of them: a mount replaced by one the
+// view does not expose is reported as unmounted, and conversely.
+func (m *mfs) viewEvent(ev MountEvent) (MountEvent, bool) {
+	if m.view == nil {
+		return ev, true
+	}
+	before := ev.Before != nil && m.visible(*ev.Before)
+	after := ev.After != nil && m.visible(*ev.After)
+	switch {
+	case before && after:
+		return ev, true
+	case before:
+		return MountEvent{Kind: Unmounted, Path: ev.Path, Before: ev.Before}, true
+	case after:
+		return MountEvent{Kind: Mounted, Path: ev.Path, After: ev.After}, true
+	default:
+		return ev, false
+	}
+}
+
+// MountEventKind is the kind of a MountEvent.
+type MountEventKind int
+
+const (
+	// Mounted events report a file system mounted on a free path.
+	Mounted MountEventKind = iota
+	// Unmounted events report a removed mount.
+	Unmounted
+	// Replaced events report a mount whose file system changed, e.g. by
+	// Replace or by stacking a layer.
+	Replaced
+)
+
+func (k MountEventKind) String() string {
+	switch k {
+	case Mounted:
+		return "mounted"
+	case Unmounted:
+		return "unmounted"
+	case Replaced:
+		return "replaced"
+	default:
+		return "unknown"
+	}
+}
+
+// MountEvent describes a change of the mount table. Before is nil for
+// Mounted events and After for Unmounted ones.
+type MountEvent struct {
+	Kind   MountEventKind
+	Path   string
+	Before *MountInfo
+	After  *MountInfo
+}
+
+// mountEvents returns the events describing the removal of the removed
+// mounts and the addition of the added ones.
+func mountEvents(removed, added []*mount) []MountEvent {
+	var res []MountEvent
+	adds := make(map[string]*mount, len(added))
+	for _, v := range added {
+		adds[v.path] = v
+	}
+	for _, v := range removed {
+		before := v.info()
+		if a, ok := adds[v.path]; ok {
+			after := a.info()
+			res = append(res, MountEvent{Kind: Replaced, Path: v.path, Before: &before, After: &after})
+			delete(adds, v.path)
+			continue
+		}
+		res = append(res, MountEvent{Kind: Unmounted, Path: v.path, Before: &before})
+	}
+	for _, v := range added {
+		if _, ok := adds[v.path]; ok {
+			after := v.info()
+			res = append(res, MountEvent{Kind: Mounted, Path: v.path, After: &after})
+		}
+	}
+	return res
+}
+
+// subscription queues the events of a subscriber so that slow readers do
+// not block the mount table updates.
+type subscription struct {
+	// filter restricts the events to the ones of a view
+	filter func(MountEvent) (MountEvent, bool)
+	mu     sync.Mutex
+	queue  []MountEvent
+	notify chan struct{}
+	done   chan struct{}
+	ch     chan MountEvent
+}
+
+func (s *subscription) push(evs []MountEvent) {
+	s.mu.Lock()
+	s.queue = append(s.queue, evs...)
+	s.mu.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscription) run() {
+	defer close(s.ch)
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			select {
+			case <-s.notify:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+		ev := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+		ev, ok := s.filter(ev)
+		if !ok {
+			continue
+		}
+		select {
+		case s.ch <- ev:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (m *mfs) SubscribeMounts() (<-chan MountEvent, func()) {
+	s := &subscription{filter: m.viewEvent, notify: make(chan struct{}, 1), done: make(chan struct{}), ch: make(chan MountEvent)}
+	m.mu.Lock()
+	if m.subs == nil {
+		m.subs = make(map[*subscription]struct{})
+	}
+	m.subs[s] = struct{}{}
+	m.mu.Unlock()
+	go s.run()
+	var once sync.Once
+	return s.ch, func() {
+		once.Do(func() {
+			m.mu.Lock()
+			delete(m.subs, s)
+			m.mu.Unlock()
+			close(s.done)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHooks(t *testing.T) {
+	var mounted, unmounted []string
+	m, err := Mount("a", fstest.MapFS{"foo": {Data: data["foo"]}})
+	require.NoError(t, err)
+	m.OnMount(func(i MountInfo) {
+		// hooks run without the lock held
+		_, err := m.ReadDir(".")
+		require.NoError(t, err)
+		mounted = append(mounted, i.Path)
+	})
+	m.OnUnmount(func(i MountInfo) {
+		unmounted = append(unmounted, i.Path)
+	})
+
+	require.NoError(t, m.Mount("b", fstest.MapFS{}))
+	assert.ErrorIs(t, m.Mount("b", fstest.MapFS{}), fs.ErrExist)
+	require.NoError(t, m.Mount("b", fstest.MapFS{}, WithShadowing(Replace)))
+	require.NoError(t, m.Bind("a", "c"))
+	require.NoError(t, m.Unmount("a"))
+	assert.ErrorIs(t, m.Unmount("a"), fs.ErrNotExist)
+
+	assert.Equal(t, []string{"b", "b", "c"}, mounted)
+	assert.Equal(t, []string{"b", "a"}, unmounted)
+
+	_, err = m.Open("a/foo")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = m.Open("c/foo")
+	assert.NoError(t, err)
+}
+
+func TestSubscribeMounts(t *testing.T) {
+	m := New()
+	ch, cancel := m.SubscribeMounts()
+	a, b := fstest.MapFS{"a": {}}, fstest.MapFS{"b": {}}
+	require.NoError(t, m.Mount("a", a))
+	require.NoError(t, m.Mount("a", b, WithShadowing(Replace)))
+	require.NoError(t, m.Unmount("a"))
+	assert.Error(t, m.Unmount("a"))
+
+	ev := <-ch
+	assert.Equal(t, Mounted, ev.Kind)
+	assert.Equal(t, "a", ev.Path)
+	assert.Nil(t, ev.Before)
+	assert.Equal(t, a, ev.After.FS)
+	ev = <-ch
+	assert.Equal(t, Replaced, ev.Kind)
+	assert.Equal(t, a, ev.Before.FS)
+	assert.Equal(t, b, ev.After.FS)
+	ev = <-ch
+	assert.Equal(t, Unmounted, ev.Kind)
+	assert.Equal(t, b, ev.Before.FS)
+	assert.Nil(t, ev.After)
+
+	cancel()
+	cancel()
+	_, ok := <-ch
+	assert.False(t, ok)
+	require.NoError(t, m.Mount("b", fstest.MapFS{}))
+}
@@ -0,0 +1,175 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// HTTPFS returns a read-only file system serving the files found under
+// baseURL. Directories cannot be listed as HTTP has no notion of them.
+func HTTPFS(baseURL string, client *http.Client) (fs.FS, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("mfs: unsupported scheme %q", u.Scheme)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &httpFS{base: u, client: client}, nil
+}
+
+func openHTTP(rawURL string) (fs.FS, error) {
+	return HTTPFS(rawURL, nil)
+}
+
+type httpFS struct {
+	base   *url.URL
+	client *http.Client
+}
+
+func (h *httpFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return &fakeDir{path: "."}, nil
+	}
+	res, err := h.do(http.MethodGet, "open", name)
+	if err != nil {
+		return nil, err
+	}
+	return &httpFile{body: res.Body, info: responseInfo(name, res)}, nil
+}
+
+// Stat requests the headers of name only.
+func (h *httpFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return (&fakeDir{path: "."}).Stat()
+	}
+	res, err := h.do(http.MethodHead, "stat", name)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	return responseInfo(name, res), nil
+}
+
+// do sends a request for name, returning the successful responses only.
+func (h *httpFS) do(method, op, name string) (*http.Response, error) {
+	u := *h.base
+	u.Path = path.Join("/", u.Path, name)
+	u.RawPath = ""
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return res, nil
+	case res.StatusCode == http.StatusNotFound, res.StatusCode == http.StatusGone:
+		err = fs.ErrNotExist
+	case res.StatusCode == http.StatusUnauthorized, res.StatusCode == http.StatusForbidden:
+		err = fs.ErrPermission
+	default:
+		err = &httpStatusError{code: res.StatusCode, status: res.Status}
+	}
+	res.Body.Close()
+	return nil, &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+func responseInfo(name string, res *http.Response) *httpFileInfo {
+	mt, _ := http.ParseTime(res.Header.Get("Last-Modified"))
+	return &httpFileInfo{name: path.Base(name), size: res.ContentLength, modTime: mt}
+}
+
+// httpStatusError reports the unexpected status of a response.
+type httpStatusError struct {
+	code   int
+	status string
+}
+
+func (e *httpStatusError) Error() string {
+	return e.status
+}
+
+// HTTPStatusCode returns the response status code, see IsRetryable.
+func (e *httpStatusError) HTTPStatusCode() int {
+	return e.code
+}
+
+type httpFile struct {
+	body io.ReadCloser
+	info *httpFileInfo
+}
+
+func (f *httpFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *httpFile) Read(b []byte) (int, error) {
+	return f.body.Read(b)
+}
+
+func (f *httpFile) Close() error {
+	return f.body.Close()
+}
+
+type httpFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i *httpFileInfo) Name() string {
+	return strings.TrimSuffix(i.name, "/")
+}
+
+func (i *httpFileInfo) Size() int64 {
+	return i.size
+}
+
+func (i *httpFileInfo) Mode() fs.FileMode {
+	return 0444
+}
+
+func (i *httpFileInfo) ModTime() time.Time {
+	return i.modTime
+}
+
+func (i *httpFileInfo) IsDir() bool {
+	return false
+}
+
+func (i *httpFileInfo) Sys() any {
+	return nil
+}
@@ -0,0 +1,605 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package objfs implements an fs.FS over a flat object store, the
+// directories being synthesized from the "/" separated object keys. It is
+// shared by the object store backends.
+package objfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"iter"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Object describes a stored object.
+type Object struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+	// Version identifies the object content, e.g. a generation number. It
+	// may be empty when the store does not support versions.
+	Version string
+}
+
+// Store is the object store API used by the file system. Missing objects
+// are reported with an error matching fs.ErrNotExist, and directory markers,
+// e.g. the directories of hierarchical namespaces, with ErrDir.
+type Store interface {
+	// List returns the objects and the common prefixes found directly
+	// under prefix, which is either empty or ends with "/". The prefixes
+	// are returned with their trailing "/".
+	List(ctx context.Context, prefix string) ([]Object, []string, error)
+	Stat(ctx context.Context, key string) (Object, error)
+	// Get reads the object from off, up to n bytes or to its end when n is
+	// negative. A non-empty version requests this version of the object.
+	Get(ctx context.Context, key, version string, off, n int64) (io.ReadCloser, Object, error)
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	Delete(ctx context.Context, key string) error
+}
+
+// Page is a page of a listing, see PagedStore.
+type Page struct {
+	Objects  []Object
+	Prefixes []string
+}
+
+// PagedStore is implemented by the stores listing by pages, e.g. following
+// continuation tokens, which lets FS stream the directory listings.
+type PagedStore interface {
+	Store
+	// ListPages is like List, yielding the listing page by page.
+	ListPages(ctx context.Context, prefix string) iter.Seq2[Page, error]
+}
+
+// TokenStore is implemented by the stores resuming listings from
+// continuation tokens, which lets FS implement ReadDirPage.
+type TokenStore interface {
+	Store
+	// ListPage returns up to n objects and prefixes found directly under
+	// prefix following token, and the token of the next page, empty after
+	// the last one.
+	ListPage(ctx context.Context, prefix, token string, n int) (Page, string, error)
+}
+
+// BatchStore is implemented by the stores deleting several objects per
+// request, which WritableFS.RemoveAll uses.
+type BatchStore interface {
+	Store
+	// DeleteBatch deletes the objects, ignoring the missing ones.
+	DeleteBatch(ctx context.Context, keys []string) error
+}
+
+// Collect gathers the pages of a listing, for the stores implementing List
+// with ListPages.
+func Collect(pages iter.Seq2[Page, error]) ([]Object, []string, error) {
+	var (
+		objs     []Object
+		prefixes []string
+	)
+	for p, err := range pages {
+		if err != nil {
+			return nil, nil, err
+		}
+		objs = append(objs, p.Objects...)
+		prefixes = append(prefixes, p.Prefixes...)
+	}
+	return objs, prefixes, nil
+}
+
+// ErrDir is returned by the stores for keys designating a directory.
+var ErrDir = errors.New("is a directory")
+
+// ErrNotEmpty is returned when removing a directory which is not empty.
+var ErrNotEmpty = errors.New("directory not empty")
+
+// FS is a read-only file system over a Store.
+type FS struct {
+	store    Store
+	prefix   string
+	ctx      context.Context
+	writable bool
+}
+
+// WritableFS adds the write operations to FS.
+type WritableFS struct {
+	*FS
+}
+
+var (
+	_ fs.StatFS    = (*FS)(nil)
+	_ fs.ReadDirFS = (*FS)(nil)
+)
+
+// New returns a read-only file system over the objects of s found under
+// prefix. ctx is used for the store requests.
+func New(ctx context.Context, s Store, prefix string) *FS {
+	return &FS{store: s, prefix: strings.Trim(prefix, "/"), ctx: ctx}
+}
+
+// NewWritable is like New but returns a writable file system.
+func NewWritable(ctx context.Context, s Store, prefix string) *WritableFS {
+	f := New(ctx, s, prefix)
+	f.writable = true
+	return &WritableFS{FS: f}
+}
+
+func (f *FS) key(name string) string {
+	if name == "." {
+		return f.prefix
+	}
+	if f.prefix == "" {
+		return name
+	}
+	return f.prefix + "/" + name
+}
+
+// dirPrefix returns the listing prefix of the directory name.
+func (f *FS) dirPrefix(name string) string {
+	if k := f.key(name); k != "" {
+		return k + "/"
+	}
+	return ""
+}
+
+func (f *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return f.dir(name), nil
+	}
+	r, o, err := f.store.Get(f.ctx, f.key(name), "", 0, -1)
+	if err == nil {
+		return &file{fs: f, name: name, info: f.fileInfo(name, o), version: o.Version, body: r}, nil
+	}
+	if errors.Is(err, ErrDir) {
+		return f.dir(name), nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	ok, err := f.isDir(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return f.dir(name), nil
+}
+
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return f.dirInfo(name), nil
+	}
+	o, err := f.store.Stat(f.ctx, f.key(name))
+	if err == nil {
+		return f.fileInfo(name, o), nil
+	}
+	if errors.Is(err, ErrDir) {
+		return f.dirInfo(name), nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	ok, err := f.isDir(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return f.dirInfo(name), nil
+}
+
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	ds, err := f.list(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	if len(ds) > 0 || name == "." {
+		return ds, nil
+	}
+	_, err = f.store.Stat(f.ctx, f.key(name))
+	switch {
+	case err == nil:
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	case errors.Is(err, ErrDir):
+		return ds, nil
+	default:
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+}
+
+// ReadDirIter streams the entries of the directory name when the store
+// implements PagedStore, the entries of each page being sorted. It yields the
+// ReadDir entries otherwise.
+func (f *FS) ReadDirIter(name string) iter.Seq2[fs.DirEntry, error] {
+	return func(yield func(fs.DirEntry, error) bool) {
+		s, ok := f.store.(PagedStore)
+		if !ok || !fs.ValidPath(name) {
+			ds, err := f.ReadDir(name)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			for _, v := range ds {
+				if !yield(v, nil) {
+					return
+				}
+			}
+			return
+		}
+		p := f.dirPrefix(name)
+		var empty = true
+		for page, err := range s.ListPages(f.ctx, p) {
+			if err != nil {
+				yield(nil, &fs.PathError{Op: "readdir", Path: name, Err: err})
+				return
+			}
+			for _, v := range f.entries(name, p, page.Objects, page.Prefixes) {
+				empty = false
+				if !yield(v, nil) {
+					return
+				}
+			}
+		}
+		if empty && name != "." {
+			// tell empty directories from missing ones
+			if _, err := f.ReadDir(name); err != nil {
+				yield(nil, err)
+			}
+		}
+	}
+}
+
+// ReadDirPage returns a page of the directory name using the store
+// continuation tokens. It fails with errors.ErrUnsupported when the store
+// does not implement TokenStore. Directory markers being skipped, a page
+// may be empty while not being the last one.
+func (f *FS) ReadDirPage(name, token string, n int) ([]fs.DirEntry, string, error) {
+	s, ok := f.store.(TokenStore)
+	if !ok {
+		return nil, "", &fs.PathError{Op: "readdir", Path: name, Err: errors.ErrUnsupported}
+	}
+	if !fs.ValidPath(name) {
+		return nil, "", &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	p := f.dirPrefix(name)
+	page, next, err := s.ListPage(f.ctx, p, token, n)
+	if err != nil {
+		return nil, "", &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	ds := f.entries(name, p, page.Objects, page.Prefixes)
+	if len(ds) == 0 && token == "" && next == "" && name != "." {
+		// tell empty directories from missing ones
+		if _, err := f.ReadDir(name); err != nil {
+			return nil, "", err
+		}
+	}
+	return ds, next, nil
+}
+
+func (f *FS) list(name string) ([]fs.DirEntry, error) {
+	p := f.dirPrefix(name)
+	objs, prefixes, err := f.store.List(f.ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return f.entries(name, p, objs, prefixes), nil
+}
+
+// entries returns the sorted entries of the directory name listed with the
+// prefix p.
+func (f *FS) entries(name, p string, objs []Object, prefixes []string) []fs.DirEntry {
+	var ds []fs.DirEntry
+	for _, v := range prefixes {
+		n := strings.TrimSuffix(strings.TrimPrefix(v, p), "/")
+		if n == "" {
+			continue
+		}
+		ds = append(ds, fs.FileInfoToDirEntry(f.dirInfo(path.Join(name, n))))
+	}
+	for _, v := range objs {
+		n := strings.TrimPrefix(v.Key, p)
+		// skip the directory markers
+		if n == "" || strings.Contains(n, "/") {
+			continue
+		}
+		ds = append(ds, fs.FileInfoToDirEntry(f.fileInfo(path.Join(name, n), v)))
+	}
+	sort.Slice(ds, func(i, j int) bool {
+		return ds[i].Name() < ds[j].Name()
+	})
+	return ds
+}
+
+// isDir reports whether objects are found under name, listing a single entry
+// when the store supports it.
+func (f *FS) isDir(name string) (bool, error) {
+	if s, ok := f.store.(TokenStore); ok {
+		page, _, err := s.ListPage(f.ctx, f.dirPrefix(name), "", 1)
+		if err != nil {
+			return false, err
+		}
+		return len(page.Objects) > 0 || len(page.Prefixes) > 0, nil
+	}
+	objs, prefixes, err := f.store.List(f.ctx, f.dirPrefix(name))
+	if err != nil {
+		return false, err
+	}
+	return len(objs) > 0 || len(prefixes) > 0, nil
+}
+
+func (f *FS) fileInfo(name string, o Object) *info {
+	if f.writable {
+		return &info{name: path.Base(name), size: o.Size, mode: 0644, modTime: o.ModTime}
+	}
+	return &info{name: path.Base(name), size: o.Size, mode: 0444, modTime: o.ModTime}
+}
+
+func (f *FS) dirInfo(name string) *info {
+	if f.writable {
+		return &info{name: path.Base(name), mode: fs.ModeDir | 0755}
+	}
+	return &info{name: path.Base(name), mode: fs.ModeDir | 0555}
+}
+
+func (f *FS) dir(name string) *dir {
+	return &dir{info: f.dirInfo(name), list: func() ([]fs.DirEntry, error) {
+		return f.list(name)
+	}}
+}
+
+func (w *WritableFS) WriteFile(name string, data []byte, _ fs.FileMode) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	if err := w.store.Put(w.ctx, w.key(name), bytes.NewReader(data), int64(len(data))); err != nil {
+		return &fs.PathError{Op: "write", Path: name, Err: err}
+	}
+	return nil
+}
+
+// MkdirAll only validates path: directories exist as long as they contain
+// objects.
+func (w *WritableFS) MkdirAll(path string, _ fs.FileMode) error {
+	if !fs.ValidPath(path) {
+		return &fs.PathError{Op: "mkdir", Path: path, Err: fs.ErrInvalid}
+	}
+	return nil
+}
+
+func (w *WritableFS) Remove(name string) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	_, err := w.store.Stat(w.ctx, w.key(name))
+	if err == nil {
+		if err := w.store.Delete(w.ctx, w.key(name)); err != nil {
+			return &fs.PathError{Op: "remove", Path: name, Err: err}
+		}
+		return nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	ok, err := w.isDir(name)
+	switch {
+	case err != nil:
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	case ok:
+		return &fs.PathError{Op: "remove", Path: name, Err: ErrNotEmpty}
+	default:
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+}
+
+func (w *WritableFS) RemoveAll(name string) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "removeall", Path: name, Err: fs.ErrInvalid}
+	}
+	if err := w.removePrefix(w.dirPrefix(name)); err != nil {
+		return &fs.PathError{Op: "removeall", Path: name, Err: err}
+	}
+	if name == "." {
+		return nil
+	}
+	// the key is either a file or a directory marker, deleted once empty
+	if err := w.store.Delete(w.ctx, w.key(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return &fs.PathError{Op: "removeall", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (w *WritableFS) removePrefix(prefix string) error {
+	objs, prefixes, err := w.store.List(w.ctx, prefix)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(objs)+len(prefixes))
+	for _, v := range objs {
+		keys = append(keys, v.Key)
+	}
+	for _, v := range prefixes {
+		if err := w.removePrefix(v); err != nil {
+			return err
+		}
+		// the directory marker, if any
+		keys = append(keys, strings.TrimSuffix(v, "/"))
+	}
+	return w.delete(keys)
+}
+
+// delete deletes the objects, in batches when the store supports it.
+func (w *WritableFS) delete(keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if s, ok := w.store.(BatchStore); ok {
+		return s.DeleteBatch(w.ctx, keys)
+	}
+	for _, v := range keys {
+		if err := w.store.Delete(w.ctx, v); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+type info struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i *info) Name() string       { return i.name }
+func (i *info) Size() int64        { return i.size }
+func (i *info) Mode() fs.FileMode  { return i.mode }
+func (i *info) ModTime() time.Time { return i.modTime }
+func (i *info) IsDir() bool        { return i.mode.IsDir() }
+func (i *info) Sys() any           { return nil }
+
+// file reads the version of the object returned when it was opened, so that
+// its content stays consistent across ranged reads.
+type file struct {
+	fs      *FS
+	name    string
+	info    *info
+	version string
+	body    io.ReadCloser
+	off     int64
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *file) Read(b []byte) (int, error) {
+	if f.body == nil {
+		if f.off >= f.info.size {
+			return 0, io.EOF
+		}
+		r, _, err := f.fs.store.Get(f.fs.ctx, f.fs.key(f.name), f.version, f.off, -1)
+		if err != nil {
+			return 0, &fs.PathError{Op: "read", Path: f.name, Err: err}
+		}
+		f.body = r
+	}
+	n, err := f.body.Read(b)
+	f.off += int64(n)
+	return n, err
+}
+
+// Seek drops the current response body, the next Read requesting the
+// object from the new offset.
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += f.info.size
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if offset != f.off && f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+	f.off = offset
+	return offset, nil
+}
+
+// ReadAt issues a ranged request.
+func (f *file) ReadAt(b []byte, off int64) (int, error) {
+	if off >= f.info.size {
+		return 0, io.EOF
+	}
+	r, _, err := f.fs.store.Get(f.fs.ctx, f.fs.key(f.name), f.version, off, int64(len(b)))
+	if err != nil {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	defer r.Close()
+	n, err := io.ReadFull(r, b)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *file) Close() error {
+	if f.body == nil {
+		return nil
+	}
+	err := f.body.Close()
+	f.body = nil
+	return err
+}
+
+type dir struct {
+	info    *info
+	list    func() ([]fs.DirEntry, error)
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *dir) Read(_ []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+func (d *dir) Close() error {
+	return nil
+}
+
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		ds, err := d.list()
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.read = ds, true
+	}
+	if n <= 0 {
+		res := d.entries
+		d.entries = nil
+		return res, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	res := d.entries[:n:n]
+	d.entries = d.entries[n:]
+	return res, nil
+}
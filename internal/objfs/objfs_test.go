@@ -0,0 +1,302 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"iter"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (m *memStore) List(_ context.Context, prefix string) ([]Object, []string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var objs []Object
+	seen := make(map[string]bool)
+	var prefixes []string
+	for k, v := range m.objects {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if i := strings.Index(k[len(prefix):], "/"); i >= 0 {
+			p := k[:len(prefix)+i+1]
+			if !seen[p] {
+				seen[p] = true
+				prefixes = append(prefixes, p)
+			}
+			continue
+		}
+		objs = append(objs, Object{Key: k, Size: int64(len(v))})
+	}
+	sort.Strings(prefixes)
+	// object stores list the keys in lexicographic order
+	sort.Slice(objs, func(i, j int) bool {
+		return objs[i].Key < objs[j].Key
+	})
+	return objs, prefixes, nil
+}
+
+func (m *memStore) Stat(_ context.Context, key string) (Object, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.objects[key]
+	if !ok {
+		return Object{}, fs.ErrNotExist
+	}
+	return Object{Key: key, Size: int64(len(v))}, nil
+}
+
+func (m *memStore) Get(ctx context.Context, key, _ string, off, n int64) (io.ReadCloser, Object, error) {
+	o, err := m.Stat(ctx, key)
+	if err != nil {
+		return nil, o, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b := m.objects[key][min(off, o.Size):]
+	if n >= 0 && n < int64(len(b)) {
+		b = b[:n]
+	}
+	return io.NopCloser(bytes.NewReader(b)), o, nil
+}
+
+func (m *memStore) Put(_ context.Context, key string, r io.Reader, _ int64) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = b
+	return nil
+}
+
+func (m *memStore) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.objects[key]; !ok {
+		return fs.ErrNotExist
+	}
+	delete(m.objects, key)
+	return nil
+}
+
+// pagedStore lists memStore by pages of a single entry.
+type pagedStore struct {
+	*memStore
+	pages int
+}
+
+func (p *pagedStore) ListPages(ctx context.Context, prefix string) iter.Seq2[Page, error] {
+	return func(yield func(Page, error) bool) {
+		objs, prefixes, err := p.List(ctx, prefix)
+		if err != nil {
+			yield(Page{}, err)
+			return
+		}
+		for _, v := range prefixes {
+			p.pages++
+			if !yield(Page{Prefixes: []string{v}}, nil) {
+				return
+			}
+		}
+		for _, v := range objs {
+			p.pages++
+			if !yield(Page{Objects: []Object{v}}, nil) {
+				return
+			}
+		}
+	}
+}
+
+// ListPage pages the listing using the index of the next entry as token.
+func (p *pagedStore) ListPage(ctx context.Context, prefix, token string, n int) (Page, string, error) {
+	objs, prefixes, err := p.List(ctx, prefix)
+	if err != nil {
+		return Page{}, "", err
+	}
+	i, _ := strconv.Atoi(token)
+	var page Page
+	for j := i; j < min(i+n, len(prefixes)+len(objs)); j++ {
+		if j < len(prefixes) {
+			page.Prefixes = append(page.Prefixes, prefixes[j])
+		} else {
+			page.Objects = append(page.Objects, objs[j-len(prefixes)])
+		}
+	}
+	p.pages++
+	if i+n >= len(prefixes)+len(objs) {
+		return page, "", nil
+	}
+	return page, strconv.Itoa(i + n), nil
+}
+
+func TestReadDirPage(t *testing.T) {
+	objs := map[string][]byte{
+		"foo":       []byte("foo"),
+		"bar":       []byte("bar"),
+		"dir/baz":   []byte("baz"),
+		"other/qux": []byte("qux"),
+	}
+	s := &pagedStore{memStore: &memStore{objects: objs}}
+	f := New(context.Background(), s, "")
+	var (
+		names []string
+		token string
+	)
+	for {
+		ds, next, err := f.ReadDirPage(".", token, 3)
+		require.NoError(t, err)
+		for _, d := range ds {
+			names = append(names, d.Name())
+		}
+		if token = next; token == "" {
+			break
+		}
+	}
+	assert.ElementsMatch(t, []string{"bar", "dir", "foo", "other"}, names)
+	assert.Equal(t, 2, s.pages)
+
+	_, _, err := f.ReadDirPage("missing", "", 3)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	_, _, err = New(context.Background(), &memStore{objects: objs}, "").ReadDirPage(".", "", 3)
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+}
+
+func TestReadDirIter(t *testing.T) {
+	s := &pagedStore{memStore: &memStore{objects: map[string][]byte{
+		"foo":       []byte("foo"),
+		"bar":       []byte("bar"),
+		"dir/baz":   []byte("baz"),
+		"other/qux": []byte("qux"),
+	}}}
+	f := New(context.Background(), s, "")
+	var names []string
+	for d, err := range f.ReadDirIter(".") {
+		require.NoError(t, err)
+		names = append(names, d.Name())
+		if len(names) == 2 {
+			break
+		}
+	}
+	assert.Equal(t, []string{"dir", "other"}, names)
+	assert.Equal(t, 2, s.pages)
+
+	for _, err := range f.ReadDirIter("missing") {
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+	}
+}
+
+func TestFS(t *testing.T) {
+	s := &memStore{objects: map[string][]byte{
+		"other":            []byte("other"),
+		"root/foo":         []byte("foo"),
+		"root/dir/bar":     []byte("bar"),
+		"root/dir/":        nil,
+		"root/dir/sub/baz": []byte("baz"),
+	}}
+	f := New(context.Background(), s, "/root/")
+	require.NoError(t, fstest.TestFS(f, "foo", "dir/bar", "dir/sub/baz"))
+
+	_, err := f.Open("other")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = f.ReadDir("foo")
+	assert.Error(t, err)
+	_, err = f.ReadDir("missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	file, err := f.Open("dir/sub/baz")
+	require.NoError(t, err)
+	b := make([]byte, 2)
+	n, err := file.(io.ReaderAt).ReadAt(b, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "az", string(b[:n]))
+	_, err = file.(io.Seeker).Seek(2, io.SeekStart)
+	require.NoError(t, err)
+	b, err = io.ReadAll(file)
+	require.NoError(t, err)
+	assert.Equal(t, "z", string(b))
+	require.NoError(t, file.Close())
+}
+
+func TestWritableFS(t *testing.T) {
+	s := &memStore{objects: map[string][]byte{}}
+	w := NewWritable(context.Background(), s, "root")
+	require.NoError(t, w.MkdirAll("dir/sub", 0755))
+	require.NoError(t, w.WriteFile("dir/sub/foo", []byte("foo"), 0644))
+	require.NoError(t, w.WriteFile("dir/bar", []byte("bar"), 0644))
+	i, err := w.Stat("dir/sub")
+	require.NoError(t, err)
+	assert.True(t, i.IsDir())
+	assert.WithinDuration(t, time.Time{}, i.ModTime(), 0)
+
+	assert.ErrorIs(t, w.Remove("dir"), ErrNotEmpty)
+	assert.ErrorIs(t, w.Remove("missing"), fs.ErrNotExist)
+	require.NoError(t, w.Remove("dir/bar"))
+	require.NoError(t, w.RemoveAll("dir"))
+	assert.Empty(t, s.objects)
+}
+
+// batchStore counts the batches deleted from a pagedStore.
+type batchStore struct {
+	*pagedStore
+	batches int
+}
+
+func (b *batchStore) DeleteBatch(ctx context.Context, keys []string) error {
+	b.batches++
+	for _, v := range keys {
+		if err := b.Delete(ctx, v); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestWritableFSBatch(t *testing.T) {
+	s := &batchStore{pagedStore: &pagedStore{memStore: &memStore{objects: map[string][]byte{
+		"dir/foo":     []byte("foo"),
+		"dir/bar":     []byte("bar"),
+		"dir/baz":     []byte("baz"),
+		"dir/sub/":    nil,
+		"dir/sub/qux": []byte("qux"),
+	}}}}
+	w := NewWritable(context.Background(), s, "")
+	assert.ErrorIs(t, w.Remove("dir"), ErrNotEmpty)
+	assert.Equal(t, 1, s.pages)
+
+	require.NoError(t, w.RemoveAll("dir"))
+	assert.Empty(t, s.objects)
+	assert.Equal(t, 2, s.batches)
+}
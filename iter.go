@@ -0,0 +1,144 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"iter"
+	"time"
+)
+
+// readDirBatch is the number of entries requested at once from the backend
+// directories when streaming them.
+const readDirBatch = 256
+
+// ReadDirIterFS is implemented by file systems able to stream the entries of
+// a directory, e.g. object stores listing keys by pages.
+type ReadDirIterFS interface {
+	fs.FS
+	ReadDirIter(name string) iter.Seq2[fs.DirEntry, error]
+}
+
+// ReadDirIter streams the entries of the directory name. Unlike ReadDir, the
+// entries are not sorted and are read from the backend as the iteration
+// goes: by the backend ReadDirIter when it implements ReadDirIterFS, by
+// batches from the opened directory otherwise. An error ends the iteration,
+// which is audited once done.
+func (m *mfs) ReadDirIter(name string) iter.Seq2[fs.DirEntry, error] {
+	return func(yield func(fs.DirEntry, error) bool) {
+		var err error
+		defer m.record("readdir", name, time.Now(), &err)
+		t := m.load()
+		name, err := m.clean("readdir", name)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		if name == "/" || name == "." || m.hasMounts(t, name) {
+			var ds []fs.DirEntry
+			if ds, err = m.readMerged(m.context(), t, name); err != nil {
+				yield(nil, err)
+				return
+			}
+			for _, v := range ds {
+				if !yield(v, nil) {
+					return
+				}
+			}
+			return
+		}
+		mnt, rel, err := m.lookup(t, "readdir", name)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for d, derr := range readDirIter(mnt.fs, rel) {
+			if derr != nil {
+				err = mnt.wrapErr("readdir", name, rel, derr)
+				yield(nil, err)
+				return
+			}
+			if !yield(&dirEntry{DirEntry: d, path: joinMountPath(name, d.Name()), opts: mnt.opts}, nil) {
+				return
+			}
+		}
+	}
+}
+
+func readDirIter(fsys fs.FS, name string) iter.Seq2[fs.DirEntry, error] {
+	if i, ok := As[ReadDirIterFS](fsys); ok {
+		return i.ReadDirIter(name)
+	}
+	return func(yield func(fs.DirEntry, error) bool) {
+		f, err := fsys.Open(name)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer f.Close()
+		d, ok := f.(fs.ReadDirFile)
+		if !ok {
+			// fall back to the file system listing, e.g. for synthesized
+			// directories
+			ds, err := fs.ReadDir(fsys, name)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			for _, v := range ds {
+				if !yield(v, nil) {
+					return
+				}
+			}
+			return
+		}
+		for {
+			ds, err := d.ReadDir(readDirBatch)
+			for _, v := range ds {
+				if !yield(v, nil) {
+					return
+				}
+			}
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if len(ds) == 0 {
+				return
+			}
+		}
+	}
+}
+
+// forwardIter forwards ReadDirIter to fsys, the iteration failing with
+// errors.ErrUnsupported when fsys cannot stream its directories.
+func forwardIter(fsys fs.FS, name string) iter.Seq2[fs.DirEntry, error] {
+	if i, ok := fsys.(ReadDirIterFS); ok {
+		return i.ReadDirIter(name)
+	}
+	return failedIter(unsupported("readdir", name))
+}
+
+// failedIter returns an iteration yielding err.
+func failedIter(err error) iter.Seq2[fs.DirEntry, error] {
+	return func(yield func(fs.DirEntry, error) bool) {
+		yield(nil, err)
+	}
+}
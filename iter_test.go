@@ -0,0 +1,113 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io/fs"
+	"iter"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type iterFS struct {
+	fstest.MapFS
+	calls int
+}
+
+func (i *iterFS) ReadDirIter(name string) iter.Seq2[fs.DirEntry, error] {
+	i.calls++
+	return func(yield func(fs.DirEntry, error) bool) {
+		ds, err := i.MapFS.ReadDir(name)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for _, v := range ds {
+			if !yield(v, nil) {
+				return
+			}
+		}
+	}
+}
+
+func TestReadDirIter(t *testing.T) {
+	files := fstest.MapFS{}
+	for _, v := range []string{"a", "b", "c", "d"} {
+		files["dir/"+v] = &fstest.MapFile{Data: data["foo"]}
+	}
+	it := &iterFS{MapFS: fstest.MapFS{"foo": {Data: data["foo"]}}}
+	m, err := Mount("m", files)
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("it", it))
+
+	collect := func(name string, max int) ([]string, error) {
+		var res []string
+		for d, err := range m.ReadDirIter(name) {
+			if err != nil {
+				return res, err
+			}
+			res = append(res, d.(FullPather).FullPath())
+			if len(res) == max {
+				break
+			}
+		}
+		return res, nil
+	}
+	got, err := collect("m/dir", -1)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"m/dir/a", "m/dir/b", "m/dir/c", "m/dir/d"}, got)
+	got, err = collect("m/dir", 2)
+	require.NoError(t, err)
+	assert.Len(t, got, 2)
+
+	got, err = collect(".", -1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"it", "m"}, got)
+
+	got, err = collect("it", -1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"it/foo"}, got)
+	assert.Equal(t, 1, it.calls)
+
+	_, err = collect("m/missing", -1)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	var me *MountError
+	assert.True(t, errors.As(err, &me))
+	_, err = collect("missing", -1)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestReadDirIterWrapped(t *testing.T) {
+	it := &iterFS{MapFS: fstest.MapFS{
+		"a.txt": {Data: data["foo"]},
+		"b.log": {Data: data["foo"]},
+		"c.txt": {Data: data["foo"]},
+	}}
+	m, err := Mount("it", it, WithTimeout(time.Second), WithMaxConcurrent(2), WithCache(time.Minute), WithExclude("*.log"))
+	require.NoError(t, err)
+
+	var got []string
+	for d, err := range m.ReadDirIter("it") {
+		require.NoError(t, err)
+		got = append(got, d.Name())
+	}
+	assert.Equal(t, []string{"a.txt", "c.txt"}, got)
+	assert.Equal(t, 1, it.calls)
+}
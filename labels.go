@@ -0,0 +1,58 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// WithProfilerLabels sets the pprof labels "mfs.mount" and "mfs.op" on the
+// goroutines while they run an operation of a mounted file system, reading
+// its files included, for the CPU and blocking profiles to attribute their
+// time to the mounts. The labels of the operation context, see WithContext,
+// are kept.
+func WithProfilerLabels() Option {
+	return func(m *mfs) {
+		m.labels = true
+	}
+}
+
+// labelContext returns the context the backend operations are labeled
+// from, nil if WithProfilerLabels is not set.
+func (m *mfs) labelContext() context.Context {
+	if !m.labels {
+		return nil
+	}
+	return m.context()
+}
+
+// labeled runs fn, the operation op of the file system mounted at mnt,
+// with the profiler labels if enabled.
+func (m *mfs) labeled(mnt *mount, op string, fn func() error) error {
+	return labeled(m.labelContext(), mnt, op, fn)
+}
+
+// labeled runs fn with the labels of the operation op of mnt added to ctx,
+// or as is when ctx is nil.
+func labeled(ctx context.Context, mnt *mount, op string, fn func() error) (err error) {
+	if ctx == nil {
+		return fn()
+	}
+	pprof.Do(ctx, pprof.Labels("mfs.mount", mnt.path, "mfs.op", op), func(context.Context) {
+		err = fn()
+	})
+	return err
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"runtime/pprof"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// labelFS records the goroutine labels of the profile taken while opening
+// and writing files.
+type labelFS struct {
+	*MemFS
+	mu     sync.Mutex
+	labels []string
+}
+
+func (l *labelFS) record() {
+	var b bytes.Buffer
+	_ = pprof.Lookup("goroutine").WriteTo(&b, 1)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, v := range bytes.Split(b.Bytes(), []byte("\n")) {
+		if bytes.HasPrefix(v, []byte("# labels: ")) {
+			l.labels = append(l.labels, string(v))
+		}
+	}
+}
+
+func (l *labelFS) Open(name string) (fs.File, error) {
+	l.record()
+	return l.MemFS.Open(name)
+}
+
+func (l *labelFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	l.record()
+	return l.MemFS.WriteFile(name, data, perm)
+}
+
+func TestProfilerLabels(t *testing.T) {
+	l := &labelFS{MemFS: NewMemFS()}
+	m := New()
+	require.NoError(t, m.Mount("mem", l))
+	require.NoError(t, m.WriteFile("mem/foo", data["foo"], 0644))
+	assert.Empty(t, l.labels)
+
+	l = &labelFS{MemFS: NewMemFS()}
+	m = New(WithProfilerLabels())
+	require.NoError(t, m.Mount("mem", l))
+	ctx := pprof.WithLabels(context.Background(), pprof.Labels("request", "r1"))
+	c := m.WithContext(ctx)
+	require.NoError(t, c.WriteFile("mem/foo", data["foo"], 0644))
+	_, err := fs.ReadFile(c, "mem/foo")
+	require.NoError(t, err)
+	require.Len(t, l.labels, 2)
+	assert.Contains(t, l.labels[0], `"mfs.mount":"mem"`)
+	assert.Contains(t, l.labels[0], `"mfs.op":"write"`)
+	assert.Contains(t, l.labels[0], `"request":"r1"`)
+	assert.Contains(t, l.labels[1], `"mfs.op":"open"`)
+}
@@ -0,0 +1,205 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+)
+
+// ErrTooManyOperations is the error returned by the operations of a mount
+// whose concurrency limit is reached under the FailOnLimit policy.
+var ErrTooManyOperations = errors.New("too many concurrent operations")
+
+// LimitPolicy controls what happens to the operations beyond the concurrency
+// limit of a mount.
+type LimitPolicy int
+
+const (
+	// QueueOnLimit makes the operations wait for a slot.
+	QueueOnLimit LimitPolicy = iota
+	// FailOnLimit makes the operations fail with ErrTooManyOperations.
+	FailOnLimit
+)
+
+// WithMaxConcurrent bounds the number of operations in flight against the
+// mounted file system, e.g. to honour the request rate limits of an object
+// store, see Limit.
+func WithMaxConcurrent(n int) MountOption {
+	return func(o *mountOptions) {
+		o.maxConcurrent = n
+	}
+}
+
+// WithLimitPolicy sets the policy applied to the operations beyond the limit
+// set with WithMaxConcurrent. It defaults to QueueOnLimit.
+func WithLimitPolicy(p LimitPolicy) MountOption {
+	return func(o *mountOptions) {
+		o.limitPolicy = p
+	}
+}
+
+// Limit returns a file system running at most n operations of fsys
+// concurrently: opening, listing and stating files, reading them and the
+// write operations. The operations beyond the limit wait for a slot or fail
+// with a *fs.PathError wrapping ErrTooManyOperations, depending on p. The
+// files opened for reading forward io.Seeker and io.ReaderAt, failing with
+// errors.ErrUnsupported when the files of fsys do not. The files opened for
+// writing are returned as is, their writes not being limited.
+func Limit(fsys fs.FS, n int, p LimitPolicy) fs.FS {
+	return newLimiter(n, p).wrap(fsys)
+}
+
+// limiter is the semaphore shared by the file systems of a mount.
+type limiter struct {
+	sem    chan struct{}
+	policy LimitPolicy
+}
+
+func newLimiter(n int, p LimitPolicy) *limiter {
+	return &limiter{sem: make(chan struct{}, max(n, 1)), policy: p}
+}
+
+func (l *limiter) wrap(fsys fs.FS) fs.FS {
+	return &limitFS{forwardFS: forwardFS{fsys: fsys, call: func(op, name string, fn func() error) error {
+		return limitedErr(l, op, name, fn)
+	}}, l: l}
+}
+
+func (l *limiter) acquire(op, name string) error {
+	if l.policy == FailOnLimit {
+		select {
+		case l.sem <- struct{}{}:
+			return nil
+		default:
+			return &fs.PathError{Op: op, Path: name, Err: ErrTooManyOperations}
+		}
+	}
+	l.sem <- struct{}{}
+	return nil
+}
+
+func (l *limiter) release() {
+	<-l.sem
+}
+
+// limited runs fn once a slot is acquired.
+func limited[T any](l *limiter, op, name string, fn func() (T, error)) (T, error) {
+	if err := l.acquire(op, name); err != nil {
+		var zero T
+		return zero, err
+	}
+	defer l.release()
+	return fn()
+}
+
+// limitedErr is limited for the functions only returning an error.
+func limitedErr(l *limiter, op, name string, fn func() error) error {
+	_, err := limited(l, op, name, func() (struct{}, error) {
+		return struct{}{}, fn()
+	})
+	return err
+}
+
+type limitFS struct {
+	forwardFS
+	l *limiter
+}
+
+func (f *limitFS) Open(name string) (fs.File, error) {
+	file, err := limited(f.l, "open", name, func() (fs.File, error) {
+		return f.fsys.Open(name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &limitFile{File: file, l: f.l, name: name}, nil
+}
+
+func (f *limitFS) Stat(name string) (fs.FileInfo, error) {
+	return limited(f.l, "stat", name, func() (fs.FileInfo, error) {
+		return fs.Stat(f.fsys, name)
+	})
+}
+
+func (f *limitFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return limited(f.l, "readdir", name, func() ([]fs.DirEntry, error) {
+		return fs.ReadDir(f.fsys, name)
+	})
+}
+
+func (f *limitFS) ReadDirPage(name, token string, n int) ([]fs.DirEntry, string, error) {
+	return readDirPage(f.fsys, name, token, n, func(fn func() (page, error)) (page, error) {
+		return limited(f.l, "readdir", name, fn)
+	})
+}
+
+func (f *limitFS) OpenFile(name string, flag int, perm fs.FileMode) (fs.File, error) {
+	w, ok := f.fsys.(OpenFileFS)
+	if !ok {
+		return nil, unsupported("open", name)
+	}
+	// the written files are returned as is to keep their io.Writer
+	return limited(f.l, "open", name, func() (fs.File, error) {
+		return w.OpenFile(name, flag, perm)
+	})
+}
+
+type limitFile struct {
+	fs.File
+	l    *limiter
+	name string
+}
+
+func (f *limitFile) Stat() (fs.FileInfo, error) {
+	return limited(f.l, "stat", f.name, f.File.Stat)
+}
+
+func (f *limitFile) Read(b []byte) (int, error) {
+	return limited(f.l, "read", f.name, func() (int, error) {
+		return f.File.Read(b)
+	})
+}
+
+func (f *limitFile) ReadAt(b []byte, off int64) (int, error) {
+	r, ok := f.File.(io.ReaderAt)
+	if !ok {
+		return 0, unsupported("read", f.name)
+	}
+	return limited(f.l, "read", f.name, func() (int, error) {
+		return r.ReadAt(b, off)
+	})
+}
+
+func (f *limitFile) Seek(offset int64, whence int) (int64, error) {
+	s, ok := f.File.(io.Seeker)
+	if !ok {
+		return 0, unsupported("seek", f.name)
+	}
+	return limited(f.l, "seek", f.name, func() (int64, error) {
+		return s.Seek(offset, whence)
+	})
+}
+
+func (f *limitFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	d, ok := f.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errors.New("not a directory")}
+	}
+	return limited(f.l, "readdir", f.name, func() ([]fs.DirEntry, error) {
+		return d.ReadDir(n)
+	})
+}
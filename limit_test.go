@@ -0,0 +1,101 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxConcurrent(t *testing.T) {
+	mem := NewMemFS()
+	require.NoError(t, mem.WriteFile("foo", data["foo"], 0644))
+	require.NoError(t, mem.WriteFile("hang", data["foo"], 0644))
+	h := &hangFS{MemFS: mem, release: make(chan struct{})}
+	m, err := Mount("fail", h, WithMaxConcurrent(1), WithLimitPolicy(FailOnLimit))
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		_, err := m.Open("fail/hang")
+		done <- err
+	}()
+	require.Eventually(t, func() bool {
+		_, err := fs.Stat(m, "fail/foo")
+		return errors.Is(err, ErrTooManyOperations)
+	}, time.Second, time.Millisecond)
+	var pe *fs.PathError
+	assert.True(t, errors.As(m.WriteFile("fail/bar", nil, 0644), &pe))
+	assert.ErrorIs(t, pe, ErrTooManyOperations)
+	close(h.release)
+	require.NoError(t, <-done)
+	_, err = fs.Stat(m, "fail/foo")
+	require.NoError(t, err)
+	b, err := fs.ReadFile(m, "fail/foo")
+	require.NoError(t, err)
+	assert.Equal(t, data["foo"], b)
+}
+
+func TestMaxConcurrentQueue(t *testing.T) {
+	mem := NewMemFS()
+	require.NoError(t, mem.WriteFile("foo", data["foo"], 0644))
+	require.NoError(t, mem.WriteFile("hang", data["foo"], 0644))
+	h := &hangFS{MemFS: mem, release: make(chan struct{})}
+	m, err := Mount("queue", h, WithMaxConcurrent(1))
+	require.NoError(t, err)
+
+	started := make(chan struct{})
+	go func() {
+		close(started)
+		m.Open("queue/hang")
+	}()
+	<-started
+	time.Sleep(10 * time.Millisecond)
+	queued := make(chan error)
+	go func() {
+		_, err := fs.Stat(m, "queue/foo")
+		queued <- err
+	}()
+	select {
+	case <-queued:
+		t.Fatal("operation not queued")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(h.release)
+	select {
+	case err := <-queued:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("queued operation not run")
+	}
+}
+
+func TestLimitAs(t *testing.T) {
+	_, ok := As[RenameFS](Limit(NewMemFS(), 2, QueueOnLimit))
+	assert.True(t, ok)
+	_, ok = As[RenameFS](Limit(Timeout(NewMemFS(), time.Second), 2, QueueOnLimit))
+	assert.True(t, ok)
+}
+
+func TestLimitFile(t *testing.T) {
+	testSeekReadAt(t, func(fsys fs.FS) fs.FS {
+		return Limit(fsys, 1, FailOnLimit)
+	})
+}
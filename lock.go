@@ -0,0 +1,125 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// ErrLocked is returned by Lock when the file is already locked in a
+// conflicting mode.
+var ErrLocked = errors.New("file locked")
+
+// Unlocker releases a lock.
+type Unlocker interface {
+	Unlock() error
+}
+
+// UnlockFunc adapts a function to an Unlocker.
+type UnlockFunc func() error
+
+func (f UnlockFunc) Unlock() error {
+	return f()
+}
+
+// LockFS is implemented by file systems supporting advisory locks, e.g.
+// shared with other processes. Lock does not block: it fails with an error
+// wrapping ErrLocked when name is already locked in a conflicting mode.
+type LockFS interface {
+	fs.FS
+	Lock(name string, shared bool) (Unlocker, error)
+}
+
+// locks holds the in-process advisory locks of a mount, by path relative
+// to it.
+type locks struct {
+	mu   sync.Mutex
+	held map[string]*lockState
+}
+
+type lockState struct {
+	shared    int
+	exclusive bool
+}
+
+func (l *locks) lock(name string, shared bool) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := l.held[name]
+	if s == nil {
+		s = &lockState{}
+		if l.held == nil {
+			l.held = make(map[string]*lockState)
+		}
+		l.held[name] = s
+	}
+	if s.exclusive || !shared && s.shared > 0 {
+		return false
+	}
+	if shared {
+		s.shared++
+	} else {
+		s.exclusive = true
+	}
+	return true
+}
+
+func (l *locks) unlock(name string, shared bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := l.held[name]
+	if shared {
+		s.shared--
+	} else {
+		s.exclusive = false
+	}
+	if s.shared == 0 && !s.exclusive {
+		delete(l.held, name)
+	}
+}
+
+func (m *mfs) Lock(name string, shared bool) (_ Unlocker, err error) {
+	defer m.record("lock", name, time.Now(), &err)
+	mnt, rel, err := m.writeTarget("lock", name)
+	if err != nil {
+		return nil, err
+	}
+	key := mnt.shared(rel)
+	if !mnt.locks.lock(key, shared) {
+		return nil, &fs.PathError{Op: "lock", Path: name, Err: ErrLocked}
+	}
+	var backend Unlocker
+	if l, ok := As[LockFS](mnt.writable); ok {
+		if backend, err = l.Lock(rel, shared); err != nil {
+			mnt.locks.unlock(key, shared)
+			return nil, mnt.wrapErr("lock", name, rel, err)
+		}
+	}
+	var once sync.Once
+	return UnlockFunc(func() error {
+		err := error(&fs.PathError{Op: "unlock", Path: name, Err: fs.ErrClosed})
+		once.Do(func() {
+			err = nil
+			if backend != nil {
+				err = mnt.wrapErr("unlock", name, rel, backend.Unlock())
+			}
+			mnt.locks.unlock(key, shared)
+		})
+		return err
+	}), nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type lockingFS struct {
+	*MemFS
+	locked map[string]bool
+}
+
+func (l *lockingFS) Lock(name string, _ bool) (Unlocker, error) {
+	if l.locked[name] {
+		return nil, &fs.PathError{Op: "lock", Path: name, Err: ErrLocked}
+	}
+	l.locked[name] = true
+	return UnlockFunc(func() error {
+		delete(l.locked, name)
+		return nil
+	}), nil
+}
+
+func TestLock(t *testing.T) {
+	m, err := Mount("a", NewMemFS())
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("b", NewMemFS()))
+
+	r1, err := m.Lock("a/foo", true)
+	require.NoError(t, err)
+	r2, err := m.Lock("a/foo", true)
+	require.NoError(t, err)
+	_, err = m.Lock("a/foo", false)
+	assert.ErrorIs(t, err, ErrLocked)
+	// scoped per mount
+	w, err := m.Lock("b/foo", false)
+	require.NoError(t, err)
+	_, err = m.Lock("b/foo", true)
+	assert.ErrorIs(t, err, ErrLocked)
+	require.NoError(t, w.Unlock())
+	assert.ErrorIs(t, w.Unlock(), fs.ErrClosed)
+
+	require.NoError(t, r1.Unlock())
+	_, err = m.Lock("a/foo", false)
+	assert.ErrorIs(t, err, ErrLocked)
+	require.NoError(t, r2.Unlock())
+	w, err = m.Lock("a/foo", false)
+	require.NoError(t, err)
+
+	// the locks survive the replacement of the mount
+	require.NoError(t, m.Replace("a", NewMemFS()))
+	_, err = m.Lock("a/foo", true)
+	assert.ErrorIs(t, err, ErrLocked)
+	require.NoError(t, w.Unlock())
+
+	_, err = m.Lock("missing/foo", true)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestLockFS(t *testing.T) {
+	backend := &lockingFS{MemFS: NewMemFS(), locked: map[string]bool{"held": true}}
+	m, err := Mount("locking", backend)
+	require.NoError(t, err)
+
+	_, err = m.Lock("locking/held", true)
+	assert.ErrorIs(t, err, ErrLocked)
+	u, err := m.Lock("locking/foo", false)
+	require.NoError(t, err)
+	assert.True(t, backend.locked["foo"])
+	require.NoError(t, u.Unlock())
+	assert.False(t, backend.locked["foo"])
+
+	// the in-process lock was released when the backend one failed
+	delete(backend.locked, "held")
+	u, err = m.Lock("locking/held", false)
+	require.NoError(t, err)
+	require.NoError(t, u.Unlock())
+}
+
+func TestLockFSWrapped(t *testing.T) {
+	backend := &lockingFS{MemFS: NewMemFS(), locked: map[string]bool{"dir/held": true}}
+	require.NoError(t, backend.MkdirAll("dir", 0755))
+	m, err := Mount("locking", backend, WithTimeout(time.Minute), WithMaxConcurrent(4))
+	require.NoError(t, err)
+	require.NoError(t, m.Bind("locking/dir", "bound"))
+
+	_, err = m.Lock("locking/dir/held", false)
+	assert.ErrorIs(t, err, ErrLocked)
+	_, err = m.Lock("bound/held", false)
+	assert.ErrorIs(t, err, ErrLocked)
+	u, err := m.Lock("bound/foo", false)
+	require.NoError(t, err)
+	assert.True(t, backend.locked["dir/foo"])
+	require.NoError(t, u.Unlock())
+	assert.False(t, backend.locked["dir/foo"])
+}
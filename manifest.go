@@ -0,0 +1,134 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// ErrChecksumMismatch is returned when reading a file whose content does not
+// match its manifest entry.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// Manifest maps slash separated file paths to their hex encoded SHA-256.
+type Manifest map[string]string
+
+// GenerateManifest hashes all the regular files found under root. The
+// manifest keys are relative to root.
+func GenerateManifest(fsys fs.FS, root string) (Manifest, error) {
+	m := make(Manifest)
+	err := WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		f, err := fsys.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		}
+		m[relPath(root, p)] = hex.EncodeToString(h.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func relPath(root, p string) string {
+	root = strings.Trim(root, "/")
+	p = strings.Trim(p, "/")
+	if root == "" || root == "." {
+		return p
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(p, root), "/")
+}
+
+// Verify returns a file system checking the content of the files read from
+// fsys against the manifest. Reading a file fails with ErrChecksumMismatch
+// when reaching its end with an unexpected hash, or immediately if the file
+// is not listed in the manifest.
+// The write operations are forwarded as is: the files written cannot be read
+// until the manifest is updated accordingly.
+func Verify(fsys fs.FS, m Manifest) fs.FS {
+	return &verifyFS{forwardFS: forwardFS{fsys: fsys}, m: m}
+}
+
+type verifyFS struct {
+	forwardFS
+	m Manifest
+}
+
+// components returns the wrapped file system, see Topology.
+func (v *verifyFS) components() []fs.FS {
+	return []fs.FS{v.fsys}
+}
+
+func (v *verifyFS) Open(name string) (fs.File, error) {
+	f, err := v.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	s, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !s.Mode().IsRegular() {
+		return f, nil
+	}
+	sum, ok := v.m[name]
+	if !ok {
+		f.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("%w: not in manifest", ErrChecksumMismatch)}
+	}
+	want, err := hex.DecodeString(sum)
+	if err != nil {
+		f.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("%w: invalid manifest entry", ErrChecksumMismatch)}
+	}
+	return &verifyFile{File: f, name: name, want: want, h: sha256.New()}, nil
+}
+
+type verifyFile struct {
+	fs.File
+	name string
+	want []byte
+	h    hash.Hash
+}
+
+func (f *verifyFile) Read(b []byte) (int, error) {
+	n, err := f.File.Read(b)
+	f.h.Write(b[:n])
+	if err == io.EOF && !bytes.Equal(f.h.Sum(nil), f.want) {
+		return n, &fs.PathError{Op: "read", Path: f.name, Err: ErrChecksumMismatch}
+	}
+	return n, err
+}
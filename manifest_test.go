@@ -0,0 +1,61 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifest(t *testing.T) {
+	backend := fstest.MapFS{
+		"foo":     {Data: data["foo"]},
+		"dir/baz": {Data: data["baz"]},
+	}
+	m, err := Mount("assets", backend)
+	require.NoError(t, err)
+	manifest, err := GenerateManifest(m, "assets")
+	require.NoError(t, err)
+	assert.Len(t, manifest, 2)
+	assert.Equal(t, "fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9", manifest["foo"])
+
+	require.NoError(t, m.Mount("assets", backend, WithManifest(manifest), WithShadowing(Replace)))
+	b, err := fs.ReadFile(m, "assets/dir/baz")
+	require.NoError(t, err)
+	assert.Equal(t, data["baz"], b)
+
+	backend["foo"] = &fstest.MapFile{Data: []byte("tampered")}
+	backend["new"] = &fstest.MapFile{Data: []byte("new")}
+	_, err = fs.ReadFile(m, "assets/foo")
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	_, err = m.Open("assets/new")
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	_, err = m.ReadDir("assets")
+	assert.NoError(t, err)
+
+	// the writes are forwarded, the files being read once in the manifest
+	mem := NewMemFS()
+	require.NoError(t, m.Mount("mem", mem, WithManifest(Manifest{})))
+	require.NoError(t, m.WriteFile("mem/foo", data["foo"], 0644))
+	_, err = fs.ReadFile(m, "mem/foo")
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	b, err = mem.ReadFile("foo")
+	require.NoError(t, err)
+	assert.Equal(t, data["foo"], b)
+}
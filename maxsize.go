@@ -0,0 +1,88 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// ErrFileTooLarge is the error returned when opening a file larger than the
+// limit set with WithMaxFileSize.
+var ErrFileTooLarge = errors.New("file too large")
+
+// WithMaxFileSize refuses to open the files of the mount larger than n
+// bytes, see MaxFileSize. The guard applies before the other options, e.g.
+// WithTransform or WithCache, which never see the larger files. With
+// WithDecompression, it limits the size of the compressed files, not the
+// one of their decompressed content.
+func WithMaxFileSize(n int64) MountOption {
+	return func(o *mountOptions) {
+		o.maxFileSize = n
+	}
+}
+
+// MaxFileSize returns a file system failing to open the regular files of
+// fsys larger than n bytes with a *fs.PathError wrapping ErrFileTooLarge,
+// for reading included when they are opened with OpenFile. They are still
+// listed and their entries' Info reports their size. The write operations
+// are forwarded as is.
+func MaxFileSize(fsys fs.FS, n int64) fs.FS {
+	return &maxSizeFS{forwardFS: forwardFS{fsys: fsys}, n: n}
+}
+
+type maxSizeFS struct {
+	forwardFS
+	n int64
+}
+
+func (m *maxSizeFS) Open(name string) (fs.File, error) {
+	f, err := m.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	i, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if i.Mode().IsRegular() && i.Size() > m.n {
+		f.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: ErrFileTooLarge}
+	}
+	return f, nil
+}
+
+func (m *maxSizeFS) OpenFile(name string, flag int, perm fs.FileMode) (fs.File, error) {
+	w, ok := m.fsys.(OpenFileFS)
+	if !ok {
+		return nil, unsupported("open", name)
+	}
+	f, err := w.OpenFile(name, flag, perm)
+	if err != nil || flag&(os.O_WRONLY|os.O_RDWR) == os.O_WRONLY || flag&os.O_TRUNC != 0 {
+		return f, err
+	}
+	i, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if i.Mode().IsRegular() && i.Size() > m.n {
+		f.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: ErrFileTooLarge}
+	}
+	return f, nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxFileSize(t *testing.T) {
+	mem := NewMemFS()
+	require.NoError(t, mem.MkdirAll("dir", 0755))
+	require.NoError(t, mem.WriteFile("small", []byte("foo"), 0644))
+	require.NoError(t, mem.WriteFile("dir/large", []byte("foobarbaz"), 0644))
+
+	m, err := Mount("mem", mem, WithMaxFileSize(4))
+	require.NoError(t, err)
+
+	b, err := fs.ReadFile(m, "mem/small")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(b))
+	_, err = m.Open("mem/dir/large")
+	assert.ErrorIs(t, err, ErrFileTooLarge)
+	_, err = fs.ReadFile(m, "mem/dir/large")
+	assert.ErrorIs(t, err, ErrFileTooLarge)
+
+	entries, err := m.ReadDir("mem/dir")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "large", entries[0].Name())
+	i, err := entries[0].Info()
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), i.Size())
+	_, err = m.Open("mem/dir")
+	assert.NoError(t, err)
+
+	// the files opened for reading and writing are checked too
+	_, err = m.OpenFile("mem/dir/large", os.O_RDWR, 0)
+	assert.ErrorIs(t, err, ErrFileTooLarge)
+	f, err := m.OpenFile("mem/dir/large", os.O_WRONLY, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	require.NoError(t, m.WriteFile("mem/dir/large", []byte("bar"), 0644))
+	b, err = fs.ReadFile(m, "mem/dir/large")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(b))
+}
@@ -0,0 +1,620 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemFS is a writable in-memory file system.
+type MemFS struct {
+	mu           sync.RWMutex
+	root         *memNode
+	snapshots    map[SnapshotID]*memNode
+	lastSnapshot SnapshotID
+	// gen is the generation of the tree, bumped by each snapshot: the nodes
+	// of the previous generations are shared with the snapshots and copied
+	// before being modified, see own.
+	gen uint64
+	// epoch is bumped by each rollback, detaching the files opened before.
+	epoch uint64
+}
+
+var (
+	_ WritableMFS  = (*MemFS)(nil)
+	_ fs.StatFS    = (*MemFS)(nil)
+	_ fs.ReadDirFS = (*MemFS)(nil)
+)
+
+// NewMemFS returns an empty in-memory file system.
+func NewMemFS() *MemFS {
+	return &MemFS{root: &memNode{name: ".", mode: fs.ModeDir | 0755, modTime: time.Now(), children: map[string]*memNode{}}}
+}
+
+type memNode struct {
+	name     string
+	mode     fs.FileMode
+	modTime  time.Time
+	data     []byte
+	children map[string]*memNode
+	// shared reports data being shared with a snapshot: it must be copied
+	// before being modified in place.
+	shared bool
+	gen    uint64
+	// next is the copy replacing the node in the tree during epoch, which
+	// the files opened on the node follow.
+	next  *memNode
+	epoch uint64
+}
+
+func (n *memNode) info() fs.FileInfo {
+	return &memInfo{name: n.name, mode: n.mode, modTime: n.modTime, size: int64(len(n.data))}
+}
+
+func (n *memNode) entries() []fs.DirEntry {
+	res := make([]fs.DirEntry, 0, len(n.children))
+	for _, c := range n.children {
+		res = append(res, fs.FileInfoToDirEntry(c.info()))
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name() < res[j].Name()
+	})
+	return res
+}
+
+// lookup returns the node at name. It must be called with the lock held.
+func (m *MemFS) lookup(op, name string) (*memNode, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	n := m.root
+	if name == "." {
+		return n, nil
+	}
+	for _, v := range strings.Split(name, "/") {
+		if n.children == nil {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		c, ok := n.children[v]
+		if !ok {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		n = c
+	}
+	return n, nil
+}
+
+// own returns the node at name for modification, copying it with its
+// parents when shared with a snapshot. It must be called with the write lock
+// held.
+func (m *MemFS) own(op, name string) (*memNode, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	m.root = m.owned(m.root)
+	n := m.root
+	if name == "." {
+		return n, nil
+	}
+	for _, v := range strings.Split(name, "/") {
+		c, ok := n.children[v]
+		if !ok {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		n = m.child(n, c)
+	}
+	return n, nil
+}
+
+// child returns the child c of the owned directory p for modification,
+// replacing it in p by its copy when shared with a snapshot.
+func (m *MemFS) child(p, c *memNode) *memNode {
+	c = m.owned(c)
+	p.children[c.name] = c
+	return c
+}
+
+// owned returns n, or its copy when n is shared with a snapshot, the copy
+// sharing the data and the children of n.
+func (m *MemFS) owned(n *memNode) *memNode {
+	if n.gen == m.gen {
+		return n
+	}
+	c := n.copy(m.gen)
+	n.next, n.epoch = c, m.epoch
+	return c
+}
+
+func (n *memNode) copy(gen uint64) *memNode {
+	c := &memNode{name: n.name, mode: n.mode, modTime: n.modTime, data: n.data, shared: n.data != nil, gen: gen}
+	if n.children != nil {
+		c.children = make(map[string]*memNode, len(n.children))
+		for k, v := range n.children {
+			c.children[k] = v
+		}
+	}
+	return c
+}
+
+// current returns the last copy of n made during epoch, n being opened
+// during epoch. It must be called with the lock held.
+func (m *MemFS) current(n *memNode, epoch uint64) *memNode {
+	for n.next != nil && n.epoch == epoch {
+		n = n.next
+	}
+	return n
+}
+
+// path returns the name of the node n in the tree.
+// It must be called with the lock held.
+func (m *MemFS) path(n *memNode) (string, bool) {
+	var walk func(p *memNode, name string) (string, bool)
+	walk = func(p *memNode, name string) (string, bool) {
+		if p == n {
+			return name, true
+		}
+		for k, v := range p.children {
+			if name, ok := walk(v, path.Join(name, k)); ok {
+				return name, true
+			}
+		}
+		return "", false
+	}
+	return walk(m.root, ".")
+}
+
+// parent returns the directory holding name for modification. It must be
+// called with the write lock held.
+func (m *MemFS) parent(op, name string) (*memNode, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	p, err := m.own(op, path.Dir(name))
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if !p.mode.IsDir() {
+		return nil, &fs.PathError{Op: op, Path: name, Err: errors.New("not a directory")}
+	}
+	return p, nil
+}
+
+func (m *MemFS) Open(name string) (fs.File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (m *MemFS) OpenFile(name string, flag int, perm fs.FileMode) (fs.File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.lookup("open", name)
+	switch {
+	case err == nil:
+		if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+		}
+	case errors.Is(err, fs.ErrNotExist) && flag&os.O_CREATE != 0:
+		p, err := m.parent("open", name)
+		if err != nil {
+			return nil, err
+		}
+		n = &memNode{name: path.Base(name), mode: perm & fs.ModePerm, modTime: time.Now(), gen: m.gen}
+		p.children[n.name] = n
+		p.modTime = n.modTime
+	default:
+		return nil, err
+	}
+	write := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if n.mode.IsDir() {
+		if write {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+		}
+		epoch := m.epoch
+		return &memDir{info: n.info(), dirReader: dirReader{list: func() ([]fs.DirEntry, error) {
+			m.mu.RLock()
+			defer m.mu.RUnlock()
+			return m.current(n, epoch).entries(), nil
+		}}}, nil
+	}
+	if write && flag&os.O_TRUNC != 0 {
+		if n, err = m.own("open", name); err != nil {
+			return nil, err
+		}
+		n.data, n.shared = nil, false
+		n.modTime = time.Now()
+	}
+	return &memFile{m: m, n: n, epoch: m.epoch, name: name, flag: flag}, nil
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, err := m.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return n.info(), nil
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, err := m.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !n.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return n.entries(), nil
+}
+
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, err := m.lookup("read", name)
+	if err != nil {
+		return nil, err
+	}
+	if n.mode.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+	return append([]byte(nil), n.data...), nil
+}
+
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, err := m.parent("write", name)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if n, ok := p.children[path.Base(name)]; ok {
+		if n.mode.IsDir() {
+			return &fs.PathError{Op: "write", Path: name, Err: errors.New("is a directory")}
+		}
+		n = m.child(p, n)
+		n.data, n.modTime, n.shared = append([]byte(nil), data...), now, false
+		return nil
+	}
+	p.children[path.Base(name)] = &memNode{name: path.Base(name), mode: perm & fs.ModePerm, modTime: now, data: append([]byte(nil), data...), gen: m.gen}
+	p.modTime = now
+	return nil
+}
+
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n, err := m.lookup("mkdir", name); err == nil {
+		if !n.mode.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: name, Err: errors.New("not a directory")}
+		}
+		return nil
+	}
+	m.root = m.owned(m.root)
+	n := m.root
+	for _, v := range strings.Split(name, "/") {
+		c, ok := n.children[v]
+		if !ok {
+			c = &memNode{name: v, mode: fs.ModeDir | perm&fs.ModePerm, modTime: time.Now(), children: map[string]*memNode{}, gen: m.gen}
+			n.children[v] = c
+			n.modTime = c.modTime
+		}
+		if !c.mode.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: name, Err: errors.New("not a directory")}
+		}
+		n = m.child(n, c)
+	}
+	return nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, err := m.parent("remove", name)
+	if err != nil {
+		return err
+	}
+	n, ok := p.children[path.Base(name)]
+	if !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if len(n.children) > 0 {
+		return &fs.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+	}
+	delete(p.children, n.name)
+	p.modTime = time.Now()
+	return nil
+}
+
+func (m *MemFS) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if name == "." {
+		return &fs.PathError{Op: "removeall", Path: name, Err: fs.ErrInvalid}
+	}
+	p, err := m.parent("removeall", name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	delete(p.children, path.Base(name))
+	p.modTime = time.Now()
+	return nil
+}
+
+func (m *MemFS) Rename(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	op, err := m.parent("rename", oldname)
+	if err != nil {
+		return err
+	}
+	n, ok := op.children[path.Base(oldname)]
+	if !ok {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: fs.ErrNotExist}
+	}
+	np, err := m.parent("rename", newname)
+	if err != nil {
+		return err
+	}
+	if n.mode.IsDir() && (newname == oldname || strings.HasPrefix(newname, oldname+"/")) {
+		return &fs.PathError{Op: "rename", Path: newname, Err: fs.ErrInvalid}
+	}
+	if t, ok := np.children[path.Base(newname)]; ok && t.mode.IsDir() != n.mode.IsDir() {
+		return &fs.PathError{Op: "rename", Path: newname, Err: fs.ErrExist}
+	}
+	n = m.owned(n)
+	delete(op.children, n.name)
+	n.name = path.Base(newname)
+	np.children[n.name] = n
+	now := time.Now()
+	op.modTime, np.modTime = now, now
+	return nil
+}
+
+// Chtimes sets the modification time of name, the access time not being
+// tracked.
+func (m *MemFS) Chtimes(name string, _, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.own("chtimes", name)
+	if err != nil {
+		return err
+	}
+	n.modTime = mtime
+	return nil
+}
+
+// Chmod sets the permission bits of name.
+func (m *MemFS) Chmod(name string, mode fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.own("chmod", name)
+	if err != nil {
+		return err
+	}
+	n.mode = n.mode&^fs.ModePerm | mode&fs.ModePerm
+	return nil
+}
+
+type memInfo struct {
+	name    string
+	mode    fs.FileMode
+	modTime time.Time
+	size    int64
+}
+
+func (i *memInfo) Name() string {
+	return i.name
+}
+
+func (i *memInfo) Size() int64 {
+	return i.size
+}
+
+func (i *memInfo) Mode() fs.FileMode {
+	return i.mode
+}
+
+func (i *memInfo) ModTime() time.Time {
+	return i.modTime
+}
+
+func (i *memInfo) IsDir() bool {
+	return i.mode.IsDir()
+}
+
+func (i *memInfo) Sys() any {
+	return nil
+}
+
+type memDir struct {
+	dirReader
+	info fs.FileInfo
+}
+
+func (d *memDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *memDir) Read(_ []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: errors.New("is a directory")}
+}
+
+func (d *memDir) Close() error {
+	return nil
+}
+
+var (
+	_ io.ReadWriteSeeker = (*memFile)(nil)
+	_ io.ReaderAt        = (*memFile)(nil)
+	_ io.WriterAt        = (*memFile)(nil)
+)
+
+type memFile struct {
+	m      *MemFS
+	n      *memNode
+	epoch  uint64
+	name   string
+	flag   int
+	off    int64
+	closed bool
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	f.m.mu.RLock()
+	defer f.m.mu.RUnlock()
+	return f.node().info(), nil
+}
+
+// node returns the node of the file in the tree. It must be called with the
+// lock held.
+func (f *memFile) node() *memNode {
+	return f.m.current(f.n, f.epoch)
+}
+
+// own returns the node of the file for modification, copying it with its
+// parents when shared with a snapshot. The file is written detached from the
+// tree once removed, or once the tree rolled back. It must be called with the
+// write lock held.
+func (f *memFile) own() *memNode {
+	n := f.node()
+	if n.gen == f.m.gen {
+		f.n = n
+		return n
+	}
+	if name, ok := f.m.path(n); ok && f.epoch == f.m.epoch {
+		if o, err := f.m.own("write", name); err == nil {
+			f.n = o
+			return o
+		}
+	}
+	f.n = n.copy(f.m.gen)
+	return f.n
+}
+
+func (f *memFile) check(op string, write bool) error {
+	if f.closed {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrClosed}
+	}
+	canWrite := f.flag&(os.O_WRONLY|os.O_RDWR) != 0
+	canRead := f.flag&os.O_WRONLY == 0
+	if write && !canWrite || !write && !canRead {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrPermission}
+	}
+	return nil
+}
+
+func (f *memFile) Read(b []byte) (int, error) {
+	n, err := f.ReadAt(b, f.off)
+	f.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *memFile) ReadAt(b []byte, off int64) (int, error) {
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.m.mu.RLock()
+	defer f.m.mu.RUnlock()
+	data := f.node().data
+	if off >= int64(len(data)) {
+		return 0, io.EOF
+	}
+	n := copy(b, data[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) Write(b []byte) (int, error) {
+	if f.flag&os.O_APPEND != 0 {
+		f.m.mu.RLock()
+		f.off = int64(len(f.node().data))
+		f.m.mu.RUnlock()
+	}
+	n, err := f.WriteAt(b, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *memFile) WriteAt(b []byte, off int64) (int, error) {
+	if err := f.check("write", true); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.m.mu.Lock()
+	defer f.m.mu.Unlock()
+	n := f.own()
+	if end := off + int64(len(b)); end > int64(len(n.data)) || n.shared {
+		data := make([]byte, max(end, int64(len(n.data))))
+		copy(data, n.data)
+		n.data, n.shared = data, false
+	}
+	copy(n.data[off:], b)
+	n.modTime = time.Now()
+	return len(b), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.m.mu.RLock()
+	size := int64(len(f.node().data))
+	f.m.mu.RUnlock()
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += size
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *memFile) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemFS(t *testing.T) {
+	m := NewMemFS()
+	require.NoError(t, m.MkdirAll("a/b", 0755))
+	for k, v := range data {
+		require.NoError(t, m.WriteFile("a/b/"+k, v, 0644))
+	}
+	require.NoError(t, m.WriteFile("top", data["foo"], 0644))
+	require.NoError(t, fstest.TestFS(m, "a/b/foo", "a/b/baz", "a/b/quux", "a/b/grault", "top"))
+
+	assert.ErrorIs(t, m.WriteFile("nope/foo", nil, 0644), fs.ErrNotExist)
+	assert.Error(t, m.MkdirAll("top/dir", 0755))
+
+	f, err := m.OpenFile("a/new", os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	require.NoError(t, err)
+	_, err = f.(io.Writer).Write([]byte("hello "))
+	require.NoError(t, err)
+	_, err = f.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, fs.ErrPermission)
+	require.NoError(t, f.Close())
+	_, err = m.OpenFile("a/new", os.O_CREATE|os.O_EXCL, 0600)
+	assert.ErrorIs(t, err, fs.ErrExist)
+
+	f, err = m.OpenFile("a/new", os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.(io.Writer).Write([]byte("world"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	b, err := m.ReadFile("a/new")
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(b))
+	s, err := m.Stat("a/new")
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0600), s.Mode())
+
+	require.NoError(t, m.Rename("a/new", "renamed"))
+	_, err = m.Stat("a/new")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.Error(t, m.Rename("a", "a/b/c"))
+
+	assert.Error(t, m.Remove("a/b"))
+	require.NoError(t, m.Remove("renamed"))
+	require.NoError(t, m.RemoveAll("a"))
+	require.NoError(t, m.RemoveAll("a"))
+	d, err := m.ReadDir(".")
+	require.NoError(t, err)
+	require.Len(t, d, 1)
+	assert.Equal(t, "top", d[0].Name())
+}
+
+func TestWritableMFS(t *testing.T) {
+	mem := NewMemFS()
+	m, err := Mount("tmp", mem)
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("ro", fstest.MapFS{}))
+
+	require.NoError(t, m.MkdirAll("tmp/a/b", 0755))
+	require.NoError(t, m.WriteFile("tmp/a/b/foo", data["foo"], 0644))
+	b, err := fs.ReadFile(m, "tmp/a/b/foo")
+	require.NoError(t, err)
+	assert.Equal(t, data["foo"], b)
+
+	f, err := m.OpenFile("tmp/a/bar", os.O_CREATE|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.(io.Writer).Write(data["baz"])
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	b, err = mem.ReadFile("a/bar")
+	require.NoError(t, err)
+	assert.Equal(t, data["baz"], b)
+
+	require.NoError(t, m.Remove("tmp/a/bar"))
+	assert.ErrorIs(t, m.Remove("tmp"), fs.ErrPermission)
+	require.NoError(t, m.RemoveAll("tmp/a"))
+	_, err = mem.Stat("a")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	assert.True(t, errors.Is(m.WriteFile("ro/foo", nil, 0644), errors.ErrUnsupported))
+	assert.ErrorIs(t, m.MkdirAll("nope/foo", 0755), fs.ErrNotExist)
+
+	up := NewMemFS()
+	require.NoError(t, m.Mount("tmp", up, WithShadowing(StackAbove)))
+	require.NoError(t, m.WriteFile("tmp/upper", nil, 0644))
+	_, err = up.Stat("upper")
+	assert.NoError(t, err)
+}
+
+func TestBindWrites(t *testing.T) {
+	mem := NewMemFS()
+	require.NoError(t, mem.MkdirAll("a", 0755))
+	m, err := Mount("m", mem)
+	require.NoError(t, err)
+	require.NoError(t, m.Bind("m/a", "b"))
+
+	// the writes are forwarded to the bound directory
+	require.NoError(t, m.WriteFile("b/foo", data["foo"], 0644))
+	b, err := mem.ReadFile("a/foo")
+	require.NoError(t, err)
+	assert.Equal(t, data["foo"], b)
+}
@@ -0,0 +1,456 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// Merge returns the union of the given file systems. Files are looked up in
+// order and the first match wins. Directory listings are merged, an entry
+// found in several file systems being reported once, from the first one.
+// The listed entries are LayerEntry values. The write operations are
+// forwarded to the first file system.
+func Merge(fss ...fs.FS) fs.FS {
+	return newMergeFS(fss, false, nil)
+}
+
+// MergeWith is like Merge but lets r choose between the entries found under
+// the same name in several file systems, both when listing and opening
+// them. Directories found in several file systems are still merged: r is
+// only called when one of the entries is not a directory.
+func MergeWith(r ConflictResolver, fss ...fs.FS) fs.FS {
+	return newMergeFS(fss, false, r)
+}
+
+// ErrConflict is returned by ErrorOnConflict.
+var ErrConflict = errors.New("conflicting entries")
+
+// LayerEntry is an entry listed by a merged file system, Layer being the
+// index of the file system it comes from.
+type LayerEntry struct {
+	fs.DirEntry
+	Layer int
+}
+
+// EntryLayer returns the layer of an entry listed from a merged file system,
+// directly or through an MFS.
+func EntryLayer(d fs.DirEntry) (int, bool) {
+	for {
+		switch v := d.(type) {
+		case LayerEntry:
+			return v.Layer, true
+		case interface{ Unwrap() fs.DirEntry }:
+			d = v.Unwrap()
+		default:
+			return 0, false
+		}
+	}
+}
+
+// ConflictResolver returns the entry to expose among upper and lower, found
+// under name in two layers, upper being the one from the first layer.
+type ConflictResolver func(name string, upper, lower LayerEntry) (LayerEntry, error)
+
+// PreferUpper exposes the entry of the first layer, as Merge does.
+func PreferUpper(_ string, upper, _ LayerEntry) (LayerEntry, error) {
+	return upper, nil
+}
+
+// PreferNewer exposes the most recently modified entry, the upper one when
+// both have the same modification time.
+func PreferNewer(_ string, upper, lower LayerEntry) (LayerEntry, error) {
+	u, err := upper.Info()
+	if err != nil {
+		return LayerEntry{}, err
+	}
+	l, err := lower.Info()
+	if err != nil {
+		return LayerEntry{}, err
+	}
+	if l.ModTime().After(u.ModTime()) {
+		return lower, nil
+	}
+	return upper, nil
+}
+
+// ErrorOnConflict fails with ErrConflict.
+func ErrorOnConflict(name string, _, _ LayerEntry) (LayerEntry, error) {
+	return LayerEntry{}, &fs.PathError{Op: "merge", Path: name, Err: ErrConflict}
+}
+
+// Overlay is like Merge but honors the OCI image layer whiteouts: a
+// ".wh.<name>" file hides name in the file systems below its own and a
+// ".wh..wh..opq" file hides the content of its directory in the file systems
+// below. The whiteout files themselves are not exposed.
+func Overlay(fss ...fs.FS) fs.FS {
+	return newMergeFS(fss, true, nil)
+}
+
+var (
+	_ fs.ReadDirFS = (*mergeFS)(nil)
+	_ fs.StatFS    = (*mergeFS)(nil)
+)
+
+// mergeFS forwards the write operations to the first layer, which it
+// unwraps to, see As.
+type mergeFS struct {
+	forwardFS
+	layers    []fs.FS
+	whiteouts bool
+	resolver  ConflictResolver
+}
+
+func newMergeFS(layers []fs.FS, whiteouts bool, r ConflictResolver) *mergeFS {
+	m := &mergeFS{layers: layers, whiteouts: whiteouts, resolver: r}
+	var upper fs.FS
+	if len(layers) != 0 {
+		upper = layers[0]
+	}
+	m.forwardFS = forwardFS{fsys: upper, route: m.route, readDir: m.ReadDir}
+	return m
+}
+
+// route forwards the operations reading name to the layer exposing it.
+func (m *mergeFS) route(op, name string) (fs.FS, string, error) {
+	switch op {
+	case "lstat", "readlink", "getxattr", "listxattr":
+		l, err := m.layer(op, name)
+		if err != nil {
+			return nil, "", err
+		}
+		return l, name, nil
+	}
+	return m.fsys, name, nil
+}
+
+// layer returns the layer exposing name, which may be a symbolic link.
+func (m *mergeFS) layer(op, name string) (fs.FS, error) {
+	if m.isWhiteout(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if m.resolver != nil {
+		e, err := m.pick(op, name)
+		if err != nil {
+			return nil, err
+		}
+		return m.layers[e.Layer], nil
+	}
+	for _, l := range m.layers {
+		_, err := Lstat(l, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			if m.hidden(l, name) {
+				break
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return l, nil
+	}
+	return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+// components returns the layers, see Topology.
+func (m *mergeFS) components() []fs.FS {
+	return m.layers
+}
+
+// hidden reports whether l hides name in the layers below it, either by a
+// whiteout of name or one of its parents, or by an opaque parent directory.
+func (m *mergeFS) hidden(l fs.FS, name string) bool {
+	if !m.whiteouts || name == "." {
+		return false
+	}
+	for p := name; p != "."; p = path.Dir(p) {
+		if exists(l, path.Join(path.Dir(p), whiteoutPrefix+path.Base(p))) {
+			return true
+		}
+		if exists(l, path.Join(path.Dir(p), whiteoutOpaque)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch watches name in the layers notifying their changes, the events
+// reporting the state of the union: a file removed from a layer but exposed
+// by another one is changed, and a whiteout notifies the removal of the
+// file it hides.
+func (m *mergeFS) Watch(ctx context.Context, name string) (<-chan WatchEvent, error) {
+	var ins []<-chan WatchEvent
+	for _, l := range m.layers {
+		w, ok := watcher(l)
+		if !ok {
+			continue
+		}
+		in, err := w.Watch(ctx, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ins = append(ins, in)
+	}
+	if len(ins) == 0 {
+		if !m.canWatch() {
+			return nil, unsupported("watch", name)
+		}
+		return nil, &fs.PathError{Op: "watch", Path: name, Err: fs.ErrNotExist}
+	}
+	merged := make(chan WatchEvent)
+	var wg sync.WaitGroup
+	for _, in := range ins {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range in {
+				select {
+				case merged <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+	return mapEvents(ctx, merged, m.event), nil
+}
+
+// event maps an event of a layer to the union.
+func (m *mergeFS) event(e WatchEvent) []WatchEvent {
+	if m.isWhiteout(e.Path) {
+		dir, base := path.Split(e.Path)
+		if base == whiteoutOpaque {
+			return []WatchEvent{{Path: path.Clean(dir)}}
+		}
+		e.Path = path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix))
+	}
+	_, err := m.Stat(e.Path)
+	e.Removed = errors.Is(err, fs.ErrNotExist)
+	return []WatchEvent{e}
+}
+
+// canWatch reports whether one of the layers notifies its changes.
+func (m *mergeFS) canWatch() bool {
+	for _, l := range m.layers {
+		if _, ok := watcher(l); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *mergeFS) isWhiteout(name string) bool {
+	return m.whiteouts && strings.HasPrefix(path.Base(name), whiteoutPrefix)
+}
+
+func exists(fsys fs.FS, name string) bool {
+	_, err := fs.Stat(fsys, name)
+	return err == nil
+}
+
+func (m *mergeFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if m.isWhiteout(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	layers := m.layers
+	if m.resolver != nil {
+		e, err := m.pick("open", name)
+		if err != nil {
+			return nil, err
+		}
+		layers = m.layers[e.Layer : e.Layer+1]
+	}
+	for _, l := range layers {
+		f, err := l.Open(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			if m.hidden(l, name) {
+				break
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		s, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if !s.IsDir() {
+			return f, nil
+		}
+		return &mergeDir{File: f, dirReader: dirReader{list: func() ([]fs.DirEntry, error) {
+			return m.ReadDir(name)
+		}}}, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (m *mergeFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	if m.isWhiteout(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	if m.resolver != nil {
+		e, err := m.pick("stat", name)
+		if err != nil {
+			return nil, err
+		}
+		return e.Info()
+	}
+	for _, l := range m.layers {
+		s, err := fs.Stat(l, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			if m.hidden(l, name) {
+				break
+			}
+			continue
+		}
+		return s, err
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+func (m *mergeFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	var (
+		res   []fs.DirEntry
+		found bool
+		// seen holds the index in res of the listed names, -1 for the
+		// whiteouts
+		seen = make(map[string]int)
+	)
+	if m.isWhiteout(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	for i, l := range m.layers {
+		ds, err := fs.ReadDir(l, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			if m.hidden(l, name) {
+				break
+			}
+			continue
+		}
+		if err != nil {
+			if found {
+				// a file in a lower layer is shadowed by the directories above
+				break
+			}
+			return nil, err
+		}
+		found = true
+		opaque := false
+		for _, d := range ds {
+			if m.whiteouts && d.Name() == whiteoutOpaque {
+				opaque = true
+				continue
+			}
+			if m.isWhiteout(d.Name()) {
+				if _, ok := seen[strings.TrimPrefix(d.Name(), whiteoutPrefix)]; !ok {
+					seen[strings.TrimPrefix(d.Name(), whiteoutPrefix)] = -1
+				}
+				continue
+			}
+			e := LayerEntry{DirEntry: d, Layer: i}
+			j, ok := seen[d.Name()]
+			if !ok {
+				seen[d.Name()] = len(res)
+				res = append(res, e)
+				continue
+			}
+			if j < 0 || m.resolver == nil || res[j].IsDir() && d.IsDir() {
+				continue
+			}
+			if res[j], err = m.resolver(path.Join(name, d.Name()), res[j].(LayerEntry), e); err != nil {
+				return nil, err
+			}
+		}
+		if opaque || m.hidden(l, name) {
+			break
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	sortEntries(res)
+	return res, nil
+}
+
+// pick returns the entry exposed for name, resolving the conflicts between
+// the layers.
+func (m *mergeFS) pick(op, name string) (LayerEntry, error) {
+	var (
+		res   LayerEntry
+		found bool
+	)
+	for i, l := range m.layers {
+		s, err := fs.Stat(l, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			if m.hidden(l, name) {
+				break
+			}
+			continue
+		}
+		if err != nil {
+			return LayerEntry{}, err
+		}
+		e := LayerEntry{DirEntry: fs.FileInfoToDirEntry(s), Layer: i}
+		switch {
+		case !found:
+			res, found = e, true
+		case res.IsDir() && e.IsDir():
+		default:
+			if res, err = m.resolver(name, res, e); err != nil {
+				return LayerEntry{}, err
+			}
+		}
+		if m.hidden(l, name) {
+			break
+		}
+	}
+	if !found {
+		return LayerEntry{}, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return res, nil
+}
+
+type mergeDir struct {
+	fs.File
+	dirReader
+}
@@ -0,0 +1,165 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerge(t *testing.T) {
+	upper := fstest.MapFS{
+		"foo":     {Data: []byte("upper")},
+		"dir/baz": {Data: data["baz"]},
+	}
+	lower := fstest.MapFS{
+		"foo":      {Data: []byte("lower")},
+		"quux":     {Data: data["quux"]},
+		"dir/baz":  {Data: []byte("lower")},
+		"dir/grau": {Data: data["grault"]},
+	}
+	m := Merge(upper, lower)
+	require.NoError(t, fstest.TestFS(m, "foo", "quux", "dir/baz", "dir/grau"))
+
+	b, err := fs.ReadFile(m, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "upper", string(b))
+
+	d, err := fs.ReadDir(m, "dir")
+	require.NoError(t, err)
+	require.Len(t, d, 2)
+	assert.Equal(t, "baz", d[0].Name())
+	assert.Equal(t, "grau", d[1].Name())
+
+	_, err = m.Open("nope")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	// the writes go to the first file system
+	mem := NewMemFS()
+	w, ok := As[WriteFileFS](Merge(mem, lower))
+	require.True(t, ok)
+	require.NoError(t, w.WriteFile("quux", data["foo"], 0644))
+	b, err = mem.ReadFile("quux")
+	require.NoError(t, err)
+	assert.Equal(t, data["foo"], b)
+	_, ok = As[WriteFileFS](m)
+	assert.False(t, ok)
+}
+
+func TestOverlay(t *testing.T) {
+	base := fstest.MapFS{
+		"bin/sh":         {Data: []byte("sh")},
+		"etc/passwd":     {Data: []byte("root")},
+		"etc/hosts":      {Data: []byte("localhost")},
+		"var/cache/a":    {Data: []byte("a")},
+		"var/cache/b":    {Data: []byte("b")},
+		"opt/app/config": {Data: []byte("old")},
+	}
+	upper := fstest.MapFS{
+		"etc/.wh.hosts":          {},
+		"etc/passwd":             {Data: []byte("root\nuser")},
+		".wh.bin":                {},
+		"var/cache/.wh..wh..opq": {},
+		"var/cache/c":            {Data: []byte("c")},
+	}
+	o := Overlay(upper, base)
+	require.NoError(t, fstest.TestFS(o, "etc/passwd", "var/cache/c", "opt/app/config"))
+
+	b, err := fs.ReadFile(o, "etc/passwd")
+	require.NoError(t, err)
+	assert.Equal(t, "root\nuser", string(b))
+	for _, v := range []string{"etc/hosts", "bin", "bin/sh", "var/cache/a", "etc/.wh.hosts", "var/cache/.wh..wh..opq"} {
+		_, err := fs.Stat(o, v)
+		assert.ErrorIs(t, err, fs.ErrNotExist, v)
+		_, err = o.Open(v)
+		assert.ErrorIs(t, err, fs.ErrNotExist, v)
+	}
+	ds, err := fs.ReadDir(o, ".")
+	require.NoError(t, err)
+	var names []string
+	for _, d := range ds {
+		names = append(names, d.Name())
+	}
+	assert.Equal(t, []string{"etc", "opt", "var"}, names)
+	ds, err = fs.ReadDir(o, "var/cache")
+	require.NoError(t, err)
+	require.Len(t, ds, 1)
+	assert.Equal(t, "c", ds[0].Name())
+	_, err = fs.ReadDir(o, "bin")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestMergeWith(t *testing.T) {
+	now := time.Now()
+	upper := fstest.MapFS{
+		"foo":     {Data: []byte("upper"), ModTime: now.Add(-time.Hour)},
+		"bar":     {Data: []byte("upper"), ModTime: now},
+		"dir/baz": {Data: []byte("upper")},
+	}
+	lower := fstest.MapFS{
+		"foo":     {Data: []byte("lower"), ModTime: now},
+		"bar":     {Data: []byte("lower"), ModTime: now},
+		"dir/qux": {Data: []byte("lower")},
+	}
+
+	f := MergeWith(PreferNewer, upper, lower)
+	ds, err := fs.ReadDir(f, ".")
+	require.NoError(t, err)
+	layers := map[string]int{}
+	for _, d := range ds {
+		l, ok := EntryLayer(d)
+		require.True(t, ok)
+		layers[d.Name()] = l
+	}
+	assert.Equal(t, map[string]int{"bar": 0, "dir": 0, "foo": 1}, layers)
+	b, err := fs.ReadFile(f, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "lower", string(b))
+	s, err := fs.Stat(f, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, now, s.ModTime())
+	b, err = fs.ReadFile(f, "bar")
+	require.NoError(t, err)
+	assert.Equal(t, "upper", string(b))
+	ds, err = fs.ReadDir(f, "dir")
+	require.NoError(t, err)
+	assert.Len(t, ds, 2)
+
+	f = MergeWith(ErrorOnConflict, upper, lower)
+	_, err = fs.ReadDir(f, ".")
+	assert.ErrorIs(t, err, ErrConflict)
+	_, err = f.Open("foo")
+	assert.ErrorIs(t, err, ErrConflict)
+	_, err = fs.ReadDir(f, "dir")
+	require.NoError(t, err)
+
+	m, err := Mount("a", upper)
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("a", lower, WithShadowing(StackBelow), WithConflictResolver(PreferNewer)))
+	b, err = fs.ReadFile(m, "a/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "lower", string(b))
+	ds, err = m.ReadDir("a")
+	require.NoError(t, err)
+	l, ok := EntryLayer(ds[2])
+	assert.True(t, ok)
+	assert.Equal(t, "foo", ds[2].Name())
+	assert.Equal(t, 1, l)
+}
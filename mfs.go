@@ -15,148 +15,1214 @@
 package mfs
 
 import (
+	"context"
 	"errors"
+	"io"
 	"io/fs"
-	"path/filepath"
+	"path"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"golang.org/x/text/unicode/norm"
 )
 
-func Mount(path string, fs fs.FS) (MFS, error) {
-	m := &mfs{}
-	return m, m.Mount(path, fs)
+func Mount(path string, fs fs.FS, opts ...MountOption) (MFS, error) {
+	m := newMFS()
+	return m, m.Mount(path, fs, opts...)
+}
+
+// New returns an empty MFS.
+func New(opts ...Option) MFS {
+	return newMFS(opts...)
+}
+
+func newMFS(opts ...Option) *mfs {
+	m := &mfs{state: &state{concurrency: defaultConcurrency}}
+	for _, v := range opts {
+		v(m)
+	}
+	return m
 }
 
 type MFS interface {
 	fs.ReadDirFS
-	Mount(path string, fs fs.FS) error
+	WalkDirFS
+	WritableMFS
+	// XattrFS forwards the extended attributes operations to the mounted
+	// file systems and synthesizes the XattrMount and XattrMountType
+	// attributes of the mount points.
+	XattrFS
+	// ReadLinkFS forwards ReadLink and Lstat to the mounted file systems
+	// implementing it.
+	ReadLinkFS
+	// ReadDirContext is like ReadDir. The mount points of the root listing
+	// are resolved concurrently and ctx cancels the listing.
+	ReadDirContext(ctx context.Context, name string) ([]fs.DirEntry, error)
+	ReadDirIterFS
+	ReadDirPageFS
+	Mount(path string, fs fs.FS, opts ...MountOption) error
+	// Alias exposes the file system mounted at existing at newPath too,
+	// sharing its cache, watch, health, locks and statistics instead of
+	// mounting it twice. The alias keeps the file system mounted at existing
+	// when it is created: replacing or unmounting existing leaves it as is.
+	Alias(existing, newPath string) error
+	// Bind exposes the directory srcPath, which must live in an already mounted
+	// file system, at dstPath. Both views share the same backend.
+	Bind(srcPath, dstPath string) error
+	// MountResolver mounts at prefix a file system resolving the one
+	// serving each of its top level directories with resolve, e.g.
+	// "tenants/<id>/...", see Resolver and WithMaxResolved.
+	MountResolver(prefix string, resolve ResolveFunc, opts ...MountOption) error
+	// MountURL mounts the file system returned by the Opener registered
+	// for the url scheme.
+	MountURL(path, url string, opts ...MountOption) error
+	Unmount(path string) error
+	// Replace atomically swaps the file system mounted at path. Files opened
+	// from the previous one are closed and fail with ErrMountReplaced, see
+	// WithDrainTimeout.
+	Replace(path string, fs fs.FS) error
+	// MountOrReplace mounts fs at path, atomically replacing the file
+	// system mounted there if any, e.g. to publish the new snapshots of a
+	// site. The new mount starts with an empty cache, the watchers and the
+	// mount table subscribers are notified, and the files opened from the
+	// replaced file system are drained for a minute unless WithDrainTimeout
+	// is set.
+	MountOrReplace(path string, fs fs.FS, opts ...MountOption) error
+	// Undelete restores the latest version of name removed from a mount
+	// configured with WithTrash.
+	Undelete(name string) error
+	// Snapshot captures the state of the file system mounted at path,
+	// which must implement SnapshotFS, e.g. MemFS, whose snapshots share
+	// the tree, copying the nodes on write.
+	Snapshot(path string) (SnapshotID, error)
+	// Rollback restores the snapshot id of the file system mounted at path.
+	Rollback(path string, id SnapshotID) error
+	// OnMount registers fn to be called after a file system is mounted.
+	OnMount(fn func(MountInfo))
+	// OnUnmount registers fn to be called after a file system is unmounted
+	// or replaced.
+	OnUnmount(fn func(MountInfo))
+	// SubscribeMounts returns a channel receiving the changes of the mount
+	// table, in order, and a function ending the subscription and closing
+	// the channel. Events are queued for slow readers.
+	SubscribeMounts() (<-chan MountEvent, func())
+	// Health checks the mounted file systems, see HealthChecker.
+	Health(ctx context.Context) map[string]error
+	// WatchHealth runs Health every interval until ctx is done.
+	WatchHealth(ctx context.Context, interval time.Duration)
+	// SetPriority changes the priority of the mount at path, see
+	// WithPriority.
+	SetPriority(path string, n int) error
+	// Lock acquires an advisory lock on name, shared or exclusive, failing
+	// with ErrLocked when it is held in a conflicting mode. The locks are
+	// held in process, per mount and path, and by the mounted file system
+	// when it implements LockFS.
+	Lock(name string, shared bool) (Unlocker, error)
+	// Usage reports the usage of the file system mounted at name, see
+	// UsageFS. For stacked mounts, it is the one of the top layer.
+	Usage(name string) (Usage, error)
+	// Mounts returns the mount points sorted by path.
+	Mounts() []MountInfo
+	// Capabilities reports the operations supported by the file system
+	// mounted at name, none when name is not mounted. CapSeek and CapReadAt
+	// are reported for regular files, probed by opening them.
+	Capabilities(name string) CapabilitySet
+	// InvalidateCache drops the entries cached for name by the mounts
+	// configured with WithCache, the ones of its children and the listings
+	// of its parents included.
+	InvalidateCache(name string)
+	// CacheStats returns the statistics of the caches of the mounts
+	// configured with WithCache by mount point.
+	CacheStats() map[string]CacheStats
+	// ErrorStats returns the errors returned by the mounts during about
+	// the last minute, counted by class, by mount point.
+	ErrorStats() map[string]ErrorStats
+	// Topology describes the composition of the MFS: its mounts and the
+	// file systems they are made of, nested MFS included.
+	Topology() *Topology
+	// Watch notifies the changes of the files under name reported by the
+	// mounted file systems implementing WatchFS, see Poll.
+	Watch(ctx context.Context, name string) (<-chan WatchEvent, error)
+	// View returns a view of the MFS only exposing the mounts accepted by
+	// filter, evaluated with the context of the operations, e.g. the
+	// mounts of the tenant whose identity is carried by the context given
+	// to WithContext. The mounts of a view cannot be changed: Mount,
+	// Unmount and the other changes of the mount table fail with
+	// fs.ErrPermission. The views of a view are restricted by both filters.
+	View(filter MountFilter) MFS
+	// WithContext returns a view of the MFS sharing its mount table whose
+	// operations run with ctx, e.g. carrying the identity recorded by the
+	// audit log, see ContextWithIdentity.
+	WithContext(ctx context.Context) MFS
 }
 
 var _ MFS = (*mfs)(nil)
 
+// FullPather is implemented by the fs.FileInfo and fs.DirEntry values
+// returned by an MFS. Their Name is the base name of the file, as required
+// by the fs package, while FullPath reports its path in the MFS tree.
+type FullPather interface {
+	FullPath() string
+}
+
+// OwnerInfo is implemented by the fs.FileInfo values returned by an MFS.
+// Owner reports the ownership set with WithOwner, ok being false when the
+// mount has none.
+type OwnerInfo interface {
+	Owner() (uid, gid int, ok bool)
+}
+
+var (
+	_ OwnerInfo  = (*fileInfo)(nil)
+	_ FullPather = (*fileInfo)(nil)
+	_ FullPather = (*dirEntry)(nil)
+	_ FullPather = (*fakeDir)(nil)
+)
+
 type mfs struct {
-	mapfs map[string]fs.FS
-	mu    sync.RWMutex
+	*state
+	// ctx is the context of the operations of the views returned by
+	// WithContext, nil otherwise.
+	ctx context.Context
+	// view is set for the views returned by View
+	view *view
+}
+
+// state is shared by an MFS and its views.
+type state struct {
+	table        atomic.Pointer[table]
+	onMount      []func(MountInfo)
+	onUnmount    []func(MountInfo)
+	subs         map[*subscription]struct{}
+	concurrency  int
+	healthPolicy HealthPolicy
+	audit        *auditor
+	strict       bool
+	form         *norm.Form
+	// crossMountRename enables the copy fallback of Rename
+	crossMountRename bool
+	du               duCache
+	slow             *slowLog
+	// labels enables the profiler labels
+	labels bool
+	// failureThreshold is set with WithFailureThreshold
+	failureThreshold int
+	// mu serializes the mount table updates and protects the hooks
+	mu sync.Mutex
+}
+
+// table is an immutable snapshot of the mount table: readers load it without
+// locking while updates swap in a modified copy.
+type table struct {
+	mounts  map[string]*mount
+	modTime time.Time
 }
 
-func (m *mfs) Mount(path string, f fs.FS) error {
-	path = filepath.Clean(path)
+var emptyTable = &table{}
+
+// load returns the mount table, restricted to the mounts exposed by the
+// view if m is one.
+func (m *mfs) load() *table {
+	t := m.loadAll()
+	if m.view != nil {
+		return m.filter(t)
+	}
+	return t
+}
+
+// loadAll returns the whole mount table.
+func (m *mfs) loadAll() *table {
+	if t := m.table.Load(); t != nil {
+		return t
+	}
+	return emptyTable
+}
+
+type mount struct {
+	path string
+	// sub is the directory of the shared state exposed by the mount, "."
+	// unless it is a bind mount, see mount.shared.
+	sub string
+	fs  fs.FS
+	// writable receives the write operations: the top layer when the mount
+	// is not wrapped, the wrapped file system otherwise.
+	writable  fs.FS
+	layers    []fs.FS
+	opts      *mountOptions
+	mountedAt time.Time
+	handles   *handles
+	*mountShared
+	// trash is set for the mounts configured with WithTrash
+	trash    *trashFS
+	cache    *cacheFS
+	priority atomic.Int64
+	// locks is shared with the mounts replacing this one
+	locks *locks
+	// nested is the MFS mounted as is, see mfs.nested
+	nested *mfs
+	// backends are the file systems to close once the mount is removed
+	backends []*backend
+}
+
+func newMount(path string, o *mountOptions, layers ...fs.FS) *mount {
+	fss := layers
+	if o.confine || o.form != nil || o.symlinks != SymlinkFollow {
+		fss = make([]fs.FS, len(layers))
+		for i, v := range layers {
+			if fss[i] = Symlinks(v, o.symlinks); o.confine {
+				fss[i] = Confine(fss[i])
+			}
+			if o.form != nil {
+				fss[i] = Normalize(fss[i], *o.form)
+			}
+		}
+	}
+	mnt := &mount{path: path, sub: ".", layers: layers, fs: fss[0], opts: o, mountedAt: time.Now(), handles: &handles{}, mountShared: &mountShared{}, locks: &locks{}}
+	if o.closer != nil {
+		mnt.backends = []*backend{{c: o.closer}}
+	}
+	mnt.priority.Store(int64(o.priority))
+	if len(fss) > 1 {
+		mnt.fs = MergeWith(o.resolver, fss...)
+	}
+	mnt.writable = fss[0]
+	if o.maxConcurrent > 0 {
+		l := newLimiter(o.maxConcurrent, o.limitPolicy)
+		mnt.fs, mnt.writable = l.wrap(mnt.fs), l.wrap(fss[0])
+		if len(fss) == 1 {
+			mnt.writable = mnt.fs
+		}
+	}
+	if o.timeout > 0 {
+		mnt.fs, mnt.writable = Timeout(mnt.fs, o.timeout), Timeout(mnt.writable, o.timeout)
+		if len(fss) == 1 {
+			mnt.writable = mnt.fs
+		}
+	}
+	if o.retry != nil {
+		// only the reads are retried
+		mnt.fs = Retry(mnt.fs, *o.retry)
+		if len(fss) == 1 {
+			mnt.writable = mnt.fs
+		}
+	}
+	if o.breaker != nil {
+		b := newBreaker(o.breaker.failures, o.breaker.cooldown)
+		mnt.fs, mnt.writable = b.wrap(mnt.fs), b.wrap(mnt.writable)
+		if len(fss) == 1 {
+			mnt.writable = mnt.fs
+		}
+	}
+	if o.trash > 0 {
+		mnt.trash = newTrashFS(mnt.fs, mnt.writable, o.trash)
+		mnt.fs, mnt.writable = mnt.trash, mnt.trash
+	}
+	if o.wraps() {
+		mnt.fs, mnt.cache = o.wrap(mnt.fs)
+		mnt.writable = mnt.fs
+	}
+	if n, ok := mnt.fs.(*mfs); ok && len(layers) == 1 && mnt.fs == layers[0] {
+		mnt.nested = n
+	}
+	return mnt
+}
+
+// dirEntry returns the entry describing the mount point in its parent listing.
+func (mnt *mount) dirEntry() fs.DirEntry {
+	if mnt.opts.rootInfo {
+		if s, err := fs.Stat(mnt.fs, "."); err == nil {
+			return &dirEntry{DirEntry: fs.FileInfoToDirEntry(s), path: mnt.path, opts: mnt.opts}
+		}
+	}
+	return &fakeDir{path: mnt.path, modTime: mnt.mountedAt, count: func() int64 {
+		ds, _ := fs.ReadDir(mnt.fs, ".")
+		return int64(len(ds))
+	}, dir: dirReader{list: func() ([]fs.DirEntry, error) {
+		return fs.ReadDir(mnt.fs, ".")
+	}}}
+}
+
+// virtualDir returns the directory name which does not exist in any mounted
+// file system: the root or a directory leading to a mount point, e.g. "a"
+// and "a/b" for "a/b/c".
+func (m *mfs) virtualDir(t *table, name string) *fakeDir {
+	return &fakeDir{
+		path:    name,
+		modTime: t.modTime,
+		count: func() int64 {
+			ds, _ := m.ReadDir(name)
+			return int64(len(ds))
+		},
+		dir: dirReader{list: func() ([]fs.DirEntry, error) {
+			return m.ReadDir(name)
+		}},
+	}
+}
+
+// children returns the visible mounts directly under the directory name
+// and the sorted names of the directories of name leading to the deeper
+// ones.
+func (m *mfs) children(t *table, name string) (mounts []*mount, dirs []string) {
+	seen := make(map[string]bool)
+	for k, v := range t.mounts {
+		if k == "." || m.hidden(v) {
+			continue
+		}
+		rel := strings.TrimPrefix(k, "/")
+		if name != "." && name != "/" {
+			if !strings.HasPrefix(k, name+"/") {
+				continue
+			}
+			rel = k[len(name)+1:]
+		}
+		if d, _, ok := strings.Cut(rel, "/"); ok {
+			seen[d] = true
+		} else {
+			mounts = append(mounts, v)
+		}
+	}
+	for _, v := range mounts {
+		delete(seen, path.Base(v.path))
+	}
+	for k := range seen {
+		dirs = append(dirs, k)
+	}
+	sort.Strings(dirs)
+	return mounts, dirs
+}
+
+// hasMounts reports whether visible mounts are nested under the directory
+// name.
+func (m *mfs) hasMounts(t *table, name string) bool {
+	mounts, dirs := m.children(t, name)
+	return len(mounts) > 0 || len(dirs) > 0
+}
+
+func (m *mfs) Mount(path string, f fs.FS, opts ...MountOption) (err error) {
+	defer m.record("mount", path, time.Now(), &err)
+	if err := m.checkView("mount", path); err != nil {
+		return err
+	}
+	o := m.newMountOptions(opts...)
+	path = m.mountPath(path)
+	if err := checkPath("mount", path); err != nil {
+		return err
+	}
+	var replaced *mount
+	err = m.update(func(t *table) (*mount, *mount, error) {
+		old, ok := t.mounts[path]
+		if !ok {
+			return nil, t.set(newMount(path, o, f)), nil
+		}
+		switch o.shadow {
+		case ErrorIfExists:
+			return nil, nil, fs.ErrExist
+		case Replace:
+			replaced = old
+			mnt := newMount(path, o, f)
+			mnt.priority.Store(old.priority.Load())
+			mnt.locks = old.locks
+			return old, t.set(mnt), nil
+		case StackAbove:
+			mnt := newMount(path, o, append([]fs.FS{f}, old.layers...)...)
+			mnt.locks = old.locks
+			mnt.backends = append(mnt.backends, old.backends...)
+			return old, t.set(mnt), nil
+		case StackBelow:
+			mnt := newMount(path, o, append(old.layers[:len(old.layers):len(old.layers)], f)...)
+			mnt.locks = old.locks
+			mnt.backends = append(mnt.backends, old.backends...)
+			return old, t.set(mnt), nil
+		default:
+			return nil, nil, &fs.PathError{Op: "mount", Path: path, Err: fs.ErrInvalid}
+		}
+	})
+	if replaced != nil {
+		replaced.handles.drain(o.drain)
+	}
+	return err
+}
+
+func (m *mfs) Unmount(path string) (err error) {
+	defer m.record("unmount", path, time.Now(), &err)
+	if err := m.checkView("unmount", path); err != nil {
+		return err
+	}
+	path = m.mountPath(path)
+	return m.update(func(t *table) (*mount, *mount, error) {
+		old, ok := t.mounts[path]
+		if !ok {
+			return nil, nil, &fs.PathError{Op: "unmount", Path: path, Err: fs.ErrNotExist}
+		}
+		delete(t.mounts, path)
+		return old, nil, nil
+	})
+}
+
+func (m *mfs) Bind(srcPath, dstPath string) (err error) {
+	defer m.record("bind", dstPath, time.Now(), &err)
+	if err := m.checkView("bind", dstPath); err != nil {
+		return err
+	}
+	if srcPath, err = m.clean("bind", srcPath); err != nil {
+		return err
+	}
+	dstPath = m.mountPath(dstPath)
+	if err := checkPath("bind", dstPath); err != nil {
+		return err
+	}
+	// the backend is checked before taking the lock
+	src, rel, ok := m.loadAll().resolve(srcPath)
+	if !ok {
+		return &fs.PathError{Op: "bind", Path: srcPath, Err: fs.ErrNotExist}
+	}
+	s, err := fs.Stat(src.fs, rel)
+	if err != nil {
+		return &fs.PathError{Op: "bind", Path: srcPath, Err: err}
+	}
+	if !s.IsDir() {
+		return &fs.PathError{Op: "bind", Path: srcPath, Err: errors.New("not a directory")}
+	}
+	return m.update(func(t *table) (*mount, *mount, error) {
+		if t.mounts[src.path] != src {
+			return nil, nil, &fs.PathError{Op: "bind", Path: srcPath, Err: ErrMountReplaced}
+		}
+		if _, ok := t.mounts[dstPath]; ok {
+			return nil, nil, fs.ErrExist
+		}
+		return nil, t.set(src.bind(dstPath, rel)), nil
+	})
+}
+
+// mountShared is the state shared by a mount and its aliases.
+type mountShared struct {
+	health atomic.Pointer[healthStatus]
+	errs   errorLog
+	rates  errorRates
+}
+
+// backend is a file system opened for the mounts by MountURL or Serve,
+// closed once the mounts using it, refs, are all removed.
+type backend struct {
+	c    io.Closer
+	refs atomic.Int32
+}
+
+// alias returns a mount exposing the file system of mnt at path, sharing
+// its state.
+func (mnt *mount) alias(path string) *mount {
+	a := &mount{
+		path:        path,
+		sub:         mnt.sub,
+		fs:          mnt.fs,
+		writable:    mnt.writable,
+		layers:      mnt.layers,
+		opts:        mnt.opts,
+		mountedAt:   time.Now(),
+		handles:     &handles{},
+		mountShared: mnt.mountShared,
+		trash:       mnt.trash,
+		cache:       mnt.cache,
+		locks:       mnt.locks,
+		nested:      mnt.nested,
+		backends:    mnt.backends,
+	}
+	a.priority.Store(mnt.priority.Load())
+	return a
+}
+
+// release closes the backends of mnt, removed from the table, which no other
+// mount uses, once its files are drained.
+func (mnt *mount) release() {
+	for _, b := range mnt.backends {
+		if b.refs.Add(-1) != 0 {
+			continue
+		}
+		h := mnt.handles
+		h.drain(mnt.opts.drain)
+		time.AfterFunc(max(mnt.opts.drain, 0), func() {
+			h.invalidate()
+			_ = b.c.Close()
+		})
+	}
+}
+
+// bind returns an alias of mnt exposing its directory dir at path.
+func (mnt *mount) bind(path, dir string) *mount {
+	a := mnt.alias(path)
+	if dir == "." {
+		return a
+	}
+	a.sub = mnt.shared(dir)
+	a.fs, a.writable = newSubFS(mnt.fs, dir), newSubFS(mnt.writable, dir)
+	a.nested = nil
+	return a
+}
+
+// shared returns the path of rel in the state shared with the aliases of
+// the mount, e.g. its cache or locks, which is relative to the directory
+// exposed by the bind mounts.
+func (mnt *mount) shared(rel string) string {
+	return joinMountPath(mnt.sub, rel)
+}
+
+func (m *mfs) Alias(existing, newPath string) (err error) {
+	defer m.record("alias", newPath, time.Now(), &err)
+	if err := m.checkView("alias", newPath); err != nil {
+		return err
+	}
+	existing, newPath = m.mountPath(existing), m.mountPath(newPath)
+	if err := checkPath("alias", newPath); err != nil {
+		return err
+	}
+	return m.update(func(t *table) (*mount, *mount, error) {
+		mnt, ok := t.mounts[existing]
+		if !ok {
+			return nil, nil, &fs.PathError{Op: "alias", Path: existing, Err: fs.ErrNotExist}
+		}
+		if _, ok := t.mounts[newPath]; ok {
+			return nil, nil, fs.ErrExist
+		}
+		return nil, t.set(mnt.alias(newPath)), nil
+	})
+}
+
+// aliasPaths returns the paths of name in the aliases and bind mounts of the
+// mount holding it.
+func (m *mfs) aliasPaths(name string) []string {
+	t := m.loadAll()
+	mnt, rel, ok := t.resolve(name)
+	if !ok {
+		return nil
+	}
+	key := mnt.shared(rel)
+	var res []string
+	for _, v := range t.mounts {
+		if v == mnt || v.mountShared != mnt.mountShared {
+			continue
+		}
+		switch {
+		case v.sub == ".":
+			res = append(res, joinMountPath(v.path, key))
+		case key == v.sub:
+			res = append(res, v.path)
+		case strings.HasPrefix(key, v.sub+"/"):
+			res = append(res, joinMountPath(v.path, key[len(v.sub)+1:]))
+		case strings.HasPrefix(v.sub, key+"/"):
+			// a parent of the bind mount directory changed
+			res = append(res, v.path)
+		}
+	}
+	return res
+}
+
+// update runs fn on a copy of the mount table, which replaces the current
+// one if fn succeeds. fn returns the mount removed from and the one added to
+// the table, which are then passed to the lifecycle hooks once the lock is
+// released.
+func (m *mfs) update(fn func(t *table) (old, mnt *mount, err error)) error {
+	return m.updateAll(func(t *table) ([]*mount, []*mount, error) {
+		old, mnt, err := fn(t)
+		var removed, added []*mount
+		if old != nil {
+			removed = append(removed, old)
+		}
+		if mnt != nil {
+			added = append(added, mnt)
+		}
+		return removed, added, err
+	})
+}
+
+// updateAll is like update for changes involving several mounts.
+func (m *mfs) updateAll(fn func(t *table) (removed, added []*mount, err error)) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-	if m.mapfs == nil {
-		m.mapfs = make(map[string]fs.FS)
+	cur := m.loadAll()
+	t := &table{mounts: make(map[string]*mount, len(cur.mounts)+1), modTime: cur.modTime}
+	for k, v := range cur.mounts {
+		t.mounts[k] = v
 	}
-	if _, ok := m.mapfs[path]; ok {
-		return fs.ErrExist
+	removed, added, err := fn(t)
+	if err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	if len(removed) != 0 || len(added) != 0 {
+		t.modTime = time.Now()
+		m.table.Store(t)
+		for _, v := range append(removed, added...) {
+			m.du.invalidate(v.path)
+		}
+		for _, v := range added {
+			for _, b := range v.backends {
+				b.refs.Add(1)
+			}
+		}
+		for _, v := range removed {
+			if v.cache != nil {
+				v.cache.stopWatch()
+			}
+			if v.trash != nil {
+				v.trash.stopPurge()
+			}
+			v.release()
+		}
+		for _, v := range added {
+			if v.cache != nil {
+				v.cache.startWatch()
+			}
+			if v.trash != nil {
+				v.trash.startPurge()
+			}
+		}
+		if len(m.subs) != 0 {
+			// queued with the lock held to keep the updates order
+			evs := mountEvents(removed, added)
+			for s := range m.subs {
+				s.push(evs)
+			}
+		}
+	}
+	onMount, onUnmount := m.onMount, m.onUnmount
+	m.mu.Unlock()
+	for _, v := range removed {
+		for _, fn := range onUnmount {
+			fn(v.info())
+		}
+	}
+	for _, v := range added {
+		for _, fn := range onMount {
+			fn(v.info())
+		}
 	}
-	m.mapfs[path] = f
 	return nil
 }
 
-func (m *mfs) Open(name string) (fs.File, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	name = filepath.Clean(name)
-	open := func(fs fs.FS, n string) (fs.File, error) {
-		f, err := fs.Open(n)
-		if err != nil {
-			return nil, err
-		}
-		return &file{File: f, path: name}, nil
+func (m *mfs) SetPriority(path string, n int) (err error) {
+	defer m.record("setpriority", path, time.Now(), &err)
+	if err := m.checkView("setpriority", path); err != nil {
+		return err
+	}
+	path = m.mountPath(path)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mnt, ok := m.load().mounts[path]
+	if !ok {
+		return &fs.PathError{Op: "setpriority", Path: path, Err: fs.ErrNotExist}
 	}
-	if name == "." || name == "/" {
-		return &fakeDir{path: name}, nil
+	mnt.priority.Store(int64(n))
+	return nil
+}
+
+func (t *table) set(mnt *mount) *mount {
+	t.mounts[mnt.path] = mnt
+	return mnt
+}
+
+// resolve returns the mount holding name together with the path relative to
+// the mount root. The mount with the highest priority wins and, among equal
+// priorities, the deepest one.
+func (t *table) resolve(name string) (*mount, string, bool) {
+	var (
+		res *mount
+		rel string
+	)
+	for k, v := range t.mounts {
+		if r, ok := match(k, name); ok && (res == nil || v.before(res)) {
+			res, rel = v, r
+		}
 	}
-	for k, v := range m.mapfs {
-		if name == k || name == k+"/" {
-			return open(v, ".")
+	return res, rel, res != nil
+}
+
+type resolved struct {
+	mnt *mount
+	rel string
+}
+
+// candidates returns all the mounts holding name in resolution order.
+func (t *table) candidates(name string) []resolved {
+	var res []resolved
+	for k, v := range t.mounts {
+		if r, ok := match(k, name); ok {
+			res = append(res, resolved{mnt: v, rel: r})
 		}
-		if len(name) > len(k) && name[:len(k)] == k && name[len(k)] == '/' {
-			return open(v, name[len(k)+1:])
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].mnt.before(res[j].mnt)
+	})
+	return res
+}
+
+// match returns the path of name relative to the mount point k if name
+// belongs to it.
+func match(k, name string) (string, bool) {
+	switch {
+	case k == ".":
+		// the file system mounted at the root holds everything
+		if rel := strings.TrimPrefix(name, "/"); rel != "" {
+			return rel, true
 		}
+		return ".", true
+	case name == k || name == k+"/":
+		return ".", true
+	case len(name) > len(k) && name[:len(k)] == k && name[len(k)] == '/':
+		return name[len(k)+1:], true
+	default:
+		return "", false
 	}
-	return nil, fs.ErrNotExist
 }
 
-func (m *mfs) ReadDir(name string) ([]fs.DirEntry, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	name = filepath.Clean(name)
-	readDir := func(rfs fs.FS, n string) ([]fs.DirEntry, error) {
-		if !strings.HasSuffix(name, "/") {
-			name += "/"
+// before reports whether mnt takes precedence over o when both hold a path.
+func (mnt *mount) before(o *mount) bool {
+	if p, q := mnt.priority.Load(), o.priority.Load(); p != q {
+		return p > q
+	}
+	return mnt.depth() > o.depth()
+}
+
+func (mnt *mount) depth() int {
+	if mnt.path == "." {
+		return 0
+	}
+	return len(mnt.path)
+}
+
+// fallback runs fn with the mount holding name and, while it fails with
+// fs.ErrNotExist, with the deeper mounts holding it, which were shadowed by
+// the priority of the previous one. It returns the mount of the last call,
+// or of the first one when all fail. Within the flattened nested MFS, see
+// nested, the mounts fn is run with are resolved the same way, the ones
+// they were reached through being appended to via if not nil.
+func (m *mfs) fallback(t *table, op, name string, via *[]*mount, fn func(mnt *mount, rel string) error) (*mount, string, error) {
+	mnt, rel, err := m.lookupMount(t, op, name)
+	if err != nil {
+		return nil, "", err
+	}
+	base := 0
+	if via != nil {
+		base = len(*via)
+	}
+	fmnt, frel, err := m.call(op, mnt, rel, via, fn)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return fmnt, frel, err
+	}
+	cur := mnt
+	for _, c := range t.candidates(name)[1:] {
+		if c.mnt.depth() <= cur.depth() || m.healthErr(c.mnt, op, name, c.rel) != nil {
+			continue
 		}
-		ds, err := fs.ReadDir(rfs, n)
-		if err != nil {
-			return nil, err
+		cur = c.mnt
+		if via != nil {
+			*via = (*via)[:base]
 		}
-		var res []fs.DirEntry
-		for _, d := range ds {
-			res = append(res, &dirEntry{DirEntry: d, path: d.Name()})
+		if cm, cr, e := m.call(op, c.mnt, c.rel, via, fn); !errors.Is(e, fs.ErrNotExist) {
+			return cm, cr, e
 		}
-		return res, nil
 	}
-	if name == "/" || name == "." {
-		var res []fs.DirEntry
-		for k := range m.mapfs {
-			res = append(res, &fakeDir{path: k})
+	if via != nil {
+		*via = (*via)[:base]
+	}
+	return fmnt, frel, err
+}
+
+// lookup resolves name to its mount, applying the health policy, within
+// the flattened nested MFS included, see nested.
+func (m *mfs) lookup(t *table, op, name string) (*mount, string, error) {
+	mnt, rel, err := m.lookupMount(t, op, name)
+	if err != nil {
+		return nil, "", err
+	}
+	n := m.nested(mnt, rel)
+	if n == nil {
+		return mnt, rel, nil
+	}
+	inner, irel, err := n.lookup(n.load(), op, rel)
+	if err != nil {
+		return nil, "", mnt.wrapErr(op, name, rel, err)
+	}
+	return inner, irel, nil
+}
+
+// lookupMount resolves name to its mount in t, applying the health policy.
+func (m *mfs) lookupMount(t *table, op, name string) (*mount, string, error) {
+	mnt, rel, ok := t.resolve(name)
+	if !ok {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if err := m.healthErr(mnt, op, name, rel); err != nil {
+		return nil, "", err
+	}
+	return mnt, rel, nil
+}
+
+// cleanMountPath cleans a mount point path, "/" and "." both designating
+// the root mount.
+func cleanMountPath(path string) string {
+	path = cleanPath(path)
+	if path == "/" {
+		return "."
+	}
+	return path
+}
+
+func (m *mfs) Open(name string) (_ fs.File, err error) {
+	defer m.record("open", name, time.Now(), &err)
+	if name, err = m.clean("open", name); err != nil {
+		return nil, err
+	}
+	return m.open(name, true)
+}
+
+// open opens the cleaned name, once more from the new table if the mount
+// holding it was replaced meanwhile and retry is set.
+func (m *mfs) open(name string, retry bool) (fs.File, error) {
+	t := m.load()
+	if (name == "." || name == "/") && (t.mounts["."] == nil || m.hidden(t.mounts["."])) {
+		return m.virtualDir(t, name), nil
+	}
+	var (
+		f   fs.File
+		via []*mount
+	)
+	mnt, rel, err := m.fallback(t, "open", name, &via, func(mnt *mount, rel string) (err error) {
+		f, err = mnt.fs.Open(rel)
+		return err
+	})
+	if errors.Is(err, fs.ErrNotExist) && m.hasMounts(t, name) {
+		return m.virtualDir(t, name), nil
+	}
+	if mnt == nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, mnt.wrapErr("open", name, rel, err)
+	}
+	h := &file{File: f, path: name, mnt: mnt, rel: rel, via: via, labels: m.labelContext()}
+	if mnt.path == "." && rel == "." || m.hasMounts(t, name) {
+		h.list = func() ([]fs.DirEntry, error) {
+			return m.ReadDir(name)
+		}
+	} else if _, ok := f.(fs.ReadDirFile); !ok {
+		h.list = func() ([]fs.DirEntry, error) {
+			return fs.ReadDir(mnt.fs, rel)
 		}
-		return res, nil
 	}
-	for k, v := range m.mapfs {
-		if name == k || name == k+"/" {
-			return readDir(v, ".")
+	if !h.track() {
+		if retry {
+			return m.open(name, false)
 		}
-		if len(name) > len(k) && name[:len(k)] == k && name[len(k)] == '/' {
-			return readDir(v, name[len(k)+1:])
+		return nil, &fs.PathError{Op: "open", Path: name, Err: ErrMountReplaced}
+	}
+	return h, nil
+}
+
+func (m *mfs) ReadDir(name string) ([]fs.DirEntry, error) {
+	return m.ReadDirContext(m.context(), name)
+}
+
+func (m *mfs) ReadDirContext(ctx context.Context, name string) (_ []fs.DirEntry, err error) {
+	defer m.recordContext(ctx, "readdir", name, time.Now(), &err)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	t := m.load()
+	if name, err = m.clean("readdir", name); err != nil {
+		return nil, err
+	}
+	return m.readMerged(ctx, t, name)
+}
+
+// readMerged lists the directory name merged with the mount points under
+// it: the ones directly under it and the directories leading to the deeper
+// ones, which shadow its entries. The mount points of the root listing are
+// resolved concurrently. The directory only has to exist in a mounted file
+// system when no mount point is under it.
+func (m *mfs) readMerged(ctx context.Context, t *table, name string) ([]fs.DirEntry, error) {
+	mounts, dirs := m.children(t, name)
+	root, dir := name == "." || name == "/", name
+	if root {
+		dir = "."
+	}
+	// the last job lists the directory
+	entries := make([]fs.DirEntry, len(mounts), len(mounts)+len(dirs))
+	var (
+		ds  []fs.DirEntry
+		mnt *mount
+	)
+	err := parallel(ctx, m.concurrency, len(mounts)+1, func(i int) error {
+		if i < len(mounts) {
+			entries[i] = mounts[i].dirEntry()
+			return nil
 		}
+		if root {
+			if mnt = t.mounts["."]; mnt == nil || m.hidden(mnt) {
+				mnt = nil
+				return nil
+			}
+			var err error
+			ds, err = fs.ReadDir(mnt.fs, ".")
+			return err
+		}
+		var (
+			rel string
+			err error
+		)
+		mnt, rel, err = m.fallback(t, "readdir", name, nil, func(mnt *mount, rel string) (err error) {
+			ds, err = fs.ReadDir(mnt.fs, rel)
+			return err
+		})
+		switch {
+		case errors.Is(err, fs.ErrNotExist) && (len(mounts) > 0 || len(dirs) > 0):
+			mnt = nil
+			return nil
+		case err != nil && mnt != nil:
+			return mnt.wrapErr("readdir", name, rel, err)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil, fs.ErrNotExist
+	res := entries
+	seen := make(map[string]struct{}, len(mounts)+len(dirs))
+	for _, v := range mounts {
+		seen[path.Base(v.path)] = struct{}{}
+	}
+	for _, v := range dirs {
+		seen[v] = struct{}{}
+		res = append(res, m.virtualDir(t, joinMountPath(dir, v)))
+	}
+	for _, d := range ds {
+		if _, ok := seen[d.Name()]; !ok {
+			res = append(res, &dirEntry{DirEntry: d, path: joinMountPath(dir, d.Name()), opts: mnt.opts})
+		}
+	}
+	if root || len(mounts) > 0 || len(dirs) > 0 {
+		sortEntries(res)
+	}
+	return res, nil
 }
 
 type file struct {
 	fs.File
 	path string
+	mnt  *mount
+	// rel is the path of the file in the mount
+	rel string
+	// via are the mounts of the flattened nested MFS mnt was reached
+	// through, which also track the file
+	via []*mount
+	// list overrides the backend directory listing
+	list func() ([]fs.DirEntry, error)
+	dir  *dirReader
+	// labels is the context the reads are labeled from, see WithProfilerLabels
+	labels context.Context
+	stale  atomic.Bool
+	closed atomic.Bool
+}
+
+func (f *file) Read(b []byte) (int, error) {
+	if f.stale.Load() {
+		return 0, &fs.PathError{Op: "read", Path: f.path, Err: ErrMountReplaced}
+	}
+	var n int
+	err := labeled(f.labels, f.mnt, "read", func() (err error) {
+		n, err = f.File.Read(b)
+		return err
+	})
+	return n, f.mnt.wrapErr("read", f.path, f.rel, err)
+}
+
+// Seek forwards to the backend file when it implements io.Seeker.
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	if f.stale.Load() {
+		return 0, &fs.PathError{Op: "seek", Path: f.path, Err: ErrMountReplaced}
+	}
+	s, ok := f.File.(io.Seeker)
+	if !ok {
+		return 0, &fs.PathError{Op: "seek", Path: f.path, Err: errors.ErrUnsupported}
+	}
+	n, err := s.Seek(offset, whence)
+	return n, f.mnt.wrapErr("seek", f.path, f.rel, err)
+}
+
+// ReadAt forwards to the backend file when it implements io.ReaderAt.
+func (f *file) ReadAt(b []byte, off int64) (int, error) {
+	if f.stale.Load() {
+		return 0, &fs.PathError{Op: "read", Path: f.path, Err: ErrMountReplaced}
+	}
+	r, ok := f.File.(io.ReaderAt)
+	if !ok {
+		return 0, &fs.PathError{Op: "read", Path: f.path, Err: errors.ErrUnsupported}
+	}
+	var n int
+	err := labeled(f.labels, f.mnt, "read", func() (err error) {
+		n, err = r.ReadAt(b, off)
+		return err
+	})
+	return n, f.mnt.wrapErr("read", f.path, f.rel, err)
+}
+
+// Unwrap returns the backend file, see OSFile.
+func (f *file) Unwrap() fs.File {
+	return f.File
+}
+
+func (f *file) ReadDir(n int) ([]fs.DirEntry, error) {
+	if f.stale.Load() {
+		return nil, &fs.PathError{Op: "readdir", Path: f.path, Err: ErrMountReplaced}
+	}
+	if f.list != nil {
+		if f.dir == nil {
+			f.dir = &dirReader{list: f.list}
+		}
+		return f.dir.ReadDir(n)
+	}
+	ds, err := f.File.(fs.ReadDirFile).ReadDir(n)
+	for i, v := range ds {
+		ds[i] = &dirEntry{DirEntry: v, path: joinMountPath(f.path, v.Name()), opts: f.mnt.opts}
+	}
+	return ds, f.mnt.wrapErr("readdir", f.path, f.rel, err)
+}
+
+func (f *file) Close() error {
+	if f.closed.Swap(true) {
+		if f.stale.Load() {
+			return nil
+		}
+		return &fs.PathError{Op: "close", Path: f.path, Err: fs.ErrClosed}
+	}
+	f.untrack()
+	return f.mnt.wrapErr("close", f.path, f.rel, f.File.Close())
+}
+
+// track adds f to the handles of its mounts, closing it and reporting false
+// if one of them was replaced.
+func (f *file) track() bool {
+	for _, v := range append([]*mount{f.mnt}, f.via...) {
+		if !v.handles.add(f) {
+			f.untrack()
+			f.File.Close()
+			return false
+		}
+	}
+	return true
+}
+
+func (f *file) untrack() {
+	f.mnt.handles.remove(f)
+	for _, v := range f.via {
+		v.handles.remove(f)
+	}
+}
+
+func (f *file) invalidate() {
+	f.stale.Store(true)
+	if !f.closed.Swap(true) {
+		f.untrack()
+		f.File.Close()
+	}
 }
 
 func (f *file) Stat() (fs.FileInfo, error) {
+	if f.stale.Load() {
+		return nil, &fs.PathError{Op: "stat", Path: f.path, Err: ErrMountReplaced}
+	}
 	i, err := f.File.Stat()
 	if err != nil {
-		return nil, err
+		return nil, f.mnt.wrapErr("stat", f.path, f.rel, err)
 	}
 	return &fileInfo{
 		FileInfo: i,
 		path:     f.path,
+		opts:     f.mnt.opts,
 	}, nil
 }
 
 type fileInfo struct {
 	fs.FileInfo
 	path string
+	// opts are the options of the mount holding the file, nil for the
+	// synthesized directories
+	opts *mountOptions
+}
+
+func (f *fileInfo) Mode() fs.FileMode {
+	m := f.FileInfo.Mode()
+	if f.opts != nil && f.opts.modeMask != nil {
+		m = m&^fs.ModePerm | m&*f.opts.modeMask&fs.ModePerm
+	}
+	return m
+}
+
+func (f *fileInfo) Owner() (uid, gid int, ok bool) {
+	if f.opts == nil || f.opts.owner == nil {
+		return 0, 0, false
+	}
+	return f.opts.owner.uid, f.opts.owner.gid, true
 }
 
 func (f *fileInfo) Name() string {
+	return path.Base(f.path)
+}
+
+func (f *fileInfo) FullPath() string {
 	return f.path
 }
 
 type dirEntry struct {
 	fs.DirEntry
 	path string
+	opts *mountOptions
 }
 
 func (d *dirEntry) Name() string {
+	return path.Base(d.path)
+}
+
+func (d *dirEntry) FullPath() string {
 	return d.path
 }
 
+func (d *dirEntry) Unwrap() fs.DirEntry {
+	return d.DirEntry
+}
+
+func (d *dirEntry) Info() (fs.FileInfo, error) {
+	i, err := d.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{FileInfo: i, path: d.path, opts: d.opts}, nil
+}
+
 var (
 	_ fs.DirEntry = (*fakeDir)(nil)
 	_ fs.FileInfo = (*fakeDir)(nil)
 	_ fs.File     = (*fakeDir)(nil)
+
+	_ fs.ReadDirFile = (*fakeDir)(nil)
+	_ fs.ReadDirFile = (*file)(nil)
+	_ io.ReadSeeker  = (*file)(nil)
+	_ io.ReaderAt    = (*file)(nil)
 )
 
 type fakeDir struct {
-	path string
+	path    string
+	modTime time.Time
+	count   func() int64
+	dir     dirReader
+
+	sizeOnce sync.Once
+	size     int64
+}
+
+func (f *fakeDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	return f.dir.ReadDir(n)
 }
 
 func (f *fakeDir) Stat() (fs.FileInfo, error) {
@@ -171,8 +1237,16 @@ func (f *fakeDir) Close() error {
 	return nil
 }
 
+// Size returns the number of entries in the directory, counted on the first
+// call as it lists the directory.
 func (f *fakeDir) Size() int64 {
-	return 0
+	if f.count == nil {
+		return 0
+	}
+	f.sizeOnce.Do(func() {
+		f.size = f.count()
+	})
+	return f.size
 }
 
 func (f *fakeDir) Mode() fs.FileMode {
@@ -180,7 +1254,7 @@ func (f *fakeDir) Mode() fs.FileMode {
 }
 
 func (f *fakeDir) ModTime() time.Time {
-	return time.Time{}
+	return f.modTime
 }
 
 func (f *fakeDir) Sys() any {
@@ -188,6 +1262,10 @@ func (f *fakeDir) Sys() any {
 }
 
 func (f *fakeDir) Name() string {
+	return path.Base(f.path)
+}
+
+func (f *fakeDir) FullPath() string {
 	return f.path
 }
 
@@ -15,10 +15,19 @@
 package mfs
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/psanford/memfs"
 	"github.com/stretchr/testify/assert"
@@ -95,7 +104,9 @@ func Test(t *testing.T) {
 				if strings.HasPrefix(tt.prefix, "/") {
 					p = "/"
 				}
-				assert.Equal(t, p+"m1/1/foo", s.Name())
+				assert.Equal(t, "foo", s.Name())
+				require.Implements(t, (*FullPather)(nil), s)
+				assert.Equal(t, p+"m1/1/foo", s.(FullPather).FullPath())
 				b, err := io.ReadAll(f)
 				require.NoError(t, err)
 				assert.Equal(t, data["foo"], b)
@@ -107,11 +118,13 @@ func Test(t *testing.T) {
 				require.Len(t, d, 2)
 				for _, v := range d {
 					assert.True(t, v.IsDir())
+					assert.False(t, strings.HasPrefix(v.Name(), "/"))
 					fn := assert.False
 					if strings.HasPrefix(tt.prefix, "/") {
 						fn = assert.True
 					}
-					fn(t, strings.HasPrefix(v.Name(), "/"))
+					require.Implements(t, (*FullPather)(nil), v)
+					fn(t, strings.HasPrefix(v.(FullPather).FullPath(), "/"))
 				}
 			})
 
@@ -119,7 +132,528 @@ func Test(t *testing.T) {
 				d, err := mfs.ReadDir(p + "m1/1")
 				require.NoError(t, err)
 				require.Len(t, d, 4)
+				for _, v := range d {
+					assert.Equal(t, filepath.Clean(p+"m1/1/"+v.Name()), v.(FullPather).FullPath())
+				}
 			})
 		})
 	}
 }
+
+func TestBind(t *testing.T) {
+	m1 := memfs.New()
+	require.NoError(t, m1.MkdirAll("a/b", 0755))
+	require.NoError(t, m1.WriteFile("a/b/foo", data["foo"], 0666))
+	require.NoError(t, m1.WriteFile("a/bar", data["baz"], 0666))
+
+	mfs, err := Mount("m1", m1)
+	require.NoError(t, err)
+	require.NoError(t, mfs.Bind("m1/a/b", "b"))
+
+	b, err := fs.ReadFile(mfs, "b/foo")
+	require.NoError(t, err)
+	assert.Equal(t, data["foo"], b)
+
+	d, err := mfs.ReadDir("b")
+	require.NoError(t, err)
+	require.Len(t, d, 1)
+	assert.Equal(t, "foo", d[0].Name())
+
+	assert.ErrorIs(t, mfs.Bind("m1/a/b", "b"), fs.ErrExist)
+	assert.ErrorIs(t, mfs.Bind("m1/nope", "nope"), fs.ErrNotExist)
+	assert.Error(t, mfs.Bind("m1/a/bar", "bar"))
+	assert.ErrorIs(t, mfs.Bind("nope", "nope"), fs.ErrNotExist)
+}
+
+func TestAlias(t *testing.T) {
+	mem := NewMemFS()
+	require.NoError(t, mem.WriteFile("foo", data["foo"], 0644))
+	c := &countingFS{MemFS: mem}
+	m, err := Mount("data", c, WithCache(time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, m.Alias("data", "alias"))
+
+	for _, v := range []string{"data/foo", "alias/foo"} {
+		b, err := fs.ReadFile(m, v)
+		require.NoError(t, err)
+		assert.Equal(t, data["foo"], b)
+	}
+	assert.EqualValues(t, 1, c.opens.Load(), "the cache is shared")
+	s := m.CacheStats()
+	assert.Equal(t, s["data"], s["alias"])
+
+	_, n, err := DiskUsage(context.Background(), m, "data")
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, n)
+	require.NoError(t, m.WriteFile("alias/foo", data["quux"], 0644))
+	b, err := fs.ReadFile(m, "data/foo")
+	require.NoError(t, err)
+	assert.Equal(t, data["quux"], b)
+	_, n, err = DiskUsage(context.Background(), m, "data")
+	require.NoError(t, err)
+	assert.EqualValues(t, 5, n)
+
+	assert.ErrorIs(t, m.Alias("data", "alias"), fs.ErrExist)
+	assert.ErrorIs(t, m.Alias("nope", "other"), fs.ErrNotExist)
+
+	require.NoError(t, m.Unmount("data"))
+	b, err = fs.ReadFile(m, "alias/foo")
+	require.NoError(t, err)
+	assert.Equal(t, data["quux"], b)
+}
+
+func TestShadowing(t *testing.T) {
+	base := memfs.New()
+	require.NoError(t, base.WriteFile("foo", []byte("base"), 0666))
+	require.NoError(t, base.WriteFile("baz", data["baz"], 0666))
+	override := memfs.New()
+	require.NoError(t, override.WriteFile("foo", []byte("override"), 0666))
+
+	read := func(m MFS, name string) string {
+		b, err := fs.ReadFile(m, name)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	m, err := Mount("m", base)
+	require.NoError(t, err)
+	assert.ErrorIs(t, m.Mount("m", override), fs.ErrExist)
+	assert.ErrorIs(t, m.Mount("m", override, WithShadowing(ErrorIfExists)), fs.ErrExist)
+
+	require.NoError(t, m.Mount("m", override, WithShadowing(StackAbove)))
+	assert.Equal(t, "override", read(m, "m/foo"))
+	assert.Equal(t, "qux", read(m, "m/baz"))
+
+	m, err = Mount("m", base)
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("m", override, WithShadowing(StackBelow)))
+	assert.Equal(t, "base", read(m, "m/foo"))
+	d, err := m.ReadDir("m")
+	require.NoError(t, err)
+	assert.Len(t, d, 2)
+
+	require.NoError(t, m.Mount("m", override, WithShadowing(Replace)))
+	assert.Equal(t, "override", read(m, "m/foo"))
+	_, err = m.Open("m/baz")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestMountMetadata(t *testing.T) {
+	m1 := memfs.New()
+	for k, v := range data {
+		require.NoError(t, m1.WriteFile(k, v, 0666))
+	}
+	before := time.Now()
+	m, err := Mount("m1", m1)
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("m2", fstest.MapFS{"foo": {Data: data["foo"]}}, WithRootInfo()))
+
+	s, err := fs.Stat(m, ".")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, s.Size())
+	assert.False(t, s.ModTime().Before(before))
+
+	d, err := m.ReadDir(".")
+	require.NoError(t, err)
+	require.Len(t, d, 2)
+	for _, v := range d {
+		i, err := v.Info()
+		require.NoError(t, err)
+		assert.True(t, i.IsDir())
+		switch v.Name() {
+		case "m1":
+			assert.EqualValues(t, len(data), i.Size())
+			assert.False(t, i.ModTime().Before(before))
+		case "m2":
+			assert.Equal(t, fs.ModeDir|0555, i.Mode())
+		default:
+			t.Fatalf("unexpected entry %s", v.Name())
+		}
+	}
+}
+
+type recordFS struct {
+	fs.FS
+	name  string
+	calls *[]string
+}
+
+func (r *recordFS) Open(name string) (fs.File, error) {
+	*r.calls = append(*r.calls, r.name+":"+name)
+	return r.FS.Open(name)
+}
+
+func TestMiddleware(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware {
+		return func(fsys fs.FS) fs.FS {
+			return &recordFS{FS: fsys, name: name, calls: &calls}
+		}
+	}
+	upper := func(_ string, r io.Reader) (io.Reader, error) {
+		b, err := io.ReadAll(r)
+		return strings.NewReader(strings.ToUpper(string(b))), err
+	}
+	m, err := Mount("m", fstest.MapFS{"foo": {Data: data["foo"]}},
+		WithMiddleware(record("a"), record("b")),
+		WithMiddleware(record("c")),
+		WithTransform(upper),
+	)
+	require.NoError(t, err)
+	b, err := fs.ReadFile(m, "m/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "BAR", string(b))
+	assert.Equal(t, []string{"a:foo", "b:foo", "c:foo"}, calls)
+}
+
+func TestModeMaskOwner(t *testing.T) {
+	m, err := Mount("m", fstest.MapFS{
+		"foo":     {Data: data["foo"], Mode: 0644},
+		"dir/baz": {Data: data["baz"], Mode: 0600},
+	}, WithModeMask(0555), WithOwner(1000, 100))
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("other", fstest.MapFS{"foo": {Data: data["foo"], Mode: 0644}}))
+
+	s, err := fs.Stat(m, "m/foo")
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0444), s.Mode())
+	uid, gid, ok := s.(OwnerInfo).Owner()
+	assert.True(t, ok)
+	assert.Equal(t, []int{1000, 100}, []int{uid, gid})
+
+	ds, err := m.ReadDir("m")
+	require.NoError(t, err)
+	for _, v := range ds {
+		i, err := v.Info()
+		require.NoError(t, err)
+		if v.IsDir() {
+			assert.Equal(t, fs.ModeDir|0555, i.Mode(), v.Name())
+		} else {
+			assert.Equal(t, fs.FileMode(0444), i.Mode(), v.Name())
+		}
+		_, _, ok := i.(OwnerInfo).Owner()
+		assert.True(t, ok)
+	}
+	require.NoError(t, WalkDir(m, "m/dir", func(path string, d fs.DirEntry, err error) error {
+		require.NoError(t, err)
+		i, err := d.Info()
+		require.NoError(t, err)
+		if !d.IsDir() {
+			assert.Equal(t, fs.FileMode(0400), i.Mode(), path)
+		}
+		return nil
+	}))
+
+	s, err = fs.Stat(m, "other/foo")
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0644), s.Mode())
+	_, _, ok = s.(OwnerInfo).Owner()
+	assert.False(t, ok)
+}
+
+func TestRootMount(t *testing.T) {
+	for _, root := range []string{"/", ".", ""} {
+		t.Run(root, func(t *testing.T) {
+			def := fstest.MapFS{
+				"index.html": {Data: []byte("index")},
+				"m1/shadow":  {Data: []byte("shadowed")},
+				"dir/foo":    {Data: data["foo"]},
+			}
+			m, err := Mount("m1", fstest.MapFS{"foo": {Data: data["foo"]}})
+			require.NoError(t, err)
+			require.NoError(t, m.Mount(root, def))
+			assert.ErrorIs(t, m.Mount("/", def), fs.ErrExist)
+
+			b, err := fs.ReadFile(m, "index.html")
+			require.NoError(t, err)
+			assert.Equal(t, "index", string(b))
+			b, err = fs.ReadFile(m, "/dir/foo")
+			require.NoError(t, err)
+			assert.Equal(t, data["foo"], b)
+			_, err = m.Open("m1/shadow")
+			assert.ErrorIs(t, err, fs.ErrNotExist)
+
+			d, err := m.ReadDir(".")
+			require.NoError(t, err)
+			var names []string
+			for _, v := range d {
+				names = append(names, v.Name())
+			}
+			assert.Equal(t, []string{"dir", "index.html", "m1"}, names)
+
+			var walked []string
+			require.NoError(t, m.WalkDir(".", func(p string, d fs.DirEntry, err error) error {
+				require.NoError(t, err)
+				walked = append(walked, p)
+				return nil
+			}))
+			assert.Equal(t, []string{".", "dir", "dir/foo", "index.html", "m1", "m1/foo"}, walked)
+
+			require.NoError(t, m.Unmount(root))
+			_, err = m.Open("index.html")
+			assert.ErrorIs(t, err, fs.ErrNotExist)
+		})
+	}
+}
+
+func TestIntermediateDirs(t *testing.T) {
+	names := func(ds []fs.DirEntry) []string {
+		var res []string
+		for _, v := range ds {
+			res = append(res, v.Name())
+		}
+		return res
+	}
+	m, err := Mount("a/b/c", fstest.MapFS{"foo": {Data: data["foo"]}})
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("a/d", fstest.MapFS{"baz": {Data: data["baz"]}}))
+	require.NoError(t, m.Mount("x", fstest.MapFS{"y": {Data: data["quux"]}}))
+	require.NoError(t, m.Mount("x/z/w", fstest.MapFS{}))
+
+	for name, want := range map[string][]string{
+		".":   {"a", "x"},
+		"/":   {"a", "x"},
+		"a":   {"b", "d"},
+		"a/b": {"c"},
+		"x":   {"y", "z"},
+		"x/z": {"w"},
+	} {
+		ds, err := m.ReadDir(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, want, names(ds), name)
+		i, err := fs.Stat(m, name)
+		require.NoError(t, err, name)
+		assert.True(t, i.IsDir(), name)
+		f, err := m.Open(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, want, readAllDir(t, f, 1), name)
+		require.NoError(t, f.Close())
+		var got []string
+		for d, err := range m.ReadDirIter(name) {
+			require.NoError(t, err)
+			got = append(got, d.Name())
+		}
+		assert.Equal(t, want, got, name)
+	}
+	i, err := fs.Stat(m, "a/b")
+	require.NoError(t, err)
+	assert.Equal(t, "b", i.Name())
+	_, err = fs.Stat(m, "a/missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = m.ReadDir("a/b/missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	var walked []string
+	require.NoError(t, m.WalkDir(".", func(p string, d fs.DirEntry, err error) error {
+		require.NoError(t, err)
+		walked = append(walked, p)
+		return nil
+	}))
+	assert.Equal(t, []string{".", "a", "a/b", "a/b/c", "a/b/c/foo", "a/d", "a/d/baz", "x", "x/y", "x/z", "x/z/w"}, walked)
+	walked = nil
+	require.NoError(t, m.WalkDir("a", func(p string, d fs.DirEntry, err error) error {
+		walked = append(walked, p)
+		if p == "a/b" {
+			return fs.SkipDir
+		}
+		return nil
+	}))
+	assert.Equal(t, []string{"a", "a/b", "a/d", "a/d/baz"}, walked)
+}
+
+func TestFakeDirSize(t *testing.T) {
+	m, err := Mount("a/b", fstest.MapFS{})
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("a/c", fstest.MapFS{}))
+	i, err := fs.Stat(m, "a")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, i.Size())
+
+	// the entries are counted once
+	calls := 0
+	d := &fakeDir{count: func() int64 {
+		calls++
+		return 2
+	}}
+	assert.EqualValues(t, 2, d.Size())
+	assert.EqualValues(t, 2, d.Size())
+	assert.Equal(t, 1, calls)
+}
+
+func TestNestedMountParents(t *testing.T) {
+	names := func(ds []fs.DirEntry) []string {
+		var res []string
+		for _, v := range ds {
+			res = append(res, v.Name())
+		}
+		return res
+	}
+	m, err := Mount("assets/js", fstest.MapFS{"app.js": {}})
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("assets/css", fstest.MapFS{"app.css": {}}))
+	ds, err := m.ReadDir(".")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"assets"}, names(ds))
+	ds, err = m.ReadDir("assets")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"css", "js"}, names(ds))
+
+	require.NoError(t, m.Mount(".", fstest.MapFS{"assets/img/logo.png": {}, "assets/js/old.js": {}, "index.html": {}}))
+	ds, err = m.ReadDir(".")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"assets", "index.html"}, names(ds))
+	ds, err = m.ReadDir("assets")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"css", "img", "js"}, names(ds))
+	ds, err = m.ReadDir("assets/js")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"app.js"}, names(ds))
+
+	require.NoError(t, m.Mount("assets", fstest.MapFS{"favicon.ico": {}, "css/old.css": {}}))
+	ds, err = m.ReadDir(".")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"assets", "index.html"}, names(ds))
+	ds, err = m.ReadDir("assets")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"css", "favicon.ico", "js"}, names(ds))
+	f, err := m.Open("assets")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"css", "favicon.ico", "js"}, readAllDir(t, f, -1))
+	require.NoError(t, f.Close())
+
+	var walked []string
+	require.NoError(t, m.WalkDir(".", func(p string, d fs.DirEntry, err error) error {
+		require.NoError(t, err)
+		walked = append(walked, p)
+		return nil
+	}))
+	assert.Equal(t, []string{".", "assets", "assets/css", "assets/css/app.css", "assets/favicon.ico", "assets/js", "assets/js/app.js", "index.html"}, walked)
+}
+
+func TestRandomAccess(t *testing.T) {
+	content := []byte("0123456789")
+	m, err := Mount("m", fstest.MapFS{"foo": {Data: content}})
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("http", &httpFS{}))
+
+	f, err := m.Open("m/foo")
+	require.NoError(t, err)
+	defer f.Close()
+	b := make([]byte, 3)
+	n, err := f.(io.ReaderAt).ReadAt(b, 4)
+	require.NoError(t, err)
+	assert.Equal(t, "456", string(b[:n]))
+	off, err := f.(io.Seeker).Seek(-2, io.SeekEnd)
+	require.NoError(t, err)
+	assert.EqualValues(t, 8, off)
+	b, err = io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "89", string(b))
+
+	d, err := m.Open("http")
+	require.NoError(t, err)
+	_, err = d.(io.Seeker).Seek(0, io.SeekStart)
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+
+	srv := httptest.NewServer(http.FileServerFS(m))
+	defer srv.Close()
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/m/foo", nil)
+	require.NoError(t, err)
+	req.Header.Set("Range", "bytes=2-5")
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusPartialContent, res.StatusCode)
+	b, err = io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "2345", string(b))
+}
+
+func TestConcurrentMounts(t *testing.T) {
+	m, err := Mount("stable", fstest.MapFS{"foo": {Data: data["foo"]}})
+	require.NoError(t, err)
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			assert.NoError(t, m.Mount("tmp", fstest.MapFS{"bar": {Data: data["baz"]}}))
+			assert.NoError(t, m.Unmount("tmp"))
+		}
+		close(done)
+	}()
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				b, err := fs.ReadFile(m, "stable/foo")
+				assert.NoError(t, err)
+				assert.Equal(t, data["foo"], b)
+				_, err = m.ReadDir(".")
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkOpen(b *testing.B) {
+	m := New()
+	for i := 0; i < 32; i++ {
+		require.NoError(b, m.Mount(fmt.Sprintf("m%d", i), fstest.MapFS{"foo": {Data: data["foo"]}}))
+	}
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			f, err := m.Open("m16/foo")
+			if err != nil {
+				b.Fatal(err)
+			}
+			f.Close()
+		}
+	})
+}
+
+func TestMountPriority(t *testing.T) {
+	m, err := Mount("site", fstest.MapFS{
+		"index.html":    {Data: []byte("site")},
+		"assets/app.js": {Data: []byte("site")},
+	})
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("site/assets", fstest.MapFS{
+		"app.js":   {Data: []byte("assets")},
+		"logo.png": {Data: []byte("assets")},
+	}))
+	read := func(name string) string {
+		b, err := fs.ReadFile(m, name)
+		require.NoError(t, err)
+		return string(b)
+	}
+	assert.Equal(t, "assets", read("site/assets/app.js"))
+
+	require.NoError(t, m.SetPriority("site", 10))
+	assert.Equal(t, "site", read("site/assets/app.js"))
+	// missing from the promoted mount
+	assert.Equal(t, "assets", read("site/assets/logo.png"))
+	ds, err := m.ReadDir("site/assets")
+	require.NoError(t, err)
+	assert.Len(t, ds, 1)
+	_, err = m.Open("site/assets/missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	require.NoError(t, m.Replace("site", fstest.MapFS{"assets/app.js": {Data: []byte("replaced")}}))
+	assert.Equal(t, "replaced", read("site/assets/app.js"))
+	require.NoError(t, m.SetPriority("site", 0))
+	assert.Equal(t, "assets", read("site/assets/app.js"))
+	assert.ErrorIs(t, m.SetPriority("missing", 1), fs.ErrNotExist)
+
+	require.NoError(t, m.Mount("site/assets/js", fstest.MapFS{"app.js": {Data: []byte("js")}}, WithPriority(-1)))
+	require.NoError(t, m.Mount("site/assets", fstest.MapFS{"js/app.js": {Data: []byte("assets")}}, WithShadowing(Replace)))
+	assert.Equal(t, "assets", read("site/assets/js/app.js"))
+}
@@ -0,0 +1,57 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+// nested returns the MFS mounted as is at mnt, without options wrapping it,
+// if rel, the path resolved to mnt, is resolved directly within its mount
+// table rather than through its methods: a single lookup instead of
+// cleaning the path twice, taking the locks of both and wrapping the
+// errors twice. The errors are then only recorded by its mounts, see
+// ErrorStats. Only the nested MFS configured so that it makes no
+// difference are flattened: without audit, slow operations logging, strict
+// paths or Unicode normalization, nor any view, and with the same profiler
+// labels and cross-mount rename settings as m. The root of the nested MFS,
+// merging its mount points, is not flattened either.
+func (m *mfs) nested(mnt *mount, rel string) *mfs {
+	n := mnt.nested
+	if n == nil || rel == "." || n.view != nil || n.ctx != nil || n.audit != nil || n.slow != nil || n.strict || n.form != nil ||
+		n.labels != m.labels || n.crossMountRename != m.crossMountRename {
+		return nil
+	}
+	return n
+}
+
+// call runs fn with mnt and rel or, when rel is resolved within the MFS
+// nested at mnt, with its mounts as fallback does, appending mnt to via if
+// not nil. It returns the mount and path of the last call.
+func (m *mfs) call(op string, mnt *mount, rel string, via *[]*mount, fn func(mnt *mount, rel string) error) (*mount, string, error) {
+	n := m.nested(mnt, rel)
+	switch {
+	case n == nil && !m.labels:
+		return mnt, rel, fn(mnt, rel)
+	case n == nil:
+		return mnt, rel, m.labeled(mnt, op, func() error {
+			return fn(mnt, rel)
+		})
+	}
+	if via != nil {
+		*via = append(*via, mnt)
+	}
+	inner, irel, err := n.fallback(n.load(), op, rel, via, fn)
+	if inner == nil {
+		return mnt, rel, err
+	}
+	return inner, irel, err
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNested(t *testing.T) {
+	inner := New()
+	require.NoError(t, inner.Mount("b", NewMemFS()))
+	m := New()
+	require.NoError(t, m.Mount("a", inner))
+	require.NoError(t, m.Mount("c", NewMemFS()))
+
+	require.NoError(t, m.MkdirAll("a/b/dir", 0755))
+	require.NoError(t, m.WriteFile("a/b/dir/foo", data["foo"], 0644))
+	b, err := fs.ReadFile(inner, "b/dir/foo")
+	require.NoError(t, err)
+	assert.Equal(t, data["foo"], b)
+	entries, err := m.ReadDir("a")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "b", entries[0].Name())
+
+	_, err = m.Open("a/b/missing")
+	assert.EqualError(t, err, "open a/b/missing: mount b: missing: file does not exist")
+	var me *MountError
+	require.ErrorAs(t, err, &me)
+	assert.NotErrorAs(t, me.Err, &me)
+	_, err = m.Open("a/missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	// a single lock table
+	u, err := m.Lock("a/b/dir/foo", false)
+	require.NoError(t, err)
+	_, err = inner.Lock("b/dir/foo", true)
+	assert.ErrorIs(t, err, ErrLocked)
+	require.NoError(t, u.Unlock())
+
+	// the disk usage of the nested MFS is invalidated
+	_, n, err := DiskUsage(context.Background(), inner, "b")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data["foo"])), n)
+	require.NoError(t, m.WriteFile("a/b/bar", data["bar"], 0644))
+	_, n, err = DiskUsage(context.Background(), inner, "b")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data["foo"])+len(data["bar"])), n)
+
+	require.NoError(t, m.Rename("a/b/bar", "a/b/dir/bar"))
+	assert.ErrorIs(t, m.Rename("a/b/dir/bar", "c/bar"), ErrCrossMount)
+
+	// the files are invalidated when either mount is replaced
+	f, err := m.Open("a/b/dir/foo")
+	require.NoError(t, err)
+	require.NoError(t, m.Replace("a", New()))
+	_, err = f.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, ErrMountReplaced)
+	require.NoError(t, m.Replace("a", inner))
+	f, err = m.Open("a/b/dir/foo")
+	require.NoError(t, err)
+	g, err := m.Open("a/b/dir/bar")
+	require.NoError(t, err)
+	require.NoError(t, g.Close())
+	require.NoError(t, inner.Replace("b", NewMemFS()))
+	_, err = f.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, ErrMountReplaced)
+}
+
+func TestNestedAudited(t *testing.T) {
+	var ops []string
+	inner := New(WithAudit(AuditFunc(func(r AuditRecord) {
+		ops = append(ops, r.Op+":"+r.Path)
+	})))
+	require.NoError(t, inner.Mount("b", NewMemFS()))
+	m := New()
+	require.NoError(t, m.Mount("a", inner))
+	require.NoError(t, m.WriteFile("a/b/foo", data["foo"], 0644))
+	f, err := m.Open("a/b/foo")
+	require.NoError(t, err)
+	_, err = io.ReadAll(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	_, err = m.Open("a/b/missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.Equal(t, []string{"mount:b", "write:b/foo", "open:b/foo", "open:b/missing"}, ops)
+}
@@ -0,0 +1,115 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ocifs exposes the root file system of an OCI or Docker image
+// without extracting it. The image layers are stacked with mfs.Overlay,
+// which applies their whiteouts.
+//
+// The uncompressed layers are spooled to anonymous temporary files so that
+// their content can be read at random, the files being released by Close.
+// Symbolic links are only resolved inside the layer defining them.
+package ocifs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"go.linka.cloud/mfs"
+)
+
+// FS is the flattened root file system of an image.
+type FS struct {
+	fs.FS
+	files []*os.File
+}
+
+// New returns the root file system of img.
+func New(img v1.Image) (*FS, error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+	f := &FS{}
+	fss := make([]fs.FS, len(layers))
+	for i, l := range layers {
+		// the image layers are ordered from the base, the overlay from the top
+		if fss[len(layers)-1-i], err = f.spool(l); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	f.FS = mfs.Overlay(fss...)
+	return f, nil
+}
+
+// Open returns the root file system of the image stored in a tarball, as
+// produced by docker save.
+func Open(path string) (*FS, error) {
+	img, err := tarball.ImageFromPath(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return New(img)
+}
+
+// Pull returns the root file system of the image ref fetched from its
+// registry.
+func Pull(ref string, opts ...remote.Option) (*FS, error) {
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	img, err := remote.Image(r, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return New(img)
+}
+
+func (f *FS) spool(l v1.Layer) (fs.FS, error) {
+	rc, err := l.Uncompressed()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	tmp, err := os.CreateTemp("", "ocifs-")
+	if err != nil {
+		return nil, err
+	}
+	// the file lives as long as it is open
+	os.Remove(tmp.Name())
+	f.files = append(f.files, tmp)
+	size, err := io.Copy(tmp, rc)
+	if err != nil {
+		return nil, err
+	}
+	return mfs.OpenArchive(tmp, size, mfs.FormatTar)
+}
+
+// Close releases the spooled layers.
+func (f *FS) Close() error {
+	var errs []error
+	for _, v := range f.files {
+		errs = append(errs, v.Close())
+	}
+	f.files = nil
+	return errors.Join(errs...)
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocifs
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func layer(t *testing.T, files map[string]string) v1.Layer {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for k, v := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: k, Mode: 0644, Size: int64(len(v)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(v))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	l, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	})
+	require.NoError(t, err)
+	return l
+}
+
+func image(t *testing.T) v1.Image {
+	img, err := mutate.AppendLayers(empty.Image,
+		layer(t, map[string]string{
+			"bin/sh":      "sh",
+			"etc/passwd":  "root",
+			"etc/hosts":   "localhost",
+			"var/cache/a": "a",
+		}),
+		layer(t, map[string]string{
+			"etc/.wh.hosts":          "",
+			"etc/passwd":             "root\nuser",
+			"var/cache/.wh..wh..opq": "",
+			"var/cache/b":            "b",
+		}),
+	)
+	require.NoError(t, err)
+	return img
+}
+
+func TestOCIFS(t *testing.T) {
+	f, err := New(image(t))
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, fstest.TestFS(f, "bin/sh", "etc/passwd", "var/cache/b"))
+	b, err := fs.ReadFile(f, "etc/passwd")
+	require.NoError(t, err)
+	assert.Equal(t, "root\nuser", string(b))
+	for _, v := range []string{"etc/hosts", "var/cache/a"} {
+		_, err := fs.Stat(f, v)
+		assert.ErrorIs(t, err, fs.ErrNotExist, v)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "image.tar")
+	ref, err := name.ParseReference("example.com/image:latest")
+	require.NoError(t, err)
+	require.NoError(t, tarball.WriteToFile(path, ref, image(t)))
+	f, err := Open(path)
+	require.NoError(t, err)
+	b, err := fs.ReadFile(f, "bin/sh")
+	require.NoError(t, err)
+	assert.Equal(t, "sh", string(b))
+	require.NoError(t, f.Close())
+}
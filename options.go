@@ -0,0 +1,232 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"io"
+	"io/fs"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const defaultConcurrency = 8
+
+// Option configures an MFS created with New.
+type Option func(m *mfs)
+
+// WithConcurrency bounds the number of mounts queried concurrently, e.g.
+// when listing the root directory. It defaults to 8.
+func WithConcurrency(n int) Option {
+	return func(m *mfs) {
+		if n > 0 {
+			m.concurrency = n
+		}
+	}
+}
+
+// MountOption configures a single Mount call.
+type MountOption func(o *mountOptions)
+
+type mountOptions struct {
+	shadow     ShadowPolicy
+	rootInfo   bool
+	transforms []TransformFunc
+	decompress bool
+	manifest   Manifest
+	middleware []Middleware
+	modeMask   *fs.FileMode
+	owner      *owner
+	trash      time.Duration
+	timeout    time.Duration
+	resolver   ConflictResolver
+	priority   int
+	confine    bool
+	form       *norm.Form
+	// contentTypes maps the lower case extensions to their content type
+	contentTypes map[string]string
+	// maxConcurrent bounds the operations in flight when positive
+	maxConcurrent int
+	limitPolicy   LimitPolicy
+	retry         *RetryPolicy
+	breaker       *breakerOptions
+	cache         *cacheOptions
+	maxResolved   int
+	// include and exclude are the globs of WithInclude and WithExclude
+	include, exclude []string
+	maxFileSize      int64
+	symlinks         SymlinkPolicy
+	drain            time.Duration
+	// closer is the backend opened by MountURL or Serve, see backend
+	closer io.Closer
+}
+
+type owner struct {
+	uid, gid int
+}
+
+func newMountOptions(opts ...MountOption) *mountOptions {
+	o := &mountOptions{}
+	for _, v := range opts {
+		v(o)
+	}
+	return o
+}
+
+// wraps reports whether wrap changes the mounted file system.
+func (o *mountOptions) wraps() bool {
+	return o.maxFileSize > 0 || o.decompress || len(o.transforms) > 0 || o.manifest != nil || len(o.include) > 0 || len(o.exclude) > 0 || o.cache != nil || len(o.middleware) > 0
+}
+
+// wrap applies the file system wrappers configured by the options, returning
+// the cache configured with WithCache if any.
+func (o *mountOptions) wrap(fsys fs.FS) (fs.FS, *cacheFS) {
+	if o.maxFileSize > 0 {
+		fsys = MaxFileSize(fsys, o.maxFileSize)
+	}
+	if o.decompress {
+		fsys = Decompress(fsys)
+	}
+	for _, fn := range o.transforms {
+		fsys = Transform(fsys, fn)
+	}
+	if o.manifest != nil {
+		fsys = Verify(fsys, o.manifest)
+	}
+	if len(o.include) > 0 || len(o.exclude) > 0 {
+		fsys = GlobFilter(fsys, o.include, o.exclude)
+	}
+	var c *cacheFS
+	if o.cache != nil {
+		c = newCacheFS(fsys, o.cache)
+		fsys = c
+	}
+	for i := len(o.middleware) - 1; i >= 0; i-- {
+		fsys = o.middleware[i](fsys)
+	}
+	return fsys, c
+}
+
+// ShadowPolicy controls what happens when mounting at a path which is
+// already a mount point.
+type ShadowPolicy int
+
+const (
+	// ErrorIfExists makes Mount fail with fs.ErrExist.
+	ErrorIfExists ShadowPolicy = iota
+	// Replace swaps the existing file system with the new one.
+	Replace
+	// StackAbove merges the new file system on top of the existing one,
+	// its files shadowing the ones below.
+	StackAbove
+	// StackBelow merges the new file system under the existing one,
+	// only exposing files missing from the layers above.
+	StackBelow
+)
+
+// WithShadowing sets the policy applied when the mount point already exists.
+func WithShadowing(p ShadowPolicy) MountOption {
+	return func(o *mountOptions) {
+		o.shadow = p
+	}
+}
+
+// WithConflictResolver sets the resolver of the conflicts between the
+// layers of a stacked mount, see MergeWith.
+func WithConflictResolver(r ConflictResolver) MountOption {
+	return func(o *mountOptions) {
+		o.resolver = r
+	}
+}
+
+// WithPriority sets the priority of the mount, 0 by default. When several
+// mounts hold a path, e.g. "site" and "site/assets" for "site/assets/app.js",
+// the one with the highest priority serves it, the deepest one among equal
+// priorities. Opening and listing fall back to the deeper mounts holding the
+// path when it does not exist in a shallower one promoted by its priority.
+func WithPriority(n int) MountOption {
+	return func(o *mountOptions) {
+		o.priority = n
+	}
+}
+
+// WithRootInfo makes the mount point report the FileInfo of the backend root
+// directory in listings instead of a synthesized one.
+func WithRootInfo() MountOption {
+	return func(o *mountOptions) {
+		o.rootInfo = true
+	}
+}
+
+// WithTransform rewrites the content of the mounted files with fn as they are
+// read. It may be given several times, the transforms being applied in order.
+func WithTransform(fn TransformFunc) MountOption {
+	return func(o *mountOptions) {
+		o.transforms = append(o.transforms, fn)
+	}
+}
+
+// WithDecompression exposes the compressed files of the mount under their
+// uncompressed name, see Decompress.
+func WithDecompression() MountOption {
+	return func(o *mountOptions) {
+		o.decompress = true
+	}
+}
+
+// WithManifest verifies the content of the mounted files against m, see
+// Verify. The manifest paths are relative to the mount point, as returned by
+// GenerateManifest called with the mount point as root.
+func WithManifest(m Manifest) MountOption {
+	return func(o *mountOptions) {
+		o.manifest = m
+	}
+}
+
+// WithModeMask masks the permission bits reported for the files of the
+// mount, e.g. 0555 to present them as read-only. The file type bits are
+// kept. It does not change the permissions enforced by the backend.
+func WithModeMask(mask fs.FileMode) MountOption {
+	return func(o *mountOptions) {
+		mask &= fs.ModePerm
+		o.modeMask = &mask
+	}
+}
+
+// WithOwner sets the ownership reported for the files of the mount, see
+// OwnerInfo. This is meant for exports (FUSE, NFS) of backends without
+// meaningful ownership.
+func WithOwner(uid, gid int) MountOption {
+	return func(o *mountOptions) {
+		o.owner = &owner{uid: uid, gid: gid}
+	}
+}
+
+// Middleware wraps a file system, e.g. to cache, rewrite or log its
+// operations. Decompress is a Middleware.
+type Middleware func(fs.FS) fs.FS
+
+// WithMiddleware wraps the mounted file system with mw, the first middleware
+// being the outermost one. The middleware wrap the file system after the
+// other options, e.g. WithTransform. It may be given several times, the
+// middleware being appended to the chain.
+//
+// Writes are forwarded to the outermost middleware, which should implement
+// the write interfaces of WritableMFS for the mount to remain writable.
+func WithMiddleware(mw ...Middleware) MountOption {
+	return func(o *mountOptions) {
+		o.middleware = append(o.middleware, mw...)
+	}
+}
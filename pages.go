@@ -0,0 +1,125 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/fs"
+	"sort"
+	"time"
+)
+
+// ReadDirPageFS is implemented by file systems able to list directories by
+// pages, e.g. object stores resuming listings from continuation tokens.
+type ReadDirPageFS interface {
+	fs.FS
+	// ReadDirPage returns up to n entries of the directory name following
+	// token, the opaque token returned by the previous call, or the first
+	// entries when token is empty. The returned token is empty after the
+	// last page. It fails with errors.ErrUnsupported when the file system
+	// cannot page the directory.
+	ReadDirPage(name, token string, n int) ([]fs.DirEntry, string, error)
+}
+
+// ReadDirPage pages the directory with the backend ReadDirPage when it
+// supports it. Otherwise, the entries are sorted by name and the token
+// designates the last entry returned: the backend directory is listed on
+// every call but the caller does not need to buffer it.
+func (m *mfs) ReadDirPage(name, token string, n int) (_ []fs.DirEntry, _ string, err error) {
+	defer m.record("readdir", name, time.Now(), &err)
+	if n <= 0 {
+		return nil, "", &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	t := m.load()
+	if name, err = m.clean("readdir", name); err != nil {
+		return nil, "", err
+	}
+	if name == "/" || name == "." || m.hasMounts(t, name) {
+		ds, err := m.readMerged(m.context(), t, name)
+		if err != nil {
+			return nil, "", err
+		}
+		return pageEntries("readdir", name, ds, token, n)
+	}
+	mnt, rel, err := m.lookup(t, "readdir", name)
+	if err != nil {
+		return nil, "", err
+	}
+	var ds []fs.DirEntry
+	next := ""
+	p, ok := As[ReadDirPageFS](mnt.fs)
+	if ok {
+		ds, next, err = p.ReadDirPage(rel, token, n)
+	}
+	if !ok || errors.Is(err, errors.ErrUnsupported) {
+		ds, err = fs.ReadDir(mnt.fs, rel)
+		if err == nil {
+			ds, next, err = pageEntries("readdir", name, ds, token, n)
+		}
+	}
+	if err != nil {
+		return nil, "", mnt.wrapErr("readdir", name, rel, err)
+	}
+	res := make([]fs.DirEntry, len(ds))
+	for i, d := range ds {
+		res[i] = &dirEntry{DirEntry: d, path: joinMountPath(name, d.Name()), opts: mnt.opts}
+	}
+	return res, next, nil
+}
+
+// page is the result of a ReadDirPage call run by the wrappers, see
+// readDirPage.
+type page struct {
+	entries []fs.DirEntry
+	next    string
+}
+
+// readDirPage forwards ReadDirPage to fsys, running the call with wrap when
+// not nil, e.g. to bound it with a timeout.
+func readDirPage(fsys fs.FS, name, token string, n int, wrap func(fn func() (page, error)) (page, error)) ([]fs.DirEntry, string, error) {
+	p, ok := fsys.(ReadDirPageFS)
+	if !ok {
+		return nil, "", unsupported("readdir", name)
+	}
+	fn := func() (page, error) {
+		ds, next, err := p.ReadDirPage(name, token, n)
+		return page{entries: ds, next: next}, err
+	}
+	if wrap == nil {
+		wrap = func(fn func() (page, error)) (page, error) { return fn() }
+	}
+	res, err := wrap(fn)
+	return res.entries, res.next, err
+}
+
+// pageEntries returns the page of the sorted entries ds following token.
+func pageEntries(op, name string, ds []fs.DirEntry, token string, n int) ([]fs.DirEntry, string, error) {
+	i := 0
+	if token != "" {
+		b, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+		}
+		after := string(b)
+		i = sort.Search(len(ds), func(i int) bool { return ds[i].Name() > after })
+	}
+	end := min(i+n, len(ds))
+	next := ""
+	if end < len(ds) {
+		next = base64.RawURLEncoding.EncodeToString([]byte(ds[end-1].Name()))
+	}
+	return ds[i:end], next, nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readPages(t *testing.T, m MFS, name string, n int) (pages [][]string) {
+	token := ""
+	for {
+		ds, next, err := m.ReadDirPage(name, token, n)
+		require.NoError(t, err)
+		var names []string
+		for _, d := range ds {
+			names = append(names, d.Name())
+		}
+		pages = append(pages, names)
+		if token = next; token == "" {
+			return pages
+		}
+	}
+}
+
+type pagedFS struct {
+	fstest.MapFS
+	calls int
+}
+
+func (p *pagedFS) ReadDirPage(name, token string, n int) ([]fs.DirEntry, string, error) {
+	p.calls++
+	ds, err := p.MapFS.ReadDir(name)
+	if err != nil {
+		return nil, "", err
+	}
+	return pageEntries("readdir", name, ds, token, n)
+}
+
+func TestReadDirPage(t *testing.T) {
+	m, err := Mount("a", fstest.MapFS{
+		"foo":     {Data: data["foo"]},
+		"bar":     {Data: data["baz"]},
+		"baz":     {Data: data["baz"]},
+		"dir/qux": {Data: data["foo"]},
+		"zzz":     {Data: data["foo"]},
+	})
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("b", fstest.MapFS{}))
+	require.NoError(t, m.Mount("c", fstest.MapFS{}))
+
+	assert.Equal(t, [][]string{{"bar", "baz"}, {"dir", "foo"}, {"zzz"}}, readPages(t, m, "a", 2))
+	assert.Equal(t, [][]string{{"a", "b"}, {"c"}}, readPages(t, m, ".", 2))
+
+	ds, _, err := m.ReadDirPage("a", "", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "a/bar", ds[0].(interface{ FullPath() string }).FullPath())
+
+	_, _, err = m.ReadDirPage("a", "%%", 2)
+	assert.ErrorIs(t, err, fs.ErrInvalid)
+	_, _, err = m.ReadDirPage("a", "", 0)
+	assert.ErrorIs(t, err, fs.ErrInvalid)
+	_, _, err = m.ReadDirPage("a/missing", "", 2)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestReadDirPageWrapped(t *testing.T) {
+	p := &pagedFS{MapFS: fstest.MapFS{
+		"a.txt": {Data: data["foo"]},
+		"b.log": {Data: data["foo"]},
+		"c.txt": {Data: data["foo"]},
+		"d.txt": {Data: data["foo"]},
+	}}
+	m, err := Mount("p", p, WithTimeout(time.Second), WithMaxConcurrent(2), WithCache(time.Minute), WithExclude("*.log"))
+	require.NoError(t, err)
+
+	assert.Equal(t, [][]string{{"a.txt"}, {"c.txt", "d.txt"}}, readPages(t, m, "p", 2))
+	assert.Equal(t, 2, p.calls)
+
+	_, _, err = m.ReadDirPage("p/b.log", "", 2)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.Equal(t, 2, p.calls)
+}
@@ -0,0 +1,83 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type slowFS struct {
+	fs.FS
+	delay   time.Duration
+	running *atomic.Int32
+	max     *atomic.Int32
+}
+
+func (s slowFS) Stat(name string) (fs.FileInfo, error) {
+	n := s.running.Add(1)
+	defer s.running.Add(-1)
+	for {
+		m := s.max.Load()
+		if n <= m || s.max.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	time.Sleep(s.delay)
+	return fs.Stat(s.FS, name)
+}
+
+func TestReadDirContext(t *testing.T) {
+	var running, max atomic.Int32
+	m := New(WithConcurrency(4))
+	for i := 0; i < 16; i++ {
+		f := slowFS{FS: fstest.MapFS{"foo": {Data: data["foo"]}}, delay: 20 * time.Millisecond, running: &running, max: &max}
+		require.NoError(t, m.Mount(fmt.Sprintf("m%02d", i), f, WithRootInfo()))
+	}
+	ds, err := m.ReadDirContext(context.Background(), ".")
+	require.NoError(t, err)
+	require.Len(t, ds, 16)
+	assert.Equal(t, "m00", ds[0].Name())
+	assert.Equal(t, int32(4), max.Load())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = m.ReadDirContext(ctx, ".")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestParallel(t *testing.T) {
+	var calls atomic.Int32
+	want := errors.New("boom")
+	err := parallel(context.Background(), 2, 100, func(i int) error {
+		calls.Add(1)
+		if i == 3 {
+			return want
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, want)
+	assert.Less(t, calls.Load(), int32(100))
+	assert.NoError(t, parallel(context.Background(), 2, 0, func(int) error { return nil }))
+}
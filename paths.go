@@ -0,0 +1,105 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// cleanPath normalizes the paths given to the MFS: both the slash and the
+// backslash are accepted as separators, the result using slashes whatever
+// the platform, as the mount table keys do.
+func cleanPath(name string) string {
+	return path.Clean(strings.ReplaceAll(name, `\`, "/"))
+}
+
+// checkPath rejects the cleaned names which cannot be resolved within the
+// MFS: the ones containing a NUL byte or escaping the root with "..".
+func checkPath(op, name string) error {
+	if strings.ContainsRune(name, 0) || name == ".." || strings.HasPrefix(name, "../") {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return nil
+}
+
+// WithStrictPaths hardens the path handling of the MFS. Instead of being
+// cleaned, the names which are not valid as defined by fs.ValidPath, once
+// stripped of a leading slash, are rejected with fs.ErrInvalid, e.g.
+// "dir//foo", "dir/./foo" or "dir/../foo". The mounted file systems are
+// confined, see Confine.
+func WithStrictPaths() Option {
+	return func(m *mfs) {
+		m.strict = true
+	}
+}
+
+// clean normalizes name with cleanPath, or rejects it if it is not strictly
+// valid in strict mode, before it is matched against the mount table.
+func (m *mfs) clean(op, name string) (string, error) {
+	if m.strict && name != "/" && !validName(strings.TrimPrefix(strings.ReplaceAll(name, `\`, "/"), "/")) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	name = m.normalize(cleanPath(name))
+	return name, checkPath(op, name)
+}
+
+// lookupPath cleans name and resolves it to its mount.
+func (m *mfs) lookupPath(op, name string) (*mount, string, error) {
+	name, err := m.clean(op, name)
+	if err != nil {
+		return nil, "", err
+	}
+	return m.lookup(m.load(), op, name)
+}
+
+// mountPath cleans and normalizes a mount point path.
+func (m *mfs) mountPath(path string) string {
+	return m.normalize(cleanMountPath(path))
+}
+
+// newMountOptions returns the options of a mount of m.
+func (m *mfs) newMountOptions(opts ...MountOption) *mountOptions {
+	o := newMountOptions(opts...)
+	o.confine, o.form = m.strict, m.form
+	return o
+}
+
+func validName(name string) bool {
+	return fs.ValidPath(name) && !strings.ContainsAny(name, "\\\x00")
+}
+
+// Confine returns a file system only passing to fsys the names valid as
+// defined by fs.ValidPath and free of backslashes and NUL bytes, failing
+// the others with fs.ErrInvalid. It keeps lenient backends, e.g. resolving
+// ".." themselves, from being used to escape their root. It does not guard
+// against the symbolic links the backend follows.
+func Confine(fsys fs.FS) fs.FS {
+	c := &confinedFS{}
+	c.forwardFS = forwardFS{fsys: fsys, route: c.check}
+	return c
+}
+
+type confinedFS struct {
+	forwardFS
+}
+
+func (c *confinedFS) check(op, name string) (fs.FS, string, error) {
+	if !validName(name) {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return c.fsys, name, nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleanPath(t *testing.T) {
+	tests := map[string]string{
+		"":            ".",
+		"/":           "/",
+		`\`:           "/",
+		"foo/bar/":    "foo/bar",
+		`foo\bar`:     "foo/bar",
+		`foo\bar\..\`: "foo",
+		`foo/.\bar`:   "foo/bar",
+	}
+	for in, want := range tests {
+		assert.Equal(t, want, cleanPath(in), in)
+	}
+}
+
+func TestBackslashPaths(t *testing.T) {
+	m, err := Mount(`data\static`, fstest.MapFS{"dir/foo": {Data: []byte("foo")}})
+	require.NoError(t, err)
+	require.NoError(t, m.Mount(`data\mem`, NewMemFS()))
+
+	b, err := fs.ReadFile(m, `data\static\dir\foo`)
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(b))
+	entries, err := m.ReadDir(`data\static\dir`)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "foo", entries[0].Name())
+
+	require.NoError(t, m.MkdirAll(`data\mem\dir`, 0755))
+	require.NoError(t, m.WriteFile(`data\mem\dir\bar`, []byte("bar"), 0644))
+	b, err = fs.ReadFile(m, "data/mem/dir/bar")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(b))
+
+	require.NoError(t, m.Unmount(`data\static`))
+	_, err = m.Open("data/static/dir/foo")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestPathValidation(t *testing.T) {
+	m, err := Mount("data", fstest.MapFS{"foo": {Data: []byte("foo")}})
+	require.NoError(t, err)
+	for _, v := range []string{"..", "../data/foo", "data/../../foo", "data/fo\x00o"} {
+		_, err := m.Open(v)
+		assert.ErrorIs(t, err, fs.ErrInvalid, v)
+	}
+	assert.ErrorIs(t, m.Mount("../other", NewMemFS()), fs.ErrInvalid)
+	// lenient names are cleaned
+	for _, v := range []string{"data//foo", "data/./foo", "other/../data/foo"} {
+		_, err := fs.Stat(m, v)
+		assert.NoError(t, err, v)
+	}
+}
+
+func TestStrictPaths(t *testing.T) {
+	m := New(WithStrictPaths())
+	require.NoError(t, m.Mount("data", fstest.MapFS{"dir/foo": {Data: []byte("foo")}}))
+	for _, v := range []string{"data//dir/foo", "data/./dir/foo", "data/x/../dir/foo", "data/dir/", "data/fo\x00o"} {
+		_, err := m.Open(v)
+		assert.ErrorIs(t, err, fs.ErrInvalid, v)
+	}
+	for _, v := range []string{"data/dir/foo", `data\dir\foo`, "/", "."} {
+		_, err := m.Open(v)
+		assert.NoError(t, err, v)
+	}
+	var walked []string
+	require.NoError(t, m.WalkDir("data", func(path string, d fs.DirEntry, err error) error {
+		walked = append(walked, path)
+		return err
+	}))
+	assert.Equal(t, []string{"data", "data/dir", "data/dir/foo"}, walked)
+}
+
+func TestConfine(t *testing.T) {
+	// a backend resolving ".." itself
+	lenient := lenientFS{fstest.MapFS{"secret": {Data: []byte("secret")}}}
+	_, err := lenient.Open("jail/../secret")
+	require.NoError(t, err)
+	c := Confine(lenient)
+	for _, v := range []string{"jail/../secret", "../secret", "/secret", `jail\..\secret`} {
+		_, err := c.Open(v)
+		assert.ErrorIs(t, err, fs.ErrInvalid, v)
+	}
+	_, err = fs.ReadFile(c, "secret")
+	assert.NoError(t, err)
+}
+
+type lenientFS struct {
+	fs fs.FS
+}
+
+func (l lenientFS) Open(name string) (fs.File, error) {
+	return l.fs.Open(cleanPath(name))
+}
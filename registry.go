@@ -0,0 +1,171 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Opener creates a file system from a URL whose scheme it was registered for.
+type Opener func(url string) (fs.FS, error)
+
+var (
+	openersMu sync.RWMutex
+	openers   = make(map[string]Opener)
+)
+
+func init() {
+	Register("file", openFile)
+	Register("zip", openArchive(FormatZip))
+	Register("tar", openArchive(FormatTar))
+	Register("http", openHTTP)
+	Register("https", openHTTP)
+}
+
+// Register makes a backend available to MountURL under the given scheme.
+// It panics if opener is nil or if the scheme is already registered.
+func Register(scheme string, opener func(url string) (fs.FS, error)) {
+	openersMu.Lock()
+	defer openersMu.Unlock()
+	if opener == nil {
+		panic("mfs: Register opener is nil")
+	}
+	scheme = strings.ToLower(scheme)
+	if _, dup := openers[scheme]; dup {
+		panic("mfs: Register called twice for scheme " + scheme)
+	}
+	openers[scheme] = opener
+}
+
+// Schemes returns the sorted list of registered schemes.
+func Schemes() []string {
+	openersMu.RLock()
+	defer openersMu.RUnlock()
+	var res []string
+	for k := range openers {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// OpenURL opens the file system described by rawURL using the opener
+// registered for its scheme.
+func OpenURL(rawURL string) (fs.FS, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	openersMu.RLock()
+	o, ok := openers[strings.ToLower(u.Scheme)]
+	openersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("mfs: unknown scheme %q (forgotten import?)", u.Scheme)
+	}
+	return o(rawURL)
+}
+
+func MountURL(path, url string, opts ...MountOption) (MFS, error) {
+	m := newMFS()
+	return m, m.MountURL(path, url, opts...)
+}
+
+func (m *mfs) MountURL(path, url string, opts ...MountOption) error {
+	f, err := OpenURL(url)
+	if err != nil {
+		return err
+	}
+	c, ok := f.(io.Closer)
+	if !ok {
+		return m.Mount(path, f, opts...)
+	}
+	if err := m.Mount(path, f, append(opts, withCloser(c))...); err != nil {
+		c.Close()
+		return err
+	}
+	return nil
+}
+
+// withCloser makes the mount close c once unmounted or replaced, and its
+// files drained, see WithDrainTimeout.
+func withCloser(c io.Closer) MountOption {
+	return func(o *mountOptions) {
+		o.closer = c
+	}
+}
+
+// localPath returns the file path of a file:// like URL, accepting both
+// absolute (file:///abs) and relative (file://rel) forms.
+func localPath(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	p := u.Host + u.Path
+	if u.Opaque != "" {
+		p = u.Opaque
+	}
+	if p == "" {
+		return "", fmt.Errorf("mfs: missing path in %q", rawURL)
+	}
+	return p, nil
+}
+
+func openFile(rawURL string) (fs.FS, error) {
+	p, err := localPath(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	s, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if !s.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: p, Err: fmt.Errorf("not a directory")}
+	}
+	return DirFS(p), nil
+}
+
+func openArchive(format Format) Opener {
+	return func(rawURL string) (fs.FS, error) {
+		p, err := localPath(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		s, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		a, err := OpenArchive(f, s.Size(), format)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		a.(*archiveFS).closer = f
+		return a, nil
+	}
+}
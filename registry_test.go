@@ -0,0 +1,95 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"archive/zip"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMountURL(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "foo"), data["foo"], 0644))
+
+	zp := filepath.Join(t.TempDir(), "archive.zip")
+	zf, err := os.Create(zp)
+	require.NoError(t, err)
+	zw := zip.NewWriter(zf)
+	w, err := zw.Create("baz")
+	require.NoError(t, err)
+	_, err = w.Write(data["baz"])
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	require.NoError(t, zf.Close())
+
+	var heads atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			heads.Add(1)
+		}
+		http.FileServer(http.Dir(dir)).ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	m, err := MountURL("file", "file://"+dir)
+	require.NoError(t, err)
+	require.NoError(t, m.MountURL("zip", "zip://"+zp))
+	require.NoError(t, m.MountURL("http", srv.URL))
+
+	for _, tt := range []struct {
+		path string
+		want []byte
+	}{
+		{"file/foo", data["foo"]},
+		{"zip/baz", data["baz"]},
+		{"http/foo", data["foo"]},
+	} {
+		b, err := fs.ReadFile(m, tt.path)
+		require.NoError(t, err, tt.path)
+		assert.Equal(t, tt.want, b, tt.path)
+	}
+
+	_, err = m.Open("http/nope")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	// the http files are stated without being downloaded
+	s, err := fs.Stat(m.(*mfs).load().mounts["http"].fs, "foo")
+	require.NoError(t, err)
+	assert.EqualValues(t, len(data["foo"]), s.Size())
+	assert.EqualValues(t, 1, heads.Load())
+
+	// the archive file is closed once unmounted
+	f := m.(*mfs).load().mounts["zip"].fs.(*archiveFS).closer.(*os.File)
+	require.NoError(t, m.Unmount("zip"))
+	assert.Eventually(t, func() bool {
+		_, err := f.Stat()
+		return errors.Is(err, os.ErrClosed)
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Error(t, m.MountURL("nope", "nope://whatever"))
+	assert.Panics(t, func() { Register("file", openFile) })
+	assert.Contains(t, Schemes(), "https")
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io/fs"
+	"time"
+)
+
+// ErrCrossMount is returned by Rename when the paths belong to different
+// mounts and the MFS was not created with WithCrossMountRename.
+var ErrCrossMount = errors.New("cross-mount rename")
+
+// WithCrossMountRename makes Rename copy the entries across mounts before
+// removing them from their source, see Copy. Such renames are not atomic:
+// the copied entries are left in place when the copy fails.
+func WithCrossMountRename() Option {
+	return func(m *mfs) {
+		m.crossMountRename = true
+	}
+}
+
+func (m *mfs) Rename(oldpath, newpath string) (err error) {
+	defer m.record("rename", oldpath, time.Now(), &err)
+	defer m.invalidate(oldpath)
+	defer m.invalidate(newpath)
+	src, oldrel, err := m.writeTarget("rename", oldpath)
+	if err != nil {
+		return err
+	}
+	dst, newrel, err := m.writeTarget("rename", newpath)
+	if err != nil {
+		return err
+	}
+	if oldrel == "." || newrel == "." {
+		return &fs.PathError{Op: "rename", Path: oldpath, Err: fs.ErrPermission}
+	}
+	if src != dst {
+		if !m.crossMountRename {
+			return &fs.PathError{Op: "rename", Path: oldpath, Err: ErrCrossMount}
+		}
+		if err := Copy(m, oldpath, newpath); err != nil {
+			return err
+		}
+		return m.RemoveAll(oldpath)
+	}
+	w, ok := src.writable.(RenameFS)
+	if !ok {
+		return unsupported("rename", oldpath)
+	}
+	return src.wrapErr("rename", oldpath, oldrel, m.labeled(src, "rename", func() error {
+		return w.Rename(oldrel, newrel)
+	}))
+}
@@ -0,0 +1,62 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRename(t *testing.T) {
+	for _, cross := range []bool{false, true} {
+		var opts []Option
+		if cross {
+			opts = append(opts, WithCrossMountRename())
+		}
+		m := New(opts...)
+		require.NoError(t, m.Mount("a", NewMemFS()))
+		require.NoError(t, m.Mount("b", NewMemFS()))
+		require.NoError(t, m.Mount("static", fstest.MapFS{"foo": {}}))
+		require.NoError(t, m.MkdirAll("a/dir", 0755))
+		require.NoError(t, m.WriteFile("a/dir/foo", []byte("foo"), 0644))
+
+		require.NoError(t, m.Rename("a/dir/foo", "a/dir/bar"))
+		_, err := fs.Stat(m, "a/dir/foo")
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+		b, err := fs.ReadFile(m, "a/dir/bar")
+		require.NoError(t, err)
+		assert.Equal(t, "foo", string(b))
+
+		assert.ErrorIs(t, m.Rename("a", "b/a"), fs.ErrPermission)
+		assert.ErrorIs(t, m.Rename("static/foo", "static/bar"), errors.ErrUnsupported)
+
+		err = m.Rename("a/dir", "b/dir")
+		if !cross {
+			assert.ErrorIs(t, err, ErrCrossMount)
+			continue
+		}
+		require.NoError(t, err)
+		_, err = fs.Stat(m, "a/dir")
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+		b, err = fs.ReadFile(m, "b/dir/bar")
+		require.NoError(t, err)
+		assert.Equal(t, "foo", string(b))
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"container/list"
+	"io/fs"
+	"strings"
+	"sync"
+)
+
+const defaultMaxResolved = 64
+
+// ResolveFunc returns the file system serving the paths whose first
+// segment, relative to the mount point, is segment.
+type ResolveFunc func(segment string) (fs.FS, error)
+
+// WithMaxResolved bounds the number of file systems retained by a mount
+// created with MountResolver, the least recently used being dropped and
+// resolved again on their next access. It defaults to 64.
+func WithMaxResolved(n int) MountOption {
+	return func(o *mountOptions) {
+		o.maxResolved = n
+	}
+}
+
+func (m *mfs) MountResolver(prefix string, resolve ResolveFunc, opts ...MountOption) error {
+	o := newMountOptions(opts...)
+	return m.Mount(prefix, Resolver(resolve, o.maxResolved), opts...)
+}
+
+// Resolver returns a file system lazily resolving the file system serving
+// each of its top level directories with resolve, e.g. the backend of a
+// tenant for "<id>/...". The resolved file systems are retained, up to max
+// of them, the least recently used being dropped beyond, 64 when max is not
+// positive. The errors returned by resolve are not retained.
+//
+// The root directory lists nothing as the segments are not known upfront.
+// Renaming across top level directories fails with ErrCrossMount.
+func Resolver(resolve ResolveFunc, max int) fs.FS {
+	if max <= 0 {
+		max = defaultMaxResolved
+	}
+	r := &resolverFS{resolve: resolve, max: max, entries: make(map[string]*list.Element), lru: list.New()}
+	r.forwardFS = forwardFS{route: r.route, readDir: r.ReadDir}
+	return r
+}
+
+type resolution struct {
+	segment string
+	ready   chan struct{}
+	fsys    fs.FS
+	err     error
+}
+
+type resolverFS struct {
+	forwardFS
+	resolve ResolveFunc
+	max     int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+// get returns the file system of segment, resolving it once for the
+// concurrent callers.
+func (r *resolverFS) get(segment string) (fs.FS, error) {
+	r.mu.Lock()
+	if e, ok := r.entries[segment]; ok {
+		r.lru.MoveToFront(e)
+		v := e.Value.(*resolution)
+		r.mu.Unlock()
+		<-v.ready
+		return v.fsys, v.err
+	}
+	v := &resolution{segment: segment, ready: make(chan struct{})}
+	r.entries[segment] = r.lru.PushFront(v)
+	for r.lru.Len() > r.max {
+		e := r.lru.Back()
+		r.lru.Remove(e)
+		delete(r.entries, e.Value.(*resolution).segment)
+	}
+	r.mu.Unlock()
+	v.fsys, v.err = r.resolve(segment)
+	if v.err != nil {
+		r.mu.Lock()
+		if e, ok := r.entries[segment]; ok && e.Value == v {
+			r.lru.Remove(e)
+			delete(r.entries, segment)
+		}
+		r.mu.Unlock()
+	}
+	close(v.ready)
+	return v.fsys, v.err
+}
+
+// split resolves the file system of name, returning the path relative to
+// it.
+func (r *resolverFS) split(op, name string) (fs.FS, string, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	segment, rel, ok := strings.Cut(name, "/")
+	if !ok {
+		rel = "."
+	}
+	fsys, err := r.get(segment)
+	if err != nil {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return fsys, rel, nil
+}
+
+// route forwards the operations to the file system of name, the top level
+// directories not being removable.
+func (r *resolverFS) route(op, name string) (fs.FS, string, error) {
+	fsys, rel, err := r.split(op, name)
+	if err != nil {
+		return nil, "", err
+	}
+	if rel == "." && (op == "remove" || op == "removeall") {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrPermission}
+	}
+	return fsys, rel, nil
+}
+
+func (r *resolverFS) Open(name string) (fs.File, error) {
+	if name == "." {
+		return &fakeDir{path: name}, nil
+	}
+	fsys, rel, err := r.split("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return fsys.Open(rel)
+}
+
+func (r *resolverFS) Stat(name string) (fs.FileInfo, error) {
+	if name == "." {
+		return &fakeDir{path: name}, nil
+	}
+	fsys, rel, err := r.split("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	i, err := fs.Stat(fsys, rel)
+	if err != nil || rel != "." {
+		return i, err
+	}
+	return &sizedInfo{FileInfo: i, name: name, size: i.Size()}, nil
+}
+
+func (r *resolverFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name == "." {
+		return nil, nil
+	}
+	fsys, rel, err := r.split("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadDir(fsys, rel)
+}
+
+func (r *resolverFS) Rename(oldname, newname string) error {
+	fsys, oldrel, err := r.split("rename", oldname)
+	if err != nil {
+		return err
+	}
+	if segment, _, _ := strings.Cut(oldname, "/"); !strings.HasPrefix(newname, segment+"/") {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: ErrCrossMount}
+	}
+	_, newrel, err := r.split("rename", newname)
+	if err != nil {
+		return err
+	}
+	w, ok := fsys.(RenameFS)
+	if !ok {
+		return unsupported("rename", oldname)
+	}
+	return w.Rename(oldrel, newrel)
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"io/fs"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMountResolver(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		tenants = map[string]*MemFS{"a": NewMemFS(), "b": NewMemFS(), "c": NewMemFS()}
+		calls   = make(map[string]int)
+	)
+	resolve := func(id string) (fs.FS, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[id]++
+		if v, ok := tenants[id]; ok {
+			return v, nil
+		}
+		return nil, fs.ErrNotExist
+	}
+	m, err := Mount("static", NewMemFS())
+	require.NoError(t, err)
+	require.NoError(t, m.MountResolver("tenants", resolve, WithMaxResolved(1)))
+
+	require.NoError(t, m.WriteFile("tenants/a/foo", data["foo"], 0644))
+	b, err := fs.ReadFile(m, "tenants/a/foo")
+	require.NoError(t, err)
+	assert.Equal(t, data["foo"], b)
+	b, err = tenants["a"].ReadFile("foo")
+	require.NoError(t, err)
+	assert.Equal(t, data["foo"], b)
+	assert.Equal(t, 1, calls["a"])
+
+	i, err := fs.Stat(m, "tenants/a")
+	require.NoError(t, err)
+	assert.True(t, i.IsDir())
+	assert.Equal(t, "a", i.Name())
+	ds, err := m.ReadDir("tenants/a")
+	require.NoError(t, err)
+	require.Len(t, ds, 1)
+	assert.Equal(t, "foo", ds[0].Name())
+	ds, err = m.ReadDir("tenants")
+	require.NoError(t, err)
+	assert.Empty(t, ds)
+
+	// b evicts a, resolved again on its next access
+	_, err = fs.Stat(m, "tenants/b")
+	require.NoError(t, err)
+	_, err = fs.Stat(m, "tenants/a/foo")
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls["a"])
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := fs.Stat(m, "tenants/c")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, calls["c"])
+
+	_, err = fs.Stat(m, "tenants/missing/foo")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = fs.Stat(m, "tenants/missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.Equal(t, 2, calls["missing"], "the errors are not retained")
+
+	assert.ErrorIs(t, m.Rename("tenants/c/foo", "tenants/a/foo"), ErrCrossMount)
+	require.NoError(t, m.WriteFile("tenants/c/foo", data["foo"], 0644))
+	require.NoError(t, m.Rename("tenants/c/foo", "tenants/c/bar"))
+	assert.ErrorIs(t, m.Remove("tenants/c"), fs.ErrPermission)
+}
@@ -0,0 +1,152 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy configures the retries of the reads of a mount, see Retry.
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts, 3 when zero.
+	Attempts int
+	// Backoff is the delay before the first retry, 100ms when zero. It
+	// doubles after each retry, up to MaxBackoff.
+	Backoff time.Duration
+	// MaxBackoff bounds the delay between two attempts, 5s when zero.
+	MaxBackoff time.Duration
+	// Retryable reports whether an operation failing with err is retried,
+	// IsRetryable when nil.
+	Retryable func(err error) bool
+	// Context, when not nil, stops the retries once done, e.g. when the
+	// server exposing the MFS shuts down.
+	Context context.Context
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.Attempts <= 0 {
+		p.Attempts = 3
+	}
+	if p.Backoff <= 0 {
+		p.Backoff = 100 * time.Millisecond
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = 5 * time.Second
+	}
+	if p.Retryable == nil {
+		p.Retryable = IsRetryable
+	}
+	if p.Context == nil {
+		p.Context = context.Background()
+	}
+	return p
+}
+
+// WithRetry retries the failed reads of the mounted file system according
+// to p, see Retry.
+func WithRetry(p RetryPolicy) MountOption {
+	return func(o *mountOptions) {
+		o.retry = &p
+	}
+}
+
+// IsRetryable reports whether err is a transient error worth retrying: a
+// reset, refused or aborted connection, a network timeout, an unexpected
+// EOF or an HTTP error whose status is 429 or 5xx. The errors implementing
+// HTTPStatusCode() int, e.g. the ones of the S3 client, report their status
+// this way. The context errors are not retryable.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	for _, v := range []error{syscall.ECONNRESET, syscall.ECONNREFUSED, syscall.ECONNABORTED, syscall.EPIPE, io.ErrUnexpectedEOF} {
+		if errors.Is(err, v) {
+			return true
+		}
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	var he interface{ HTTPStatusCode() int }
+	if errors.As(err, &he) {
+		c := he.HTTPStatusCode()
+		return c == 429 || c >= 500 && c < 600
+	}
+	return false
+}
+
+// Retry returns a file system retrying the idempotent reads of fsys failing
+// with a retryable error: opening, listing and stating files. The reads of
+// the opened files are not retried as they may have consumed part of the
+// content. The write operations are forwarded as is.
+func Retry(fsys fs.FS, p RetryPolicy) fs.FS {
+	return &retryFS{forwardFS: forwardFS{fsys: fsys}, p: p.withDefaults()}
+}
+
+type retryFS struct {
+	forwardFS
+	p RetryPolicy
+}
+
+// retried runs fn until it succeeds, fails with an error which is not
+// retryable or the attempts are exhausted.
+func retried[T any](p RetryPolicy, fn func() (T, error)) (T, error) {
+	d := p.Backoff
+	for i := 1; ; i++ {
+		v, err := fn()
+		if err == nil || i >= p.Attempts || !p.Retryable(err) {
+			return v, err
+		}
+		t := time.NewTimer(d)
+		select {
+		case <-p.Context.Done():
+			t.Stop()
+			return v, err
+		case <-t.C:
+		}
+		d = min(2*d, p.MaxBackoff)
+	}
+}
+
+func (r *retryFS) Open(name string) (fs.File, error) {
+	return retried(r.p, func() (fs.File, error) {
+		return r.fsys.Open(name)
+	})
+}
+
+func (r *retryFS) Stat(name string) (fs.FileInfo, error) {
+	return retried(r.p, func() (fs.FileInfo, error) {
+		return fs.Stat(r.fsys, name)
+	})
+}
+
+func (r *retryFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return retried(r.p, func() ([]fs.DirEntry, error) {
+		return fs.ReadDir(r.fsys, name)
+	})
+}
+
+func (r *retryFS) ReadDirPage(name, token string, n int) ([]fs.DirEntry, string, error) {
+	return readDirPage(r.fsys, name, token, n, func(fn func() (page, error)) (page, error) {
+		return retried(r.p, fn)
+	})
+}
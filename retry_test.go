@@ -0,0 +1,120 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingFS fails the first fails opens with err.
+type failingFS struct {
+	fs.FS
+	err   error
+	fails int32
+	calls atomic.Int32
+}
+
+func (f *failingFS) Open(name string) (fs.File, error) {
+	if f.calls.Add(1) <= f.fails {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: f.err}
+	}
+	return f.FS.Open(name)
+}
+
+func TestRetry(t *testing.T) {
+	src := fstest.MapFS{"foo": {Data: data["foo"]}}
+	p := RetryPolicy{Backoff: time.Millisecond}
+
+	f := &failingFS{FS: src, err: syscall.ECONNRESET, fails: 2}
+	m, err := Mount("remote", f, WithRetry(p))
+	require.NoError(t, err)
+	b, err := fs.ReadFile(m, "remote/foo")
+	require.NoError(t, err)
+	assert.Equal(t, data["foo"], b)
+	assert.EqualValues(t, 3, f.calls.Load())
+
+	f = &failingFS{FS: src, err: syscall.ECONNRESET, fails: 5}
+	_, err = fs.ReadFile(Retry(f, p), "foo")
+	assert.ErrorIs(t, err, syscall.ECONNRESET)
+	assert.EqualValues(t, 3, f.calls.Load())
+
+	f = &failingFS{FS: src, err: errors.New("boom"), fails: 5}
+	_, err = fs.ReadFile(Retry(f, p), "foo")
+	assert.Error(t, err)
+	assert.EqualValues(t, 1, f.calls.Load())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	f = &failingFS{FS: src, err: syscall.ECONNRESET, fails: 5}
+	_, err = fs.ReadFile(Retry(f, RetryPolicy{Backoff: time.Hour, Context: ctx}), "foo")
+	assert.ErrorIs(t, err, syscall.ECONNRESET)
+	assert.EqualValues(t, 1, f.calls.Load())
+
+	_, ok := As[RenameFS](Retry(NewMemFS(), p))
+	assert.True(t, ok)
+}
+
+func TestRetryHTTP(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "foo")
+	}))
+	defer srv.Close()
+	h, err := HTTPFS(srv.URL, srv.Client())
+	require.NoError(t, err)
+	b, err := fs.ReadFile(Retry(h, RetryPolicy{Backoff: time.Millisecond}), "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(b))
+	assert.EqualValues(t, 3, calls.Load())
+}
+
+func TestIsRetryable(t *testing.T) {
+	for _, v := range []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("boom"), false},
+		{fs.ErrNotExist, false},
+		{context.Canceled, false},
+		{fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{io.ErrUnexpectedEOF, true},
+		{os.ErrDeadlineExceeded, true},
+		{&httpStatusError{code: 503, status: "503 Service Unavailable"}, true},
+		{&httpStatusError{code: 429, status: "429 Too Many Requests"}, true},
+		{&httpStatusError{code: 400, status: "400 Bad Request"}, false},
+	} {
+		assert.Equal(t, v.want, IsRetryable(v.err), "%v", v.err)
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package s3fs provides a file system over an S3 compatible object store
+// bucket. Directories are synthesized from the "/" separated object keys.
+package s3fs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+
+	"go.linka.cloud/mfs/internal/objfs"
+)
+
+// Client is the subset of the *s3.Client API used by the file system.
+type Client interface {
+	s3.ListObjectsV2APIClient
+	s3.HeadObjectAPIClient
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+}
+
+var (
+	_ Client           = (*s3.Client)(nil)
+	_ objfs.TokenStore = (*store)(nil)
+	_ objfs.PagedStore = (*store)(nil)
+	_ objfs.BatchStore = (*store)(nil)
+)
+
+// Option configures the file system.
+type Option func(o *options)
+
+type options struct {
+	prefix   string
+	writable bool
+	ctx      context.Context
+}
+
+// WithPrefix exposes only the objects under prefix.
+func WithPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+// WithWrites makes the file system writable: WriteFile puts objects and
+// Remove and RemoveAll delete them.
+func WithWrites() Option {
+	return func(o *options) {
+		o.writable = true
+	}
+}
+
+// WithContext sets the context used for the requests. It defaults to
+// context.Background.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// New returns a file system over the objects of bucket.
+func New(client Client, bucket string, opts ...Option) fs.FS {
+	o := &options{ctx: context.Background()}
+	for _, v := range opts {
+		v(o)
+	}
+	s := &store{c: client, bucket: bucket}
+	if o.writable {
+		return objfs.NewWritable(o.ctx, s, o.prefix)
+	}
+	return objfs.New(o.ctx, s, o.prefix)
+}
+
+type store struct {
+	c      Client
+	bucket string
+}
+
+func (s *store) List(ctx context.Context, prefix string) ([]objfs.Object, []string, error) {
+	return objfs.Collect(s.ListPages(ctx, prefix))
+}
+
+func (s *store) ListPages(ctx context.Context, prefix string) iter.Seq2[objfs.Page, error] {
+	return func(yield func(objfs.Page, error) bool) {
+		p := s3.NewListObjectsV2Paginator(s.c, &s3.ListObjectsV2Input{
+			Bucket:    aws.String(s.bucket),
+			Prefix:    aws.String(prefix),
+			Delimiter: aws.String("/"),
+		})
+		for p.HasMorePages() {
+			res, err := p.NextPage(ctx)
+			if err != nil {
+				yield(objfs.Page{}, mapErr(err))
+				return
+			}
+			if !yield(page(res), nil) {
+				return
+			}
+		}
+	}
+}
+
+func (s *store) ListPage(ctx context.Context, prefix, token string, n int) (objfs.Page, string, error) {
+	in := &s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+		MaxKeys:   aws.Int32(int32(n)),
+	}
+	if token != "" {
+		in.ContinuationToken = aws.String(token)
+	}
+	res, err := s.c.ListObjectsV2(ctx, in)
+	if err != nil {
+		return objfs.Page{}, "", mapErr(err)
+	}
+	if !aws.ToBool(res.IsTruncated) {
+		return page(res), "", nil
+	}
+	return page(res), aws.ToString(res.NextContinuationToken), nil
+}
+
+func page(res *s3.ListObjectsV2Output) objfs.Page {
+	var p objfs.Page
+	for _, v := range res.CommonPrefixes {
+		p.Prefixes = append(p.Prefixes, aws.ToString(v.Prefix))
+	}
+	for _, v := range res.Contents {
+		p.Objects = append(p.Objects, objfs.Object{Key: aws.ToString(v.Key), Size: aws.ToInt64(v.Size), ModTime: aws.ToTime(v.LastModified)})
+	}
+	return p
+}
+
+func (s *store) Stat(ctx context.Context, key string) (objfs.Object, error) {
+	res, err := s.c.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+	if err != nil {
+		return objfs.Object{}, mapErr(err)
+	}
+	return objfs.Object{Key: key, Size: aws.ToInt64(res.ContentLength), ModTime: aws.ToTime(res.LastModified)}, nil
+}
+
+func (s *store) Get(ctx context.Context, key, version string, off, n int64) (io.ReadCloser, objfs.Object, error) {
+	in := &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)}
+	if version != "" {
+		in.VersionId = aws.String(version)
+	}
+	switch {
+	case n >= 0:
+		in.Range = aws.String(fmt.Sprintf("bytes=%d-%d", off, off+n-1))
+	case off > 0:
+		in.Range = aws.String(fmt.Sprintf("bytes=%d-", off))
+	}
+	res, err := s.c.GetObject(ctx, in)
+	if err != nil {
+		return nil, objfs.Object{}, mapErr(err)
+	}
+	// the object size is only known for complete reads, ranged reads
+	// are done on already stated files
+	return res.Body, objfs.Object{
+		Key:     key,
+		Size:    aws.ToInt64(res.ContentLength),
+		ModTime: aws.ToTime(res.LastModified),
+		Version: aws.ToString(res.VersionId),
+	}, nil
+}
+
+func (s *store) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	_, err := s.c.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		Body:          r,
+		ContentLength: aws.Int64(size),
+	})
+	return mapErr(err)
+}
+
+func (s *store) Delete(ctx context.Context, key string) error {
+	_, err := s.c.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+	return mapErr(err)
+}
+
+// maxDeleteBatch is the maximum number of keys deleted per DeleteObjects
+// request.
+const maxDeleteBatch = 1000
+
+func (s *store) DeleteBatch(ctx context.Context, keys []string) error {
+	for len(keys) > 0 {
+		n := min(len(keys), maxDeleteBatch)
+		ids := make([]types.ObjectIdentifier, n)
+		for i, v := range keys[:n] {
+			ids[i] = types.ObjectIdentifier{Key: aws.String(v)}
+		}
+		res, err := s.c.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(s.bucket),
+			Delete: &types.Delete{Objects: ids, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return mapErr(err)
+		}
+		// the missing keys are not reported as errors
+		if len(res.Errors) != 0 {
+			e := res.Errors[0]
+			return fmt.Errorf("%s: %w", aws.ToString(e.Key), mapErr(&smithy.GenericAPIError{Code: aws.ToString(e.Code), Message: aws.ToString(e.Message)}))
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
+
+// mapErr maps the S3 API errors to their fs equivalent.
+func mapErr(err error) error {
+	var ae smithy.APIError
+	if err == nil || !errors.As(err, &ae) {
+		return err
+	}
+	switch ae.ErrorCode() {
+	case "NoSuchKey", "NotFound":
+		return fmt.Errorf("%w: %v", fs.ErrNotExist, err)
+	case "AccessDenied", "Forbidden":
+		return fmt.Errorf("%w: %v", fs.ErrPermission, err)
+	default:
+		return err
+	}
+}
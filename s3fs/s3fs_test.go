@@ -0,0 +1,185 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3fs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.linka.cloud/mfs"
+)
+
+// fakeClient is an in-memory bucket returning listings by pages of two keys.
+type fakeClient struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	pages   int
+	batches int
+}
+
+func (c *fakeClient) ListObjectsV2(_ context.Context, in *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pages++
+	prefix, delim := aws.ToString(in.Prefix), aws.ToString(in.Delimiter)
+	var keys []string
+	seen := make(map[string]bool)
+	for k := range c.objects {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if i := strings.Index(k[len(prefix):], delim); delim != "" && i >= 0 {
+			k = k[:len(prefix)+i+1]
+		}
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	start, _ := strconv.Atoi(aws.ToString(in.ContinuationToken))
+	end := min(start+2, len(keys))
+	out := &s3.ListObjectsV2Output{IsTruncated: aws.Bool(end < len(keys))}
+	if end < len(keys) {
+		out.NextContinuationToken = aws.String(strconv.Itoa(end))
+	}
+	for _, k := range keys[start:end] {
+		if strings.HasSuffix(k, delim) && delim != "" {
+			out.CommonPrefixes = append(out.CommonPrefixes, types.CommonPrefix{Prefix: aws.String(k)})
+			continue
+		}
+		out.Contents = append(out.Contents, types.Object{Key: aws.String(k), Size: aws.Int64(int64(len(c.objects[k]))), LastModified: aws.Time(time.Unix(0, 0))})
+	}
+	return out, nil
+}
+
+func (c *fakeClient) HeadObject(_ context.Context, in *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.objects[aws.ToString(in.Key)]
+	if !ok {
+		return nil, &types.NotFound{}
+	}
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(int64(len(b))), LastModified: aws.Time(time.Unix(0, 0))}, nil
+}
+
+func (c *fakeClient) GetObject(_ context.Context, in *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.objects[aws.ToString(in.Key)]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	if r := aws.ToString(in.Range); r != "" {
+		var start, end int
+		if _, err := fmt.Sscanf(r, "bytes=%d-%d", &start, &end); err != nil {
+			end = len(b) - 1
+		}
+		b = b[min(start, len(b)):min(end+1, len(b))]
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(b)), ContentLength: aws.Int64(int64(len(b))), LastModified: aws.Time(time.Unix(0, 0))}, nil
+}
+
+func (c *fakeClient) PutObject(_ context.Context, in *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	b, err := io.ReadAll(in.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.objects[aws.ToString(in.Key)] = b
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (c *fakeClient) DeleteObject(_ context.Context, in *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.objects, aws.ToString(in.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (c *fakeClient) DeleteObjects(_ context.Context, in *s3.DeleteObjectsInput, _ ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.batches++
+	for _, v := range in.Delete.Objects {
+		delete(c.objects, aws.ToString(v.Key))
+	}
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
+func TestS3FS(t *testing.T) {
+	c := &fakeClient{objects: map[string][]byte{
+		"site/index.html":   []byte("index"),
+		"site/a":            []byte("a"),
+		"site/b":            []byte("b"),
+		"site/css/main.css": []byte("body{}"),
+		"other/file":        []byte("other"),
+	}}
+	f := New(c, "bucket", WithPrefix("site"))
+	require.NoError(t, fstest.TestFS(f, "index.html", "a", "b", "css/main.css"))
+	_, ok := f.(mfs.WriteFileFS)
+	assert.False(t, ok)
+
+	c.pages = 0
+	ds, err := fs.ReadDir(f, ".")
+	require.NoError(t, err)
+	assert.Len(t, ds, 4)
+	assert.Equal(t, 2, c.pages)
+
+	m, err := mfs.Mount("s3", f)
+	require.NoError(t, err)
+	c.pages = 0
+	for d, err := range m.ReadDirIter("s3") {
+		require.NoError(t, err)
+		assert.Equal(t, "s3/a", d.(mfs.FullPather).FullPath())
+		break
+	}
+	assert.Equal(t, 1, c.pages)
+
+	_, err = f.Open("missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestS3FSWrites(t *testing.T) {
+	c := &fakeClient{objects: map[string][]byte{}}
+	m, err := mfs.Mount("s3", New(c, "bucket", WithPrefix("data"), WithWrites()))
+	require.NoError(t, err)
+	require.NoError(t, m.WriteFile("s3/dir/foo", []byte("foo"), 0644))
+	assert.Equal(t, []byte("foo"), c.objects["data/dir/foo"])
+	b, err := fs.ReadFile(m, "s3/dir/foo")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("foo"), b)
+	require.NoError(t, m.WriteFile("s3/dir/bar", []byte("bar"), 0644))
+	require.NoError(t, m.RemoveAll("s3/dir"))
+	assert.Empty(t, c.objects)
+	assert.Equal(t, 1, c.batches)
+}
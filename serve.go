@@ -0,0 +1,164 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OSFile returns the *os.File backing f, unwrapping the files returned by
+// an MFS, including nested ones. Files whose content is rewritten, e.g. by
+// Transform or Verify, are never unwrapped.
+func OSFile(f fs.File) (*os.File, bool) {
+	for {
+		switch v := f.(type) {
+		case *os.File:
+			return v, true
+		case interface{ Unwrap() fs.File }:
+			f = v.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// ServeFile replies to the request with the content of the regular file name
+// of fsys, picking the most efficient way available: the backend *os.File
+// when there is one, letting the kernel copy the data (sendfile), the file
+// itself when it implements io.Seeker, or a buffered copy without range
+// support otherwise.
+func ServeFile(w http.ResponseWriter, r *http.Request, fsys fs.FS, name string) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	defer f.Close()
+	i, err := f.Stat()
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	if !i.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	setContentType(w, fsys, name)
+	serveFile(w, r, f, i)
+}
+
+func serveFile(w http.ResponseWriter, r *http.Request, f fs.File, i fs.FileInfo) {
+	if o, ok := OSFile(f); ok {
+		http.ServeContent(w, r, i.Name(), i.ModTime(), o)
+		return
+	}
+	if s, ok := f.(io.ReadSeeker); ok && seekable(s) {
+		http.ServeContent(w, r, i.Name(), i.ModTime(), s)
+		return
+	}
+	serveBuffered(w, r, f, i)
+}
+
+// seekable reports whether Seek is supported, as the MFS files always
+// implement it.
+func seekable(s io.Seeker) bool {
+	_, err := s.Seek(0, io.SeekCurrent)
+	return err == nil
+}
+
+func serveBuffered(w http.ResponseWriter, r *http.Request, f fs.File, i fs.FileInfo) {
+	if notModified(w, r, i) {
+		return
+	}
+	br := bufio.NewReader(f)
+	h := w.Header()
+	if h.Get("Content-Type") == "" {
+		ct := mime.TypeByExtension(path.Ext(i.Name()))
+		if ct == "" {
+			b, _ := br.Peek(512)
+			ct = http.DetectContentType(b)
+		}
+		h.Set("Content-Type", ct)
+	}
+	if !i.ModTime().IsZero() {
+		h.Set("Last-Modified", i.ModTime().UTC().Format(http.TimeFormat))
+	}
+	if i.Size() >= 0 {
+		h.Set("Content-Length", strconv.FormatInt(i.Size(), 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		io.Copy(w, br)
+	}
+}
+
+// notModified replies with 304 Not Modified when the If-None-Match or
+// If-Modified-Since conditions of the request match, as http.ServeContent
+// does.
+func notModified(w http.ResponseWriter, r *http.Request, i fs.FileInfo) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := w.Header().Get("Etag")
+		if etag == "" || !etagMatch(inm, etag) {
+			return false
+		}
+	} else {
+		ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+		if err != nil || i.ModTime().IsZero() || i.ModTime().Truncate(time.Second).After(ims) {
+			return false
+		}
+	}
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatch reports whether the If-None-Match header value matches etag,
+// using the weak comparison.
+func etagMatch(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func httpError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.Error(w, "404 page not found", http.StatusNotFound)
+	case errors.Is(err, fs.ErrPermission):
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+	default:
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeFile(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("0123456789")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "foo.txt"), content, 0644))
+	m, err := Mount("os", os.DirFS(dir))
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("map", fstest.MapFS{"foo.txt": {Data: content}}))
+	identity := func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+	require.NoError(t, m.Mount("stream", fstest.MapFS{"foo.txt": {Data: content}}, WithTransform(identity)))
+	n, err := Mount("nested", m)
+	require.NoError(t, err)
+
+	f, err := n.Open("nested/os/foo.txt")
+	require.NoError(t, err)
+	_, ok := OSFile(f)
+	assert.True(t, ok)
+	require.NoError(t, f.Close())
+	f, err = n.Open("nested/stream/foo.txt")
+	require.NoError(t, err)
+	_, ok = OSFile(f)
+	assert.False(t, ok)
+	require.NoError(t, f.Close())
+
+	get := func(name, rng string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, "/"+name, nil)
+		if rng != "" {
+			req.Header.Set("Range", rng)
+		}
+		w := httptest.NewRecorder()
+		ServeFile(w, req, n, name)
+		return w.Result()
+	}
+	for _, v := range []string{"os", "map"} {
+		res := get("nested/"+v+"/foo.txt", "bytes=2-5")
+		assert.Equal(t, http.StatusPartialContent, res.StatusCode, v)
+		b, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "2345", string(b), v)
+	}
+
+	res := get("nested/stream/foo.txt", "bytes=2-5")
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/plain; charset=utf-8", res.Header.Get("Content-Type"))
+	b, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, content, b)
+
+	assert.Equal(t, http.StatusNotFound, get("nested/os/missing", "").StatusCode)
+	assert.Equal(t, http.StatusNotFound, get("nested/os", "").StatusCode)
+}
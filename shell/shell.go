@@ -0,0 +1,420 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package shell provides an interactive shell browsing and managing an MFS,
+// meant to be embedded by command line tools, e.g. cmd/mfsctl. A remote MFS
+// served over gRPC is browsed by mounting its client at the root of a local
+// one:
+//
+//	m := mfs.New()
+//	m.Mount("/", grpc.New(conn))
+//	shell.New(m).Run(term)
+//
+// The paths given to the commands are relative to the current directory
+// unless they start with a slash. The arguments are separated by spaces,
+// without quoting.
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/term"
+
+	"go.linka.cloud/mfs"
+)
+
+// Shell runs commands against an MFS from a current directory.
+type Shell struct {
+	m   mfs.MFS
+	cwd string
+}
+
+type command struct {
+	usage string
+	help  string
+	run   func(s *Shell, w io.Writer, args []string) error
+	// paths reports whether the arguments are completed as paths
+	paths bool
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"cd":     {usage: "cd [dir]", help: "change the current directory, the root by default", run: (*Shell).cd, paths: true},
+		"pwd":    {usage: "pwd", help: "print the current directory", run: (*Shell).pwd},
+		"ls":     {usage: "ls [-l] [path...]", help: "list directories", run: (*Shell).ls, paths: true},
+		"cat":    {usage: "cat path...", help: "print files", run: (*Shell).cat, paths: true},
+		"stat":   {usage: "stat path...", help: "describe files", run: (*Shell).stat, paths: true},
+		"find":   {usage: "find [dir] [pattern]", help: "find the entries whose name matches pattern", run: (*Shell).find, paths: true},
+		"cp":     {usage: "cp src dst", help: "copy a file or a directory tree", run: (*Shell).cp, paths: true},
+		"mount":  {usage: "mount path url", help: "mount the file system opened from url, see mfs.OpenURL", run: (*Shell).mount, paths: true},
+		"umount": {usage: "umount path", help: "unmount a file system", run: (*Shell).umount, paths: true},
+		"help":   {usage: "help", help: "list the commands", run: (*Shell).help},
+		"exit":   {usage: "exit", help: "leave the shell"},
+	}
+}
+
+// ErrExit is returned by Exec for the exit command.
+var ErrExit = errors.New("exit")
+
+// New returns a shell over m whose current directory is the root.
+func New(m mfs.MFS) *Shell {
+	return &Shell{m: m, cwd: "/"}
+}
+
+// Dir returns the current directory.
+func (s *Shell) Dir() string {
+	return s.cwd
+}
+
+// Run reads the commands from rw, usually a terminal in raw mode, until
+// exit or the end of the input, with line editing and the completion of
+// the command names and paths on tab. The errors of the commands are
+// written to rw.
+func (s *Shell) Run(rw io.ReadWriter) error {
+	t := term.NewTerminal(rw, s.prompt())
+	t.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' {
+			return "", 0, false
+		}
+		line, pos, candidates := s.complete(line, pos)
+		if len(candidates) > 1 {
+			fmt.Fprintln(t, strings.Join(candidates, "  "))
+		}
+		return line, pos, true
+	}
+	for {
+		line, err := t.ReadLine()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.Exec(t, line); errors.Is(err, ErrExit) {
+			return nil
+		} else if err != nil {
+			fmt.Fprintf(t, "error: %v\n", err)
+		}
+		t.SetPrompt(s.prompt())
+	}
+}
+
+func (s *Shell) prompt() string {
+	return "mfs:" + s.cwd + "> "
+}
+
+// Exec runs the command line writing its output to w. It returns ErrExit
+// for the exit command.
+func (s *Shell) Exec(w io.Writer, line string) error {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return nil
+	}
+	if args[0] == "exit" {
+		return ErrExit
+	}
+	c, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("%s: unknown command, see help", args[0])
+	}
+	return c.run(s, w, args[1:])
+}
+
+// abs returns the absolute shell path of p.
+func (s *Shell) abs(p string) string {
+	if !strings.HasPrefix(p, "/") {
+		p = path.Join(s.cwd, p)
+	}
+	return path.Clean(p)
+}
+
+// name returns the MFS name of the shell path p.
+func (s *Shell) name(p string) string {
+	if p = strings.TrimPrefix(s.abs(p), "/"); p == "" {
+		return "."
+	}
+	return p
+}
+
+func usage(name string) error {
+	return fmt.Errorf("usage: %s", commands[name].usage)
+}
+
+func (s *Shell) cd(_ io.Writer, args []string) error {
+	if len(args) > 1 {
+		return usage("cd")
+	}
+	p := "/"
+	if len(args) == 1 {
+		p = s.abs(args[0])
+	}
+	i, err := fs.Stat(s.m, s.name(p))
+	if err != nil {
+		return err
+	}
+	if !i.IsDir() {
+		return fmt.Errorf("%s: not a directory", p)
+	}
+	s.cwd = p
+	return nil
+}
+
+func (s *Shell) pwd(w io.Writer, _ []string) error {
+	_, err := fmt.Fprintln(w, s.cwd)
+	return err
+}
+
+func (s *Shell) ls(w io.Writer, args []string) error {
+	long := len(args) > 0 && args[0] == "-l"
+	if long {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	for i, v := range args {
+		if len(args) > 1 {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "%s:\n", v)
+		}
+		if err := s.list(w, v, long); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Shell) list(w io.Writer, p string, long bool) error {
+	name := s.name(p)
+	i, err := fs.Stat(s.m, name)
+	if err != nil {
+		return err
+	}
+	var infos []fs.FileInfo
+	if !i.IsDir() {
+		infos = append(infos, i)
+	} else {
+		ds, err := fs.ReadDir(s.m, name)
+		if err != nil {
+			return err
+		}
+		for _, v := range ds {
+			i, err := v.Info()
+			if err != nil {
+				return err
+			}
+			infos = append(infos, i)
+		}
+	}
+	if !long {
+		for _, v := range infos {
+			fmt.Fprintln(w, entryName(v))
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', tabwriter.AlignRight)
+	for _, v := range infos {
+		fmt.Fprintf(tw, "%s\t%d\t %s\t %s\t\n", v.Mode(), v.Size(), v.ModTime().Format(time.DateTime), entryName(v))
+	}
+	return tw.Flush()
+}
+
+// entryName returns the name of the entry, followed by a slash for the
+// directories.
+func entryName(i fs.FileInfo) string {
+	if i.IsDir() {
+		return i.Name() + "/"
+	}
+	return i.Name()
+}
+
+func (s *Shell) cat(w io.Writer, args []string) error {
+	if len(args) == 0 {
+		return usage("cat")
+	}
+	for _, v := range args {
+		f, err := s.m.Open(s.name(v))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Shell) stat(w io.Writer, args []string) error {
+	if len(args) == 0 {
+		return usage("stat")
+	}
+	for _, v := range args {
+		i, err := fs.Stat(s.m, s.name(v))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "  Path: %s\n  Size: %d\n  Mode: %s\nModify: %s\n", s.abs(v), i.Size(), i.Mode(), i.ModTime().Format(time.RFC3339))
+		if m := s.mountOf(s.name(v)); m != "" {
+			fmt.Fprintf(w, " Mount: %s\n", m)
+		}
+	}
+	return nil
+}
+
+// mountOf returns the shell path of the deepest mount holding name.
+func (s *Shell) mountOf(name string) string {
+	res, depth := "", -1
+	for _, v := range s.m.Mounts() {
+		if v.Path != "." && name != v.Path && !strings.HasPrefix(name, v.Path+"/") {
+			continue
+		}
+		d := len(v.Path)
+		if v.Path == "." {
+			d = 0
+		}
+		if d > depth {
+			res, depth = "/"+strings.TrimPrefix(v.Path, "."), d
+		}
+	}
+	return res
+}
+
+func (s *Shell) find(w io.Writer, args []string) error {
+	if len(args) > 2 {
+		return usage("find")
+	}
+	dir, pattern := ".", ""
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	if len(args) > 1 {
+		pattern = args[1]
+	}
+	for v, err := range mfs.Find(context.Background(), s.m, s.name(dir), mfs.FindOptions{Name: pattern}) {
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, s.abs("/"+v.Path))
+	}
+	return nil
+}
+
+func (s *Shell) cp(_ io.Writer, args []string) error {
+	if len(args) != 2 {
+		return usage("cp")
+	}
+	return mfs.Copy(s.m, s.name(args[0]), s.name(args[1]))
+}
+
+func (s *Shell) mount(_ io.Writer, args []string) error {
+	if len(args) != 2 {
+		return usage("mount")
+	}
+	return s.m.MountURL(s.name(args[0]), args[1])
+}
+
+func (s *Shell) umount(_ io.Writer, args []string) error {
+	if len(args) != 1 {
+		return usage("umount")
+	}
+	return s.m.Unmount(s.name(args[0]))
+}
+
+func (s *Shell) help(w io.Writer, _ []string) error {
+	names := make([]string, 0, len(commands))
+	for k := range commands {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, v := range names {
+		fmt.Fprintf(tw, "%s\t%s\n", commands[v].usage, commands[v].help)
+	}
+	return tw.Flush()
+}
+
+// complete completes the word of line ending at pos, the command name for
+// the first one, a path for the arguments of the commands taking paths. It
+// returns the new line and position, along with the candidates.
+func (s *Shell) complete(line string, pos int) (string, int, []string) {
+	start := strings.LastIndexByte(line[:pos], ' ') + 1
+	if strings.TrimSpace(line[:start]) == "" {
+		start = 0
+	}
+	word := line[start:pos]
+	var candidates []string
+	if start == 0 {
+		for k := range commands {
+			if strings.HasPrefix(k, word) {
+				candidates = append(candidates, k+" ")
+			}
+		}
+	} else if c, ok := commands[strings.Fields(line[:start])[0]]; ok && c.paths {
+		candidates = s.completePath(word)
+	}
+	sort.Strings(candidates)
+	if len(candidates) == 0 {
+		return line, pos, nil
+	}
+	prefix := candidates[0]
+	for _, v := range candidates[1:] {
+		for !strings.HasPrefix(v, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	if len(candidates) > 1 {
+		prefix = strings.TrimSuffix(prefix, " ")
+	}
+	return line[:start] + prefix + line[pos:], start + len(prefix), candidates
+}
+
+// completePath returns the paths of the entries completing word, the
+// directories ending with a slash and the files with a space.
+func (s *Shell) completePath(word string) []string {
+	dir, base := "", word
+	if i := strings.LastIndexByte(word, '/'); i >= 0 {
+		dir, base = word[:i+1], word[i+1:]
+	}
+	ds, err := fs.ReadDir(s.m, s.name(dir))
+	if err != nil {
+		return nil
+	}
+	var res []string
+	for _, v := range ds {
+		if !strings.HasPrefix(v.Name(), base) {
+			continue
+		}
+		if v.IsDir() {
+			res = append(res, dir+v.Name()+"/")
+		} else {
+			res = append(res, dir+v.Name()+" ")
+		}
+	}
+	return res
+}
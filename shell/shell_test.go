@@ -0,0 +1,114 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shell
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.linka.cloud/mfs"
+)
+
+func newShell(t *testing.T) *Shell {
+	mem := mfs.NewMemFS()
+	require.NoError(t, mem.MkdirAll("dir/sub", 0755))
+	require.NoError(t, mem.WriteFile("dir/foo", []byte("foo"), 0644))
+	require.NoError(t, mem.WriteFile("bar", []byte("bar"), 0644))
+	m, err := mfs.Mount("data", mem)
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("tmp", mfs.NewMemFS()))
+	return New(m)
+}
+
+func exec(t *testing.T, s *Shell, line string) string {
+	var buf bytes.Buffer
+	require.NoError(t, s.Exec(&buf, line))
+	return buf.String()
+}
+
+func TestShell(t *testing.T) {
+	s := newShell(t)
+	assert.Equal(t, "data/\ntmp/\n", exec(t, s, "ls"))
+	assert.Equal(t, "bar\ndir/\n", exec(t, s, "ls /data"))
+	exec(t, s, "cd data/dir")
+	assert.Equal(t, "/data/dir\n", exec(t, s, "pwd"))
+	assert.Equal(t, "foo", exec(t, s, "cat foo"))
+	assert.Equal(t, "foobar", exec(t, s, "cat foo ../bar"))
+	assert.Contains(t, exec(t, s, "ls -l"), " 3 ")
+	assert.Contains(t, exec(t, s, "stat foo"), "  Path: /data/dir/foo\n  Size: 3\n")
+	assert.Contains(t, exec(t, s, "stat foo"), " Mount: /data\n")
+	assert.Equal(t, "/data/dir/foo\n", exec(t, s, "find / foo"))
+
+	exec(t, s, "cp /data/dir /tmp/copy")
+	assert.Equal(t, "foo\n", exec(t, s, "ls /tmp/copy/foo"))
+	exec(t, s, "cd")
+	assert.Equal(t, "/\n", exec(t, s, "pwd"))
+	exec(t, s, "umount tmp")
+	assert.Equal(t, "data/\n", exec(t, s, "ls"))
+	exec(t, s, "mount tmp file://"+t.TempDir())
+	assert.Equal(t, "data/\ntmp/\n", exec(t, s, "ls"))
+
+	assert.ErrorIs(t, s.Exec(io.Discard, "cd missing"), fs.ErrNotExist)
+	assert.Error(t, s.Exec(io.Discard, "cd /data/bar"))
+	assert.Error(t, s.Exec(io.Discard, "unknown"))
+	assert.EqualError(t, s.Exec(io.Discard, "cp a"), "usage: cp src dst")
+	assert.ErrorIs(t, s.Exec(io.Discard, "exit"), ErrExit)
+	assert.Contains(t, exec(t, s, "help"), "umount path")
+}
+
+func TestComplete(t *testing.T) {
+	s := newShell(t)
+	line, pos, _ := s.complete("ca", 2)
+	assert.Equal(t, "cat ", line)
+	assert.Equal(t, 4, pos)
+	line, _, c := s.complete("c", 1)
+	assert.Equal(t, "c", line)
+	assert.Equal(t, []string{"cat ", "cd ", "cp "}, c)
+	line, _, _ = s.complete("ls da", 5)
+	assert.Equal(t, "ls data/", line)
+	line, _, _ = s.complete("cat data/dir/f", 14)
+	assert.Equal(t, "cat data/dir/foo ", line)
+	line, _, c = s.complete("cd data/", 8)
+	assert.Equal(t, "cd data/", line)
+	assert.Equal(t, []string{"data/bar ", "data/dir/"}, c)
+	line, _, c = s.complete("pwd d", 5)
+	assert.Equal(t, "pwd d", line)
+	assert.Empty(t, c)
+}
+
+type terminal struct {
+	io.Reader
+	out bytes.Buffer
+}
+
+func (t *terminal) Write(b []byte) (int, error) {
+	return t.out.Write(b)
+}
+
+func TestRun(t *testing.T) {
+	s := newShell(t)
+	rw := &terminal{Reader: strings.NewReader("cd da\t\rls\rcat missing\rexit\r")}
+	require.NoError(t, s.Run(rw))
+	out := rw.out.String()
+	assert.Contains(t, out, "mfs:/data> ")
+	assert.Contains(t, out, "dir/")
+	assert.Contains(t, out, "error: ")
+}
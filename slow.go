@@ -0,0 +1,57 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// WithSlowThreshold logs to l the operations taking d or longer, at the
+// warning level with their path, mount and duration. Unlike WithAudit, the
+// other operations cost a mere clock reading.
+func WithSlowThreshold(d time.Duration, l *slog.Logger) Option {
+	return func(m *mfs) {
+		m.slow = &slowLog{threshold: d, logger: l}
+	}
+}
+
+type slowLog struct {
+	threshold time.Duration
+	logger    *slog.Logger
+}
+
+// logSlow logs the operation op on name started at start if it exceeded the
+// threshold set with WithSlowThreshold.
+func (m *mfs) logSlow(ctx context.Context, op, name string, start time.Time, err error) {
+	s := m.slow
+	if s == nil {
+		return
+	}
+	d := time.Since(start)
+	if d < s.threshold {
+		return
+	}
+	attrs := []slog.Attr{slog.String("op", op), slog.String("path", name)}
+	if mnt, _, ok := m.loadAll().resolve(m.mountPath(name)); ok {
+		attrs = append(attrs, slog.String("mount", mnt.path))
+	}
+	attrs = append(attrs, slog.Duration("duration", d))
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	s.logger.LogAttrs(ctx, slog.LevelWarn, "mfs slow operation", attrs...)
+}
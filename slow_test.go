@@ -0,0 +1,48 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"bytes"
+	"io/fs"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlowThreshold(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(slog.NewTextHandler(&buf, nil))
+
+	m := New(WithSlowThreshold(time.Hour, l))
+	require.NoError(t, m.Mount("mem", NewMemFS()))
+	require.NoError(t, m.WriteFile("mem/foo", data["foo"], 0644))
+	_, err := fs.ReadFile(m, "mem/foo")
+	require.NoError(t, err)
+	assert.Empty(t, buf.String())
+
+	m = New(WithSlowThreshold(0, l))
+	require.NoError(t, m.Mount("mem", NewMemFS()))
+	require.NoError(t, m.WriteFile("mem/foo", data["foo"], 0644))
+	_, err = m.Open("mem/missing")
+	require.Error(t, err)
+	assert.Contains(t, buf.String(), "level=WARN")
+	assert.Contains(t, buf.String(), "op=write path=mem/foo mount=mem duration=")
+	assert.Contains(t, buf.String(), "op=open path=mem/missing mount=mem duration=")
+	assert.Contains(t, buf.String(), "error=")
+}
@@ -0,0 +1,103 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"io/fs"
+	"time"
+)
+
+// SnapshotID identifies a snapshot of a SnapshotFS.
+type SnapshotID uint64
+
+// SnapshotFS is implemented by file systems able to capture their state and
+// to restore it later, like MemFS.
+type SnapshotFS interface {
+	fs.FS
+	Snapshot() (SnapshotID, error)
+	// Rollback restores the state captured by the snapshot id, which fails
+	// with fs.ErrNotExist when unknown.
+	Rollback(id SnapshotID) error
+}
+
+var _ SnapshotFS = (*MemFS)(nil)
+
+// Snapshot captures the tree of m. The snapshot shares the tree with m: the
+// nodes are copied on write, each modification of m copying the nodes from
+// the root down to the modified one, and the file contents being copied on
+// their first write. A snapshot thus costs the nodes modified after it.
+func (m *MemFS) Snapshot() (SnapshotID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastSnapshot++
+	if m.snapshots == nil {
+		m.snapshots = make(map[SnapshotID]*memNode)
+	}
+	m.snapshots[m.lastSnapshot] = m.root
+	m.gen++
+	return m.lastSnapshot, nil
+}
+
+// Rollback restores the tree captured by the snapshot id, which can be
+// restored again later, the tree being shared with the snapshot as by
+// Snapshot. The files opened before are detached from the tree.
+func (m *MemFS) Rollback(id SnapshotID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.snapshots[id]
+	if !ok {
+		return &fs.PathError{Op: "rollback", Path: ".", Err: fs.ErrNotExist}
+	}
+	m.root = s
+	m.epoch++
+	return nil
+}
+
+// mountSnapshotFS returns the file system of the mount at path receiving its
+// writes, through the wrappers of the mount.
+func (m *mfs) mountSnapshotFS(op, path string) (SnapshotFS, error) {
+	path = m.mountPath(path)
+	mnt, ok := m.load().mounts[path]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: path, Err: fs.ErrNotExist}
+	}
+	s, ok := As[SnapshotFS](mnt.writable)
+	if !ok {
+		return nil, unsupported(op, path)
+	}
+	return s, nil
+}
+
+func (m *mfs) Snapshot(path string) (_ SnapshotID, err error) {
+	defer m.record("snapshot", path, time.Now(), &err)
+	s, err := m.mountSnapshotFS("snapshot", path)
+	if err != nil {
+		return 0, err
+	}
+	return s.Snapshot()
+}
+
+func (m *mfs) Rollback(path string, id SnapshotID) (err error) {
+	defer m.record("rollback", path, time.Now(), &err)
+	defer m.invalidate(path)
+	s, err := m.mountSnapshotFS("rollback", path)
+	if err != nil {
+		return err
+	}
+	if err := s.Rollback(id); err != nil {
+		return &fs.PathError{Op: "rollback", Path: path, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	mem := NewMemFS()
+	m, err := Mount("mem", mem)
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("ro", fstest.MapFS{}))
+	require.NoError(t, m.MkdirAll("mem/dir", 0755))
+	require.NoError(t, m.WriteFile("mem/dir/foo", []byte("foo"), 0644))
+
+	id, err := m.Snapshot("mem")
+	require.NoError(t, err)
+
+	f, err := m.OpenFile("mem/dir/foo", os.O_RDWR, 0)
+	require.NoError(t, err)
+	_, err = f.(io.Writer).Write([]byte("bar"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.NoError(t, m.WriteFile("mem/new", []byte("new"), 0644))
+	require.NoError(t, m.RemoveAll("mem/dir"))
+	require.NoError(t, fstest.TestFS(mem, "new"))
+
+	require.NoError(t, m.Rollback("mem", id))
+	require.NoError(t, fstest.TestFS(mem, "dir/foo"))
+	b, err := fs.ReadFile(m, "mem/dir/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(b))
+	_, err = fs.Stat(m, "mem/new")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	// the snapshot is left untouched by the writes following a rollback
+	require.NoError(t, m.WriteFile("mem/dir/foo", []byte("baz"), 0644))
+	require.NoError(t, m.Rollback("mem", id))
+	b, err = fs.ReadFile(m, "mem/dir/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(b))
+
+	assert.ErrorIs(t, m.Rollback("mem", id+1), fs.ErrNotExist)
+	_, err = m.Snapshot("ro")
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+	_, err = m.Snapshot("missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestSnapshotShared(t *testing.T) {
+	mem := NewMemFS()
+	require.NoError(t, mem.MkdirAll("a/b", 0755))
+	require.NoError(t, mem.MkdirAll("c", 0755))
+	require.NoError(t, mem.WriteFile("a/b/foo", []byte("foo"), 0644))
+	require.NoError(t, mem.WriteFile("c/bar", []byte("bar"), 0644))
+	f, err := mem.OpenFile("a/b/foo", os.O_RDWR, 0)
+	require.NoError(t, err)
+	r, err := mem.Open("a/b/foo")
+	require.NoError(t, err)
+
+	id, err := mem.Snapshot()
+	require.NoError(t, err)
+	s := mem.snapshots[id]
+	assert.Same(t, s, mem.root)
+
+	// the writes copy the path to the modified node only
+	require.NoError(t, mem.WriteFile("c/baz", []byte("baz"), 0644))
+	assert.NotSame(t, s, mem.root)
+	assert.NotSame(t, s.children["c"], mem.root.children["c"])
+	assert.Same(t, s.children["a"], mem.root.children["a"])
+	assert.Same(t, s.children["c"].children["bar"], mem.root.children["c"].children["bar"])
+
+	// the files opened before the snapshot write to the tree, not to the
+	// snapshot, and see each other's writes
+	_, err = f.(io.Writer).Write([]byte("new"))
+	require.NoError(t, err)
+	assert.NotSame(t, s.children["a"], mem.root.children["a"])
+	assert.Equal(t, "foo", string(s.children["a"].children["b"].children["foo"].data))
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(b))
+	require.NoError(t, mem.Rename("a/b/foo", "c/foo"))
+	_, err = f.(io.WriterAt).WriteAt([]byte("!"), 3)
+	require.NoError(t, err)
+	b, err = mem.ReadFile("c/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "new!", string(b))
+
+	// the files opened before a rollback are detached from the tree
+	require.NoError(t, mem.Rollback(id))
+	_, err = f.(io.WriterAt).WriteAt([]byte("?"), 0)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	b, err = mem.ReadFile("a/b/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(b))
+	assert.Equal(t, "foo", string(s.children["a"].children["b"].children["foo"].data))
+	require.NoError(t, fstest.TestFS(mem, "a/b/foo", "c/bar"))
+}
+
+func TestSnapshotWrapped(t *testing.T) {
+	mem := NewMemFS()
+	m, err := Mount("mem", mem, WithTimeout(time.Minute), WithCache(time.Minute))
+	require.NoError(t, err)
+	require.NoError(t, m.WriteFile("mem/foo", []byte("foo"), 0644))
+	id, err := m.Snapshot("mem")
+	require.NoError(t, err)
+	require.NoError(t, m.WriteFile("mem/foo", []byte("bar"), 0644))
+	require.NoError(t, m.Rollback("mem", id))
+	b, err := fs.ReadFile(m, "mem/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(b))
+}
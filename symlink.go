@@ -0,0 +1,216 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrSymlinkRejected is the error returned when a path goes through a
+// symbolic link the policy set with WithSymlinks does not allow.
+var ErrSymlinkRejected = errors.New("symbolic link rejected")
+
+// ReadLinkFS is implemented by the file systems supporting symbolic links,
+// e.g. DirFS. It has the methods of fs.ReadLinkFS.
+type ReadLinkFS interface {
+	fs.FS
+	// ReadLink returns the destination of the named symbolic link.
+	ReadLink(name string) (string, error)
+	// Lstat returns the FileInfo of the named file without following it
+	// if it is a symbolic link.
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// ReadLink returns the destination of the named symbolic link of fsys.
+func ReadLink(fsys fs.FS, name string) (string, error) {
+	l, ok := fsys.(ReadLinkFS)
+	if !ok {
+		return "", unsupported("readlink", name)
+	}
+	return l.ReadLink(name)
+}
+
+// Lstat returns the FileInfo of the named file of fsys without following
+// it if it is a symbolic link. It is fs.Stat for the file systems not
+// implementing ReadLinkFS.
+func Lstat(fsys fs.FS, name string) (fs.FileInfo, error) {
+	if l, ok := fsys.(ReadLinkFS); ok {
+		return l.Lstat(name)
+	}
+	return fs.Stat(fsys, name)
+}
+
+// SymlinkPolicy controls how the symbolic links of a mount are handled.
+type SymlinkPolicy int
+
+const (
+	// SymlinkFollow resolves the symbolic links transparently, as the
+	// mounted file system does.
+	SymlinkFollow SymlinkPolicy = iota
+	// SymlinkNoFollow exposes the symbolic links as links: they are listed,
+	// reported by Stat and ReadLink, and can be removed or renamed, but the
+	// operations going through them fail with ErrSymlinkRejected.
+	SymlinkNoFollow
+	// SymlinkContain resolves the symbolic links pointing inside the mounted
+	// file system and rejects the ones pointing outside with
+	// ErrSymlinkRejected, e.g. to "../../etc" or to an absolute path.
+	SymlinkContain
+)
+
+// WithSymlinks sets the policy applied to the symbolic links of the mounted
+// file system, see Symlinks. It defaults to SymlinkFollow.
+func WithSymlinks(p SymlinkPolicy) MountOption {
+	return func(o *mountOptions) {
+		o.symlinks = p
+	}
+}
+
+// Symlinks returns a file system applying p to the symbolic links of fsys.
+// The links are resolved by the wrapper itself, one path element at a time
+// with Lstat and ReadLink, before the operations are passed to fsys with
+// the resolved names. The checks race with the concurrent changes of the
+// backend: it guards against the links present when the operations start.
+//
+// fsys is returned as is with SymlinkFollow or if it does not implement
+// ReadLinkFS, its links, if any, being invisible.
+func Symlinks(fsys fs.FS, p SymlinkPolicy) fs.FS {
+	if _, ok := As[ReadLinkFS](fsys); !ok || p == SymlinkFollow {
+		return fsys
+	}
+	s := &symlinkFS{p: p}
+	s.forwardFS = forwardFS{fsys: fsys, route: s.route}
+	return s
+}
+
+type symlinkFS struct {
+	forwardFS
+	p SymlinkPolicy
+}
+
+// resolve returns name with its symbolic links resolved, the last element
+// only being followed if follow is true.
+func (s *symlinkFS) resolve(op, name string, follow bool) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return name, nil
+	}
+	cur, rest, hops := ".", strings.Split(name, "/"), 0
+	for len(rest) > 0 {
+		next := path.Join(cur, rest[0])
+		rest = rest[1:]
+		i, err := Lstat(s.fsys, next)
+		if err != nil {
+			// the missing files cannot be links, the operation reports them
+			return path.Join(append([]string{next}, rest...)...), nil
+		}
+		if i.Mode()&fs.ModeSymlink == 0 || len(rest) == 0 && !follow {
+			cur = next
+			continue
+		}
+		if s.p == SymlinkNoFollow {
+			return "", &fs.PathError{Op: op, Path: name, Err: ErrSymlinkRejected}
+		}
+		if hops++; hops > maxSymlinks {
+			return "", &fs.PathError{Op: op, Path: name, Err: errors.New("too many links")}
+		}
+		target, err := ReadLink(s.fsys, next)
+		if err != nil {
+			return "", err
+		}
+		if path.IsAbs(target) {
+			return "", &fs.PathError{Op: op, Path: name, Err: ErrSymlinkRejected}
+		}
+		target = path.Join(cur, target)
+		if target == ".." || strings.HasPrefix(target, "../") {
+			return "", &fs.PathError{Op: op, Path: name, Err: ErrSymlinkRejected}
+		}
+		cur = "."
+		if target != "." {
+			rest = append(strings.Split(target, "/"), rest...)
+		}
+	}
+	return cur, nil
+}
+
+// route resolves the links of name, the operations on the links
+// themselves, e.g. Remove or Rename, not following the last element.
+func (s *symlinkFS) route(op, name string) (fs.FS, string, error) {
+	follow := true
+	switch op {
+	case "readlink", "lstat", "remove", "removeall", "rename":
+		follow = false
+	}
+	rel, err := s.resolve(op, name, follow)
+	if err != nil {
+		return nil, "", err
+	}
+	return s.fsys, rel, nil
+}
+
+// Stat reports the links themselves with SymlinkNoFollow.
+func (s *symlinkFS) Stat(name string) (fs.FileInfo, error) {
+	rel, err := s.resolve("stat", name, s.p != SymlinkNoFollow)
+	if err != nil {
+		return nil, err
+	}
+	return Lstat(s.fsys, rel)
+}
+
+func (m *mfs) ReadLink(name string) (_ string, err error) {
+	defer m.record("readlink", name, time.Now(), &err)
+	mnt, rel, err := m.lookupPath("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	l, ok := mnt.fs.(ReadLinkFS)
+	if !ok {
+		return "", unsupported("readlink", name)
+	}
+	var target string
+	err = m.labeled(mnt, "readlink", func() (err error) {
+		target, err = l.ReadLink(rel)
+		return err
+	})
+	return target, mnt.wrapErr("readlink", name, rel, err)
+}
+
+// Lstat is fs.Stat for the mount points and the mounts whose file system
+// does not implement ReadLinkFS.
+func (m *mfs) Lstat(name string) (_ fs.FileInfo, err error) {
+	mnt, rel, lerr := m.lookupPath("lstat", name)
+	if lerr != nil || rel == "." {
+		return fs.Stat(m, name)
+	}
+	l, ok := As[ReadLinkFS](mnt.fs)
+	if !ok {
+		return fs.Stat(m, name)
+	}
+	defer m.record("lstat", name, time.Now(), &err)
+	var i fs.FileInfo
+	err = m.labeled(mnt, "lstat", func() (err error) {
+		i, err = l.Lstat(rel)
+		return err
+	})
+	if err != nil {
+		return nil, mnt.wrapErr("lstat", name, rel, err)
+	}
+	return i, nil
+}
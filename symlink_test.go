@@ -0,0 +1,122 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writableDir is DirFS supporting WriteFile and Remove.
+type writableDir struct {
+	ReadLinkFS
+	dir string
+}
+
+func (w writableDir) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(filepath.Join(w.dir, name), data, perm)
+}
+
+func (w writableDir) Remove(name string) error {
+	return os.Remove(filepath.Join(w.dir, name))
+}
+
+func symlinkDir(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "outside"), []byte("secret"), 0644))
+	dir := filepath.Join(root, "dir")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "foo"), data["foo"], 0644))
+	for k, v := range map[string]string{"file": "sub/foo", "subdir": "sub", "out": "../outside", "abs": filepath.Join(root, "outside"), "loop": "loop"} {
+		require.NoError(t, os.Symlink(v, filepath.Join(dir, k)))
+	}
+	return dir
+}
+
+func TestSymlinks(t *testing.T) {
+	dir := symlinkDir(t)
+	wdir := writableDir{ReadLinkFS: DirFS(dir).(ReadLinkFS), dir: dir}
+
+	m, err := Mount("follow", DirFS(dir))
+	require.NoError(t, err)
+	b, err := fs.ReadFile(m, "follow/out")
+	require.NoError(t, err)
+	assert.Equal(t, "secret", string(b))
+	target, err := m.ReadLink("follow/file")
+	require.NoError(t, err)
+	assert.Equal(t, "sub/foo", target)
+	i, err := m.Lstat("follow/file")
+	require.NoError(t, err)
+	assert.Equal(t, fs.ModeSymlink, i.Mode().Type())
+
+	require.NoError(t, m.Mount("nofollow", wdir, WithSymlinks(SymlinkNoFollow)))
+	for _, v := range []string{"nofollow/file", "nofollow/subdir/foo", "nofollow/out"} {
+		_, err = fs.ReadFile(m, v)
+		assert.ErrorIs(t, err, ErrSymlinkRejected, v)
+	}
+	_, err = fs.ReadFile(m, "nofollow/sub/foo")
+	assert.NoError(t, err)
+	i, err = m.Lstat("nofollow/subdir")
+	require.NoError(t, err)
+	assert.Equal(t, fs.ModeSymlink, i.Mode().Type())
+	target, err = m.ReadLink("nofollow/out")
+	require.NoError(t, err)
+	assert.Equal(t, "../outside", target)
+	_, err = m.ReadLink("nofollow/subdir/foo")
+	assert.ErrorIs(t, err, ErrSymlinkRejected)
+	i, err = fs.Stat(Symlinks(DirFS(dir), SymlinkNoFollow), "file")
+	require.NoError(t, err)
+	assert.Equal(t, fs.ModeSymlink, i.Mode().Type())
+	ds, err := fs.ReadDir(m, "nofollow")
+	require.NoError(t, err)
+	assert.Len(t, ds, 6)
+	require.NoError(t, m.Remove("nofollow/loop"))
+	_, err = os.Lstat(filepath.Join(dir, "loop"))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	require.NoError(t, os.Symlink("loop", filepath.Join(dir, "loop")))
+
+	require.NoError(t, m.Mount("contain", wdir, WithSymlinks(SymlinkContain)))
+	for _, v := range []string{"contain/file", "contain/subdir/foo"} {
+		b, err = fs.ReadFile(m, v)
+		require.NoError(t, err, v)
+		assert.Equal(t, data["foo"], b)
+	}
+	for _, v := range []string{"contain/out", "contain/abs"} {
+		_, err = fs.ReadFile(m, v)
+		assert.ErrorIs(t, err, ErrSymlinkRejected, v)
+		assert.Equal(t, ClassPermission, ClassifyError(err))
+	}
+	_, err = fs.ReadFile(m, "contain/loop")
+	assert.ErrorContains(t, err, "too many links")
+	require.NoError(t, m.WriteFile("contain/subdir/bar", data["baz"], 0644))
+	b, err = os.ReadFile(filepath.Join(dir, "sub", "bar"))
+	require.NoError(t, err)
+	assert.Equal(t, data["baz"], b)
+	_, err = fs.ReadFile(m, "contain/missing/foo")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	mem := NewMemFS()
+	assert.Equal(t, fs.FS(mem), Symlinks(mem, SymlinkContain))
+	require.NoError(t, m.Mount("mem", mem))
+	_, err = m.ReadLink("mem/foo")
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+}
@@ -0,0 +1,174 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// CompareFunc reports whether the regular files a and b of fsys are
+// identical.
+type CompareFunc func(fsys fs.FS, a, b string) (bool, error)
+
+// CompareMetadata considers files with the same size and modification time
+// identical.
+func CompareMetadata(fsys fs.FS, a, b string) (bool, error) {
+	sa, err := fs.Stat(fsys, a)
+	if err != nil {
+		return false, err
+	}
+	sb, err := fs.Stat(fsys, b)
+	if err != nil {
+		return false, err
+	}
+	return sa.Size() == sb.Size() && sa.ModTime().Equal(sb.ModTime()), nil
+}
+
+// CompareContent compares the SHA-256 of the files content.
+func CompareContent(fsys fs.FS, a, b string) (bool, error) {
+	sa, err := fs.Stat(fsys, a)
+	if err != nil {
+		return false, err
+	}
+	sb, err := fs.Stat(fsys, b)
+	if err != nil {
+		return false, err
+	}
+	if sa.Size() != sb.Size() {
+		return false, nil
+	}
+	ha, err := hashFile(fsys, a)
+	if err != nil {
+		return false, err
+	}
+	hb, err := hashFile(fsys, b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(ha, hb), nil
+}
+
+func hashFile(fsys fs.FS, name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// CompareOption configures the file comparison used by Sync and Diff.
+type CompareOption func(o *compareOptions)
+
+type compareOptions struct {
+	compare CompareFunc
+}
+
+func newCompareOptions(opts ...CompareOption) *compareOptions {
+	o := &compareOptions{compare: CompareMetadata}
+	for _, v := range opts {
+		v(o)
+	}
+	return o
+}
+
+// WithCompare sets the function used to detect modified files. It defaults
+// to CompareMetadata.
+func WithCompare(fn CompareFunc) CompareOption {
+	return func(o *compareOptions) {
+		o.compare = fn
+	}
+}
+
+// Sync makes the dst tree a copy of the src one: missing files and
+// directories are created, modified files are copied over and files missing
+// from src are removed from dst.
+func Sync(ctx context.Context, m MFS, src, dst string, opts ...CompareOption) error {
+	o := newCompareOptions(opts...)
+	src, dst = cleanPath(src), cleanPath(dst)
+	if dst == src || strings.HasPrefix(dst, src+"/") || strings.HasPrefix(src, dst+"/") {
+		return &fs.PathError{Op: "sync", Path: dst, Err: fs.ErrInvalid}
+	}
+	err := WalkDir(m, src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		target := dst + strings.TrimPrefix(p, src)
+		i, err := d.Info()
+		if err != nil {
+			return err
+		}
+		t, err := fs.Stat(m, target)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			return err
+		case t.IsDir() != d.IsDir():
+			if err := m.RemoveAll(target); err != nil {
+				return err
+			}
+		case d.IsDir():
+			return nil
+		case d.Type().IsRegular():
+			same, err := o.compare(m, p, target)
+			if err != nil || same {
+				return err
+			}
+		}
+		switch {
+		case d.IsDir():
+			return m.MkdirAll(target, i.Mode().Perm())
+		case d.Type().IsRegular():
+			return copyFile(m, p, target, i, &copyOptions{})
+		default:
+			return nil
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return WalkDir(m, dst, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		_, err = fs.Stat(m, src+strings.TrimPrefix(p, dst))
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if err := m.RemoveAll(p); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return fs.SkipDir
+		}
+		return nil
+	})
+}
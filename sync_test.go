@@ -0,0 +1,67 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	src := fstest.MapFS{
+		"foo":      {Data: data["foo"]},
+		"dir/baz":  {Data: data["baz"]},
+		"dir/quux": {Data: data["quux"]},
+		"file":     {Data: []byte("was a dir")},
+	}
+	dst := NewMemFS()
+	require.NoError(t, dst.WriteFile("foo", []byte("old"), 0644))
+	require.NoError(t, dst.WriteFile("stale", nil, 0644))
+	require.NoError(t, dst.MkdirAll("file/sub", 0755))
+	require.NoError(t, dst.MkdirAll("dir/gone", 0755))
+
+	m, err := Mount("src", src)
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("dst", dst))
+
+	require.NoError(t, Sync(ctx, m, "src", "dst", WithCompare(CompareContent)))
+	for k, v := range src {
+		b, err := fs.ReadFile(dst, k)
+		require.NoError(t, err, k)
+		assert.Equal(t, v.Data, b, k)
+	}
+	for _, k := range []string{"stale", "dir/gone", "file/sub"} {
+		_, err := dst.Stat(k)
+		assert.ErrorIs(t, err, fs.ErrNotExist, k)
+	}
+
+	before, err := dst.Stat("foo")
+	require.NoError(t, err)
+	require.NoError(t, Sync(ctx, m, "src", "dst", WithCompare(CompareContent)))
+	after, err := dst.Stat("foo")
+	require.NoError(t, err)
+	assert.Equal(t, before.ModTime(), after.ModTime())
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, Sync(cctx, m, "src", "dst"), context.Canceled)
+	assert.ErrorIs(t, Sync(ctx, m, "dst", "dst/sub"), fs.ErrInvalid)
+}
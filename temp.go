@@ -0,0 +1,114 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// tempAttempts bounds the names tried by CreateTemp and MkdirTemp.
+const tempAttempts = 10000
+
+// tempName returns a name built from pattern as os.CreateTemp does: the
+// last "*" is replaced by a random string, which is appended otherwise.
+func tempName(op, dir, pattern string) (func() string, error) {
+	if strings.ContainsAny(pattern, `/\`) {
+		return nil, &fs.PathError{Op: op, Path: pattern, Err: errors.New("pattern contains path separator")}
+	}
+	prefix, suffix := pattern, ""
+	if i := strings.LastIndex(pattern, "*"); i != -1 {
+		prefix, suffix = pattern[:i], pattern[i+1:]
+	}
+	if dir == "" {
+		dir = "."
+	}
+	return func() string {
+		return joinMountPath(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10)+suffix)
+	}, nil
+}
+
+// CreateTemp creates a new file in the directory dir of m, opened for
+// reading and writing, and returns it with its path. The file name is
+// built from pattern as os.CreateTemp does. The file is created with
+// O_EXCL, so that concurrent calls never return the same file: the mounted
+// file system must honor it. The caller should remove the file when done.
+func CreateTemp(m MFS, dir, pattern string) (fs.File, string, error) {
+	next, err := tempName("createtemp", dir, pattern)
+	if err != nil {
+		return nil, "", err
+	}
+	for range tempAttempts {
+		name := next()
+		f, err := m.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		return f, name, nil
+	}
+	return nil, "", &fs.PathError{Op: "createtemp", Path: joinMountPath(dir, pattern), Err: fs.ErrExist}
+}
+
+// MkdirTemp creates a new directory in the directory dir of m and returns
+// its path. The directory name is built from pattern as os.MkdirTemp does.
+// As MkdirAll does not fail on existing directories, the candidate names
+// are locked while checked and created, see Lock, which makes the calls
+// of the process never return the same directory. The caller should
+// remove the directory when done.
+func MkdirTemp(m MFS, dir, pattern string) (string, error) {
+	next, err := tempName("mkdirtemp", dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	for range tempAttempts {
+		name := next()
+		ok, err := mkdirNew(m, name)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return name, nil
+		}
+	}
+	return "", &fs.PathError{Op: "mkdirtemp", Path: joinMountPath(dir, pattern), Err: fs.ErrExist}
+}
+
+// mkdirNew creates the directory name, reporting false if it exists.
+func mkdirNew(m MFS, name string) (bool, error) {
+	u, err := m.Lock(name, false)
+	if errors.Is(err, ErrLocked) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer u.Unlock()
+	if _, err := fs.Stat(m, name); err == nil {
+		return false, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+	if err := m.MkdirAll(name, 0700); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateTemp(t *testing.T) {
+	m, err := Mount("tmp", NewMemFS())
+	require.NoError(t, err)
+
+	f, name, err := CreateTemp(m, "tmp", "upload-*.part")
+	require.NoError(t, err)
+	assert.Equal(t, "tmp", path.Dir(name))
+	assert.True(t, strings.HasPrefix(path.Base(name), "upload-"), name)
+	assert.True(t, strings.HasSuffix(name, ".part"), name)
+	_, err = f.(io.Writer).Write([]byte("foo"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	b, err := fs.ReadFile(m, name)
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(b))
+
+	_, name, err = CreateTemp(m, "tmp", "prefix")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(path.Base(name), "prefix"), name)
+
+	_, _, err = CreateTemp(m, "tmp", "a/b")
+	assert.Error(t, err)
+	require.NoError(t, m.Mount("static", fstest.MapFS{}))
+	_, _, err = CreateTemp(m, "static", "")
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+}
+
+func TestMkdirTemp(t *testing.T) {
+	m, err := Mount("tmp", NewMemFS())
+	require.NoError(t, err)
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		names = make(map[string]struct{})
+	)
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name, err := MkdirTemp(m, "tmp", "dir-*")
+			assert.NoError(t, err)
+			mu.Lock()
+			names[name] = struct{}{}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, names, 20)
+	entries, err := m.ReadDir("tmp")
+	require.NoError(t, err)
+	assert.Len(t, entries, 20)
+	for _, v := range entries {
+		assert.True(t, v.IsDir())
+		assert.True(t, strings.HasPrefix(v.Name(), "dir-"))
+	}
+}
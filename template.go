@@ -0,0 +1,247 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"bytes"
+	"errors"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TemplateDataFunc returns the data the template at path is executed with.
+// The path is relative to the templates file system.
+type TemplateDataFunc func(path string) (any, error)
+
+// TemplateOption configures Templates.
+type TemplateOption func(o *templateOptions)
+
+type templateOptions struct {
+	html  bool
+	funcs map[string]any
+	ext   string
+}
+
+// WithHTMLTemplates executes the templates with html/template, escaping the
+// data for HTML, instead of text/template.
+func WithHTMLTemplates() TemplateOption {
+	return func(o *templateOptions) {
+		o.html = true
+	}
+}
+
+// WithTemplateFuncs adds funcs to the templates functions.
+func WithTemplateFuncs(funcs map[string]any) TemplateOption {
+	return func(o *templateOptions) {
+		if o.funcs == nil {
+			o.funcs = make(map[string]any, len(funcs))
+		}
+		for k, v := range funcs {
+			o.funcs[k] = v
+		}
+	}
+}
+
+// WithTemplateExt only renders the files with the extension ext, e.g.
+// ".tmpl", which are exposed without it: "index.html.tmpl" is served as
+// "index.html", hiding a file with that name. The other files are exposed
+// as is.
+func WithTemplateExt(ext string) TemplateOption {
+	return func(o *templateOptions) {
+		o.ext = ext
+	}
+}
+
+// Templates returns a file system exposing the regular files of fsys
+// rendered as Go templates, executed with the data returned by fn for each
+// file. A template directory of an MFS is exposed under another mount path
+// by mounting Templates(fs.Sub(m, dir), fn).
+//
+// The files are rendered when opened: their size is the one of the render
+// and their modification time the render time, as the output depends on
+// the data. The rendering errors are returned by Open.
+func Templates(fsys fs.FS, fn TemplateDataFunc, opts ...TemplateOption) fs.FS {
+	o := &templateOptions{}
+	for _, v := range opts {
+		v(o)
+	}
+	return &templateFS{fsys: fsys, fn: fn, o: o}
+}
+
+type templateFS struct {
+	fsys fs.FS
+	fn   TemplateDataFunc
+	o    *templateOptions
+}
+
+func (t *templateFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	src := name
+	if t.o.ext != "" {
+		if strings.HasSuffix(name, t.o.ext) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		f, err := t.render(name, name+t.o.ext)
+		if err == nil || !errors.Is(err, fs.ErrNotExist) {
+			return f, err
+		}
+		return t.fsys.Open(src)
+	}
+	return t.render(name, src)
+}
+
+// render opens the template src and renders it as name. Files which are not
+// regular are returned as is.
+func (t *templateFS) render(name, src string) (fs.File, error) {
+	f, err := t.fsys.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	i, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !i.Mode().IsRegular() {
+		if t.o.ext != "" {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		return t.fsys.Open(src)
+	}
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	data, err := t.fn(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	var buf bytes.Buffer
+	if t.o.html {
+		err = executeTemplate(htmltemplate.New(name).Funcs(t.o.funcs), string(b), &buf, data)
+	} else {
+		err = executeTemplate(template.New(name).Funcs(t.o.funcs), string(b), &buf, data)
+	}
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	info := &renderedInfo{FileInfo: i, name: path.Base(name), size: int64(buf.Len()), modTime: time.Now()}
+	return &renderedFile{Reader: bytes.NewReader(buf.Bytes()), info: info}, nil
+}
+
+func executeTemplate[T interface {
+	Parse(text string) (T, error)
+	Execute(w io.Writer, data any) error
+}](t T, text string, w io.Writer, data any) error {
+	t, err := t.Parse(text)
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, data)
+}
+
+func (t *templateFS) Stat(name string) (fs.FileInfo, error) {
+	f, err := t.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+func (t *templateFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	ds, err := fs.ReadDir(t.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	rendered := make(map[string]struct{})
+	if t.o.ext != "" {
+		for _, d := range ds {
+			if d.Type().IsRegular() && strings.HasSuffix(d.Name(), t.o.ext) {
+				rendered[strings.TrimSuffix(d.Name(), t.o.ext)] = struct{}{}
+			}
+		}
+	}
+	res := make([]fs.DirEntry, 0, len(ds))
+	for _, d := range ds {
+		n := d.Name()
+		switch {
+		case !d.Type().IsRegular():
+			if _, ok := rendered[n]; ok {
+				continue
+			}
+			res = append(res, d)
+			continue
+		case t.o.ext == "":
+		case strings.HasSuffix(n, t.o.ext):
+			n = strings.TrimSuffix(n, t.o.ext)
+		default:
+			if _, ok := rendered[n]; !ok {
+				res = append(res, d)
+			}
+			continue
+		}
+		res = append(res, &templateEntry{DirEntry: d, t: t, name: n, path: joinMountPath(name, n)})
+	}
+	sortEntries(res)
+	return res, nil
+}
+
+// templateEntry defers the rendering until Info is called.
+type templateEntry struct {
+	fs.DirEntry
+	t    *templateFS
+	name string
+	path string
+}
+
+func (e *templateEntry) Name() string {
+	return e.name
+}
+
+func (e *templateEntry) Info() (fs.FileInfo, error) {
+	return e.t.Stat(e.path)
+}
+
+type renderedFile struct {
+	*bytes.Reader
+	info *renderedInfo
+}
+
+func (f *renderedFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *renderedFile) Close() error {
+	return nil
+}
+
+type renderedInfo struct {
+	fs.FileInfo
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i *renderedInfo) Name() string       { return i.name }
+func (i *renderedInfo) Size() int64        { return i.size }
+func (i *renderedInfo) ModTime() time.Time { return i.modTime }
@@ -0,0 +1,102 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplates(t *testing.T) {
+	src := fstest.MapFS{
+		"index.html.tmpl": {Data: []byte(`<p>{{ .Name }}</p>`)},
+		"index.html":      {Data: []byte("hidden")},
+		"hello.txt.tmpl":  {Data: []byte(`{{ upper .Name }}`)},
+		"static.css":      {Data: []byte("body{}")},
+		"broken.tmpl":     {Data: []byte(`{{ .Name `)},
+		"dir/page.tmpl":   {Data: []byte(`{{ .Path }}`)},
+	}
+	data := func(path string) (any, error) {
+		return map[string]string{"Name": "<b>mfs</b>", "Path": path}, nil
+	}
+	fsys := Templates(src, data, WithTemplateExt(".tmpl"), WithTemplateFuncs(map[string]any{"upper": strings.ToUpper}))
+
+	b, err := fs.ReadFile(fsys, "index.html")
+	require.NoError(t, err)
+	assert.Equal(t, "<p><b>mfs</b></p>", string(b))
+	b, err = fs.ReadFile(fsys, "hello.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "<B>MFS</B>", string(b))
+	b, err = fs.ReadFile(fsys, "static.css")
+	require.NoError(t, err)
+	assert.Equal(t, "body{}", string(b))
+	b, err = fs.ReadFile(fsys, "dir/page")
+	require.NoError(t, err)
+	assert.Equal(t, "dir/page", string(b))
+
+	_, err = fsys.Open("index.html.tmpl")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = fsys.Open("broken")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, fs.ErrNotExist)
+
+	i, err := fs.Stat(fsys, "index.html")
+	require.NoError(t, err)
+	assert.Equal(t, "index.html", i.Name())
+	assert.EqualValues(t, len("<p><b>mfs</b></p>"), i.Size())
+
+	ds, err := fs.ReadDir(fsys, ".")
+	require.NoError(t, err)
+	var names []string
+	for _, d := range ds {
+		names = append(names, d.Name())
+	}
+	assert.Equal(t, []string{"broken", "dir", "hello.txt", "index.html", "static.css"}, names)
+	i, err = ds[2].Info()
+	require.NoError(t, err)
+	assert.EqualValues(t, len("<B>MFS</B>"), i.Size())
+
+	html := Templates(src, data, WithHTMLTemplates(), WithTemplateExt(".tmpl"))
+	b, err = fs.ReadFile(html, "index.html")
+	require.NoError(t, err)
+	assert.Equal(t, "<p>&lt;b&gt;mfs&lt;/b&gt;</p>", string(b))
+
+	failing := Templates(src, func(string) (any, error) { return nil, errors.New("no data") })
+	_, err = fs.ReadFile(failing, "static.css")
+	assert.ErrorContains(t, err, "no data")
+}
+
+func TestTemplatesMount(t *testing.T) {
+	mem := NewMemFS()
+	require.NoError(t, mem.WriteFile("greet", []byte(`hello {{ . }}`), 0644))
+	m, err := Mount("templates", mem)
+	require.NoError(t, err)
+	sub, err := fs.Sub(m, "templates")
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("rendered", Templates(sub, func(path string) (any, error) { return path, nil })))
+
+	b, err := fs.ReadFile(m, "rendered/greet")
+	require.NoError(t, err)
+	assert.Equal(t, "hello greet", string(b))
+	b, err = fs.ReadFile(m, "templates/greet")
+	require.NoError(t, err)
+	assert.Equal(t, "hello {{ . }}", string(b))
+}
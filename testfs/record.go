@@ -0,0 +1,386 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// ErrNotRecorded is returned by the replayed file systems for the
+// operations missing from the recording.
+var ErrNotRecorded = errors.New("operation not recorded")
+
+// recordedErrors are the errors kept identifiable by errors.Is when
+// replayed.
+var recordedErrors = map[string]error{
+	"notexist":    fs.ErrNotExist,
+	"exist":       fs.ErrExist,
+	"permission":  fs.ErrPermission,
+	"invalid":     fs.ErrInvalid,
+	"closed":      fs.ErrClosed,
+	"unsupported": errors.ErrUnsupported,
+	"deadline":    context.DeadlineExceeded,
+}
+
+// event is a line of a recording.
+type event struct {
+	Op      string       `json:"op"`
+	Path    string       `json:"path"`
+	Error   string       `json:"error,omitempty"`
+	Kind    string       `json:"kind,omitempty"`
+	Info    *recordInfo  `json:"info,omitempty"`
+	Entries []recordInfo `json:"entries,omitempty"`
+	Data    []byte       `json:"data,omitempty"`
+}
+
+func (e *event) setErr(err error) {
+	if err == nil {
+		return
+	}
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		err = pe.Err
+	}
+	e.Error = err.Error()
+	for k, v := range recordedErrors {
+		if errors.Is(err, v) {
+			e.Kind = k
+			break
+		}
+	}
+}
+
+func (e *event) err() error {
+	if e.Error == "" {
+		return nil
+	}
+	return &fs.PathError{Op: e.Op, Path: e.Path, Err: &recordedError{msg: e.Error, err: recordedErrors[e.Kind]}}
+}
+
+type recordedError struct {
+	msg string
+	err error
+}
+
+func (e *recordedError) Error() string {
+	return e.msg
+}
+
+func (e *recordedError) Unwrap() error {
+	return e.err
+}
+
+type recordInfo struct {
+	Name    string      `json:"name"`
+	Size    int64       `json:"size"`
+	Mode    fs.FileMode `json:"mode"`
+	ModTime time.Time   `json:"modTime"`
+}
+
+func newRecordInfo(i fs.FileInfo) *recordInfo {
+	return &recordInfo{Name: i.Name(), Size: i.Size(), Mode: i.Mode(), ModTime: i.ModTime()}
+}
+
+func newRecordEntries(entries []fs.DirEntry) []recordInfo {
+	out := make([]recordInfo, 0, len(entries))
+	for _, v := range entries {
+		i, err := v.Info()
+		if err != nil {
+			out = append(out, recordInfo{Name: v.Name(), Mode: v.Type()})
+			continue
+		}
+		out = append(out, *newRecordInfo(i))
+	}
+	return out
+}
+
+// Record returns a file system logging the operations run on fsys and their
+// results to w as JSON lines, to be served by Replay: opening, stating and
+// listing files, and the content read from the opened files, logged when
+// they are closed. The write operations are not recorded.
+func Record(fsys fs.FS, w io.Writer) fs.FS {
+	return &recorder{fsys: fsys, enc: json.NewEncoder(w)}
+}
+
+type recorder struct {
+	fsys fs.FS
+	mu   sync.Mutex
+	enc  *json.Encoder
+}
+
+var (
+	_ fs.StatFS    = (*recorder)(nil)
+	_ fs.ReadDirFS = (*recorder)(nil)
+)
+
+func (r *recorder) log(e *event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_ = r.enc.Encode(e)
+}
+
+func (r *recorder) Open(name string) (fs.File, error) {
+	f, err := r.fsys.Open(name)
+	e := &event{Op: OpOpen, Path: name}
+	e.setErr(err)
+	if err == nil {
+		if i, err := f.Stat(); err == nil {
+			e.Info = newRecordInfo(i)
+		}
+	}
+	r.log(e)
+	if err != nil {
+		return nil, err
+	}
+	return &recordFile{File: f, r: r, name: name}, nil
+}
+
+func (r *recorder) Stat(name string) (fs.FileInfo, error) {
+	i, err := fs.Stat(r.fsys, name)
+	e := &event{Op: OpStat, Path: name}
+	e.setErr(err)
+	if err == nil {
+		e.Info = newRecordInfo(i)
+	}
+	r.log(e)
+	return i, err
+}
+
+func (r *recorder) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(r.fsys, name)
+	e := &event{Op: OpReadDir, Path: name, Entries: newRecordEntries(entries)}
+	e.setErr(err)
+	r.log(e)
+	return entries, err
+}
+
+type recordFile struct {
+	fs.File
+	r       *recorder
+	name    string
+	mu      sync.Mutex
+	read    *event
+	readDir *event
+}
+
+func (f *recordFile) Read(b []byte) (int, error) {
+	n, err := f.File.Read(b)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.read == nil {
+		f.read = &event{Op: OpRead, Path: f.name}
+	}
+	f.read.Data = append(f.read.Data, b[:n]...)
+	if err != nil && err != io.EOF && f.read.Error == "" {
+		f.read.setErr(err)
+	}
+	return n, err
+}
+
+func (f *recordFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	d, ok := f.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: OpReadDir, Path: f.name, Err: errors.New("not a directory")}
+	}
+	entries, err := d.ReadDir(n)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.readDir == nil {
+		f.readDir = &event{Op: OpReadDir, Path: f.name}
+	}
+	f.readDir.Entries = append(f.readDir.Entries, newRecordEntries(entries)...)
+	if err != nil && err != io.EOF && f.readDir.Error == "" {
+		f.readDir.setErr(err)
+	}
+	return entries, err
+}
+
+func (f *recordFile) Close() error {
+	f.mu.Lock()
+	read, readDir := f.read, f.readDir
+	f.read, f.readDir = nil, nil
+	f.mu.Unlock()
+	if read != nil {
+		f.r.log(read)
+	}
+	if readDir != nil {
+		f.r.log(readDir)
+	}
+	return f.File.Close()
+}
+
+// Replay returns a file system serving the responses recorded by Record
+// from r, e.g. to reproduce offline the behaviour of a remote backend. The
+// last recorded response of an operation on a path is served, the
+// operations missing from the recording failing with ErrNotRecorded. The
+// recorded errors are replayed with their message, fs.ErrNotExist,
+// fs.ErrPermission and the like remaining identifiable with errors.Is.
+func Replay(r io.Reader) (fs.FS, error) {
+	rp := &replayFS{events: make(map[string]*event)}
+	dec := json.NewDecoder(r)
+	for {
+		var e event
+		if err := dec.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		rp.events[e.Op+"\x00"+e.Path] = &e
+	}
+	return rp, nil
+}
+
+type replayFS struct {
+	events map[string]*event
+}
+
+var (
+	_ fs.StatFS    = (*replayFS)(nil)
+	_ fs.ReadDirFS = (*replayFS)(nil)
+)
+
+func (r *replayFS) event(op, name string) (*event, error) {
+	e, ok := r.events[op+"\x00"+name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: ErrNotRecorded}
+	}
+	return e, e.err()
+}
+
+func (r *replayFS) Open(name string) (fs.File, error) {
+	e, err := r.event(OpOpen, name)
+	if err != nil {
+		return nil, err
+	}
+	if e.Info == nil {
+		return nil, &fs.PathError{Op: OpOpen, Path: name, Err: ErrNotRecorded}
+	}
+	f := &replayFile{fs: r, name: name, info: e.Info}
+	if e, ok := r.events[OpRead+"\x00"+name]; ok {
+		f.data = bytes.NewReader(e.Data)
+		f.err = e.err()
+	}
+	return f, nil
+}
+
+func (r *replayFS) Stat(name string) (fs.FileInfo, error) {
+	e, err := r.event(OpStat, name)
+	if err == nil {
+		return replayInfo{e.Info}, nil
+	}
+	if !errors.Is(err, ErrNotRecorded) {
+		return nil, err
+	}
+	// fall back to the info of the opened file
+	if e, ok := r.events[OpOpen+"\x00"+name]; ok && e.Info != nil {
+		return replayInfo{e.Info}, nil
+	}
+	return nil, err
+}
+
+func (r *replayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := r.event(OpReadDir, name)
+	if err != nil {
+		return nil, err
+	}
+	return replayEntries(e.Entries), nil
+}
+
+func replayEntries(infos []recordInfo) []fs.DirEntry {
+	out := make([]fs.DirEntry, len(infos))
+	for i := range infos {
+		out[i] = replayInfo{&infos[i]}
+	}
+	return out
+}
+
+// replayInfo implements fs.FileInfo and fs.DirEntry from a recorded info.
+type replayInfo struct {
+	i *recordInfo
+}
+
+func (i replayInfo) Name() string               { return i.i.Name }
+func (i replayInfo) Size() int64                { return i.i.Size }
+func (i replayInfo) Mode() fs.FileMode          { return i.i.Mode }
+func (i replayInfo) ModTime() time.Time         { return i.i.ModTime }
+func (i replayInfo) IsDir() bool                { return i.i.Mode.IsDir() }
+func (i replayInfo) Sys() any                   { return nil }
+func (i replayInfo) Type() fs.FileMode          { return i.i.Mode.Type() }
+func (i replayInfo) Info() (fs.FileInfo, error) { return i, nil }
+func (i replayInfo) String() string             { return fs.FormatFileInfo(i) }
+
+type replayFile struct {
+	fs      *replayFS
+	name    string
+	info    *recordInfo
+	data    *bytes.Reader
+	err     error
+	entries []fs.DirEntry
+	listed  bool
+}
+
+func (f *replayFile) Stat() (fs.FileInfo, error) {
+	return replayInfo{f.info}, nil
+}
+
+func (f *replayFile) Read(b []byte) (int, error) {
+	if f.info.Mode.IsDir() {
+		return 0, &fs.PathError{Op: OpRead, Path: f.name, Err: errors.New("is a directory")}
+	}
+	if f.data == nil {
+		return 0, &fs.PathError{Op: OpRead, Path: f.name, Err: ErrNotRecorded}
+	}
+	n, err := f.data.Read(b)
+	if err == io.EOF && f.err != nil {
+		err = f.err
+	}
+	return n, err
+}
+
+func (f *replayFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.info.Mode.IsDir() {
+		return nil, &fs.PathError{Op: OpReadDir, Path: f.name, Err: errors.New("not a directory")}
+	}
+	if !f.listed {
+		e, err := f.fs.event(OpReadDir, f.name)
+		if err != nil {
+			return nil, err
+		}
+		f.entries, f.listed = replayEntries(e.Entries), true
+	}
+	if n <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(f.entries))
+	entries := f.entries[:n]
+	f.entries = f.entries[n:]
+	return entries, nil
+}
+
+func (f *replayFile) Close() error {
+	return nil
+}
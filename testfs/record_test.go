@@ -0,0 +1,76 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordReplay(t *testing.T) {
+	var buf bytes.Buffer
+	r := Record(fstest.MapFS{
+		"foo":     {Data: []byte("foobar")},
+		"dir/bar": {Data: []byte("bar")},
+	}, &buf)
+	require.NoError(t, fstest.TestFS(r, "foo", "dir/bar"))
+	_, err := fs.Stat(r, "missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	p, err := Replay(&buf)
+	require.NoError(t, err)
+	require.NoError(t, fstest.TestFS(p, "foo", "dir/bar"))
+	b, err := fs.ReadFile(p, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foobar", string(b))
+	entries, err := fs.ReadDir(p, "dir")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "bar", entries[0].Name())
+	_, err = fs.Stat(p, "missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = p.Open("other")
+	assert.ErrorIs(t, err, ErrNotRecorded)
+}
+
+func TestReplayReadError(t *testing.T) {
+	errBoom := errors.New("boom")
+	var buf bytes.Buffer
+	r := Record(New(fstest.MapFS{
+		"foo": {Data: []byte("foobar")},
+	}, Fault{Op: OpRead, Err: errBoom, After: 1}), &buf)
+	f, err := r.Open("foo")
+	require.NoError(t, err)
+	_, err = f.Read(make([]byte, 3))
+	require.NoError(t, err)
+	_, err = io.ReadAll(f)
+	assert.ErrorIs(t, err, errBoom)
+	require.NoError(t, f.Close())
+
+	p, err := Replay(&buf)
+	require.NoError(t, err)
+	f, err = p.Open("foo")
+	require.NoError(t, err)
+	b, err := io.ReadAll(f)
+	assert.EqualError(t, err, "read foo: boom")
+	assert.Equal(t, "foo", string(b))
+}
@@ -0,0 +1,303 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testfs provides a file system wrapper injecting errors, latencies
+// and short reads, to test the error handling of the code using a file
+// system against flaky backends, and to record and replay the operations
+// run on a file system.
+package testfs
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"sync"
+	"time"
+
+	"go.linka.cloud/mfs"
+)
+
+// The operations faults apply to.
+const (
+	OpOpen      = "open"
+	OpStat      = "stat"
+	OpReadDir   = "readdir"
+	OpRead      = "read"
+	OpWrite     = "write"
+	OpMkdir     = "mkdir"
+	OpRemove    = "remove"
+	OpRemoveAll = "removeall"
+	OpRename    = "rename"
+	OpChtimes   = "chtimes"
+	OpChmod     = "chmod"
+)
+
+// Fault describes a fault injected in the operations matching Op and
+// Pattern. The calls are counted per fault, which makes the injection
+// deterministic.
+type Fault struct {
+	// Op is the operation the fault applies to, all of them when empty.
+	// OpRead applies to the reads of the opened files, OpReadDir to both
+	// the file system and the opened directories listings.
+	Op string
+	// Pattern is matched against the path of the operations with
+	// path.Match, all of them matching when empty.
+	Pattern string
+	// Err is returned by the operation, wrapped in a *fs.PathError.
+	Err error
+	// Latency delays the operation.
+	Latency time.Duration
+	// ShortRead, when greater than 0, bounds the bytes returned by each
+	// read.
+	ShortRead int
+	// After lets the first After matching calls through.
+	After int
+	// Times, when greater than 0, bounds the number of injections.
+	Times int
+}
+
+type fault struct {
+	Fault
+	calls    int
+	injected int
+}
+
+// FS wraps a file system, injecting the faults in its operations. The
+// write operations are forwarded to the wrapped file system when it
+// supports them.
+type FS struct {
+	fsys   fs.FS
+	mu     sync.Mutex
+	faults []*fault
+}
+
+var (
+	_ fs.StatFS       = (*FS)(nil)
+	_ fs.ReadDirFS    = (*FS)(nil)
+	_ mfs.WritableMFS = (*FS)(nil)
+)
+
+// New returns a file system injecting faults in the operations of fsys.
+func New(fsys fs.FS, faults ...Fault) *FS {
+	f := &FS{fsys: fsys}
+	for _, v := range faults {
+		f.Inject(v)
+	}
+	return f
+}
+
+// Inject adds a fault, evaluated after the existing ones.
+func (f *FS) Inject(v Fault) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = append(f.faults, &fault{Fault: v})
+}
+
+// Reset removes all the faults.
+func (f *FS) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = nil
+}
+
+// inject applies the faults matching op on name, sleeping for their
+// latencies. It returns the error to fail the operation with and the short
+// read limit, 0 when none.
+func (f *FS) inject(op, name string) (int, error) {
+	var (
+		latency time.Duration
+		short   int
+		err     error
+	)
+	f.mu.Lock()
+	for _, v := range f.faults {
+		if v.Op != "" && v.Op != op {
+			continue
+		}
+		if v.Pattern != "" {
+			if ok, _ := path.Match(v.Pattern, name); !ok {
+				continue
+			}
+		}
+		v.calls++
+		if v.calls <= v.After || v.Times > 0 && v.injected >= v.Times {
+			continue
+		}
+		v.injected++
+		latency += v.Latency
+		if v.ShortRead > 0 && (short == 0 || v.ShortRead < short) {
+			short = v.ShortRead
+		}
+		if err == nil && v.Err != nil {
+			err = &fs.PathError{Op: op, Path: name, Err: v.Err}
+		}
+	}
+	f.mu.Unlock()
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	return short, err
+}
+
+// Unwrap returns the wrapped file system, see mfs.As.
+func (f *FS) Unwrap() fs.FS {
+	return f.fsys
+}
+
+func (f *FS) Open(name string) (fs.File, error) {
+	if _, err := f.inject(OpOpen, name); err != nil {
+		return nil, err
+	}
+	file, err := f.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &File{File: file, fs: f, name: name}, nil
+}
+
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	if _, err := f.inject(OpStat, name); err != nil {
+		return nil, err
+	}
+	return fs.Stat(f.fsys, name)
+}
+
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if _, err := f.inject(OpReadDir, name); err != nil {
+		return nil, err
+	}
+	return fs.ReadDir(f.fsys, name)
+}
+
+func unsupported(op, name string) error {
+	return &fs.PathError{Op: op, Path: name, Err: errors.ErrUnsupported}
+}
+
+func (f *FS) OpenFile(name string, flag int, perm fs.FileMode) (fs.File, error) {
+	w, ok := f.fsys.(mfs.OpenFileFS)
+	if !ok {
+		return nil, unsupported(OpOpen, name)
+	}
+	if _, err := f.inject(OpOpen, name); err != nil {
+		return nil, err
+	}
+	// the file is returned as is to keep its io.Writer
+	return w.OpenFile(name, flag, perm)
+}
+
+func (f *FS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	w, ok := f.fsys.(mfs.WriteFileFS)
+	if !ok {
+		return unsupported(OpWrite, name)
+	}
+	if _, err := f.inject(OpWrite, name); err != nil {
+		return err
+	}
+	return w.WriteFile(name, data, perm)
+}
+
+func (f *FS) MkdirAll(name string, perm fs.FileMode) error {
+	w, ok := f.fsys.(mfs.MkdirAllFS)
+	if !ok {
+		return unsupported(OpMkdir, name)
+	}
+	if _, err := f.inject(OpMkdir, name); err != nil {
+		return err
+	}
+	return w.MkdirAll(name, perm)
+}
+
+func (f *FS) Remove(name string) error {
+	w, ok := f.fsys.(mfs.RemoveFS)
+	if !ok {
+		return unsupported(OpRemove, name)
+	}
+	if _, err := f.inject(OpRemove, name); err != nil {
+		return err
+	}
+	return w.Remove(name)
+}
+
+func (f *FS) RemoveAll(name string) error {
+	w, ok := f.fsys.(mfs.RemoveAllFS)
+	if !ok {
+		return unsupported(OpRemoveAll, name)
+	}
+	if _, err := f.inject(OpRemoveAll, name); err != nil {
+		return err
+	}
+	return w.RemoveAll(name)
+}
+
+func (f *FS) Rename(oldname, newname string) error {
+	w, ok := f.fsys.(mfs.RenameFS)
+	if !ok {
+		return unsupported(OpRename, oldname)
+	}
+	if _, err := f.inject(OpRename, oldname); err != nil {
+		return err
+	}
+	return w.Rename(oldname, newname)
+}
+
+func (f *FS) Chtimes(name string, atime, mtime time.Time) error {
+	w, ok := f.fsys.(mfs.ChtimesFS)
+	if !ok {
+		return unsupported(OpChtimes, name)
+	}
+	if _, err := f.inject(OpChtimes, name); err != nil {
+		return err
+	}
+	return w.Chtimes(name, atime, mtime)
+}
+
+func (f *FS) Chmod(name string, mode fs.FileMode) error {
+	w, ok := f.fsys.(mfs.ChmodFS)
+	if !ok {
+		return unsupported(OpChmod, name)
+	}
+	if _, err := f.inject(OpChmod, name); err != nil {
+		return err
+	}
+	return w.Chmod(name, mode)
+}
+
+// File is a file opened from FS, injecting the faults in its reads.
+type File struct {
+	fs.File
+	fs   *FS
+	name string
+}
+
+func (f *File) Read(b []byte) (int, error) {
+	short, err := f.fs.inject(OpRead, f.name)
+	if err != nil {
+		return 0, err
+	}
+	if short > 0 && len(b) > short {
+		b = b[:short]
+	}
+	return f.File.Read(b)
+}
+
+func (f *File) ReadDir(n int) ([]fs.DirEntry, error) {
+	d, ok := f.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: OpReadDir, Path: f.name, Err: errors.New("not a directory")}
+	}
+	if _, err := f.fs.inject(OpReadDir, f.name); err != nil {
+		return nil, err
+	}
+	return d.ReadDir(n)
+}
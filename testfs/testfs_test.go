@@ -0,0 +1,74 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.linka.cloud/mfs"
+)
+
+func TestFS(t *testing.T) {
+	errBoom := errors.New("boom")
+	f := New(fstest.MapFS{
+		"foo":     {Data: []byte("foobar")},
+		"dir/bar": {Data: []byte("bar")},
+	})
+	require.NoError(t, fstest.TestFS(f, "foo", "dir/bar"))
+
+	f.Inject(Fault{Op: OpOpen, Pattern: "dir/*", Err: errBoom, After: 1, Times: 1})
+	_, err := f.Open("dir/bar")
+	require.NoError(t, err)
+	_, err = f.Open("dir/bar")
+	assert.ErrorIs(t, err, errBoom)
+	var pe *fs.PathError
+	require.True(t, errors.As(err, &pe))
+	assert.Equal(t, "dir/bar", pe.Path)
+	_, err = f.Open("dir/bar")
+	require.NoError(t, err)
+
+	f.Inject(Fault{Op: OpRead, Pattern: "foo", ShortRead: 2, Latency: 10 * time.Millisecond})
+	file, err := f.Open("foo")
+	require.NoError(t, err)
+	start := time.Now()
+	n, err := file.Read(make([]byte, 6))
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.GreaterOrEqual(t, time.Since(start), 10*time.Millisecond)
+	b, err := io.ReadAll(file)
+	require.NoError(t, err)
+	assert.Equal(t, "obar", string(b))
+
+	f.Reset()
+	f.Inject(Fault{Op: OpReadDir, Err: fs.ErrPermission})
+	_, err = fs.ReadDir(f, "dir")
+	assert.ErrorIs(t, err, fs.ErrPermission)
+	_, err = fs.Stat(f, "dir")
+	require.NoError(t, err)
+
+	// through an MFS
+	m, err := mfs.Mount("flaky", New(mfs.NewMemFS(), Fault{Op: OpWrite, Err: errBoom}))
+	require.NoError(t, err)
+	require.NoError(t, m.MkdirAll("flaky/dir", 0755))
+	assert.ErrorIs(t, m.WriteFile("flaky/dir/foo", nil, 0644), errBoom)
+}
@@ -0,0 +1,102 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tftp serves an MFS subtree over TFTP, e.g. for PXE boot.
+package tftp
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"net"
+	"path"
+	"strings"
+
+	"github.com/pin/tftp/v3"
+
+	"go.linka.cloud/mfs"
+)
+
+// Serve serves the regular files of m under root over TFTP on the UDP
+// address addr until ctx is done. The requested file names are resolved
+// relative to root, through the mount table of m: they cannot escape it.
+// Write requests are refused.
+func Serve(ctx context.Context, addr string, m mfs.MFS, root string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	return ServeConn(ctx, conn, m, root)
+}
+
+// ServeConn is like Serve with an already opened connection, which is
+// closed when ctx is done.
+func ServeConn(ctx context.Context, conn net.PacketConn, m mfs.MFS, root string) error {
+	s := tftp.NewServer(ReadHandler(m, root), nil)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Shutdown()
+		case <-done:
+		}
+	}()
+	if err := s.Serve(conn); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+// ReadHandler returns the tftp read handler serving the files of m under
+// root, see Serve.
+func ReadHandler(m mfs.MFS, root string) func(filename string, rf io.ReaderFrom) error {
+	root = strings.TrimPrefix(path.Clean("/"+root), "/")
+	return func(filename string, rf io.ReaderFrom) error {
+		name := resolve(root, filename)
+		f, err := m.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		i, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if !i.Mode().IsRegular() {
+			return &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		if t, ok := rf.(tftp.OutgoingTransfer); ok {
+			t.SetSize(i.Size())
+		}
+		_, err = rf.ReadFrom(f)
+		return err
+	}
+}
+
+// resolve returns the MFS name of the requested filename, which may be
+// rooted or use backslashes as some PXE clients do.
+func resolve(root, filename string) string {
+	name := strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(filename, `\`, "/")), "/")
+	switch {
+	case root == "" && name == "":
+		return "."
+	case root == "":
+		return name
+	case name == "":
+		return root
+	default:
+		return root + "/" + name
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tftp
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/pin/tftp/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.linka.cloud/mfs"
+)
+
+func TestServe(t *testing.T) {
+	kernel := strings.Repeat("k", 3000)
+	m, err := mfs.Mount("boot", fstest.MapFS{
+		"pxelinux.0":           {Data: []byte("pxe")},
+		"pxelinux.cfg/default": {Data: []byte("default")},
+		"images/vmlinuz":       {Data: []byte(kernel)},
+	})
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("other", fstest.MapFS{"secret": {Data: []byte("secret")}}))
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() { errs <- ServeConn(ctx, conn, m, "/boot") }()
+
+	c, err := tftp.NewClient(conn.LocalAddr().String())
+	require.NoError(t, err)
+	c.SetTimeout(time.Second)
+	c.SetRetries(1)
+	get := func(name string) (string, error) {
+		wt, err := c.Receive(name, "octet")
+		if err != nil {
+			return "", err
+		}
+		var b bytes.Buffer
+		_, err = wt.WriteTo(&b)
+		return b.String(), err
+	}
+
+	for name, want := range map[string]string{
+		"pxelinux.0":            "pxe",
+		"/pxelinux.cfg/default": "default",
+		`pxelinux.cfg\default`:  "default",
+		"images/vmlinuz":        kernel,
+		"../../images/vmlinuz":  kernel,
+		"/images/../pxelinux.0": "pxe",
+	} {
+		got, err := get(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, want, got, name)
+	}
+	for _, name := range []string{"missing", "images", "../other/secret"} {
+		_, err := get(name)
+		assert.Error(t, err, name)
+	}
+	_, err = c.Send("upload", "octet")
+	if err == nil {
+		t.Fatal("write request accepted")
+	}
+
+	cancel()
+	select {
+	case err := <-errs:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop")
+	}
+}
@@ -0,0 +1,352 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package thumbfs provides a read-only file system exposing resized
+// variants of the images of another file system, e.g. an MFS mount, turning
+// an MFS into a simple asset pipeline:
+//
+//	sub, _ := fs.Sub(m, "photos")
+//	m.Mount(".thumbs", thumbfs.New(sub))
+//
+// The image at path is exposed at "<width>/<path>", scaled down to width
+// keeping its aspect ratio, e.g. ".thumbs/200/photo.jpg". Images narrower
+// than width are exposed unchanged. The variants are rendered on first read
+// and cached until their original is modified.
+package thumbfs
+
+import (
+	"bytes"
+	"container/list"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/draw"
+)
+
+// Option configures the file system.
+type Option func(o *options)
+
+type options struct {
+	widths  []int
+	cache   int
+	quality int
+}
+
+// WithWidths sets the widths the variants are available in. It defaults to
+// 128, 256 and 512.
+func WithWidths(widths ...int) Option {
+	return func(o *options) {
+		o.widths = widths
+	}
+}
+
+// WithCacheSize sets how many variants are cached. It defaults to 256.
+func WithCacheSize(n int) Option {
+	return func(o *options) {
+		o.cache = n
+	}
+}
+
+// WithJPEGQuality sets the quality of the JPEG variants, from 1 to 100. It
+// defaults to jpeg.DefaultQuality.
+func WithJPEGQuality(q int) Option {
+	return func(o *options) {
+		o.quality = q
+	}
+}
+
+// New returns a file system exposing the JPEG, PNG and GIF images of fsys
+// resized to the configured widths. The directories of fsys are listed
+// under each width with their images only.
+func New(fsys fs.FS, opts ...Option) fs.FS {
+	o := &options{widths: []int{128, 256, 512}, cache: 256, quality: jpeg.DefaultQuality}
+	for _, v := range opts {
+		v(o)
+	}
+	return &thumbFS{fsys: fsys, o: o, entries: make(map[string]*list.Element), lru: list.New()}
+}
+
+type thumbFS struct {
+	fsys fs.FS
+	o    *options
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type variant struct {
+	key     string
+	modTime time.Time
+	size    int64
+	data    []byte
+}
+
+// split returns the width and the path of the original image of name.
+func (t *thumbFS) split(op, name string) (int, string, error) {
+	if !fs.ValidPath(name) {
+		return 0, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	w, rel, ok := strings.Cut(name, "/")
+	if !ok {
+		rel = "."
+	}
+	width, err := strconv.Atoi(w)
+	if err != nil || !slices.Contains(t.o.widths, width) || w != strconv.Itoa(width) {
+		return 0, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return width, rel, nil
+}
+
+func (t *thumbFS) Open(name string) (fs.File, error) {
+	if name == "." {
+		return &dir{t: t, name: name}, nil
+	}
+	width, rel, err := t.split("open", name)
+	if err != nil {
+		return nil, err
+	}
+	i, err := fs.Stat(t.fsys, rel)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: unwrap(err)}
+	}
+	if i.IsDir() {
+		return &dir{t: t, name: name}, nil
+	}
+	if !isImage(rel) || !i.Mode().IsRegular() {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	v, err := t.variant(name, rel, width, i)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &file{Reader: bytes.NewReader(v.data), info: &info{name: path.Base(name), size: int64(len(v.data)), modTime: i.ModTime()}}, nil
+}
+
+func (t *thumbFS) Stat(name string) (fs.FileInfo, error) {
+	f, err := t.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+func (t *thumbFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name == "." {
+		ws := slices.Clone(t.o.widths)
+		slices.Sort(ws)
+		ds := make([]fs.DirEntry, 0, len(ws))
+		for _, w := range slices.Compact(ws) {
+			ds = append(ds, fs.FileInfoToDirEntry(&info{name: strconv.Itoa(w), dir: true}))
+		}
+		return ds, nil
+	}
+	_, rel, err := t.split("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	ds, err := fs.ReadDir(t.fsys, rel)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: unwrap(err)}
+	}
+	res := make([]fs.DirEntry, 0, len(ds))
+	for _, d := range ds {
+		switch {
+		case d.IsDir():
+			res = append(res, d)
+		case d.Type().IsRegular() && isImage(d.Name()):
+			res = append(res, &entry{DirEntry: d, t: t, path: name + "/" + d.Name()})
+		}
+	}
+	return res, nil
+}
+
+// variant returns the variant of the image rel at width, rendering it if it
+// is not cached or its original i was modified since.
+func (t *thumbFS) variant(key, rel string, width int, i fs.FileInfo) (*variant, error) {
+	t.mu.Lock()
+	if e, ok := t.entries[key]; ok {
+		v := e.Value.(*variant)
+		if v.modTime.Equal(i.ModTime()) && v.size == i.Size() {
+			t.lru.MoveToFront(e)
+			t.mu.Unlock()
+			return v, nil
+		}
+		t.lru.Remove(e)
+		delete(t.entries, key)
+	}
+	t.mu.Unlock()
+	b, err := t.render(rel, width)
+	if err != nil {
+		return nil, err
+	}
+	v := &variant{key: key, modTime: i.ModTime(), size: i.Size(), data: b}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if e, ok := t.entries[key]; ok {
+		t.lru.Remove(e)
+	}
+	t.entries[key] = t.lru.PushFront(v)
+	for t.lru.Len() > t.o.cache {
+		e := t.lru.Back()
+		t.lru.Remove(e)
+		delete(t.entries, e.Value.(*variant).key)
+	}
+	return v, nil
+}
+
+func (t *thumbFS) render(rel string, width int) ([]byte, error) {
+	f, err := t.fsys.Open(rel)
+	if err != nil {
+		return nil, unwrap(err)
+	}
+	defer f.Close()
+	src, format, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	b := src.Bounds()
+	dst := src
+	if b.Dx() > width {
+		height := max(1, b.Dy()*width/b.Dx())
+		r := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(r, r.Bounds(), src, b, draw.Src, nil)
+		dst = r
+	}
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: t.o.quality})
+	case "gif":
+		err = gif.Encode(&buf, dst, nil)
+	default:
+		err = png.Encode(&buf, dst)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func isImage(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return true
+	}
+	return false
+}
+
+// unwrap returns the underlying error of a *fs.PathError, for the errors to
+// be reported with the path of the variant.
+func unwrap(err error) error {
+	if e, ok := err.(*fs.PathError); ok {
+		return e.Err
+	}
+	return err
+}
+
+// entry defers the rendering until Info is called.
+type entry struct {
+	fs.DirEntry
+	t    *thumbFS
+	path string
+}
+
+func (e *entry) Info() (fs.FileInfo, error) {
+	return e.t.Stat(e.path)
+}
+
+type file struct {
+	*bytes.Reader
+	info *info
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *file) Close() error {
+	return nil
+}
+
+type dir struct {
+	t    *thumbFS
+	name string
+	ds   []fs.DirEntry
+	read bool
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) {
+	return &info{name: path.Base(d.name), dir: true}, nil
+}
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: fs.ErrInvalid}
+}
+
+func (d *dir) Close() error {
+	return nil
+}
+
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		ds, err := d.t.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.ds, d.read = ds, true
+	}
+	if n <= 0 {
+		ds := d.ds
+		d.ds = nil
+		return ds, nil
+	}
+	if len(d.ds) == 0 {
+		return nil, io.EOF
+	}
+	ds := d.ds[:min(n, len(d.ds))]
+	d.ds = d.ds[len(ds):]
+	return ds, nil
+}
+
+type info struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i *info) Name() string       { return i.name }
+func (i *info) Size() int64        { return i.size }
+func (i *info) ModTime() time.Time { return i.modTime }
+func (i *info) IsDir() bool        { return i.dir }
+func (i *info) Sys() any           { return nil }
+
+func (i *info) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
@@ -0,0 +1,137 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package thumbfs
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.linka.cloud/mfs"
+)
+
+func encode(t *testing.T, w, h int, enc func(*bytes.Buffer, image.Image) error) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := range w {
+		for y := range h {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, enc(&buf, img))
+	return buf.Bytes()
+}
+
+func pngEnc(b *bytes.Buffer, img image.Image) error {
+	return png.Encode(b, img)
+}
+
+func jpegEnc(b *bytes.Buffer, img image.Image) error {
+	return jpeg.Encode(b, img, nil)
+}
+
+func TestThumbFS(t *testing.T) {
+	src := fstest.MapFS{
+		"photo.jpg":      {Data: encode(t, 400, 200, jpegEnc), ModTime: time.Unix(1, 0)},
+		"icons/logo.png": {Data: encode(t, 64, 64, pngEnc)},
+		"notes.txt":      {Data: []byte("not an image")},
+	}
+	fsys := New(src, WithWidths(100, 200))
+
+	ds, err := fs.ReadDir(fsys, ".")
+	require.NoError(t, err)
+	require.Len(t, ds, 2)
+	assert.Equal(t, "100", ds[0].Name())
+	assert.True(t, ds[0].IsDir())
+
+	ds, err = fs.ReadDir(fsys, "100")
+	require.NoError(t, err)
+	require.Len(t, ds, 2)
+	assert.Equal(t, "icons", ds[0].Name())
+	assert.Equal(t, "photo.jpg", ds[1].Name())
+
+	b, err := fs.ReadFile(fsys, "100/photo.jpg")
+	require.NoError(t, err)
+	img, format, err := image.Decode(bytes.NewReader(b))
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+	assert.Equal(t, image.Rect(0, 0, 100, 50), img.Bounds())
+
+	i, err := ds[1].Info()
+	require.NoError(t, err)
+	assert.EqualValues(t, len(b), i.Size())
+	assert.Equal(t, time.Unix(1, 0), i.ModTime())
+
+	b, err = fs.ReadFile(fsys, "100/icons/logo.png")
+	require.NoError(t, err)
+	img, format, err = image.Decode(bytes.NewReader(b))
+	require.NoError(t, err)
+	assert.Equal(t, "png", format)
+	assert.Equal(t, image.Rect(0, 0, 64, 64), img.Bounds())
+
+	for _, v := range []string{"300/photo.jpg", "100/notes.txt", "100/missing.png", "0100/photo.jpg"} {
+		_, err = fs.ReadFile(fsys, v)
+		assert.ErrorIs(t, err, fs.ErrNotExist, v)
+	}
+
+	require.NoError(t, fstest.TestFS(fsys, "100/photo.jpg", "200/icons/logo.png"))
+}
+
+func TestThumbFSCache(t *testing.T) {
+	src := fstest.MapFS{
+		"a.png": {Data: encode(t, 200, 200, pngEnc)},
+		"b.png": {Data: encode(t, 200, 200, pngEnc)},
+	}
+	fsys := New(src, WithWidths(50), WithCacheSize(1)).(*thumbFS)
+
+	_, err := fs.ReadFile(fsys, "50/a.png")
+	require.NoError(t, err)
+	_, err = fs.ReadFile(fsys, "50/b.png")
+	require.NoError(t, err)
+	assert.Len(t, fsys.entries, 1)
+	assert.Contains(t, fsys.entries, "50/b.png")
+
+	src["b.png"] = &fstest.MapFile{Data: encode(t, 300, 100, pngEnc), ModTime: time.Unix(2, 0)}
+	b, err := fs.ReadFile(fsys, "50/b.png")
+	require.NoError(t, err)
+	img, _, err := image.Decode(bytes.NewReader(b))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 50, 16), img.Bounds())
+}
+
+func TestThumbFSMount(t *testing.T) {
+	mem := mfs.NewMemFS()
+	require.NoError(t, mem.WriteFile("photo.png", encode(t, 256, 128, pngEnc), 0644))
+	m, err := mfs.Mount("photos", mem)
+	require.NoError(t, err)
+	sub, err := fs.Sub(m, "photos")
+	require.NoError(t, err)
+	require.NoError(t, m.Mount(".thumbs", New(sub)))
+
+	b, err := fs.ReadFile(m, ".thumbs/128/photo.png")
+	require.NoError(t, err)
+	img, _, err := image.Decode(bytes.NewReader(b))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 128, 64), img.Bounds())
+}
@@ -0,0 +1,221 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WithTimeout bounds the operations run against the mounted file system,
+// see Timeout.
+func WithTimeout(d time.Duration) MountOption {
+	return func(o *mountOptions) {
+		o.timeout = d
+	}
+}
+
+// Timeout returns a file system failing the operations of fsys not
+// completed within d with a *fs.PathError wrapping context.DeadlineExceeded:
+// opening, listing and stating files, reading them and the write
+// operations. Each call runs in a goroutine of its own, left running in the
+// background after a timeout until fsys returns: Timeout bounds the wait of
+// the callers, not the work of fsys. The files opened by the calls timed out
+// are closed once they return. The reads following a timed out one fail, the
+// offset of the file being unknown: such a file should be closed. The files
+// implement fs.File, fs.ReadDirFile, io.Seeker and io.ReaderAt, the last two
+// failing with errors.ErrUnsupported when the files of fsys do not.
+func Timeout(fsys fs.FS, d time.Duration) fs.FS {
+	return &timeoutFS{forwardFS: forwardFS{fsys: fsys, call: func(op, name string, fn func() error) error {
+		return boundedErr(d, op, name, fn)
+	}}, d: d}
+}
+
+type timeoutFS struct {
+	forwardFS
+	d time.Duration
+}
+
+type timeoutResult[T any] struct {
+	v   T
+	err error
+}
+
+// bounded runs fn, failing when it does not return within d. cleanup, if
+// not nil, releases the value returned by fn after the timeout.
+func bounded[T any](d time.Duration, op, name string, fn func() (T, error), cleanup func(T)) (T, error) {
+	ch := make(chan timeoutResult[T], 1)
+	go func() {
+		v, err := fn()
+		ch <- timeoutResult[T]{v: v, err: err}
+	}()
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case r := <-ch:
+		return r.v, r.err
+	case <-t.C:
+		if cleanup != nil {
+			go func() {
+				if r := <-ch; r.err == nil {
+					cleanup(r.v)
+				}
+			}()
+		}
+		var zero T
+		return zero, &fs.PathError{Op: op, Path: name, Err: context.DeadlineExceeded}
+	}
+}
+
+// readBufs pools the buffers of the bounded reads, see boundedRead.
+var readBufs = sync.Pool{New: func() any { return new([]byte) }}
+
+// maxReadBuf is the size of the largest buffer kept in readBufs.
+const maxReadBuf = 1 << 20
+
+// boundedRead is bounded for the reads in b: read runs in a buffer of its
+// own as the call may outlive this one, pooled once both returned.
+func boundedRead(d time.Duration, op, name string, b []byte, read func([]byte) (int, error)) (int, error) {
+	p := readBufs.Get().(*[]byte)
+	if cap(*p) < len(b) {
+		*p = make([]byte, len(b))
+	}
+	buf := (*p)[:len(b)]
+	var refs atomic.Int32
+	release := func() {
+		if refs.Add(1) == 2 && cap(*p) <= maxReadBuf {
+			readBufs.Put(p)
+		}
+	}
+	defer release()
+	n, err := bounded(d, op, name, func() (int, error) {
+		defer release()
+		return read(buf)
+	}, nil)
+	// n is 0 after a timeout, buf being still owned by read
+	return copy(b, buf[:n]), err
+}
+
+// boundedErr is bounded for the functions only returning an error.
+func boundedErr(d time.Duration, op, name string, fn func() error) error {
+	_, err := bounded(d, op, name, func() (struct{}, error) {
+		return struct{}{}, fn()
+	}, nil)
+	return err
+}
+
+func (t *timeoutFS) Open(name string) (fs.File, error) {
+	f, err := bounded(t.d, "open", name, func() (fs.File, error) {
+		return t.fsys.Open(name)
+	}, func(f fs.File) {
+		f.Close()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &timeoutFile{File: f, d: t.d, name: name}, nil
+}
+
+func (t *timeoutFS) Stat(name string) (fs.FileInfo, error) {
+	return bounded(t.d, "stat", name, func() (fs.FileInfo, error) {
+		return fs.Stat(t.fsys, name)
+	}, nil)
+}
+
+func (t *timeoutFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return bounded(t.d, "readdir", name, func() ([]fs.DirEntry, error) {
+		return fs.ReadDir(t.fsys, name)
+	}, nil)
+}
+
+func (t *timeoutFS) ReadDirPage(name, token string, n int) ([]fs.DirEntry, string, error) {
+	return readDirPage(t.fsys, name, token, n, func(fn func() (page, error)) (page, error) {
+		return bounded(t.d, "readdir", name, fn, nil)
+	})
+}
+
+func (t *timeoutFS) OpenFile(name string, flag int, perm fs.FileMode) (fs.File, error) {
+	w, ok := t.fsys.(OpenFileFS)
+	if !ok {
+		return nil, unsupported("open", name)
+	}
+	// the written files are returned as is to keep their io.Writer
+	return bounded(t.d, "open", name, func() (fs.File, error) {
+		return w.OpenFile(name, flag, perm)
+	}, func(f fs.File) {
+		f.Close()
+	})
+}
+
+type timeoutFile struct {
+	fs.File
+	d    time.Duration
+	name string
+	// timedOut reports a read having timed out, leaving the offset unknown.
+	timedOut atomic.Bool
+}
+
+func (f *timeoutFile) Stat() (fs.FileInfo, error) {
+	return bounded(f.d, "stat", f.name, f.File.Stat, nil)
+}
+
+func (f *timeoutFile) Read(b []byte) (int, error) {
+	if f.timedOut.Load() {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: context.DeadlineExceeded}
+	}
+	n, err := boundedRead(f.d, "read", f.name, b, f.File.Read)
+	if errors.Is(err, context.DeadlineExceeded) {
+		f.timedOut.Store(true)
+	}
+	return n, err
+}
+
+func (f *timeoutFile) ReadAt(b []byte, off int64) (int, error) {
+	r, ok := f.File.(io.ReaderAt)
+	if !ok {
+		return 0, unsupported("read", f.name)
+	}
+	return boundedRead(f.d, "read", f.name, b, func(buf []byte) (int, error) {
+		return r.ReadAt(buf, off)
+	})
+}
+
+func (f *timeoutFile) Seek(offset int64, whence int) (int64, error) {
+	s, ok := f.File.(io.Seeker)
+	if !ok {
+		return 0, unsupported("seek", f.name)
+	}
+	if f.timedOut.Load() {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: context.DeadlineExceeded}
+	}
+	return bounded(f.d, "seek", f.name, func() (int64, error) {
+		return s.Seek(offset, whence)
+	}, nil)
+}
+
+func (f *timeoutFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	d, ok := f.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errors.New("not a directory")}
+	}
+	return bounded(f.d, "readdir", f.name, func() ([]fs.DirEntry, error) {
+		return d.ReadDir(n)
+	}, nil)
+}
@@ -0,0 +1,154 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hangFS blocks the operations on the paths starting with "hang" until
+// release is closed.
+type hangFS struct {
+	*MemFS
+	release chan struct{}
+}
+
+func (h *hangFS) wait(name string) {
+	if len(name) >= 4 && name[:4] == "hang" {
+		<-h.release
+	}
+}
+
+func (h *hangFS) Open(name string) (fs.File, error) {
+	h.wait(name)
+	return h.MemFS.Open(name)
+}
+
+func (h *hangFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	h.wait(name)
+	return h.MemFS.WriteFile(name, data, perm)
+}
+
+func TestTimeout(t *testing.T) {
+	mem := NewMemFS()
+	require.NoError(t, mem.WriteFile("foo", data["foo"], 0644))
+	require.NoError(t, mem.WriteFile("hang", data["foo"], 0644))
+	h := &hangFS{MemFS: mem, release: make(chan struct{})}
+	defer close(h.release)
+	m, err := Mount("slow", h, WithTimeout(20*time.Millisecond))
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("other", fstest.MapFS{"foo": {Data: data["foo"]}}))
+
+	b, err := fs.ReadFile(m, "slow/foo")
+	require.NoError(t, err)
+	assert.Equal(t, data["foo"], b)
+
+	start := time.Now()
+	_, err = m.Open("slow/hang")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	var pe *fs.PathError
+	require.True(t, errors.As(err, &pe))
+	assert.Less(t, time.Since(start), time.Second)
+	assert.ErrorIs(t, m.WriteFile("slow/hang2", nil, 0644), context.DeadlineExceeded)
+	require.NoError(t, m.WriteFile("slow/bar", data["foo"], 0644))
+
+	_, err = fs.ReadFile(m, "other/foo")
+	require.NoError(t, err)
+}
+
+// plainFS returns files only implementing fs.File.
+type plainFS struct {
+	fs.FS
+}
+
+func (p plainFS) Open(name string) (fs.File, error) {
+	f, err := p.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return struct{ fs.File }{f}, nil
+}
+
+// testSeekReadAt checks that the files of the file systems returned by wrap
+// forward io.Seeker and io.ReaderAt.
+func testSeekReadAt(t *testing.T, wrap func(fs.FS) fs.FS) {
+	mem := NewMemFS()
+	require.NoError(t, mem.WriteFile("foo", []byte("foobar"), 0644))
+	f, err := wrap(mem).Open("foo")
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.(io.Seeker).Seek(3, io.SeekStart)
+	require.NoError(t, err)
+	b, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(b))
+	b = make([]byte, 3)
+	_, err = f.(io.ReaderAt).ReadAt(b, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(b))
+
+	f, err = wrap(plainFS{mem}).Open("foo")
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.(io.Seeker).Seek(3, io.SeekStart)
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+	_, err = f.(io.ReaderAt).ReadAt(b, 0)
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+}
+
+// hangFile blocks its reads until release is closed.
+type hangFile struct {
+	*memFile
+	release chan struct{}
+}
+
+func (h *hangFile) Read(b []byte) (int, error) {
+	<-h.release
+	return h.memFile.Read(b)
+}
+
+func TestTimeoutFile(t *testing.T) {
+	testSeekReadAt(t, func(fsys fs.FS) fs.FS {
+		return Timeout(fsys, time.Minute)
+	})
+
+	mem := NewMemFS()
+	require.NoError(t, mem.WriteFile("foo", []byte("foobar"), 0644))
+	f, err := mem.Open("foo")
+	require.NoError(t, err)
+	h := &hangFile{memFile: f.(*memFile), release: make(chan struct{})}
+	tf := &timeoutFile{File: h, d: 20 * time.Millisecond, name: "foo"}
+	b := make([]byte, 3)
+	_, err = tf.Read(b)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	close(h.release)
+	// the offset is unknown once a read timed out
+	_, err = tf.Read(b)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = tf.Seek(0, io.SeekStart)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = tf.ReadAt(b, 3)
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(b))
+}
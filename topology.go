@@ -0,0 +1,141 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Topology is a node of the composition of an MFS returned by
+// MFS.Topology: the MFS itself, one of its mounts or a file system. The
+// children of an MFS are its mounts, the one of a mount is its file system,
+// and the ones of a file system are the file systems it wraps or composes,
+// e.g. the layers of an overlay, the file systems of a Failover or the one
+// wrapped by a middleware implementing Unwrap() fs.FS.
+type Topology struct {
+	// Label is the mount point of the mounts, the Go type of the MFS and
+	// of the file systems.
+	Label string
+	// Mount reports whether the node is a mount.
+	Mount    bool
+	Children []*Topology
+}
+
+func (m *mfs) Topology() *Topology {
+	return m.topology(map[*state]bool{})
+}
+
+// topology returns the topology of m, seen holding the MFS being described
+// to stop at the ones mounted within themselves.
+func (m *mfs) topology(seen map[*state]bool) *Topology {
+	t := &Topology{Label: fmt.Sprintf("%T", m)}
+	if seen[m.state] {
+		return t
+	}
+	seen[m.state] = true
+	defer delete(seen, m.state)
+	var mounts []*mount
+	for _, v := range m.load().mounts {
+		mounts = append(mounts, v)
+	}
+	sort.Slice(mounts, func(i, j int) bool { return mounts[i].path < mounts[j].path })
+	for _, v := range mounts {
+		label := "/"
+		if v.path != "." {
+			label += v.path
+		}
+		t.Children = append(t.Children, &Topology{Label: label, Mount: true, Children: []*Topology{fsTopology(v.fs, seen)}})
+	}
+	return t
+}
+
+func fsTopology(fsys fs.FS, seen map[*state]bool) *Topology {
+	switch v := fsys.(type) {
+	case *mfs:
+		return v.topology(seen)
+	case interface{ components() []fs.FS }:
+		t := &Topology{Label: fmt.Sprintf("%T", fsys)}
+		for _, c := range v.components() {
+			t.Children = append(t.Children, fsTopology(c, seen))
+		}
+		return t
+	case interface{ Unwrap() fs.FS }:
+		t := &Topology{Label: fmt.Sprintf("%T", fsys)}
+		if u := v.Unwrap(); u != nil {
+			t.Children = []*Topology{fsTopology(u, seen)}
+		}
+		return t
+	}
+	return &Topology{Label: fmt.Sprintf("%T", fsys)}
+}
+
+// walk calls fn with the nodes of the topology in depth-first order, along
+// with their id and the id of their parent, -1 for t.
+func (t *Topology) walk(fn func(n *Topology, id, parent int)) {
+	id := 0
+	var walk func(n *Topology, parent int)
+	walk = func(n *Topology, parent int) {
+		cur := id
+		id++
+		fn(n, cur, parent)
+		for _, v := range n.Children {
+			walk(v, cur)
+		}
+	}
+	walk(t, -1)
+}
+
+// DOT renders the topology as a Graphviz graph, the mounts being drawn as
+// folders.
+func (t *Topology) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph mfs {\n")
+	t.walk(func(n *Topology, id, parent int) {
+		shape := "box"
+		if n.Mount {
+			shape = "folder"
+		}
+		fmt.Fprintf(&b, "\tn%d [label=%s, shape=%s];\n", id, strconv.Quote(n.Label), shape)
+		if parent >= 0 {
+			fmt.Fprintf(&b, "\tn%d -> n%d;\n", parent, id)
+		}
+	})
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Mermaid renders the topology as a Mermaid flowchart, the mounts being
+// drawn as stadiums.
+func (t *Topology) Mermaid() string {
+	var b strings.Builder
+	b.WriteString("graph TD\n")
+	t.walk(func(n *Topology, id, parent int) {
+		label := `"` + strings.ReplaceAll(n.Label, `"`, "#quot;") + `"`
+		if n.Mount {
+			label = "([" + label + "])"
+		} else {
+			label = "[" + label + "]"
+		}
+		fmt.Fprintf(&b, "\tn%d%s\n", id, label)
+		if parent >= 0 {
+			fmt.Fprintf(&b, "\tn%d --> n%d\n", parent, id)
+		}
+	})
+	return b.String()
+}
@@ -0,0 +1,71 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopology(t *testing.T) {
+	inner := New()
+	require.NoError(t, inner.Mount("b", NewMemFS()))
+	m := New()
+	require.NoError(t, m.Mount("cdn", Failover(fstest.MapFS{}, NewMemFS()), WithTimeout(time.Second)))
+	require.NoError(t, m.Mount("layers", NewMemFS()))
+	require.NoError(t, m.Mount("layers", fstest.MapFS{}, WithShadowing(StackAbove)))
+	require.NoError(t, m.Mount("nested", inner))
+	require.NoError(t, m.Mount("self", m))
+
+	top := m.Topology()
+	assert.Equal(t, "*mfs.mfs", top.Label)
+	require.Len(t, top.Children, 4)
+	cdn := top.Children[0]
+	assert.Equal(t, "/cdn", cdn.Label)
+	assert.True(t, cdn.Mount)
+	require.Len(t, cdn.Children, 1)
+	timeout := cdn.Children[0]
+	require.Len(t, timeout.Children, 1)
+	failover := timeout.Children[0]
+	assert.Equal(t, "*mfs.FailoverFS", failover.Label)
+	require.Len(t, failover.Children, 2)
+	assert.Equal(t, "fstest.MapFS", failover.Children[0].Label)
+	assert.Equal(t, "*mfs.MemFS", failover.Children[1].Label)
+	assert.Len(t, top.Children[1].Children[0].Children, 2)
+	assert.Equal(t, "/b", top.Children[2].Children[0].Children[0].Label)
+	assert.Empty(t, top.Children[3].Children[0].Children)
+
+	m = New()
+	require.NoError(t, m.Mount("data", NewMemFS()))
+	assert.Equal(t, `digraph mfs {
+	n0 [label="*mfs.mfs", shape=box];
+	n1 [label="/data", shape=folder];
+	n0 -> n1;
+	n2 [label="*mfs.MemFS", shape=box];
+	n1 -> n2;
+}
+`, m.Topology().DOT())
+	assert.Equal(t, `graph TD
+	n0["*mfs.mfs"]
+	n1(["/data"])
+	n0 --> n1
+	n2["*mfs.MemFS"]
+	n1 --> n2
+`, m.Topology().Mermaid())
+}
@@ -0,0 +1,232 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// TransformFunc returns the content to expose for the file at path, the
+// original content being read from r. The path is relative to the mount
+// point.
+type TransformFunc func(path string, r io.Reader) (io.Reader, error)
+
+// Transform returns a file system whose regular files are rewritten by fn on
+// read. As the transformed size cannot be known upfront, Stat buffers the
+// rest of the transformed content to compute it, the size being remembered
+// until the file changes. The write operations are forwarded as is, the
+// content written not being transformed.
+func Transform(fsys fs.FS, fn TransformFunc) fs.FS {
+	t := &transformFS{fn: fn}
+	t.forwardFS = forwardFS{fsys: fsys, readDir: t.ReadDir}
+	return t
+}
+
+type transformFS struct {
+	forwardFS
+	fn    TransformFunc
+	sizes sizeCache
+}
+
+// components returns the wrapped file system, see Topology.
+func (t *transformFS) components() []fs.FS {
+	return []fs.FS{t.fsys}
+}
+
+func (t *transformFS) Open(name string) (fs.File, error) {
+	f, err := t.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	s, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !s.Mode().IsRegular() {
+		return f, nil
+	}
+	r, err := t.fn(name, f)
+	if err != nil {
+		f.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &transformFile{File: f, r: r, sizes: &t.sizes, path: name}, nil
+}
+
+func (t *transformFS) Stat(name string) (fs.FileInfo, error) {
+	s, err := fs.Stat(t.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if !s.Mode().IsRegular() {
+		return s, nil
+	}
+	if n, ok := t.sizes.get(name, s); ok {
+		return &sizedInfo{FileInfo: s, size: n}, nil
+	}
+	f, err := t.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+func (t *transformFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	ds, err := fs.ReadDir(t.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	for i, d := range ds {
+		if d.Type().IsRegular() {
+			ds[i] = &transformEntry{DirEntry: d, t: t, path: joinMountPath(name, d.Name())}
+		}
+	}
+	return ds, nil
+}
+
+// Lstat reports the transformed size of the regular files, as Stat does.
+func (t *transformFS) Lstat(name string) (fs.FileInfo, error) {
+	i, err := Lstat(t.fsys, name)
+	if err != nil || !i.Mode().IsRegular() {
+		return i, err
+	}
+	return t.Stat(name)
+}
+
+// transformEntry defers the computation of the transformed size until Info
+// is called.
+type transformEntry struct {
+	fs.DirEntry
+	t    *transformFS
+	path string
+}
+
+func (e *transformEntry) Info() (fs.FileInfo, error) {
+	return e.t.Stat(e.path)
+}
+
+type transformFile struct {
+	fs.File
+	r io.Reader
+	// name overrides the name of the underlying file when not empty
+	name string
+	read int64
+	buf  *bytes.Reader
+	// sizes remembers the size of the file, found under path, once known
+	sizes *sizeCache
+	path  string
+}
+
+func (f *transformFile) Read(b []byte) (int, error) {
+	if f.buf != nil {
+		return f.buf.Read(b)
+	}
+	n, err := f.r.Read(b)
+	f.read += int64(n)
+	if err == io.EOF {
+		if s, serr := f.File.Stat(); serr == nil {
+			f.sizes.set(f.path, s, f.read)
+		}
+	}
+	return n, err
+}
+
+func (f *transformFile) Stat() (fs.FileInfo, error) {
+	s, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if n, ok := f.sizes.get(f.path, s); ok && f.buf == nil {
+		return &sizedInfo{FileInfo: s, name: f.name, size: n}, nil
+	}
+	if f.buf == nil {
+		b, err := io.ReadAll(f.r)
+		if err != nil {
+			return nil, err
+		}
+		f.buf = bytes.NewReader(b)
+	}
+	f.sizes.set(f.path, s, f.read+f.buf.Size())
+	return &sizedInfo{FileInfo: s, name: f.name, size: f.read + f.buf.Size()}, nil
+}
+
+func (f *transformFile) Close() error {
+	if c, ok := f.r.(io.Closer); ok {
+		c.Close()
+	}
+	return f.File.Close()
+}
+
+// sizeCache remembers the sizes of the rewritten files, valid as long as the
+// size and the modification time of their source do not change. A nil
+// sizeCache remembers nothing.
+type sizeCache struct {
+	mu    sync.Mutex
+	sizes map[string]cachedSize
+}
+
+type cachedSize struct {
+	src     int64
+	modTime time.Time
+	size    int64
+}
+
+func (c *sizeCache) get(name string, src fs.FileInfo) (int64, bool) {
+	if c == nil {
+		return 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.sizes[name]
+	if !ok || v.src != src.Size() || !v.modTime.Equal(src.ModTime()) {
+		return 0, false
+	}
+	return v.size, true
+}
+
+func (c *sizeCache) set(name string, src fs.FileInfo, size int64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sizes == nil {
+		c.sizes = make(map[string]cachedSize)
+	}
+	c.sizes[name] = cachedSize{src: src.Size(), modTime: src.ModTime(), size: size}
+}
+
+type sizedInfo struct {
+	fs.FileInfo
+	name string
+	size int64
+}
+
+func (i *sizedInfo) Name() string {
+	if i.name != "" {
+		return i.name
+	}
+	return i.FileInfo.Name()
+}
+
+func (i *sizedInfo) Size() int64 {
+	return i.size
+}
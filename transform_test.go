@@ -0,0 +1,124 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransform(t *testing.T) {
+	upper := func(path string, r io.Reader) (io.Reader, error) {
+		if path == "broken" {
+			return nil, errors.New("broken")
+		}
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(bytes.Repeat(bytes.ToUpper(b), 2)), nil
+	}
+	m, err := Mount("m", fstest.MapFS{
+		"foo":     {Data: data["foo"]},
+		"dir/baz": {Data: data["baz"]},
+		"broken":  {Data: data["foo"]},
+	}, WithTransform(upper))
+	require.NoError(t, err)
+
+	b, err := fs.ReadFile(m, "m/dir/baz")
+	require.NoError(t, err)
+	assert.Equal(t, "QUXQUX", string(b))
+
+	f, err := m.Open("m/foo")
+	require.NoError(t, err)
+	defer f.Close()
+	b = make([]byte, 2)
+	_, err = io.ReadFull(f, b)
+	require.NoError(t, err)
+	s, err := f.Stat()
+	require.NoError(t, err)
+	assert.EqualValues(t, 6, s.Size())
+	assert.Equal(t, "foo", s.Name())
+	rest, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "BARBAR", string(b)+string(rest))
+
+	d, err := m.ReadDir("m")
+	require.NoError(t, err)
+	for _, v := range d {
+		if v.Name() != "foo" {
+			continue
+		}
+		i, err := v.Info()
+		require.NoError(t, err)
+		assert.EqualValues(t, 6, i.Size())
+	}
+
+	_, err = m.Open("m/broken")
+	assert.Error(t, err)
+}
+
+func TestTransformSize(t *testing.T) {
+	var n int
+	upper := func(_ string, r io.Reader) (io.Reader, error) {
+		n++
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(bytes.ToUpper(b)), nil
+	}
+	files := fstest.MapFS{"foo": {Data: data["foo"]}}
+	fsys := Transform(files, upper)
+
+	// the size is remembered until the file changes
+	for range 2 {
+		s, err := fs.Stat(fsys, "foo")
+		require.NoError(t, err)
+		assert.EqualValues(t, 3, s.Size())
+	}
+	assert.Equal(t, 1, n)
+	files["foo"] = &fstest.MapFile{Data: data["quux"], ModTime: time.Now()}
+	s, err := fs.Stat(fsys, "foo")
+	require.NoError(t, err)
+	assert.EqualValues(t, 5, s.Size())
+	assert.Equal(t, 2, n)
+}
+
+func TestTransformWrites(t *testing.T) {
+	upper := func(_ string, r io.Reader) (io.Reader, error) {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(bytes.ToUpper(b)), nil
+	}
+	m, err := Mount("m", NewMemFS(), WithTransform(upper))
+	require.NoError(t, err)
+
+	// the content is written as is
+	require.NoError(t, m.WriteFile("m/foo", data["foo"], 0644))
+	b, err := fs.ReadFile(m, "m/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "BAR", string(b))
+}
@@ -0,0 +1,357 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io/fs"
+	"iter"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TrashDir is the directory of the mount backends holding the entries
+// removed from a mount configured with WithTrash. It is hidden from the
+// mount.
+const TrashDir = ".trash"
+
+// WithTrash makes Remove and RemoveAll move the entries to the TrashDir of
+// the mounted file system, from where Undelete restores them, instead of
+// deleting them. The trashed entries are deleted after retention, checked
+// when mounting and then every retention, at most every hour, while the
+// file system is mounted. The mounted file system must implement RenameFS,
+// MkdirAllFS and RemoveAllFS.
+func WithTrash(retention time.Duration) MountOption {
+	return func(o *mountOptions) {
+		o.trash = retention
+	}
+}
+
+// trashFS hides the TrashDir of fsys and turns the removals into moves to
+// it. w is the backend receiving the writes, fsys being the merged view of
+// a stacked mount.
+type trashFS struct {
+	forwardFS
+	w         fs.FS
+	retention time.Duration
+	// mu serializes the moves to and from the trash
+	mu   sync.Mutex
+	last int64
+	// mounts counts the mounts sharing the trash, the periodic purge being
+	// stopped by stop once they are all unmounted
+	mounts int
+	stop   chan struct{}
+}
+
+// startPurge purges the trash, then periodically until stopPurge is called
+// as many times.
+func (t *trashFS) startPurge() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.mounts++; t.mounts > 1 {
+		return
+	}
+	stop := make(chan struct{})
+	t.stop = stop
+	go func() {
+		t.purge()
+		tk := time.NewTicker(min(t.retention, time.Hour))
+		defer tk.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-tk.C:
+				t.purge()
+			}
+		}
+	}()
+}
+
+func (t *trashFS) stopPurge() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.mounts--; t.mounts == 0 && t.stop != nil {
+		close(t.stop)
+		t.stop = nil
+	}
+}
+
+// components returns the wrapped file system, see Topology.
+func (t *trashFS) components() []fs.FS {
+	return []fs.FS{t.fsys}
+}
+
+func newTrashFS(fsys, w fs.FS, retention time.Duration) *trashFS {
+	t := &trashFS{w: w, retention: retention}
+	t.forwardFS = forwardFS{fsys: fsys, route: t.route, event: t.event}
+	return t
+}
+
+// route hides the TrashDir, forwarding the writes to w.
+func (t *trashFS) route(op, name string) (fs.FS, string, error) {
+	switch op {
+	case "stat", "readdir", "lstat", "readlink", "getxattr", "listxattr", "watch":
+		if trashed(name) {
+			return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		return t.fsys, name, nil
+	}
+	if trashed(name) {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrPermission}
+	}
+	return t.w, name, nil
+}
+
+// event drops the events of the TrashDir.
+func (t *trashFS) event(e WatchEvent) []WatchEvent {
+	if trashed(e.Path) {
+		return nil
+	}
+	return []WatchEvent{e}
+}
+
+func trashed(name string) bool {
+	return name == TrashDir || strings.HasPrefix(name, TrashDir+"/")
+}
+
+func (t *trashFS) Open(name string) (fs.File, error) {
+	if trashed(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	f, err := t.fsys.Open(name)
+	if err != nil || name != "." {
+		return f, err
+	}
+	return &trashRoot{File: f, dirReader: dirReader{list: func() ([]fs.DirEntry, error) {
+		return t.ReadDir(".")
+	}}}, nil
+}
+
+func (t *trashFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if trashed(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	ds, err := fs.ReadDir(t.fsys, name)
+	if err != nil || name != "." {
+		return ds, err
+	}
+	res := ds[:0]
+	for _, v := range ds {
+		if v.Name() != TrashDir {
+			res = append(res, v)
+		}
+	}
+	return res, nil
+}
+
+// ReadDirPage filters the TrashDir out of the pages of the root directory,
+// which may then hold fewer entries than requested.
+func (t *trashFS) ReadDirPage(name, token string, n int) ([]fs.DirEntry, string, error) {
+	if trashed(name) {
+		return nil, "", &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	ds, next, err := readDirPage(t.fsys, name, token, n, nil)
+	if err != nil || name != "." {
+		return ds, next, err
+	}
+	res := ds[:0]
+	for _, v := range ds {
+		if v.Name() != TrashDir {
+			res = append(res, v)
+		}
+	}
+	return res, next, nil
+}
+
+func (t *trashFS) ReadDirIter(name string) iter.Seq2[fs.DirEntry, error] {
+	if trashed(name) {
+		return failedIter(&fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist})
+	}
+	return func(yield func(fs.DirEntry, error) bool) {
+		for d, err := range forwardIter(t.fsys, name) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if name == "." && d.Name() == TrashDir {
+				continue
+			}
+			if !yield(d, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (t *trashFS) Remove(name string) error {
+	s, err := t.Stat(name)
+	if err != nil {
+		return err
+	}
+	if s.IsDir() {
+		ds, err := fs.ReadDir(t.w, name)
+		if err != nil {
+			return err
+		}
+		if len(ds) != 0 {
+			return &fs.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+		}
+	}
+	return t.trash("remove", name)
+}
+
+func (t *trashFS) RemoveAll(name string) error {
+	if _, err := t.Stat(name); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return t.trash("removeall", name)
+}
+
+// backend returns the operations of the writable backend needed by the
+// trash.
+func (t *trashFS) backend(op, name string) (RenameFS, MkdirAllFS, RemoveAllFS, error) {
+	r, ok1 := t.w.(RenameFS)
+	m, ok2 := t.w.(MkdirAllFS)
+	d, ok3 := t.w.(RemoveAllFS)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, nil, nil, unsupported(op, name)
+	}
+	return r, m, d, nil
+}
+
+// trash moves name to a new directory of the trash named after the current
+// time.
+func (t *trashFS) trash(op, name string) error {
+	if name == "." || trashed(name) {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrPermission}
+	}
+	r, m, _, err := t.backend(op, name)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id := max(time.Now().UnixNano(), t.last+1)
+	t.last = id
+	dst := path.Join(TrashDir, strconv.FormatInt(id, 10), name)
+	if err := m.MkdirAll(path.Dir(dst), 0o700); err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	if err := r.Rename(name, dst); err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	time.AfterFunc(t.retention, func() {
+		t.purge()
+	})
+	return nil
+}
+
+// undelete restores the latest trashed version of name.
+func (t *trashFS) undelete(name string) error {
+	r, m, _, err := t.backend("undelete", name)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ids, err := t.ids()
+	if err != nil {
+		return err
+	}
+	for i := len(ids) - 1; i >= 0; i-- {
+		src := path.Join(TrashDir, strconv.FormatInt(ids[i], 10), name)
+		if _, err := fs.Stat(t.w, src); err != nil {
+			continue
+		}
+		if _, err := fs.Stat(t.w, name); err == nil {
+			return &fs.PathError{Op: "undelete", Path: name, Err: fs.ErrExist}
+		}
+		if err := m.MkdirAll(path.Dir(name), 0o755); err != nil {
+			return &fs.PathError{Op: "undelete", Path: name, Err: err}
+		}
+		if err := r.Rename(src, name); err != nil {
+			return &fs.PathError{Op: "undelete", Path: name, Err: err}
+		}
+		return nil
+	}
+	return &fs.PathError{Op: "undelete", Path: name, Err: fs.ErrNotExist}
+}
+
+// ids returns the sorted trash directories. It must be called with the
+// lock held.
+func (t *trashFS) ids() ([]int64, error) {
+	ds, err := fs.ReadDir(t.w, TrashDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var res []int64
+	for _, v := range ds {
+		if id, err := strconv.ParseInt(v.Name(), 10, 64); err == nil {
+			res = append(res, id)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i] < res[j]
+	})
+	return res, nil
+}
+
+// purge deletes the trash directories older than the retention.
+func (t *trashFS) purge() {
+	_, _, d, err := t.backend("purge", TrashDir)
+	if err != nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ids, _ := t.ids()
+	limit := time.Now().Add(-t.retention).UnixNano()
+	for _, v := range ids {
+		if v > limit {
+			return
+		}
+		_ = d.RemoveAll(path.Join(TrashDir, strconv.FormatInt(v, 10)))
+	}
+}
+
+// trashRoot filters the TrashDir out of the root directory listing.
+type trashRoot struct {
+	fs.File
+	dirReader
+}
+
+func (m *mfs) Undelete(name string) (err error) {
+	defer m.record("undelete", name, time.Now(), &err)
+	defer m.invalidate(name)
+	mnt, rel, err := m.writeTarget("undelete", name)
+	if err != nil {
+		return err
+	}
+	if mnt.trash == nil {
+		return unsupported("undelete", name)
+	}
+	if err := mnt.trash.undelete(mnt.shared(rel)); err != nil {
+		return mnt.wrapErr("undelete", name, rel, err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"strconv"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrash(t *testing.T) {
+	mem := NewMemFS()
+	m, err := Mount("mem", mem, WithTrash(50*time.Millisecond))
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("ro", fstest.MapFS{"foo": {Data: data["foo"]}}, WithTrash(time.Hour)))
+	require.NoError(t, m.MkdirAll("mem/dir", 0755))
+	require.NoError(t, m.WriteFile("mem/dir/foo", []byte("v1"), 0644))
+
+	require.NoError(t, m.RemoveAll("mem/dir"))
+	_, err = fs.Stat(m, "mem/dir")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	ds, err := m.ReadDir("mem")
+	require.NoError(t, err)
+	assert.Empty(t, ds)
+	_, err = fs.Stat(m, "mem/"+TrashDir)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.ErrorIs(t, m.WriteFile("mem/"+TrashDir+"/foo", nil, 0644), fs.ErrPermission)
+	require.NoError(t, m.RemoveAll("mem/missing"))
+	assert.ErrorIs(t, m.Remove("mem/missing"), fs.ErrNotExist)
+
+	require.NoError(t, m.MkdirAll("mem/dir", 0755))
+	require.NoError(t, m.WriteFile("mem/dir/foo", []byte("v2"), 0644))
+	require.NoError(t, m.Remove("mem/dir/foo"))
+	require.NoError(t, m.Undelete("mem/dir/foo"))
+	b, err := fs.ReadFile(m, "mem/dir/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "v2", string(b))
+	assert.ErrorIs(t, m.Undelete("mem/dir/foo"), fs.ErrExist)
+
+	require.NoError(t, m.Remove("mem/dir/foo"))
+	require.NoError(t, m.Remove("mem/dir"))
+	require.NoError(t, m.Undelete("mem/dir"))
+	require.NoError(t, fstest.TestFS(mem, "dir", TrashDir))
+
+	assert.Eventually(t, func() bool {
+		ds, err := fs.ReadDir(mem, TrashDir)
+		return err == nil && len(ds) == 0
+	}, time.Second, 10*time.Millisecond)
+	assert.ErrorIs(t, m.Undelete("mem/dir/foo"), fs.ErrNotExist)
+
+	assert.ErrorIs(t, m.Remove("ro/foo"), errors.ErrUnsupported)
+	require.NoError(t, m.Mount("plain", NewMemFS()))
+	assert.ErrorIs(t, m.Undelete("plain/foo"), errors.ErrUnsupported)
+}
+
+func TestTrashPurge(t *testing.T) {
+	mem := NewMemFS()
+	old := strconv.FormatInt(time.Now().Add(-2*time.Hour).UnixNano(), 10)
+	require.NoError(t, mem.MkdirAll(path.Join(TrashDir, old), 0700))
+	require.NoError(t, mem.WriteFile(path.Join(TrashDir, old, "foo"), data["foo"], 0644))
+
+	// the trash is purged once mounted, then periodically
+	m, err := Mount("mem", mem, WithTrash(time.Hour))
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		ds, err := fs.ReadDir(mem, TrashDir)
+		return err == nil && len(ds) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, m.Mount("short", mem, WithTrash(20*time.Millisecond)))
+	require.NoError(t, m.WriteFile("short/foo", data["foo"], 0644))
+	require.NoError(t, m.Remove("short/foo"))
+	assert.Eventually(t, func() bool {
+		ds, err := fs.ReadDir(mem, TrashDir)
+		return err == nil && len(ds) == 0
+	}, time.Second, 10*time.Millisecond)
+}
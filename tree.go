@@ -0,0 +1,174 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+)
+
+// TreeOption configures Tree.
+type TreeOption func(o *treeOptions)
+
+type treeOptions struct {
+	depth    int
+	dirsOnly bool
+}
+
+// WithTreeDepth limits the descent below the root, its children being at
+// depth 1, when greater than 0.
+func WithTreeDepth(n int) TreeOption {
+	return func(o *treeOptions) {
+		o.depth = n
+	}
+}
+
+// WithTreeDirsOnly only renders the directories.
+func WithTreeDirsOnly() TreeOption {
+	return func(o *treeOptions) {
+		o.dirsOnly = true
+	}
+}
+
+// Tree writes to w the tree rooted at root in fsys the way the tree command
+// does, followed by the count of directories and files, e.g.:
+//
+//	.
+//	├── data [mount]
+//	│   └── foo (3 B)
+//	└── static [mount]
+//
+//	2 directories, 1 file
+//
+// The regular files are followed by their size and, when fsys is an MFS,
+// the mount points are marked. The directories failing to be listed are
+// followed by the error, which does not stop the rendering: only the
+// errors stating root and writing to w are returned.
+func Tree(w io.Writer, fsys fs.FS, root string, opts ...TreeOption) error {
+	var o treeOptions
+	for _, v := range opts {
+		v(&o)
+	}
+	root = path.Clean(root)
+	i, err := fs.Stat(fsys, root)
+	if err != nil {
+		return err
+	}
+	t := &treeWriter{w: bufio.NewWriter(w), fsys: fsys, opts: o}
+	if m, ok := fsys.(interface{ Mounts() []MountInfo }); ok {
+		t.mounts = make(map[string]bool)
+		for _, v := range m.Mounts() {
+			t.mounts[v.Path] = true
+		}
+	}
+	t.line("", root, i, nil)
+	if i.IsDir() {
+		t.dir(root, "", 1)
+	}
+	dirs, files := "directories", "files"
+	if t.dirs == 1 {
+		dirs = "directory"
+	}
+	if t.files == 1 {
+		files = "file"
+	}
+	if o.dirsOnly {
+		fmt.Fprintf(t.w, "\n%d %s\n", t.dirs, dirs)
+	} else {
+		fmt.Fprintf(t.w, "\n%d %s, %d %s\n", t.dirs, dirs, t.files, files)
+	}
+	return t.w.Flush()
+}
+
+type treeWriter struct {
+	w      *bufio.Writer
+	fsys   fs.FS
+	opts   treeOptions
+	mounts map[string]bool
+	dirs   int
+	files  int
+}
+
+func (t *treeWriter) dir(name, prefix string, depth int) {
+	ds, err := fs.ReadDir(t.fsys, name)
+	if err != nil {
+		fmt.Fprintf(t.w, "%s└── [error: %v]\n", prefix, err)
+		return
+	}
+	if t.opts.dirsOnly {
+		var dirs []fs.DirEntry
+		for _, v := range ds {
+			if v.IsDir() {
+				dirs = append(dirs, v)
+			}
+		}
+		ds = dirs
+	}
+	for i, v := range ds {
+		branch, indent := "├── ", "│   "
+		if i == len(ds)-1 {
+			branch, indent = "└── ", "    "
+		}
+		p := path.Join(name, v.Name())
+		var info fs.FileInfo
+		if v.Type().IsRegular() {
+			info, err = v.Info()
+		}
+		t.line(prefix+branch, p, info, err)
+		if v.IsDir() {
+			t.dirs++
+			if t.opts.depth <= 0 || depth < t.opts.depth {
+				t.dir(p, prefix+indent, depth+1)
+			}
+		} else {
+			t.files++
+		}
+	}
+}
+
+// line writes the line of the entry name, whose info is only set for
+// regular files.
+func (t *treeWriter) line(prefix, name string, info fs.FileInfo, err error) {
+	s := prefix + path.Base(name)
+	if prefix == "" {
+		s = name
+	}
+	switch {
+	case err != nil:
+		s += fmt.Sprintf(" [error: %v]", err)
+	case info != nil && info.Mode().IsRegular():
+		s += " (" + formatSize(info.Size()) + ")"
+	}
+	if t.mounts[name] {
+		s += " [mount]"
+	}
+	fmt.Fprintln(t.w, s)
+}
+
+// formatSize formats n bytes with binary prefixes, e.g. "1.5 KiB".
+func formatSize(n int64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	f, unit := float64(n)/1024, 0
+	for f >= 1024 && unit < 5 {
+		f /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %ciB", f, "KMGTPE"[unit])
+}
@@ -0,0 +1,57 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTree(t *testing.T) {
+	mem := NewMemFS()
+	require.NoError(t, mem.MkdirAll("dir/sub", 0755))
+	require.NoError(t, mem.WriteFile("foo", data["foo"], 0644))
+	require.NoError(t, mem.WriteFile("dir/large", bytes.Repeat([]byte("a"), 1536), 0644))
+	m, err := Mount("data", mem)
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("static", fstest.MapFS{}))
+
+	var buf bytes.Buffer
+	require.NoError(t, Tree(&buf, m, "."))
+	assert.Equal(t, strings.Join([]string{
+		".",
+		"├── data [mount]",
+		"│   ├── dir",
+		"│   │   ├── large (1.5 KiB)",
+		"│   │   └── sub",
+		"│   └── foo (3 B)",
+		"└── static [mount]",
+		"",
+		"4 directories, 2 files",
+		"",
+	}, "\n"), buf.String())
+
+	buf.Reset()
+	require.NoError(t, Tree(&buf, m, "data", WithTreeDepth(1), WithTreeDirsOnly()))
+	assert.Equal(t, "data [mount]\n└── dir\n\n1 directory\n", buf.String())
+
+	assert.Error(t, Tree(&buf, m, "missing"))
+	assert.Equal(t, "1.0 MiB", formatSize(1<<20))
+}
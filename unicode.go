@@ -0,0 +1,237 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// ErrNameCollision is returned by the file systems returned by Normalize
+// when several names of a directory have the same normalized form.
+var ErrNameCollision = errors.New("normalized names collision")
+
+// WithUnicodeNormalization normalizes the names given to the MFS and its
+// mount points to the form f, e.g. norm.NFC, before matching them against
+// the mount table, so that the paths created on macOS (NFD) resolve against
+// NFC named mounts. The mounted file systems are wrapped with Normalize.
+func WithUnicodeNormalization(f norm.Form) Option {
+	return func(m *mfs) {
+		m.form = &f
+	}
+}
+
+// normalize returns name in the normalization form of m.
+func (m *mfs) normalize(name string) string {
+	if m.form == nil {
+		return name
+	}
+	return m.form.String(name)
+}
+
+// Normalize returns a file system exposing the names of fsys in the form f.
+// The names given to it are normalized and resolved against the ones of
+// fsys whatever their form, the created files being named in the form f.
+// The listings report the directories holding several names with the same
+// normalized form with ErrNameCollision, as does opening such a name when
+// it is not stored in the form f.
+func Normalize(fsys fs.FS, f norm.Form) fs.FS {
+	n := &normalizeFS{form: f}
+	n.forwardFS = forwardFS{fsys: fsys, route: n.route, readDir: n.ReadDir, event: n.event}
+	return n
+}
+
+type normalizeFS struct {
+	forwardFS
+	form norm.Form
+}
+
+// resolve returns the name of fsys matching the normalized name.
+func (n *normalizeFS) resolve(op, name string) (string, error) {
+	if name == "." {
+		return name, nil
+	}
+	// most names are stored as they are given
+	if _, err := fs.Stat(n.fsys, name); !errors.Is(err, fs.ErrNotExist) {
+		return name, nil
+	}
+	dir, err := n.resolve(op, path.Dir(name))
+	if err != nil {
+		return "", err
+	}
+	base := path.Base(name)
+	ds, err := fs.ReadDir(n.fsys, dir)
+	if err != nil {
+		return joinMountPath(dir, base), nil
+	}
+	res := ""
+	for _, v := range ds {
+		if n.form.String(v.Name()) != base {
+			continue
+		}
+		if res != "" {
+			return "", &fs.PathError{Op: op, Path: name, Err: ErrNameCollision}
+		}
+		res = v.Name()
+	}
+	if res == "" {
+		res = base
+	}
+	return joinMountPath(dir, res), nil
+}
+
+// route normalizes name and resolves it, see resolve.
+func (n *normalizeFS) route(op, name string) (fs.FS, string, error) {
+	r, err := n.resolve(op, n.form.String(name))
+	if err != nil {
+		return nil, "", err
+	}
+	return n.fsys, r, nil
+}
+
+// event normalizes the names of the events.
+func (n *normalizeFS) event(e WatchEvent) []WatchEvent {
+	e.Path = n.form.String(e.Path)
+	return []WatchEvent{e}
+}
+
+func (n *normalizeFS) Open(name string) (fs.File, error) {
+	name = n.form.String(name)
+	r, err := n.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := n.fsys.Open(r)
+	if err != nil {
+		return nil, err
+	}
+	// the files are returned as is to keep their io.Seeker, io.ReaderAt...
+	if _, ok := f.(fs.ReadDirFile); !ok {
+		return f, nil
+	}
+	if s, err := f.Stat(); err != nil || !s.IsDir() {
+		return f, nil
+	}
+	return &normalizeDir{File: f, n: n, path: name}, nil
+}
+
+func (n *normalizeFS) Stat(name string) (fs.FileInfo, error) {
+	name = n.form.String(name)
+	r, err := n.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	s, err := fs.Stat(n.fsys, r)
+	if err != nil {
+		return nil, err
+	}
+	return &normalizeInfo{FileInfo: s, name: path.Base(name)}, nil
+}
+
+func (n *normalizeFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	name = n.form.String(name)
+	r, err := n.resolve("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	ds, err := fs.ReadDir(n.fsys, r)
+	if err != nil {
+		return nil, err
+	}
+	return n.entries(name, ds)
+}
+
+func (n *normalizeFS) Lstat(name string) (fs.FileInfo, error) {
+	i, err := n.forwardFS.Lstat(name)
+	if err != nil {
+		return nil, err
+	}
+	return &normalizeInfo{FileInfo: i, name: path.Base(n.form.String(name))}, nil
+}
+
+// entries normalizes the names of the entries of the directory name.
+func (n *normalizeFS) entries(name string, ds []fs.DirEntry) ([]fs.DirEntry, error) {
+	seen := make(map[string]struct{}, len(ds))
+	res := make([]fs.DirEntry, 0, len(ds))
+	for _, v := range ds {
+		k := n.form.String(v.Name())
+		if _, ok := seen[k]; ok {
+			return nil, &fs.PathError{Op: "readdir", Path: joinMountPath(name, k), Err: ErrNameCollision}
+		}
+		seen[k] = struct{}{}
+		if k != v.Name() {
+			v = &normalizeEntry{DirEntry: v, name: k}
+		}
+		res = append(res, v)
+	}
+	sortEntries(res)
+	return res, nil
+}
+
+// normalizeDir normalizes the names listed from the directory.
+type normalizeDir struct {
+	fs.File
+	n    *normalizeFS
+	path string
+}
+
+func (d *normalizeDir) Stat() (fs.FileInfo, error) {
+	s, err := d.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &normalizeInfo{FileInfo: s, name: path.Base(d.path)}, nil
+}
+
+func (d *normalizeDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	ds, err := d.File.(fs.ReadDirFile).ReadDir(count)
+	if len(ds) == 0 {
+		return ds, err
+	}
+	res, nerr := d.n.entries(d.path, ds)
+	if nerr != nil {
+		return nil, nerr
+	}
+	return res, err
+}
+
+type normalizeInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (i *normalizeInfo) Name() string {
+	return i.name
+}
+
+type normalizeEntry struct {
+	fs.DirEntry
+	name string
+}
+
+func (e *normalizeEntry) Name() string {
+	return e.name
+}
+
+func (e *normalizeEntry) Info() (fs.FileInfo, error) {
+	i, err := e.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return &normalizeInfo{FileInfo: i, name: e.name}, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	cafeNFC = "caf\u00e9"
+	cafeNFD = "cafe\u0301"
+)
+
+func TestNormalize(t *testing.T) {
+	mem := NewMemFS()
+	require.NoError(t, mem.MkdirAll(cafeNFD, 0755))
+	require.NoError(t, mem.WriteFile(cafeNFD+"/menu", []byte("menu"), 0644))
+	n := Normalize(mem, norm.NFC)
+
+	b, err := fs.ReadFile(n, cafeNFC+"/menu")
+	require.NoError(t, err)
+	assert.Equal(t, "menu", string(b))
+	b, err = fs.ReadFile(n, cafeNFD+"/menu")
+	require.NoError(t, err)
+	assert.Equal(t, "menu", string(b))
+	s, err := fs.Stat(n, cafeNFD)
+	require.NoError(t, err)
+	assert.Equal(t, cafeNFC, s.Name())
+
+	entries, err := fs.ReadDir(n, ".")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, cafeNFC, entries[0].Name())
+	require.NoError(t, fstest.TestFS(n, cafeNFC+"/menu"))
+
+	// written in the existing directory, under the normalized name
+	require.NoError(t, n.(WriteFileFS).WriteFile(cafeNFC+"/"+cafeNFD, nil, 0644))
+	_, err = fs.Stat(mem, cafeNFD+"/"+cafeNFC)
+	require.NoError(t, err)
+
+	require.NoError(t, mem.WriteFile(cafeNFC, nil, 0644))
+	_, err = fs.ReadDir(n, ".")
+	assert.ErrorIs(t, err, ErrNameCollision)
+}
+
+func TestUnicodeNormalization(t *testing.T) {
+	m := New(WithUnicodeNormalization(norm.NFC))
+	require.NoError(t, m.Mount(cafeNFD, fstest.MapFS{cafeNFD: {Data: []byte("foo")}}))
+
+	b, err := fs.ReadFile(m, cafeNFC+"/"+cafeNFC)
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(b))
+	b, err = fs.ReadFile(m, cafeNFD+"/"+cafeNFD)
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(b))
+
+	entries, err := m.ReadDir(".")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, cafeNFC, entries[0].Name())
+	entries, err = m.ReadDir(cafeNFD)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, cafeNFC, entries[0].Name())
+
+	assert.ErrorIs(t, m.Mount(cafeNFC, NewMemFS()), fs.ErrExist)
+	require.NoError(t, m.Unmount(cafeNFC))
+}
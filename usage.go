@@ -0,0 +1,104 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"io/fs"
+	"os"
+)
+
+// Usage reports the space of a file system, in bytes.
+type Usage struct {
+	// Total is the size of the file system, 0 when it is not bounded.
+	Total uint64
+	Used  uint64
+	// Free is the space available for writing, 0 when the file system is
+	// not bounded.
+	Free uint64
+}
+
+// UsageFS is implemented by file systems able to report their usage.
+type UsageFS interface {
+	fs.FS
+	Usage() (Usage, error)
+}
+
+func (m *mfs) Usage(name string) (Usage, error) {
+	mnt, _, err := m.lookupPath("usage", name)
+	if err != nil {
+		return Usage{}, err
+	}
+	// the writes land in the top layer, under the wrappers of the mount
+	u, ok := As[UsageFS](mnt.writable)
+	if !ok {
+		return Usage{}, unsupported("usage", name)
+	}
+	s, err := u.Usage()
+	if err != nil {
+		return Usage{}, &fs.PathError{Op: "usage", Path: name, Err: err}
+	}
+	return s, nil
+}
+
+// Usage reports the bytes held by the files of m, which is not bounded.
+func (m *MemFS) Usage() (Usage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return Usage{Used: m.root.size()}, nil
+}
+
+func (n *memNode) size() uint64 {
+	s := uint64(len(n.data))
+	for _, v := range n.children {
+		s += v.size()
+	}
+	return s
+}
+
+// DirFS is like os.DirFS, reporting the usage of the file system holding
+// dir where the platform supports it. The "file" scheme opens DirFS file
+// systems.
+func DirFS(dir string) fs.FS {
+	return &dirFS{FS: os.DirFS(dir), dir: dir}
+}
+
+type dirFS struct {
+	fs.FS
+	dir string
+}
+
+func (d *dirFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(d.FS, name)
+}
+
+func (d *dirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(d.FS, name)
+}
+
+func (d *dirFS) ReadLink(name string) (string, error) {
+	return ReadLink(d.FS, name)
+}
+
+func (d *dirFS) Lstat(name string) (fs.FileInfo, error) {
+	return Lstat(d.FS, name)
+}
+
+func (d *dirFS) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(d.FS, name)
+}
+
+func (d *dirFS) Usage() (Usage, error) {
+	return statfs(d.dir)
+}
@@ -0,0 +1,69 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsage(t *testing.T) {
+	mem := NewMemFS()
+	require.NoError(t, mem.MkdirAll("dir", 0755))
+	require.NoError(t, mem.WriteFile("foo", []byte("foo"), 0644))
+	require.NoError(t, mem.WriteFile("dir/bar", []byte("barbaz"), 0644))
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "foo"), []byte("foo"), 0644))
+	require.NoError(t, fstest.TestFS(DirFS(dir), "foo"))
+
+	m, err := Mount("mem", mem)
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("dir", DirFS(dir)))
+	require.NoError(t, m.Mount("static", fstest.MapFS{}))
+
+	u, err := m.Usage("mem/dir")
+	require.NoError(t, err)
+	assert.Equal(t, Usage{Used: 9}, u)
+
+	u, err = m.Usage("dir")
+	if runtime.GOOS == "linux" || runtime.GOOS == "darwin" || runtime.GOOS == "freebsd" {
+		require.NoError(t, err)
+		assert.NotZero(t, u.Total)
+		assert.LessOrEqual(t, u.Free, u.Total)
+		assert.LessOrEqual(t, u.Used, u.Total)
+	} else {
+		assert.ErrorIs(t, err, errors.ErrUnsupported)
+	}
+
+	_, err = m.Usage("static")
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+	_, err = m.Usage("missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	// the mount wrappers forward the usage
+	require.NoError(t, m.Mount("wrapped", mem, WithTimeout(time.Minute), WithMaxConcurrent(1)))
+	u, err = m.Usage("wrapped")
+	require.NoError(t, err)
+	assert.Equal(t, Usage{Used: 9}, u)
+}
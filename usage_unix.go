@@ -0,0 +1,34 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || darwin || freebsd
+
+package mfs
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+func statfs(dir string) (Usage, error) {
+	var s unix.Statfs_t
+	if err := unix.Statfs(dir, &s); err != nil {
+		return Usage{}, err
+	}
+	bs := uint64(s.Bsize)
+	return Usage{
+		Total: uint64(s.Blocks) * bs,
+		Used:  (uint64(s.Blocks) - uint64(s.Bfree)) * bs,
+		Free:  uint64(s.Bavail) * bs,
+	}, nil
+}
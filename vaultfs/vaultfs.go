@@ -0,0 +1,440 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package vaultfs provides a read-only file system over a HashiCorp Vault KV
+// secrets engine. Secrets are exposed as directories containing one file per
+// secret key, the folders of the KV mount as plain directories.
+package vaultfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+const defaultCacheTTL = time.Minute
+
+// Option configures the file system.
+type Option func(o *options)
+
+type options struct {
+	version int
+	ttl     time.Duration
+	ctx     context.Context
+}
+
+// WithKVVersion sets the version of the KV secrets engine, 1 or 2. It
+// defaults to 2.
+func WithKVVersion(v int) Option {
+	return func(o *options) {
+		if v == 1 || v == 2 {
+			o.version = v
+		}
+	}
+}
+
+// WithCacheTTL sets how long secrets are cached. Secrets with a shorter lease
+// are cached for the duration of their lease only. It defaults to one minute.
+func WithCacheTTL(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.ttl = d
+		}
+	}
+}
+
+// WithContext sets the context used for the requests. It defaults to
+// context.Background.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// New returns a read-only file system over the secrets of the KV engine
+// mounted at mount.
+//
+// Secrets are cached. When a cached secret carries a renewable lease, its
+// lease is renewed once half of it has elapsed instead of reading the
+// secret again.
+func New(client *api.Client, mount string, opts ...Option) fs.FS {
+	return newFS(&vault{Logical: client.Logical(), Sys: client.Sys()}, mount, opts...)
+}
+
+// backend is the subset of the Vault API used by the file system.
+type backend interface {
+	ReadWithContext(ctx context.Context, path string) (*api.Secret, error)
+	ListWithContext(ctx context.Context, path string) (*api.Secret, error)
+	RenewWithContext(ctx context.Context, leaseID string, increment int) (*api.Secret, error)
+}
+
+type vault struct {
+	*api.Logical
+	*api.Sys
+}
+
+func newFS(b backend, mount string, opts ...Option) *vfs {
+	o := &options{version: 2, ttl: defaultCacheTTL, ctx: context.Background()}
+	for _, v := range opts {
+		v(o)
+	}
+	return &vfs{b: b, mount: strings.Trim(mount, "/"), o: o, cache: make(map[string]*secret), now: time.Now}
+}
+
+type vfs struct {
+	b     backend
+	mount string
+	o     *options
+
+	mu    sync.Mutex
+	cache map[string]*secret
+	now   func() time.Time
+}
+
+type secret struct {
+	data      map[string][]byte
+	modTime   time.Time
+	leaseID   string
+	renewable bool
+	expires   time.Time
+}
+
+func (v *vfs) dataPath(name string) string {
+	if v.o.version == 1 {
+		return v.mount + "/" + name
+	}
+	return v.mount + "/data/" + name
+}
+
+func (v *vfs) listPath(name string) string {
+	if name == "." {
+		name = ""
+	}
+	if v.o.version == 1 {
+		return v.mount + "/" + name
+	}
+	return v.mount + "/metadata/" + name
+}
+
+// expiry returns when a secret read now with the given lease must be
+// refreshed.
+func (v *vfs) expiry(lease int, renewable bool) time.Time {
+	ttl := v.o.ttl
+	if d := time.Duration(lease) * time.Second; d > 0 {
+		if renewable {
+			d /= 2
+		}
+		ttl = min(ttl, d)
+	}
+	return v.now().Add(ttl)
+}
+
+// secret returns the secret stored at name, or nil if there is none.
+func (v *vfs) secret(name string) (*secret, error) {
+	if name == "." {
+		return nil, nil
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.cache[name]
+	if ok && v.now().Before(s.expires) {
+		return s.get(), nil
+	}
+	if ok && s.renewable {
+		if r, err := v.b.RenewWithContext(v.o.ctx, s.leaseID, 0); err == nil && r != nil {
+			s.expires = v.expiry(r.LeaseDuration, r.Renewable)
+			s.renewable = r.Renewable
+			return s, nil
+		}
+	}
+	s, err := v.read(name)
+	if err != nil {
+		return nil, err
+	}
+	v.cache[name] = s
+	return s.get(), nil
+}
+
+// get returns s, or nil if it records a missing secret.
+func (s *secret) get() *secret {
+	if s.data == nil {
+		return nil
+	}
+	return s
+}
+
+func (v *vfs) read(name string) (*secret, error) {
+	r, err := v.b.ReadWithContext(v.o.ctx, v.dataPath(name))
+	if err != nil {
+		return nil, mapErr(err)
+	}
+	// missing secrets are cached too as stat probes every path as a secret
+	if r == nil || r.Data == nil {
+		return &secret{expires: v.expiry(0, false)}, nil
+	}
+	data := r.Data
+	var mod time.Time
+	if v.o.version == 2 {
+		data, _ = r.Data["data"].(map[string]any)
+		// deleted or destroyed versions have no data
+		if data == nil {
+			return &secret{expires: v.expiry(0, false)}, nil
+		}
+		if m, ok := r.Data["metadata"].(map[string]any); ok {
+			if t, ok := m["created_time"].(string); ok {
+				mod, _ = time.Parse(time.RFC3339Nano, t)
+			}
+		}
+	}
+	s := &secret{
+		data:      make(map[string][]byte, len(data)),
+		modTime:   mod,
+		leaseID:   r.LeaseID,
+		renewable: r.Renewable && r.LeaseID != "",
+	}
+	s.expires = v.expiry(r.LeaseDuration, s.renewable)
+	for k, val := range data {
+		if str, ok := val.(string); ok {
+			s.data[k] = []byte(str)
+			continue
+		}
+		b, err := json.Marshal(val)
+		if err != nil {
+			return nil, err
+		}
+		s.data[k] = b
+	}
+	return s, nil
+}
+
+// list returns the entries of the folder name, the sub folders ending with
+// a "/".
+func (v *vfs) list(name string) ([]string, error) {
+	r, err := v.b.ListWithContext(v.o.ctx, v.listPath(name))
+	if err != nil {
+		return nil, mapErr(err)
+	}
+	if r == nil || r.Data == nil {
+		return nil, nil
+	}
+	keys, _ := r.Data["keys"].([]any)
+	out := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if s, ok := k.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+// stat resolves name to either a directory or the content of a secret key.
+func (v *vfs) stat(name string) (*info, []byte, error) {
+	base := path.Base(name)
+	if name == "." {
+		return &info{name: base, dir: true}, nil, nil
+	}
+	s, err := v.secret(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if s != nil {
+		return &info{name: base, dir: true}, nil, nil
+	}
+	p, err := v.secret(path.Dir(name))
+	if err != nil {
+		return nil, nil, err
+	}
+	if p != nil {
+		if b, ok := p.data[base]; ok {
+			return &info{name: base, size: int64(len(b)), mod: p.modTime}, b, nil
+		}
+	}
+	keys, err := v.list(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(keys) != 0 {
+		return &info{name: base, dir: true}, nil, nil
+	}
+	return nil, nil, fs.ErrNotExist
+}
+
+func (v *vfs) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	i, b, err := v.stat(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if !i.dir {
+		return &file{info: i, r: bytes.NewReader(b)}, nil
+	}
+	return &dir{info: i, fs: v, path: name}, nil
+}
+
+func (v *vfs) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	i, _, err := v.stat(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return i, nil
+}
+
+func (v *vfs) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	i, _, err := v.stat(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	if !i.dir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	es, err := v.readDir(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return es, nil
+}
+
+func (v *vfs) readDir(name string) ([]fs.DirEntry, error) {
+	entries := make(map[string]fs.DirEntry)
+	s, err := v.secret(name)
+	if err != nil {
+		return nil, err
+	}
+	if s != nil {
+		for k, b := range s.data {
+			entries[k] = fs.FileInfoToDirEntry(&info{name: k, size: int64(len(b)), mod: s.modTime})
+		}
+	}
+	keys, err := v.list(name)
+	if err != nil {
+		return nil, err
+	}
+	// both secrets and folders are directories, shadowing the keys of the
+	// current secret sharing their name
+	for _, k := range keys {
+		k = strings.TrimSuffix(k, "/")
+		entries[k] = fs.FileInfoToDirEntry(&info{name: k, dir: true})
+	}
+	out := make([]fs.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name() < out[j].Name() })
+	return out, nil
+}
+
+func mapErr(err error) error {
+	var re *api.ResponseError
+	if errors.As(err, &re) {
+		switch re.StatusCode {
+		case http.StatusNotFound:
+			return fs.ErrNotExist
+		case http.StatusForbidden, http.StatusUnauthorized:
+			return fs.ErrPermission
+		}
+	}
+	return err
+}
+
+type info struct {
+	name string
+	size int64
+	mod  time.Time
+	dir  bool
+}
+
+func (i *info) Name() string       { return i.name }
+func (i *info) Size() int64        { return i.size }
+func (i *info) ModTime() time.Time { return i.mod }
+func (i *info) IsDir() bool        { return i.dir }
+func (i *info) Sys() any           { return nil }
+
+func (i *info) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+type file struct {
+	*info
+	r *bytes.Reader
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *file) Read(b []byte) (int, error) { return f.r.Read(b) }
+
+func (f *file) ReadAt(b []byte, off int64) (int, error) { return f.r.ReadAt(b, off) }
+
+func (f *file) Seek(off int64, whence int) (int64, error) { return f.r.Seek(off, whence) }
+
+func (f *file) Close() error { return nil }
+
+type dir struct {
+	*info
+	fs      *vfs
+	path    string
+	entries []fs.DirEntry
+	loaded  bool
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.path, Err: errors.New("is a directory")}
+}
+
+func (d *dir) Close() error { return nil }
+
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.loaded {
+		es, err := d.fs.readDir(d.path)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: d.path, Err: err}
+		}
+		d.entries, d.loaded = es, true
+	}
+	if n <= 0 {
+		es := d.entries
+		d.entries = nil
+		return es, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	es := d.entries[:n]
+	d.entries = d.entries[n:]
+	return es, nil
+}
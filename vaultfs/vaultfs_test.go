@@ -0,0 +1,173 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vaultfs
+
+import (
+	"context"
+	"io/fs"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.linka.cloud/mfs"
+)
+
+// fakeVault is an in-memory KV v2 engine mounted at "secret".
+type fakeVault struct {
+	secrets map[string]map[string]any
+	lease   int
+	reads   int
+	renews  int
+}
+
+func (f *fakeVault) ReadWithContext(_ context.Context, p string) (*api.Secret, error) {
+	f.reads++
+	d, ok := f.secrets[strings.TrimPrefix(p, "secret/data/")]
+	if !ok {
+		return nil, nil
+	}
+	return &api.Secret{
+		LeaseID:       "lease/" + p,
+		LeaseDuration: f.lease,
+		Renewable:     f.lease != 0,
+		Data: map[string]any{
+			"data":     d,
+			"metadata": map[string]any{"created_time": "2024-01-02T03:04:05.000000006Z"},
+		},
+	}, nil
+}
+
+func (f *fakeVault) ListWithContext(_ context.Context, p string) (*api.Secret, error) {
+	p = strings.TrimPrefix(p, "secret/metadata/")
+	if p != "" && !strings.HasSuffix(p, "/") {
+		p += "/"
+	}
+	seen := make(map[string]bool)
+	var keys []any
+	for k := range f.secrets {
+		if !strings.HasPrefix(k, p) {
+			continue
+		}
+		k = k[len(p):]
+		if i := strings.Index(k, "/"); i >= 0 {
+			k = k[:i+1]
+		}
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].(string) < keys[j].(string) })
+	return &api.Secret{Data: map[string]any{"keys": keys}}, nil
+}
+
+func (f *fakeVault) RenewWithContext(_ context.Context, _ string, _ int) (*api.Secret, error) {
+	f.renews++
+	return &api.Secret{LeaseDuration: f.lease, Renewable: true}, nil
+}
+
+func newFake() *fakeVault {
+	return &fakeVault{secrets: map[string]map[string]any{
+		"app/db":     {"user": "admin", "password": "s3cr3t"},
+		"app/api":    {"token": "abc", "scopes": []any{"read", "write"}},
+		"app/db/tls": {"cert": "CERT"},
+		"global":     {"domain": "example.com"},
+	}}
+}
+
+func TestVaultFS(t *testing.T) {
+	v := newFS(newFake(), "secret")
+	require.NoError(t, fstest.TestFS(v, "app/db/user", "app/db/password", "app/db/tls/cert", "app/api/scopes", "global/domain"))
+
+	b, err := fs.ReadFile(v, "app/db/password")
+	require.NoError(t, err)
+	assert.Equal(t, "s3cr3t", string(b))
+	b, err = fs.ReadFile(v, "app/api/scopes")
+	require.NoError(t, err)
+	assert.JSONEq(t, `["read","write"]`, string(b))
+
+	es, err := fs.ReadDir(v, "app/db")
+	require.NoError(t, err)
+	var names []string
+	for _, e := range es {
+		names = append(names, e.Name())
+	}
+	assert.Equal(t, []string{"password", "tls", "user"}, names)
+
+	i, err := fs.Stat(v, "global/domain")
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0444), i.Mode())
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC), i.ModTime())
+
+	_, err = fs.Stat(v, "app/missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = fs.Stat(v, "app/db/missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestVaultFSCache(t *testing.T) {
+	f := newFake()
+	v := newFS(f, "secret", WithCacheTTL(time.Minute))
+	now := time.Unix(0, 0)
+	v.now = func() time.Time { return now }
+
+	_, err := fs.ReadFile(v, "global/domain")
+	require.NoError(t, err)
+	reads := f.reads
+	_, err = fs.ReadFile(v, "global/domain")
+	require.NoError(t, err)
+	assert.Equal(t, reads, f.reads)
+
+	f.secrets["global"]["domain"] = "example.org"
+	now = now.Add(2 * time.Minute)
+	b, err := fs.ReadFile(v, "global/domain")
+	require.NoError(t, err)
+	assert.Equal(t, "example.org", string(b))
+	assert.Greater(t, f.reads, reads)
+}
+
+func TestVaultFSRenew(t *testing.T) {
+	f := newFake()
+	f.lease = 10
+	v := newFS(f, "secret")
+	now := time.Unix(0, 0)
+	v.now = func() time.Time { return now }
+
+	_, err := fs.ReadFile(v, "global/domain")
+	require.NoError(t, err)
+	reads := f.reads
+	now = now.Add(6 * time.Second)
+	_, err = v.secret("global")
+	require.NoError(t, err)
+	assert.Equal(t, 1, f.renews)
+	assert.Equal(t, reads, f.reads)
+}
+
+func TestVaultFSMount(t *testing.T) {
+	m, err := mfs.Mount("/secrets", newFS(newFake(), "secret"))
+	require.NoError(t, err)
+	b, err := fs.ReadFile(m, "/secrets/app/db/user")
+	require.NoError(t, err)
+	assert.Equal(t, "admin", string(b))
+}
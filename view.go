@@ -0,0 +1,78 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"io/fs"
+	"sync/atomic"
+)
+
+// MountFilter reports whether the mount described by mnt is exposed by a
+// view to the operations run with ctx, see MFS.View.
+type MountFilter func(ctx context.Context, mnt MountInfo) bool
+
+// view restricts the mounts exposed by an MFS.
+type view struct {
+	filter MountFilter
+	// cached is the last filtered table, recomputed when the mount table
+	// changes
+	cached atomic.Pointer[viewTable]
+}
+
+type viewTable struct {
+	src, t *table
+}
+
+func (m *mfs) View(filter MountFilter) MFS {
+	if m.view != nil {
+		parent := m.view.filter
+		f := filter
+		filter = func(ctx context.Context, mnt MountInfo) bool {
+			return parent(ctx, mnt) && f(ctx, mnt)
+		}
+	}
+	return &mfs{state: m.state, ctx: m.ctx, view: &view{filter: filter}}
+}
+
+// filter returns t restricted to the mounts exposed by the view.
+func (m *mfs) filter(t *table) *table {
+	if c := m.view.cached.Load(); c != nil && c.src == t {
+		return c.t
+	}
+	ctx := m.context()
+	res := &table{mounts: make(map[string]*mount, len(t.mounts)), modTime: t.modTime}
+	for k, v := range t.mounts {
+		if m.view.filter(ctx, v.info()) {
+			res.mounts[k] = v
+		}
+	}
+	m.view.cached.Store(&viewTable{src: t, t: res})
+	return res
+}
+
+// visible reports whether the mount described by i is exposed by the view
+// if m is one.
+func (m *mfs) visible(i MountInfo) bool {
+	return m.view == nil || m.view.filter(m.context(), i)
+}
+
+// checkView fails the changes of the mount table attempted from a view.
+func (m *mfs) checkView(op, path string) error {
+	if m.view != nil {
+		return &fs.PathError{Op: op, Path: path, Err: fs.ErrPermission}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestView(t *testing.T) {
+	m, err := Mount("shared", fstest.MapFS{"foo": {Data: data["foo"]}})
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("tenant-a", fstest.MapFS{"foo": {Data: data["baz"]}}))
+	require.NoError(t, m.Mount("tenant-b", fstest.MapFS{"foo": {Data: data["quux"]}}))
+
+	tenants := m.View(func(ctx context.Context, mnt MountInfo) bool {
+		id := IdentityFromContext(ctx)
+		return mnt.Path == "shared" || id != "" && mnt.Path == "tenant-"+id
+	})
+	a := tenants.WithContext(ContextWithIdentity(context.Background(), "a"))
+
+	b, err := fs.ReadFile(a, "tenant-a/foo")
+	require.NoError(t, err)
+	assert.Equal(t, data["baz"], b)
+	b, err = fs.ReadFile(a, "shared/foo")
+	require.NoError(t, err)
+	assert.Equal(t, data["foo"], b)
+	_, err = fs.ReadFile(a, "tenant-b/foo")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = fs.Stat(a, "tenant-b")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = fs.Stat(m, "tenant-b")
+	require.NoError(t, err)
+
+	var paths []string
+	for _, v := range a.Mounts() {
+		paths = append(paths, v.Path)
+	}
+	assert.Equal(t, []string{"shared", "tenant-a"}, paths)
+	ds, err := a.ReadDir(".")
+	require.NoError(t, err)
+	var names []string
+	for _, v := range ds {
+		names = append(names, v.Name())
+	}
+	assert.Equal(t, []string{"shared", "tenant-a"}, names)
+
+	// without identity only the shared mount is exposed
+	ds, err = tenants.ReadDir(".")
+	require.NoError(t, err)
+	require.Len(t, ds, 1)
+	assert.Equal(t, "shared", ds[0].Name())
+
+	// the views of a view are restricted by both filters
+	v := a.View(func(_ context.Context, mnt MountInfo) bool {
+		return strings.HasPrefix(mnt.Path, "tenant-")
+	})
+	paths = nil
+	for _, v := range v.Mounts() {
+		paths = append(paths, v.Path)
+	}
+	assert.Equal(t, []string{"tenant-a"}, paths)
+
+	assert.ErrorIs(t, a.Mount("tenant-c", fstest.MapFS{}), fs.ErrPermission)
+	assert.ErrorIs(t, a.Unmount("tenant-b"), fs.ErrPermission)
+	assert.ErrorIs(t, a.Alias("tenant-a", "other"), fs.ErrPermission)
+	assert.Len(t, m.Mounts(), 3)
+
+	// the views follow the changes of the mount table
+	require.NoError(t, m.Unmount("shared"))
+	_, err = fs.ReadFile(a, "shared/foo")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestViewEvents(t *testing.T) {
+	m, err := Mount("tenant-a", fstest.MapFS{})
+	require.NoError(t, err)
+	a := m.View(func(ctx context.Context, mnt MountInfo) bool {
+		return strings.HasPrefix(mnt.Path, "tenant-a")
+	})
+
+	var mounted, unmounted []string
+	a.OnMount(func(i MountInfo) { mounted = append(mounted, i.Path) })
+	a.OnUnmount(func(i MountInfo) { unmounted = append(unmounted, i.Path) })
+	evs, unsubscribe := a.SubscribeMounts()
+	defer unsubscribe()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := a.Watch(ctx, ".")
+	require.NoError(t, err)
+
+	require.NoError(t, m.Mount("tenant-b", fstest.MapFS{}))
+	require.NoError(t, m.Unmount("tenant-b"))
+	require.NoError(t, m.Mount("tenant-a2", fstest.MapFS{}))
+	require.NoError(t, m.Unmount("tenant-a2"))
+	assert.Equal(t, []string{"tenant-a2"}, mounted)
+	assert.Equal(t, []string{"tenant-a2"}, unmounted)
+	ev := <-evs
+	assert.Equal(t, Mounted, ev.Kind)
+	assert.Equal(t, "tenant-a2", ev.Path)
+	ev = <-evs
+	assert.Equal(t, Unmounted, ev.Kind)
+	assert.Equal(t, "tenant-a2", ev.Path)
+	assert.Equal(t, WatchEvent{Path: "tenant-a2"}, <-ch)
+	assert.Equal(t, WatchEvent{Path: "tenant-a2", Removed: true}, <-ch)
+
+	mem := NewMemFS()
+	require.NoError(t, mem.WriteFile("foo", []byte("foo"), 0644))
+	require.NoError(t, m.Mount("tenant-b", mem, WithCache(time.Hour)))
+	read := func() string {
+		b, err := fs.ReadFile(m, "tenant-b/foo")
+		require.NoError(t, err)
+		return string(b)
+	}
+	assert.Equal(t, "foo", read())
+	require.NoError(t, mem.WriteFile("foo", []byte("bar"), 0644))
+	a.InvalidateCache(".")
+	a.InvalidateCache("tenant-b")
+	assert.Equal(t, "foo", read())
+	m.InvalidateCache("tenant-b")
+	assert.Equal(t, "bar", read())
+}
@@ -0,0 +1,246 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// WalkDirFS is implemented by file systems providing a more efficient walk
+// than fs.WalkDir, e.g. object stores listing a whole prefix at once.
+type WalkDirFS interface {
+	fs.FS
+	WalkDir(root string, fn fs.WalkDirFunc) error
+}
+
+// WalkDir is like fs.WalkDir but delegates to fsys when it implements
+// WalkDirFS.
+func WalkDir(fsys fs.FS, root string, fn fs.WalkDirFunc) error {
+	if w, ok := fsys.(WalkDirFS); ok {
+		return w.WalkDir(root, fn)
+	}
+	return fs.WalkDir(fsys, root, fn)
+}
+
+var _ WalkDirFS = (*mfs)(nil)
+
+func (m *mfs) WalkDir(root string, fn fs.WalkDirFunc) error {
+	t := m.load()
+	mounts := make(map[string]*mount, len(t.mounts))
+	for k, v := range t.mounts {
+		if !m.hidden(v) {
+			mounts[k] = v
+		}
+	}
+	name, err := m.clean("lstat", root)
+	if err != nil {
+		if err := fn(root, nil, err); err != fs.SkipDir && err != fs.SkipAll {
+			return err
+		}
+		return nil
+	}
+	mnt, rel, err := m.lookup(t, "lstat", name)
+
+	w := &walker{m: m, t: t, mounts: mounts, fn: fn, visited: make(map[string]struct{}), skipped: make(map[string]struct{})}
+	if (name == "." || name == "/") && mounts["."] != nil {
+		return w.walk(mounts["."], ".")
+	}
+	if name == "." || name == "/" || errors.Is(err, fs.ErrNotExist) && m.hasMounts(t, name) {
+		if err := fn(root, m.virtualDir(t, name), nil); err != nil {
+			if err == fs.SkipDir || err == fs.SkipAll {
+				return nil
+			}
+			return err
+		}
+		if name == "/" {
+			name = "."
+		}
+		return w.walkNested(nil, name)
+	}
+	if err != nil {
+		err := fn(root, nil, err)
+		if err == fs.SkipDir || err == fs.SkipAll {
+			return nil
+		}
+		return err
+	}
+	return w.walk(mnt, rel)
+}
+
+type walker struct {
+	m      *mfs
+	t      *table
+	mounts map[string]*mount
+	fn     fs.WalkDirFunc
+	// visited are the mount points and the virtual directories walked
+	visited map[string]struct{}
+	// skipped are the directories fn returned fs.SkipDir for
+	skipped map[string]struct{}
+	stop    bool
+}
+
+// under returns the sorted mount points under dir which are not nested in
+// another mount under dir: those are reached by walking their parent.
+func (w *walker) under(dir string) []string {
+	in := func(k string) bool {
+		return k != "." && k != dir && (dir == "." || strings.HasPrefix(k, dir+"/"))
+	}
+	var res []string
+	for k := range w.mounts {
+		if !in(k) {
+			continue
+		}
+		nested := false
+		for p := range w.mounts {
+			if p != k && in(p) && strings.HasPrefix(k, p+"/") {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			res = append(res, k)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// walkNested walks the mount points under dir, the mount point of mnt if
+// not nil, which were not reached by walking mnt as their parent
+// directories do not exist in its file system: the missing directories are
+// walked as virtual ones, see virtualDir.
+func (w *walker) walkNested(mnt *mount, dir string) error {
+	for _, k := range w.under(dir) {
+		if _, ok := w.visited[k]; ok {
+			continue
+		}
+		skip, err := w.walkParents(mnt, dir, k)
+		if err != nil || w.stop {
+			return err
+		}
+		if skip {
+			continue
+		}
+		if err := w.walk(w.mounts[k], "."); err != nil || w.stop {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkParents walks the directories between dir and the mount point k
+// missing from the file system of mnt, reporting whether k is skipped.
+func (w *walker) walkParents(mnt *mount, dir, k string) (bool, error) {
+	if _, ok := w.skipped[dir]; ok {
+		return true, nil
+	}
+	i := len(dir) + 1
+	if dir == "." {
+		i = 0
+	}
+	for ; i < len(k); i++ {
+		if k[i] != '/' {
+			continue
+		}
+		p := k[:i]
+		if _, ok := w.skipped[p]; ok {
+			return true, nil
+		}
+		if _, ok := w.visited[p]; ok {
+			continue
+		}
+		if mnt != nil {
+			if rel, ok := match(mnt.path, p); ok {
+				if _, err := fs.Stat(mnt.fs, rel); err == nil {
+					continue
+				}
+			}
+		}
+		w.visited[p] = struct{}{}
+		switch err := w.fn(p, w.m.virtualDir(w.t, p), nil); err {
+		case nil:
+		case fs.SkipDir:
+			w.skipped[p] = struct{}{}
+			return true, nil
+		case fs.SkipAll:
+			w.stop = true
+			return true, nil
+		default:
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+func (w *walker) walk(mnt *mount, rel string) error {
+	w.visited[mnt.path] = struct{}{}
+	start := joinMountPath(mnt.path, rel)
+	if err := w.m.healthErr(mnt, "lstat", start, rel); err != nil {
+		err = w.fn(start, nil, err)
+		if err == fs.SkipAll {
+			w.stop = true
+		}
+		if err == fs.SkipDir || err == fs.SkipAll {
+			return nil
+		}
+		return err
+	}
+	err := WalkDir(mnt.fs, rel, func(p string, d fs.DirEntry, err error) error {
+		if w.stop {
+			return fs.SkipAll
+		}
+		full := joinMountPath(mnt.path, p)
+		if nested, ok := w.mounts[full]; ok && full != start {
+			if err := w.walk(nested, "."); err != nil {
+				return err
+			}
+			if w.stop {
+				return fs.SkipAll
+			}
+			return fs.SkipDir
+		}
+		if d != nil {
+			d = &dirEntry{DirEntry: d, path: full, opts: mnt.opts}
+		}
+		if err != nil {
+			err = mnt.wrapErr("readdir", full, p, err)
+		}
+		err = w.fn(full, d, err)
+		switch {
+		case err == fs.SkipAll:
+			w.stop = true
+		case err == fs.SkipDir && d != nil && d.IsDir():
+			w.skipped[full] = struct{}{}
+		}
+		return err
+	})
+	if err != nil || w.stop {
+		return err
+	}
+	return w.walkNested(mnt, start)
+}
+
+func joinMountPath(mnt, rel string) string {
+	if rel == "." {
+		return mnt
+	}
+	if mnt == "." {
+		return rel
+	}
+	return mnt + "/" + rel
+}
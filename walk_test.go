@@ -0,0 +1,78 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type walkCounter struct {
+	fstest.MapFS
+	walks int
+}
+
+func (w *walkCounter) WalkDir(root string, fn fs.WalkDirFunc) error {
+	w.walks++
+	return fs.WalkDir(w.MapFS, root, fn)
+}
+
+func TestWalkDir(t *testing.T) {
+	a := &walkCounter{MapFS: fstest.MapFS{"x/foo": {Data: data["foo"]}, "bar": {Data: data["baz"]}}}
+	b := fstest.MapFS{"baz": {Data: data["baz"]}}
+	m, err := Mount("a", a)
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("b", b))
+	require.NoError(t, m.Mount("a/x/nested", b))
+
+	var got []string
+	require.NoError(t, WalkDir(m, ".", func(p string, d fs.DirEntry, err error) error {
+		require.NoError(t, err)
+		got = append(got, p)
+		return nil
+	}))
+	assert.Equal(t, []string{".", "a", "a/bar", "a/x", "a/x/foo", "a/x/nested", "a/x/nested/baz", "b", "b/baz"}, got)
+	assert.Equal(t, 1, a.walks)
+
+	got = nil
+	require.NoError(t, m.WalkDir("a/x", func(p string, d fs.DirEntry, err error) error {
+		got = append(got, p)
+		return nil
+	}))
+	assert.Equal(t, []string{"a/x", "a/x/foo", "a/x/nested", "a/x/nested/baz"}, got)
+
+	a.MapFS["x/nested"] = &fstest.MapFile{Mode: fs.ModeDir}
+	got = nil
+	require.NoError(t, m.WalkDir("a", func(p string, d fs.DirEntry, err error) error {
+		got = append(got, p)
+		if p == "a/x/nested/baz" {
+			return fs.SkipAll
+		}
+		return nil
+	}))
+	assert.Equal(t, []string{"a", "a/bar", "a/x", "a/x/foo", "a/x/nested", "a/x/nested/baz"}, got)
+
+	got = nil
+	require.NoError(t, m.WalkDir("nope", func(p string, d fs.DirEntry, err error) error {
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+		got = append(got, p)
+		return nil
+	}))
+	assert.Equal(t, []string{"nope"}, got)
+}
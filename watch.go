@@ -0,0 +1,264 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+)
+
+var _ WatchFS = (*mfs)(nil)
+
+// Watch notifies the changes of the files under name, relative to the MFS,
+// reported by the file system it is mounted from when it implements
+// WatchFS, directly or behind the wrappers of the mount options, failing
+// with errors.ErrUnsupported otherwise. The mount table changes affecting
+// name are notified as changes of the mount point, or of name when the
+// mount holds it, the watch then following the new file system. The
+// directories which do not exist in a mounted file system, e.g. the root
+// of an MFS without root mount, only notify the mount table changes.
+func (m *mfs) Watch(ctx context.Context, name string) (<-chan WatchEvent, error) {
+	name, err := m.clean("watch", name)
+	if err != nil {
+		return nil, err
+	}
+	if name == "/" {
+		name = "."
+	}
+	evs, unsubscribe := m.SubscribeMounts()
+	wctx, stop := context.WithCancel(ctx)
+	in, rel, err := m.watchMount(wctx, name)
+	if err != nil && (!errors.Is(err, fs.ErrNotExist) || name != "." && !m.hasMounts(m.load(), name)) {
+		stop()
+		unsubscribe()
+		return nil, err
+	}
+	out := make(chan WatchEvent)
+	go func() {
+		defer close(out)
+		defer unsubscribe()
+		defer func() { stop() }()
+		for {
+			var e WatchEvent
+			select {
+			case v, ok := <-in:
+				if !ok {
+					in = nil
+					continue
+				}
+				e = WatchEvent{Path: rebase(v.Path, rel, name), Removed: v.Removed}
+			case v, ok := <-evs:
+				if !ok {
+					return
+				}
+				if !duRelated(v.Path, name) {
+					continue
+				}
+				e = WatchEvent{Path: v.Path, Removed: v.Kind == Unmounted}
+				if _, ok := match(v.Path, name); ok {
+					// the mount holding name changed
+					e.Path = name
+					stop()
+					wctx, stop = context.WithCancel(ctx)
+					in, rel, _ = m.watchMount(wctx, name)
+				}
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case out <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// watchMount watches name in the file system it is mounted from, returning
+// the path of name in it.
+func (m *mfs) watchMount(ctx context.Context, name string) (<-chan WatchEvent, string, error) {
+	mnt, rel, err := m.lookup(m.load(), "watch", name)
+	if err != nil {
+		return nil, "", err
+	}
+	w, ok := watcher(mnt.fs)
+	if !ok {
+		return nil, "", unsupported("watch", name)
+	}
+	// the wrappers of the mount map the events to its names
+	in, err := w.Watch(ctx, rel)
+	if err != nil {
+		return nil, "", mnt.wrapErr("watch", name, rel, err)
+	}
+	return in, rel, nil
+}
+
+// rebase returns the path p under rel rebased under name.
+func rebase(p, rel, name string) string {
+	switch {
+	case rel == ".":
+		return joinMountPath(name, p)
+	case p == rel:
+		return name
+	default:
+		return joinMountPath(name, strings.TrimPrefix(p, rel+"/"))
+	}
+}
+
+// watcher returns fsys when it notifies its changes. The wrappers implement
+// WatchFS, mapping the events to their names, but only notify the changes
+// when the file systems they wrap do.
+func watcher(fsys fs.FS) (WatchFS, bool) {
+	w, ok := fsys.(WatchFS)
+	if !ok {
+		return nil, false
+	}
+	if c, ok := fsys.(interface{ canWatch() bool }); ok && !c.canWatch() {
+		return nil, false
+	}
+	return w, true
+}
+
+// mapEvents sends the events of in mapped by fn to the returned channel,
+// which is closed with in or once ctx is done.
+func mapEvents(ctx context.Context, in <-chan WatchEvent, fn func(WatchEvent) []WatchEvent) <-chan WatchEvent {
+	out := make(chan WatchEvent)
+	go func() {
+		defer close(out)
+		for e := range in {
+			for _, v := range fn(e) {
+				select {
+				case out <- v:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// Poll returns a file system notifying the changes of the files of fsys,
+// found by walking the watched tree every interval and comparing the sizes,
+// modes and modification times of its files. It is meant for the file
+// systems unable to notify their changes, e.g. a local directory served
+// during development. The write operations are not forwarded.
+func Poll(fsys fs.FS, interval time.Duration) WatchFS {
+	return &pollFS{fsys: fsys, interval: interval}
+}
+
+type pollFS struct {
+	fsys     fs.FS
+	interval time.Duration
+}
+
+type pollState struct {
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// Unwrap returns the wrapped file system, see As.
+func (p *pollFS) Unwrap() fs.FS {
+	return p.fsys
+}
+
+func (p *pollFS) Open(name string) (fs.File, error) {
+	return p.fsys.Open(name)
+}
+
+func (p *pollFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(p.fsys, name)
+}
+
+func (p *pollFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(p.fsys, name)
+}
+
+func (p *pollFS) Watch(ctx context.Context, name string) (<-chan WatchEvent, error) {
+	prev, err := p.snapshot(name)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan WatchEvent)
+	go func() {
+		defer close(ch)
+		t := time.NewTicker(p.interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+			cur, err := p.snapshot(name)
+			if err != nil {
+				continue
+			}
+			for _, e := range pollEvents(prev, cur) {
+				select {
+				case ch <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+			prev = cur
+		}
+	}()
+	return ch, nil
+}
+
+// snapshot returns the state of the entries of the tree rooted at name,
+// skipping the ones failing to be read.
+func (p *pollFS) snapshot(name string) (map[string]pollState, error) {
+	if _, err := fs.Stat(p.fsys, name); err != nil {
+		return nil, err
+	}
+	res := make(map[string]pollState)
+	err := fs.WalkDir(p.fsys, name, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		i, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		res[path] = pollState{size: i.Size(), mode: i.Mode(), modTime: i.ModTime()}
+		return nil
+	})
+	return res, err
+}
+
+// pollEvents returns the changes between two snapshots sorted by path.
+func pollEvents(prev, cur map[string]pollState) []WatchEvent {
+	var res []WatchEvent
+	for k, v := range cur {
+		if o, ok := prev[k]; !ok || o.size != v.size || o.mode != v.mode || !o.modTime.Equal(v.modTime) {
+			res = append(res, WatchEvent{Path: k})
+		}
+	}
+	for k := range prev {
+		if _, ok := cur[k]; !ok {
+			res = append(res, WatchEvent{Path: k, Removed: true})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Path < res[j].Path })
+	return res
+}
@@ -0,0 +1,177 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/unicode/norm"
+)
+
+// nextEvent returns the first event of ch for path, failing after a second.
+func nextEvent(t *testing.T, ch <-chan WatchEvent, path string) WatchEvent {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case e, ok := <-ch:
+			require.True(t, ok, "channel closed")
+			if e.Path == path {
+				return e
+			}
+		case <-timeout:
+			require.FailNow(t, "no event for "+path)
+		}
+	}
+}
+
+func TestPoll(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0755))
+	p := Poll(DirFS(dir), 10*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := p.Watch(ctx, ".")
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "foo"), data["foo"], 0644))
+	assert.Equal(t, WatchEvent{Path: "sub/foo"}, nextEvent(t, ch, "sub/foo"))
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "sub", "foo"), time.Now(), time.Now().Add(time.Hour)))
+	assert.Equal(t, WatchEvent{Path: "sub/foo"}, nextEvent(t, ch, "sub/foo"))
+	require.NoError(t, os.Remove(filepath.Join(dir, "sub", "foo")))
+	assert.Equal(t, WatchEvent{Path: "sub/foo", Removed: true}, nextEvent(t, ch, "sub/foo"))
+
+	_, err = p.Watch(ctx, "missing")
+	assert.Error(t, err)
+	cancel()
+	for range ch {
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0755))
+	m, err := Mount("web", Poll(DirFS(dir), 10*time.Millisecond), WithTimeout(time.Second))
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("mem", NewMemFS()))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := m.Watch(ctx, "web")
+	require.NoError(t, err)
+	sub, err := m.Watch(ctx, "web/sub")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "foo"), data["foo"], 0644))
+	nextEvent(t, ch, "web/sub/foo")
+	nextEvent(t, sub, "web/sub/foo")
+
+	_, err = m.Watch(ctx, "mem")
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+	assert.Equal(t, "a/b", rebase("dir/b", "dir", "a"))
+	assert.Equal(t, "a", rebase("dir", "dir", "a"))
+	assert.Equal(t, "b", rebase("b", ".", "."))
+}
+
+// watchWrapped returns the events notified by wrap(w) on name when w, backed
+// by mem, notifies evs.
+func watchWrapped(t *testing.T, mem *MemFS, wrap func(fs.FS) fs.FS, name string, evs ...WatchEvent) []WatchEvent {
+	t.Helper()
+	w := &watchMemFS{MemFS: mem, events: make(chan WatchEvent), done: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wfs, ok := watcher(wrap(w))
+	require.True(t, ok)
+	ch, err := wfs.Watch(ctx, name)
+	require.NoError(t, err)
+	go func() {
+		for _, e := range evs {
+			w.events <- e
+		}
+	}()
+	var res []WatchEvent
+	for {
+		select {
+		case e := <-ch:
+			res = append(res, e)
+		case <-time.After(100 * time.Millisecond):
+			return res
+		}
+	}
+}
+
+func TestWatchWrapped(t *testing.T) {
+	mem := NewMemFS()
+	require.NoError(t, mem.MkdirAll("dir", 0755))
+	require.NoError(t, mem.WriteFile("dir/foo", nil, 0644))
+	require.NoError(t, mem.WriteFile("bar.gz", nil, 0644))
+	require.NoError(t, mem.WriteFile(".wh.baz", nil, 0644))
+
+	assert.Equal(t, []WatchEvent{{Path: "foo"}}, watchWrapped(t, mem, func(fsys fs.FS) fs.FS {
+		return newSubFS(fsys, "dir")
+	}, ".", WatchEvent{Path: "dir/foo"}))
+	assert.Equal(t, []WatchEvent{{Path: "foo"}}, watchWrapped(t, mem, func(fsys fs.FS) fs.FS {
+		return GlobFilter(fsys, nil, []string{".*"})
+	}, ".", WatchEvent{Path: ".git/config"}, WatchEvent{Path: "foo"}))
+	assert.Equal(t, []WatchEvent{{Path: "bar.gz"}, {Path: "bar"}}, watchWrapped(t, mem, Decompress, ".", WatchEvent{Path: "bar.gz"}))
+	assert.Equal(t, []WatchEvent{{Path: "caf\u00e9"}}, watchWrapped(t, mem, func(fsys fs.FS) fs.FS {
+		return Normalize(fsys, norm.NFC)
+	}, ".", WatchEvent{Path: "cafe\u0301"}))
+	assert.Equal(t, []WatchEvent{{Path: "foo"}}, watchWrapped(t, mem, func(fsys fs.FS) fs.FS {
+		return newTrashFS(fsys, fsys, 0)
+	}, ".", WatchEvent{Path: TrashDir + "/1/foo"}, WatchEvent{Path: "foo"}))
+	assert.Equal(t, []WatchEvent{{Path: "baz", Removed: true}, {Path: "dir/foo", Removed: false}}, watchWrapped(t, mem, func(fsys fs.FS) fs.FS {
+		return Overlay(fsys, NewMemFS())
+	}, ".", WatchEvent{Path: ".wh.baz"}, WatchEvent{Path: "dir/foo", Removed: true}))
+	assert.Equal(t, []WatchEvent{{Path: "dir/foo"}}, watchWrapped(t, mem, func(fsys fs.FS) fs.FS {
+		return Timeout(GlobFilter(fsys, nil, []string{"*.gz"}), time.Second)
+	}, ".", WatchEvent{Path: "bar.gz"}, WatchEvent{Path: "dir/foo"}))
+
+	// the wrappers only watch when the wrapped file system does
+	_, ok := watcher(GlobFilter(mem, nil, nil))
+	assert.False(t, ok)
+}
+
+func TestWatchHidden(t *testing.T) {
+	dir := t.TempDir()
+	m, err := Mount("web", Poll(DirFS(dir), 10*time.Millisecond), WithHideDotfiles())
+	require.NoError(t, err)
+	assert.True(t, m.Capabilities("web").Has(CapWatch))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := m.Watch(ctx, "web")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".env"), nil, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "foo"), nil, 0644))
+	// the events of a poll are sorted: the one of .env would come first
+	var paths []string
+	timeout := time.After(time.Second)
+	for len(paths) == 0 || paths[len(paths)-1] != "web/foo" {
+		select {
+		case e := <-ch:
+			paths = append(paths, e.Path)
+		case <-timeout:
+			require.FailNow(t, "no event for web/foo")
+		}
+	}
+	assert.NotContains(t, paths, "web/.env")
+}
@@ -0,0 +1,329 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// The interfaces below are the operations an MFS forwards to the mounted
+// file systems, the backends implementing them to be fully usable under an
+// MFS. Their names are relative to the file system, as for fs.FS.
+
+// OpenFileFS is implemented by file systems able to open files for writing.
+// Files opened with a write flag implement io.Writer.
+type OpenFileFS interface {
+	fs.FS
+	OpenFile(name string, flag int, perm fs.FileMode) (fs.File, error)
+}
+
+// WriteFileFS is implemented by file systems able to write whole files.
+type WriteFileFS interface {
+	fs.FS
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+}
+
+// MkdirAllFS is implemented by file systems able to create directories.
+type MkdirAllFS interface {
+	fs.FS
+	MkdirAll(path string, perm fs.FileMode) error
+}
+
+// RemoveFS is implemented by file systems able to remove a file or an empty
+// directory.
+type RemoveFS interface {
+	fs.FS
+	Remove(name string) error
+}
+
+// RemoveAllFS is implemented by file systems able to remove a whole tree.
+type RemoveAllFS interface {
+	fs.FS
+	RemoveAll(path string) error
+}
+
+// RenameFS is implemented by file systems able to rename a file or a
+// directory within themselves.
+type RenameFS interface {
+	fs.FS
+	Rename(oldname, newname string) error
+}
+
+// ChtimesFS is implemented by file systems able to change the access and
+// modification times of a file.
+type ChtimesFS interface {
+	fs.FS
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+// ChmodFS is implemented by file systems able to change the permission bits
+// of a file.
+type ChmodFS interface {
+	fs.FS
+	Chmod(name string, mode fs.FileMode) error
+}
+
+// As returns fsys as a T, e.g. As[RenameFS](fsys), reporting whether it
+// implements it. The wrappers forwarding an operation whether the file
+// system they wrap supports it or not, failing with errors.ErrUnsupported
+// otherwise, implement Unwrap() fs.FS returning it: As then reports whether
+// the whole chain implements T. The wrappers of this package, e.g. Timeout,
+// do so.
+func As[T fs.FS](fsys fs.FS) (T, bool) {
+	v, ok := fsys.(T)
+	if !ok {
+		return v, false
+	}
+	for {
+		u, ok := fsys.(interface{ Unwrap() fs.FS })
+		if !ok {
+			return v, true
+		}
+		if fsys = u.Unwrap(); fsys == nil {
+			return v, true
+		}
+		if _, ok := fsys.(T); !ok {
+			var zero T
+			return zero, false
+		}
+	}
+}
+
+// WritableMFS is the set of write operations an MFS forwards to the mounted
+// file systems. Operations on a mount whose file system does not implement
+// them fail with errors.ErrUnsupported.
+type WritableMFS interface {
+	OpenFileFS
+	WriteFileFS
+	MkdirAllFS
+	RemoveFS
+	RemoveAllFS
+	// Rename renames within a mount, across mounts when the MFS was
+	// created with WithCrossMountRename.
+	RenameFS
+	ChtimesFS
+	ChmodFS
+}
+
+// writeTarget resolves name to the mount receiving the writes and the path
+// relative to it.
+func (m *mfs) writeTarget(op, name string) (*mount, string, error) {
+	return m.lookupPath(op, name)
+}
+
+func unsupported(op, name string) error {
+	return &fs.PathError{Op: op, Path: name, Err: errors.ErrUnsupported}
+}
+
+func (m *mfs) OpenFile(name string, flag int, perm fs.FileMode) (_ fs.File, err error) {
+	defer m.record("openfile", name, time.Now(), &err)
+	if writeFlag(flag) {
+		defer m.invalidate(name)
+	}
+	mnt, rel, err := m.writeTarget("open", name)
+	if err != nil {
+		return nil, err
+	}
+	w, ok := mnt.writable.(OpenFileFS)
+	if !ok {
+		return nil, unsupported("open", name)
+	}
+	var f fs.File
+	err = m.labeled(mnt, "openfile", func() (err error) {
+		f, err = w.OpenFile(rel, flag, perm)
+		return err
+	})
+	if err != nil {
+		return nil, mnt.wrapErr("open", name, rel, err)
+	}
+	if writeFlag(flag) {
+		return onClose(f, name, func() { m.invalidate(name) }), nil
+	}
+	return f, nil
+}
+
+func (m *mfs) WriteFile(name string, data []byte, perm fs.FileMode) (err error) {
+	defer m.record("write", name, time.Now(), &err)
+	defer m.invalidate(name)
+	mnt, rel, err := m.writeTarget("write", name)
+	if err != nil {
+		return err
+	}
+	w, ok := mnt.writable.(WriteFileFS)
+	if !ok {
+		return unsupported("write", name)
+	}
+	return mnt.wrapErr("write", name, rel, m.labeled(mnt, "write", func() error {
+		return w.WriteFile(rel, data, perm)
+	}))
+}
+
+func (m *mfs) MkdirAll(path string, perm fs.FileMode) (err error) {
+	defer m.record("mkdir", path, time.Now(), &err)
+	defer m.invalidate(path)
+	mnt, rel, err := m.writeTarget("mkdir", path)
+	if err != nil {
+		return err
+	}
+	w, ok := mnt.writable.(MkdirAllFS)
+	if !ok {
+		return unsupported("mkdir", path)
+	}
+	return mnt.wrapErr("mkdir", path, rel, m.labeled(mnt, "mkdir", func() error {
+		return w.MkdirAll(rel, perm)
+	}))
+}
+
+func (m *mfs) Remove(name string) (err error) {
+	defer m.record("remove", name, time.Now(), &err)
+	defer m.invalidate(name)
+	mnt, rel, err := m.writeTarget("remove", name)
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrPermission}
+	}
+	w, ok := mnt.writable.(RemoveFS)
+	if !ok {
+		return unsupported("remove", name)
+	}
+	return mnt.wrapErr("remove", name, rel, m.labeled(mnt, "remove", func() error {
+		return w.Remove(rel)
+	}))
+}
+
+func (m *mfs) RemoveAll(path string) (err error) {
+	defer m.record("removeall", path, time.Now(), &err)
+	defer m.invalidate(path)
+	mnt, rel, err := m.writeTarget("removeall", path)
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		return &fs.PathError{Op: "removeall", Path: path, Err: fs.ErrPermission}
+	}
+	w, ok := mnt.writable.(RemoveAllFS)
+	if !ok {
+		return unsupported("removeall", path)
+	}
+	return mnt.wrapErr("removeall", path, rel, m.labeled(mnt, "removeall", func() error {
+		return w.RemoveAll(rel)
+	}))
+}
+
+func (m *mfs) Chtimes(name string, atime, mtime time.Time) (err error) {
+	defer m.record("chtimes", name, time.Now(), &err)
+	mnt, rel, err := m.writeTarget("chtimes", name)
+	if err != nil {
+		return err
+	}
+	w, ok := mnt.writable.(ChtimesFS)
+	if !ok {
+		return unsupported("chtimes", name)
+	}
+	return mnt.wrapErr("chtimes", name, rel, m.labeled(mnt, "chtimes", func() error {
+		return w.Chtimes(rel, atime, mtime)
+	}))
+}
+
+func (m *mfs) Chmod(name string, mode fs.FileMode) (err error) {
+	defer m.record("chmod", name, time.Now(), &err)
+	mnt, rel, err := m.writeTarget("chmod", name)
+	if err != nil {
+		return err
+	}
+	w, ok := mnt.writable.(ChmodFS)
+	if !ok {
+		return unsupported("chmod", name)
+	}
+	return mnt.wrapErr("chmod", name, rel, m.labeled(mnt, "chmod", func() error {
+		return w.Chmod(rel, mode)
+	}))
+}
+
+// onClose wraps the file f opened for writing to call done once it is
+// closed, e.g. to invalidate the caches of name which may have been filled
+// with its former content while it was written.
+func onClose(f fs.File, name string, done func()) fs.File {
+	return &writeFile{File: f, name: name, done: done}
+}
+
+// writeFile forwards the write operations of the files returned by
+// OpenFile, failing with errors.ErrUnsupported those the file does not
+// implement.
+type writeFile struct {
+	fs.File
+	name string
+	done func()
+	once sync.Once
+}
+
+func (f *writeFile) Write(b []byte) (int, error) {
+	w, ok := f.File.(io.Writer)
+	if !ok {
+		return 0, unsupported("write", f.name)
+	}
+	return w.Write(b)
+}
+
+func (f *writeFile) WriteAt(b []byte, off int64) (int, error) {
+	w, ok := f.File.(io.WriterAt)
+	if !ok {
+		return 0, unsupported("write", f.name)
+	}
+	return w.WriteAt(b, off)
+}
+
+func (f *writeFile) ReadAt(b []byte, off int64) (int, error) {
+	r, ok := f.File.(io.ReaderAt)
+	if !ok {
+		return 0, unsupported("read", f.name)
+	}
+	return r.ReadAt(b, off)
+}
+
+func (f *writeFile) Seek(offset int64, whence int) (int64, error) {
+	s, ok := f.File.(io.Seeker)
+	if !ok {
+		return 0, unsupported("seek", f.name)
+	}
+	return s.Seek(offset, whence)
+}
+
+func (f *writeFile) Sync() error {
+	if s, ok := f.File.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+func (f *writeFile) Truncate(size int64) error {
+	t, ok := f.File.(interface{ Truncate(int64) error })
+	if !ok {
+		return unsupported("truncate", f.name)
+	}
+	return t.Truncate(size)
+}
+
+func (f *writeFile) Close() error {
+	err := f.File.Close()
+	f.once.Do(f.done)
+	return err
+}
@@ -0,0 +1,71 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAs(t *testing.T) {
+	mem := NewMemFS()
+	r, ok := As[RenameFS](mem)
+	require.True(t, ok)
+	assert.Same(t, mem, r)
+	_, ok = As[ChtimesFS](fstest.MapFS{})
+	assert.False(t, ok)
+
+	// the wrappers forward the writes whatever the wrapped file system
+	_, ok = Timeout(fstest.MapFS{}, time.Second).(WriteFileFS)
+	require.True(t, ok)
+	_, ok = As[WriteFileFS](Timeout(fstest.MapFS{}, time.Second))
+	assert.False(t, ok)
+	w, ok := As[WriteFileFS](Confine(Timeout(mem, time.Second)))
+	require.True(t, ok)
+	require.NoError(t, w.WriteFile("foo", []byte("foo"), 0644))
+	_, err := mem.Stat("foo")
+	assert.NoError(t, err)
+}
+
+func TestChtimesChmod(t *testing.T) {
+	m, err := Mount("mem", NewMemFS())
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("static", fstest.MapFS{"foo": {}}))
+	require.NoError(t, m.WriteFile("mem/foo", []byte("foo"), 0644))
+
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, m.Chtimes("mem/foo", mtime, mtime))
+	require.NoError(t, m.Chmod("mem/foo", 0600))
+	s, err := fs.Stat(m, "mem/foo")
+	require.NoError(t, err)
+	assert.True(t, s.ModTime().Equal(mtime))
+	assert.Equal(t, fs.FileMode(0600), s.Mode())
+
+	assert.ErrorIs(t, m.Chtimes("static/foo", mtime, mtime), errors.ErrUnsupported)
+	assert.ErrorIs(t, m.Chmod("static/foo", 0600), errors.ErrUnsupported)
+	assert.ErrorIs(t, m.Chmod("mem/missing", 0600), fs.ErrNotExist)
+
+	// Copy preserves the modification times through the MFS
+	require.NoError(t, Copy(m, "mem/foo", "mem/bar"))
+	s, err = fs.Stat(m, "mem/bar")
+	require.NoError(t, err)
+	assert.True(t, s.ModTime().Equal(mtime))
+}
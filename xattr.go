@@ -0,0 +1,121 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"time"
+)
+
+const (
+	// XattrMount is the extended attribute of the mount-point directories
+	// holding their mount path.
+	XattrMount = "user.mfs.mount"
+	// XattrMountType is the extended attribute of the mount-point
+	// directories holding the Go type of the mounted file system.
+	XattrMountType = "user.mfs.mount.type"
+)
+
+// ErrNoXattr is returned when reading an extended attribute which is not
+// set.
+var ErrNoXattr = errors.New("no such attribute")
+
+// XattrFS is implemented by file systems supporting extended attributes.
+// Getxattr fails with ErrNoXattr when the attribute is not set.
+type XattrFS interface {
+	fs.FS
+	Getxattr(name, attr string) ([]byte, error)
+	Setxattr(name, attr string, value []byte) error
+	Listxattr(name string) ([]string, error)
+}
+
+// xattrs returns the attributes synthesized for the mount point of mnt.
+func (mnt *mount) xattrs() map[string][]byte {
+	return map[string][]byte{
+		XattrMount:     []byte(mnt.path),
+		XattrMountType: []byte(fmt.Sprintf("%T", mnt.fs)),
+	}
+}
+
+func (m *mfs) Getxattr(name, attr string) (_ []byte, err error) {
+	defer m.record("getxattr", name, time.Now(), &err)
+	mnt, rel, err := m.lookupPath("getxattr", name)
+	if err != nil {
+		return nil, err
+	}
+	if rel == "." && mnt.path != "." {
+		if v, ok := mnt.xattrs()[attr]; ok {
+			return v, nil
+		}
+	}
+	x, ok := As[XattrFS](mnt.fs)
+	if !ok {
+		// backends without attributes only have unset ones
+		if _, err := fs.Stat(mnt.fs, rel); err != nil {
+			return nil, mnt.wrapErr("getxattr", name, rel, err)
+		}
+		return nil, &fs.PathError{Op: "getxattr", Path: name, Err: ErrNoXattr}
+	}
+	b, err := x.Getxattr(rel, attr)
+	if err != nil {
+		return nil, mnt.wrapErr("getxattr", name, rel, err)
+	}
+	return b, nil
+}
+
+func (m *mfs) Setxattr(name, attr string, value []byte) (err error) {
+	defer m.record("setxattr", name, time.Now(), &err)
+	mnt, rel, err := m.lookupPath("setxattr", name)
+	if err != nil {
+		return err
+	}
+	if rel == "." && mnt.path != "." {
+		if _, ok := mnt.xattrs()[attr]; ok {
+			return &fs.PathError{Op: "setxattr", Path: name, Err: fs.ErrPermission}
+		}
+	}
+	x, ok := As[XattrFS](mnt.fs)
+	if !ok {
+		return unsupported("setxattr", name)
+	}
+	return mnt.wrapErr("setxattr", name, rel, x.Setxattr(rel, attr, value))
+}
+
+func (m *mfs) Listxattr(name string) (_ []string, err error) {
+	defer m.record("listxattr", name, time.Now(), &err)
+	mnt, rel, err := m.lookupPath("listxattr", name)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	if x, ok := As[XattrFS](mnt.fs); ok {
+		res, err = x.Listxattr(rel)
+	} else {
+		_, err = fs.Stat(mnt.fs, rel)
+	}
+	if err != nil {
+		return nil, mnt.wrapErr("listxattr", name, rel, err)
+	}
+	if rel == "." && mnt.path != "." {
+		for k := range mnt.xattrs() {
+			res = append(res, k)
+		}
+		sort.Strings(res)
+	}
+	return res, nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2024 Linka Cloud  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfs
+
+import (
+	"errors"
+	"io/fs"
+	"sort"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type xattrMapFS struct {
+	fstest.MapFS
+	attrs map[string]map[string][]byte
+}
+
+func (x *xattrMapFS) Getxattr(name, attr string) ([]byte, error) {
+	if _, err := fs.Stat(x.MapFS, name); err != nil {
+		return nil, err
+	}
+	v, ok := x.attrs[name][attr]
+	if !ok {
+		return nil, &fs.PathError{Op: "getxattr", Path: name, Err: ErrNoXattr}
+	}
+	return v, nil
+}
+
+func (x *xattrMapFS) Setxattr(name, attr string, value []byte) error {
+	if _, err := fs.Stat(x.MapFS, name); err != nil {
+		return err
+	}
+	if x.attrs[name] == nil {
+		x.attrs[name] = make(map[string][]byte)
+	}
+	x.attrs[name][attr] = value
+	return nil
+}
+
+func (x *xattrMapFS) Listxattr(name string) ([]string, error) {
+	if _, err := fs.Stat(x.MapFS, name); err != nil {
+		return nil, err
+	}
+	var res []string
+	for k := range x.attrs[name] {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func TestXattr(t *testing.T) {
+	x := &xattrMapFS{MapFS: fstest.MapFS{"foo": {Data: data["foo"]}}, attrs: map[string]map[string][]byte{}}
+	inner, err := Mount("x", x)
+	require.NoError(t, err)
+	m, err := Mount("inner", inner)
+	require.NoError(t, err)
+	require.NoError(t, m.Mount("plain", fstest.MapFS{"foo": {Data: data["foo"]}}))
+
+	require.NoError(t, m.Setxattr("inner/x/foo", "user.color", []byte("blue")))
+	b, err := m.Getxattr("inner/x/foo", "user.color")
+	require.NoError(t, err)
+	assert.Equal(t, "blue", string(b))
+	names, err := m.Listxattr("inner/x/foo")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user.color"}, names)
+
+	_, err = m.Getxattr("inner/x/foo", "user.missing")
+	assert.ErrorIs(t, err, ErrNoXattr)
+	var me *MountError
+	require.True(t, errors.As(err, &me))
+	assert.Equal(t, "x", me.MountPoint)
+	_, err = m.Getxattr("inner/x/missing", "user.color")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	b, err = m.Getxattr("plain", XattrMount)
+	require.NoError(t, err)
+	assert.Equal(t, "plain", string(b))
+	b, err = m.Getxattr("plain", XattrMountType)
+	require.NoError(t, err)
+	assert.Equal(t, "fstest.MapFS", string(b))
+	b, err = m.Getxattr("inner/x", XattrMount)
+	require.NoError(t, err)
+	assert.Equal(t, "x", string(b))
+	names, err = m.Listxattr("inner/x")
+	require.NoError(t, err)
+	assert.Equal(t, []string{XattrMount, XattrMountType}, names)
+	assert.ErrorIs(t, m.Setxattr("plain", XattrMount, nil), fs.ErrPermission)
+
+	_, err = m.Getxattr("plain/foo", "user.color")
+	assert.ErrorIs(t, err, ErrNoXattr)
+	names, err = m.Listxattr("plain/foo")
+	require.NoError(t, err)
+	assert.Empty(t, names)
+	_, err = m.Listxattr("plain/missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.ErrorIs(t, m.Setxattr("plain/foo", "user.color", nil), errors.ErrUnsupported)
+}
+
+func TestXattrWrapped(t *testing.T) {
+	x := &xattrMapFS{MapFS: fstest.MapFS{"dir/foo": {Data: data["foo"]}}, attrs: map[string]map[string][]byte{}}
+	m, err := Mount("x", x, WithTimeout(time.Minute), WithCache(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, m.Capabilities("x/dir/foo").Has(CapXattr))
+	require.NoError(t, m.Bind("x/dir", "bound"))
+	assert.True(t, m.Capabilities("bound/foo").Has(CapXattr))
+
+	require.NoError(t, m.Setxattr("bound/foo", "user.color", []byte("blue")))
+	assert.Equal(t, "blue", string(x.attrs["dir/foo"]["user.color"]))
+	b, err := m.Getxattr("x/dir/foo", "user.color")
+	require.NoError(t, err)
+	assert.Equal(t, "blue", string(b))
+	names, err := m.Listxattr("bound/foo")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user.color"}, names)
+	_, err = m.Getxattr("bound/foo", "user.missing")
+	assert.ErrorIs(t, err, ErrNoXattr)
+	_, err = m.Getxattr("bound/missing", "user.color")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}